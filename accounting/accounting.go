@@ -0,0 +1,302 @@
+package accounting
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/portfolio"
+	"trading-aggregator/trading"
+)
+
+// Method decides which lots a disposal is matched against.
+type Method string
+
+const (
+	FIFO Method = "fifo"
+	LIFO Method = "lifo"
+	// HIFO matches the lots with the highest unit cost first.
+	HIFO Method = "hifo"
+)
+
+func (m Method) Validate() error {
+	switch m {
+	case FIFO, LIFO, HIFO:
+		return nil
+	}
+
+	return fmt.Errorf("unknown lot matching method %q", m)
+}
+
+type Config struct {
+	// Method is the default lot matching method.
+	Method Method `yaml:"method" toml:"method"`
+	// Fiat is the currency trades are valued in, e.g. "USD".
+	Fiat string `yaml:"fiat" toml:"fiat"`
+}
+
+func (c Config) Validate() error {
+	var errs []error
+
+	if err := c.Method.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Fiat == "" {
+		errs = append(errs, errors.New("fiat: required"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Valuer prices one unit of asset in fiat at a time, using the venues of
+// account where it can.
+type Valuer func(account, asset, fiat string, at time.Time) (decimal.Decimal, error)
+
+// Trade is a fill with its worth in fiat at the time it filled.
+type Trade struct {
+	portfolio.Fill
+	Worth decimal.Decimal `json:"worth"`
+}
+
+// Disposal is the part of a disposal of an asset matched with one lot. A
+// disposal beyond every lot, of an asset that was not bought through the
+// service, has no cost basis and is Unmatched.
+type Disposal struct {
+	Account   string          `json:"account"`
+	OrderID   string          `json:"order_id"`
+	Asset     string          `json:"asset"`
+	Amount    decimal.Decimal `json:"amount"`
+	Acquired  time.Time       `json:"acquired,omitempty"`
+	Disposed  time.Time       `json:"disposed"`
+	Proceeds  decimal.Decimal `json:"proceeds"`
+	Cost      decimal.Decimal `json:"cost"`
+	Gain      decimal.Decimal `json:"gain"`
+	Unmatched bool            `json:"unmatched,omitempty"`
+}
+
+type Report struct {
+	Fiat      string     `json:"fiat"`
+	Method    Method     `json:"method"`
+	Trades    []Trade    `json:"trades"`
+	Disposals []Disposal `json:"disposals"`
+}
+
+// Between keeps the trades and disposals made in [from, to). Lots acquired
+// before from still make up the cost basis of the disposals.
+func (r Report) Between(from, to time.Time) Report {
+	in := func(t time.Time) bool {
+		return !t.Before(from) && t.Before(to)
+	}
+
+	report := Report{Fiat: r.Fiat, Method: r.Method, Trades: []Trade{}, Disposals: []Disposal{}}
+	for _, trade := range r.Trades {
+		if in(trade.Time) {
+			report.Trades = append(report.Trades, trade)
+		}
+	}
+	for _, disposal := range r.Disposals {
+		if in(disposal.Disposed) {
+			report.Disposals = append(report.Disposals, disposal)
+		}
+	}
+
+	return report
+}
+
+type lot struct {
+	amount   decimal.Decimal
+	cost     decimal.Decimal
+	acquired time.Time
+}
+
+// Build values the fills in fiat and turns them into tax lots. Every trade
+// acquires one asset and disposes of the other, fiat excepted, so that
+// buying BTC with USDT disposes of the USDT. Lots of an asset are pooled
+// across accounts. Fees are not known and are left out. Derivatives fills
+// acquire nothing and must not be passed, see portfolio.SpotFills.
+func Build(fills []portfolio.Fill, fiat string, method Method, value Valuer) (Report, error) {
+	if err := method.Validate(); err != nil {
+		return Report{}, err
+	}
+	fiat = strings.ToUpper(fiat)
+
+	fills = append([]portfolio.Fill(nil), fills...)
+	sort.SliceStable(fills, func(i, j int) bool { return fills[i].Time.Before(fills[j].Time) })
+
+	report := Report{Fiat: fiat, Method: method, Trades: []Trade{}, Disposals: []Disposal{}}
+	lots := map[string][]lot{}
+
+	acquire := func(asset string, amount, cost decimal.Decimal, at time.Time) {
+		if asset != fiat {
+			lots[asset] = append(lots[asset], lot{amount: amount, cost: cost, acquired: at})
+		}
+	}
+	dispose := func(fill portfolio.Fill, asset string, amount, proceeds decimal.Decimal) {
+		if asset == fiat {
+			return
+		}
+
+		var disposals []Disposal
+		lots[asset], disposals = match(lots[asset], method, amount)
+		for _, d := range disposals {
+			d.Account = fill.Account
+			d.OrderID = fill.OrderID
+			d.Asset = asset
+			d.Disposed = fill.Time
+			d.Proceeds = proceeds.Mul(d.Amount).Div(amount)
+			d.Gain = d.Proceeds.Sub(d.Cost)
+			report.Disposals = append(report.Disposals, d)
+		}
+	}
+
+	for _, fill := range fills {
+		worth, err := worth(fill, fiat, value)
+		if err != nil {
+			return Report{}, err
+		}
+		report.Trades = append(report.Trades, Trade{Fill: fill, Worth: worth})
+
+		if fill.Side == "sell" {
+			dispose(fill, fill.Base, fill.Amount, worth)
+			acquire(fill.Quote, fill.Value, worth, fill.Time)
+		} else {
+			dispose(fill, fill.Quote, fill.Value, worth)
+			acquire(fill.Base, fill.Amount, worth, fill.Time)
+		}
+	}
+
+	return report, nil
+}
+
+// worth values a fill by what was paid or received in the quote asset.
+func worth(fill portfolio.Fill, fiat string, value Valuer) (decimal.Decimal, error) {
+	switch fiat {
+	case fill.Quote:
+		return fill.Value, nil
+	case fill.Base:
+		return fill.Amount, nil
+	}
+
+	price, err := value(fill.Account, fill.Quote, fiat, fill.Time)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("value %s in %s at %s: %w", fill.Quote, fiat, fill.Time.Format(time.RFC3339), err)
+	}
+
+	return fill.Value.Mul(price), nil
+}
+
+// match takes amount out of the lots by method and returns the lots left and
+// the matched parts, without their proceeds.
+func match(lots []lot, method Method, amount decimal.Decimal) ([]lot, []Disposal) {
+	var disposals []Disposal
+	for amount.IsPositive() && len(lots) > 0 {
+		i := pick(lots, method)
+
+		matched := decimal.Min(amount, lots[i].amount)
+		cost := lots[i].cost.Mul(matched).Div(lots[i].amount)
+		disposals = append(disposals, Disposal{Amount: matched, Acquired: lots[i].acquired, Cost: cost})
+
+		lots[i].amount = lots[i].amount.Sub(matched)
+		lots[i].cost = lots[i].cost.Sub(cost)
+		if !lots[i].amount.IsPositive() {
+			lots = append(lots[:i], lots[i+1:]...)
+		}
+		amount = amount.Sub(matched)
+	}
+
+	if amount.IsPositive() {
+		disposals = append(disposals, Disposal{Amount: amount, Unmatched: true})
+	}
+
+	return lots, disposals
+}
+
+func pick(lots []lot, method Method) int {
+	switch method {
+	case LIFO:
+		return len(lots) - 1
+	case HIFO:
+		best := 0
+		for i := range lots {
+			if lots[i].cost.Div(lots[i].amount).GreaterThan(lots[best].cost.Div(lots[best].amount)) {
+				best = i
+			}
+		}
+		return best
+	}
+
+	return 0
+}
+
+type valuation struct {
+	asset string
+	fiat  string
+	at    time.Time
+}
+
+// KlineValuer values assets with the close of the minute kline of the
+// asset against the fiat currency, from the venue of the account if it
+// serves klines and from the other accounts otherwise.
+func KlineValuer(registry *trading.Registry) Valuer {
+	var mu sync.Mutex
+	cache := map[valuation]decimal.Decimal{}
+
+	return func(account, asset, fiat string, at time.Time) (decimal.Decimal, error) {
+		key := valuation{asset: asset, fiat: fiat, at: at.Truncate(time.Minute)}
+
+		mu.Lock()
+		price, ok := cache[key]
+		mu.Unlock()
+		if ok {
+			return price, nil
+		}
+
+		clients := []trading.Client{}
+		if client, ok := registry.Client(account); ok {
+			clients = append(clients, client)
+		}
+		for _, a := range registry.Accounts() {
+			if a.Name != account {
+				clients = append(clients, a.Client)
+			}
+		}
+
+		err := fmt.Errorf("no venue serves %s/%s klines", asset, fiat)
+		for _, client := range clients {
+			klineClient, ok := client.(trading.KlineClient)
+			if !ok {
+				continue
+			}
+
+			var klines []trading.Kline
+			klines, err = klineClient.GetKlines(trading.KlinesRequest{
+				Base:     asset,
+				Quote:    fiat,
+				Interval: time.Minute,
+				Start:    key.at,
+				End:      key.at.Add(time.Minute),
+			})
+			if err != nil {
+				continue
+			}
+			if len(klines) == 0 {
+				err = fmt.Errorf("no %s/%s kline", asset, fiat)
+				continue
+			}
+
+			price = klines[0].Close
+			mu.Lock()
+			cache[key] = price
+			mu.Unlock()
+
+			return price, nil
+		}
+
+		return decimal.Zero, err
+	}
+}
@@ -0,0 +1,162 @@
+package accounting
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/portfolio"
+	"trading-aggregator/simulator"
+	"trading-aggregator/trading"
+)
+
+var start = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func newFill(minutes int, side, base, quote, amount, value string) portfolio.Fill {
+	return portfolio.Fill{
+		OrderID: side + "-" + base + "-" + amount,
+		Account: "binance:default",
+		Side:    side,
+		Base:    base,
+		Quote:   quote,
+		Amount:  decimal.RequireFromString(amount),
+		Value:   decimal.RequireFromString(value),
+		Time:    start.Add(time.Duration(minutes) * time.Minute),
+	}
+}
+
+var fills = []portfolio.Fill{
+	newFill(0, "buy", "BTC", "USD", "1", "100"),
+	newFill(1, "buy", "BTC", "USD", "1", "300"),
+	newFill(2, "sell", "BTC", "USD", "1.5", "600"),
+	newFill(3, "buy", "ETH", "BTC", "10", "0.2"),
+}
+
+func btcValuer(account, asset, fiat string, at time.Time) (decimal.Decimal, error) {
+	if asset != "BTC" || fiat != "USD" {
+		return decimal.Zero, errors.New("no price")
+	}
+
+	return decimal.NewFromInt(500), nil
+}
+
+func gains(disposals []Disposal) []string {
+	var list []string
+	for _, d := range disposals {
+		list = append(list, d.Amount.String()+"@"+d.Cost.String()+"/"+d.Proceeds.String())
+	}
+
+	return list
+}
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		method Method
+		want   string
+	}{
+		{FIFO, "1@100/400 0.5@150/200 0.2@60/100"},
+		{LIFO, "1@300/400 0.5@50/200 0.2@20/100"},
+		{HIFO, "1@300/400 0.5@50/200 0.2@20/100"},
+	}
+	for _, tt := range tests {
+		report, err := Build(fills, "usd", tt.method, btcValuer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := strings.Join(gains(report.Disposals), " "); got != tt.want {
+			t.Errorf("%s: got disposals %s, want %s", tt.method, got, tt.want)
+		}
+		if len(report.Trades) != 4 || report.Trades[3].Worth.String() != "100" {
+			t.Fatalf("%s: got trades %+v", tt.method, report.Trades)
+		}
+	}
+
+	report, _ := Build(fills, "USD", FIFO, btcValuer)
+	between := report.Between(start.Add(2*time.Minute), start.Add(3*time.Minute))
+	if len(between.Trades) != 1 || len(between.Disposals) != 2 || !between.Disposals[0].Acquired.Equal(start) {
+		t.Fatalf("got report %+v", between)
+	}
+
+	// Selling what was never bought has no cost basis.
+	report, _ = Build([]portfolio.Fill{newFill(0, "sell", "BTC", "USD", "1", "100")}, "USD", FIFO, btcValuer)
+	if len(report.Disposals) != 1 || !report.Disposals[0].Unmatched || report.Disposals[0].Gain.String() != "100" {
+		t.Fatalf("got disposals %+v", report.Disposals)
+	}
+
+	_, err := Build([]portfolio.Fill{newFill(0, "buy", "BTC", "EUR", "1", "100")}, "USD", FIFO, btcValuer)
+	if err == nil || !strings.Contains(err.Error(), "value EUR in USD") {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func TestExport(t *testing.T) {
+	report, err := Build(fills, "USD", FIFO, btcValuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		format Format
+		header string
+		row    string
+	}{
+		{FormatCSV, "Date Acquired,Date Sold,Asset,Amount,Proceeds,Cost Basis,Gain,Currency,Account,Order ID",
+			"2024-03-01T12:00:00Z,2024-03-01T12:02:00Z,BTC,1,400.00,100.00,300.00,USD,binance:default,sell-BTC-1.5"},
+		{FormatKoinly, "Date,Sent Amount,Sent Currency,Received Amount,Received Currency,Fee Amount,Fee Currency,Net Worth Amount,Net Worth Currency,Label,Description,TxHash",
+			"2024-03-01 12:03:00 UTC,0.2,BTC,10,ETH,,,100.00,USD,,binance:default,buy-ETH-10"},
+		{FormatCoinTracking, "Type,Buy Amount,Buy Currency,Sell Amount,Sell Currency,Fee,Fee Currency,Exchange,Trade-Group,Comment,Date",
+			"Trade,600,USD,1.5,BTC,,,binance,binance:default,sell-BTC-1.5,01.03.2024 12:02:00"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		err := Export(&buf, tt.format, report)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(buf.String(), "\n")
+		if lines[0] != tt.header {
+			t.Errorf("%s: got header %s", tt.format, lines[0])
+		}
+		if !strings.Contains(buf.String(), tt.row+"\n") {
+			t.Errorf("%s: row %s missing from\n%s", tt.format, tt.row, buf.String())
+		}
+	}
+
+	if err := Export(&bytes.Buffer{}, "xlsx", report); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+}
+
+func TestKlineValuer(t *testing.T) {
+	sim := simulator.New()
+	sim.SetKlines("USDT", "USD", []trading.Kline{{Time: start, Close: decimal.RequireFromString("0.999")}})
+
+	registry := trading.NewRegistry()
+	registry.Set("sim", trading.Client(&noKlines{}))
+	registry.Set("sim:data", sim)
+
+	value := KlineValuer(registry)
+	price, err := value("sim:default", "USDT", "USD", start.Add(30*time.Second))
+	if err != nil || price.String() != "0.999" {
+		t.Fatalf("got price %s, %v", price, err)
+	}
+
+	if _, err := value("sim:default", "BTC", "USD", start); err == nil {
+		t.Fatal("expected error without klines")
+	}
+}
+
+// noKlines is a venue without klines.
+type noKlines struct {
+	simulator.Exchange
+}
+
+func (c *noKlines) GetKlines(trading.KlinesRequest) ([]trading.Kline, error) {
+	return nil, trading.ErrUnsupportedInterval
+}
@@ -0,0 +1,158 @@
+package accounting
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"time"
+
+	"trading-aggregator/trading"
+)
+
+// Format is an export format.
+type Format string
+
+const (
+	// FormatCSV lists the tax lots, one disposal per row.
+	FormatCSV Format = "csv"
+	// FormatKoinly lists the trades in Koinly's universal format.
+	FormatKoinly Format = "koinly"
+	// FormatCoinTracking lists the trades in CoinTracking's CSV import
+	// format.
+	FormatCoinTracking Format = "cointracking"
+)
+
+var formats = map[Format]func(*csv.Writer, Report) error{
+	FormatCSV:          writeLots,
+	FormatKoinly:       writeKoinly,
+	FormatCoinTracking: writeCoinTracking,
+}
+
+func (f Format) Validate() error {
+	if _, ok := formats[f]; !ok {
+		return fmt.Errorf("unknown export format %q", f)
+	}
+
+	return nil
+}
+
+// Export writes the report as CSV in format.
+func Export(w io.Writer, format Format, report Report) error {
+	if err := format.Validate(); err != nil {
+		return err
+	}
+	write := formats[format]
+
+	cw := csv.NewWriter(w)
+	err := write(cw, report)
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
+
+func writeLots(w *csv.Writer, report Report) error {
+	err := w.Write([]string{"Date Acquired", "Date Sold", "Asset", "Amount", "Proceeds", "Cost Basis", "Gain", "Currency", "Account", "Order ID"})
+	if err != nil {
+		return err
+	}
+
+	for _, d := range report.Disposals {
+		acquired := ""
+		if !d.Unmatched {
+			acquired = d.Acquired.UTC().Format(time.RFC3339)
+		}
+
+		err = w.Write([]string{
+			acquired,
+			d.Disposed.UTC().Format(time.RFC3339),
+			d.Asset,
+			d.Amount.String(),
+			d.Proceeds.StringFixed(2),
+			d.Cost.StringFixed(2),
+			d.Gain.StringFixed(2),
+			report.Fiat,
+			d.Account,
+			d.OrderID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sentReceived orders the two sides of a trade as what left and what came
+// into the account.
+func sentReceived(t Trade) (sentAmount, sentCurrency, receivedAmount, receivedCurrency string) {
+	if t.Side == "sell" {
+		return t.Amount.String(), t.Base, t.Value.String(), t.Quote
+	}
+
+	return t.Value.String(), t.Quote, t.Amount.String(), t.Base
+}
+
+func writeKoinly(w *csv.Writer, report Report) error {
+	err := w.Write([]string{"Date", "Sent Amount", "Sent Currency", "Received Amount", "Received Currency",
+		"Fee Amount", "Fee Currency", "Net Worth Amount", "Net Worth Currency", "Label", "Description", "TxHash"})
+	if err != nil {
+		return err
+	}
+
+	for _, t := range report.Trades {
+		sentAmount, sentCurrency, receivedAmount, receivedCurrency := sentReceived(t)
+		err = w.Write([]string{
+			t.Time.UTC().Format("2006-01-02 15:04:05 UTC"),
+			sentAmount,
+			sentCurrency,
+			receivedAmount,
+			receivedCurrency,
+			"",
+			"",
+			t.Worth.StringFixed(2),
+			report.Fiat,
+			"",
+			t.Account,
+			t.OrderID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeCoinTracking(w *csv.Writer, report Report) error {
+	err := w.Write([]string{"Type", "Buy Amount", "Buy Currency", "Sell Amount", "Sell Currency",
+		"Fee", "Fee Currency", "Exchange", "Trade-Group", "Comment", "Date"})
+	if err != nil {
+		return err
+	}
+
+	for _, t := range report.Trades {
+		sellAmount, sellCurrency, buyAmount, buyCurrency := sentReceived(t)
+		exchange, _ := trading.ParseAccount(t.Account)
+		err = w.Write([]string{
+			"Trade",
+			buyAmount,
+			buyCurrency,
+			sellAmount,
+			sellCurrency,
+			"",
+			"",
+			exchange,
+			t.Account,
+			t.OrderID,
+			t.Time.UTC().Format("02.01.2006 15:04:05"),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,554 @@
+package algo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/order"
+	"trading-aggregator/trading"
+)
+
+var ErrNotRunning = errors.New("parent order is not running")
+
+// State is what an Algorithm sizes the next child order from.
+type State struct {
+	Amount   decimal.Decimal
+	Executed decimal.Decimal
+	// Pending is the amount in child orders that have not ended yet.
+	Pending decimal.Decimal
+	// Elapsed is the time the parent has been running, pauses excluded.
+	Elapsed time.Duration
+}
+
+// Remaining is the amount that is neither executed nor in a pending child.
+func (s State) Remaining() decimal.Decimal {
+	return s.Amount.Sub(s.Executed).Sub(s.Pending)
+}
+
+// Algorithm slices a parent order into child orders. An Algorithm instance
+// works a single parent and is only called from that parent's goroutine.
+type Algorithm interface {
+	Name() string
+	// Next returns the amount of the child order to place now, zero for
+	// none, and how much running time to wait before being asked again.
+	Next(State) (decimal.Decimal, time.Duration)
+}
+
+// Starter is implemented by algorithms that need the venue while they run,
+// for instance to follow its trades. Start is called once before the first
+// Next, and ctx is done when the parent ends.
+type Starter interface {
+	Start(ctx context.Context, parent order.Order, client trading.Client) error
+}
+
+// Pricer is implemented by algorithms that price their own children. Their
+// children are good-till-canceled limit orders at Price, which the engine
+// cancels when the parent is paused or stops, and whenever Stale reports
+// that a resting child's price no longer fits the market. What a canceled
+// child left unfilled is handed to Next again.
+type Pricer interface {
+	Price() (decimal.Decimal, error)
+	Stale(price decimal.Decimal) bool
+}
+
+// Child configures the child orders of a parent. Limit children may fill up
+// to LimitOffset, a fraction, away from the current price: buys up to
+// price*(1+LimitOffset) and sells down to price*(1-LimitOffset). They are
+// immediate-or-cancel so that no child rests on the book.
+type Child struct {
+	Type        trading.OrderType
+	LimitOffset decimal.Decimal
+}
+
+type Config struct {
+	// MaxFailures ends a parent as FAILED after this many children in a row
+	// were rejected or filled nothing; 5 by default.
+	MaxFailures int
+	// Gate, if set, is asked before every child is placed. A child it
+	// refuses counts as a failure.
+	Gate func() error
+}
+
+type eventKind int
+
+const (
+	childEnded eventKind = iota
+	pause
+	resume
+	cancel
+)
+
+type event struct {
+	kind  eventKind
+	child order.Order
+}
+
+type execution struct {
+	parent    order.Order
+	algorithm Algorithm
+	child     Child
+	client    trading.Client
+	listing   trading.Listing
+	cancel    context.CancelFunc
+	events    chan event
+	done      chan struct{}
+}
+
+// Engine works parent orders with execution algorithms on any
+// trading.Client. Parents and children are kept in the tracker's store, and
+// children are tracked like any other order; the engine learns about their
+// fills from the tracker.
+type Engine struct {
+	tracker *order.Tracker
+	resolve order.ClientResolver
+	config  Config
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu         sync.Mutex
+	executions map[string]*execution
+}
+
+func NewEngine(tracker *order.Tracker, resolve order.ClientResolver, config Config) *Engine {
+	if config.MaxFailures <= 0 {
+		config.MaxFailures = 5
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	e := &Engine{
+		tracker:    tracker,
+		resolve:    resolve,
+		config:     config,
+		ctx:        ctx,
+		cancel:     cancel,
+		executions: map[string]*execution{},
+	}
+	tracker.OnTerminal(e.childEnded)
+
+	return e
+}
+
+// Close stops working every parent. Parents stopped this way keep their last
+// status.
+func (e *Engine) Close() {
+	e.cancel()
+}
+
+// Start saves parent as a running parent order and works it with algorithm
+// until it is filled, fails or is canceled. A parent counts as filled once
+// what remains is below the venue's minimum order size.
+func (e *Engine) Start(parent order.Order, algorithm Algorithm, child Child) (order.Order, error) {
+	if parent.Side != "buy" && parent.Side != "sell" {
+		return order.Order{}, fmt.Errorf("unknown side %q", parent.Side)
+	}
+	if !parent.Amount.IsPositive() {
+		return order.Order{}, fmt.Errorf("amount must be positive, got %s", parent.Amount)
+	}
+
+	client, ok := e.resolve(parent.Exchange)
+	if !ok {
+		return order.Order{}, fmt.Errorf("unknown exchange %q", parent.Exchange)
+	}
+
+	switch child.Type {
+	case "", trading.OrderTypeMarket:
+	case trading.OrderTypeLimit:
+		if _, ok := client.(trading.PriceClient); !ok {
+			return order.Order{}, fmt.Errorf("%s cannot price limit children", parent.Exchange)
+		}
+		if child.LimitOffset.IsNegative() {
+			return order.Order{}, fmt.Errorf("limit offset must not be negative, got %s", child.LimitOffset)
+		}
+	default:
+		return order.Order{}, fmt.Errorf("unknown child order type %q", child.Type)
+	}
+	if _, ok := algorithm.(Pricer); ok {
+		if _, ok := client.(trading.Canceler); !ok {
+			return order.Order{}, fmt.Errorf("%s cannot cancel resting children", parent.Exchange)
+		}
+	}
+
+	x := &execution{
+		algorithm: algorithm,
+		child:     child,
+		client:    client,
+		events:    make(chan event, 16),
+		done:      make(chan struct{}),
+	}
+
+	instrument := trading.NewInstrument(parent.Base, parent.Quote)
+	if lister, ok := client.(trading.InstrumentLister); ok {
+		listings, err := lister.ListInstruments()
+		if err != nil {
+			return order.Order{}, err
+		}
+		for _, listing := range listings {
+			if listing.Instrument == instrument {
+				x.listing = listing
+			}
+		}
+	}
+	if parent.Amount.LessThan(x.listing.MinBase) {
+		return order.Order{}, fmt.Errorf("amount %s is below the minimum of %s", parent.Amount, x.listing.MinBase)
+	}
+
+	ctx, stop := context.WithCancel(e.ctx)
+	x.cancel = stop
+	if starter, ok := algorithm.(Starter); ok {
+		err := starter.Start(ctx, parent, client)
+		if err != nil {
+			stop()
+			return order.Order{}, err
+		}
+	}
+
+	now := time.Now().UTC()
+	parent.Algo = &order.Algo{Name: algorithm.Name()}
+	parent.Detail = trading.GetOrderDetailResponse{Status: order.StatusRunning}
+	parent.CreatedAt = now
+	parent.UpdatedAt = now
+	err := e.tracker.Store().Save(parent)
+	if err != nil {
+		stop()
+		return order.Order{}, err
+	}
+	x.parent = parent
+
+	e.mu.Lock()
+	e.executions[parent.ID] = x
+	e.mu.Unlock()
+
+	go e.run(x)
+
+	return parent, nil
+}
+
+func (e *Engine) Pause(id string) error {
+	return e.send(id, event{kind: pause})
+}
+
+func (e *Engine) Resume(id string) error {
+	return e.send(id, event{kind: resume})
+}
+
+// Cancel stops placing children. The parent ends as CANCELED once its
+// pending children have ended.
+func (e *Engine) Cancel(id string) error {
+	return e.send(id, event{kind: cancel})
+}
+
+// CancelAll cancels every running parent.
+func (e *Engine) CancelAll() {
+	e.mu.Lock()
+	ids := make([]string, 0, len(e.executions))
+	for id := range e.executions {
+		ids = append(ids, id)
+	}
+	e.mu.Unlock()
+
+	for _, id := range ids {
+		_ = e.Cancel(id)
+	}
+}
+
+func (e *Engine) send(id string, ev event) error {
+	e.mu.Lock()
+	x, ok := e.executions[id]
+	e.mu.Unlock()
+
+	if !ok {
+		return ErrNotRunning
+	}
+
+	select {
+	case x.events <- ev:
+		return nil
+	case <-x.done:
+		return ErrNotRunning
+	}
+}
+
+func (e *Engine) childEnded(o order.Order) {
+	if o.ParentID == "" {
+		return
+	}
+
+	_ = e.send(o.ParentID, event{kind: childEnded, child: o})
+}
+
+func (e *Engine) run(x *execution) {
+	defer func() {
+		x.cancel()
+		e.mu.Lock()
+		delete(e.executions, x.parent.ID)
+		e.mu.Unlock()
+		close(x.done)
+	}()
+
+	// Children below the venue's minimum would be rejected, so they are
+	// raised to it, and a remainder below it cannot be traded at all.
+	minimum := decimal.Max(x.listing.MinBase, x.listing.BaseIncrement)
+	pricer, _ := x.algorithm.(Pricer)
+
+	var (
+		state         = State{Amount: x.parent.Amount}
+		executedQuote decimal.Decimal
+		children      int
+		failures      int
+		consecutive   int
+		paused        bool
+		stop          string
+		resumedAt     = time.Now()
+		elapsed       time.Duration
+		// resting are the GTC children left on the book.
+		resting = map[string]*restingChild{}
+	)
+	running := func() time.Duration {
+		if paused {
+			return elapsed
+		}
+		return elapsed + time.Since(resumedAt)
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	reset := func(wait time.Duration) {
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+	}
+
+	for {
+		select {
+		case <-e.ctx.Done():
+			return
+		case ev := <-x.events:
+			switch ev.kind {
+			case childEnded:
+				// Children pulled by the engine did not fail.
+				pulled := resting[ev.child.ID] != nil && resting[ev.child.ID].canceling
+				delete(resting, ev.child.ID)
+				state.Pending = state.Pending.Sub(ev.child.Amount)
+				state.Executed = state.Executed.Add(ev.child.Detail.ExecutedBase)
+				executedQuote = executedQuote.Add(ev.child.Detail.ExecutedQuote)
+				if ev.child.Detail.ExecutedBase.IsPositive() {
+					consecutive = 0
+				} else if !pulled {
+					failures++
+					consecutive++
+				}
+				// The algorithm is asked again right away, so that it can
+				// replace the child.
+				if !paused && stop == "" {
+					reset(0)
+				}
+			case pause:
+				if !paused {
+					elapsed = running()
+					paused = true
+				}
+			case resume:
+				if paused {
+					paused = false
+					resumedAt = time.Now()
+					reset(0)
+				}
+			case cancel:
+				if stop == "" {
+					stop = order.StatusCanceled
+				}
+			}
+		case <-timer.C:
+			if paused || stop != "" {
+				continue
+			}
+
+			if pricer != nil {
+				for _, child := range resting {
+					if !child.canceling && pricer.Stale(child.order.Price) {
+						e.cancelChild(x, child)
+					}
+				}
+			}
+
+			state.Elapsed = running()
+			amount, wait := x.algorithm.Next(state)
+			timer.Reset(wait)
+
+			remaining := trading.RoundDown(state.Remaining(), x.listing.BaseIncrement)
+			amount = trading.RoundDown(decimal.Min(amount, remaining), x.listing.BaseIncrement)
+			if amount.IsPositive() && amount.LessThan(minimum) && !remaining.LessThan(minimum) {
+				amount = minimum
+			}
+			if !amount.IsPositive() || amount.LessThan(minimum) {
+				continue
+			}
+
+			children++
+			child, err := e.placeChild(x, pricer, amount)
+			if err != nil {
+				failures++
+				consecutive++
+			} else {
+				state.Pending = state.Pending.Add(amount)
+				if child.TimeInForce == trading.GoodTillCanceled {
+					resting[child.ID] = &restingChild{order: child}
+				}
+			}
+		}
+
+		if stop == "" && consecutive >= e.config.MaxFailures {
+			stop = order.StatusFailed
+		}
+		remaining := state.Amount.Sub(state.Executed)
+		if stop == "" && (!remaining.IsPositive() || (minimum.IsPositive() && remaining.LessThan(minimum))) {
+			stop = order.StatusFilled
+		}
+
+		// Paused and stopping parents take their children off the book.
+		if paused || stop != "" {
+			for _, child := range resting {
+				if !child.canceling {
+					e.cancelChild(x, child)
+				}
+			}
+		}
+
+		status := order.StatusRunning
+		if paused {
+			status = order.StatusPaused
+		}
+		if stop != "" && !state.Pending.IsPositive() {
+			status = stop
+		}
+
+		_ = e.tracker.Update(x.parent.ID, func(o *order.Order) {
+			o.Detail = trading.GetOrderDetailResponse{
+				Status:        status,
+				ExecutedBase:  state.Executed,
+				ExecutedQuote: executedQuote,
+			}
+			o.Algo = &order.Algo{
+				Name:     x.algorithm.Name(),
+				Children: children,
+				Failures: failures,
+				Pending:  state.Pending,
+			}
+		})
+
+		if order.IsTerminalStatus(status) {
+			return
+		}
+	}
+}
+
+type restingChild struct {
+	order     order.Order
+	canceling bool
+}
+
+// cancelChild asks the venue to cancel a resting child. Its end, filled or
+// canceled, is learned from the tracker like that of any child; a failed
+// request is not repeated since it mostly means the child already ended.
+func (e *Engine) cancelChild(x *execution, child *restingChild) {
+	child.canceling = true
+	_ = x.client.(trading.Canceler).CancelOrder(trading.CancelOrderRequest{
+		Base:          child.order.Base,
+		Quote:         child.order.Quote,
+		OrderID:       child.order.OrderID,
+		ClientOrderID: child.order.ClientOrderID,
+	})
+}
+
+func (e *Engine) placeChild(x *execution, pricer Pricer, amount decimal.Decimal) (order.Order, error) {
+	if e.config.Gate != nil {
+		err := e.config.Gate()
+		if err != nil {
+			return order.Order{}, err
+		}
+	}
+
+	parent := x.parent
+	req := trading.TradeRequest{
+		Base:          parent.Base,
+		Quote:         parent.Quote,
+		Amount:        amount,
+		ClientOrderID: uuid.NewString(),
+	}
+
+	switch {
+	case pricer != nil:
+		price, err := pricer.Price()
+		if err != nil {
+			return order.Order{}, err
+		}
+
+		req.Type = trading.OrderTypeLimit
+		req.Price = price
+		req.TimeInForce = trading.GoodTillCanceled
+	case x.child.Type == trading.OrderTypeLimit:
+		res, err := x.client.(trading.PriceClient).GetPrice(trading.GetPriceRequest{
+			Base:  parent.Base,
+			Quote: parent.Quote,
+		})
+		if err != nil {
+			return order.Order{}, err
+		}
+
+		offset := decimal.NewFromInt(1).Add(x.child.LimitOffset)
+		if parent.Side == "sell" {
+			offset = decimal.NewFromInt(1).Sub(x.child.LimitOffset)
+		}
+
+		req.Type = trading.OrderTypeLimit
+		req.Price = res.Price.Mul(offset)
+		req.TimeInForce = trading.ImmediateOrCancel
+	}
+
+	var res trading.TradeResponse
+	if parent.Side == "buy" {
+		buy, err := x.client.Buy(trading.BuyRequest{TradeRequest: req})
+		if err != nil {
+			return order.Order{}, err
+		}
+		res = buy.TradeResponse
+	} else {
+		sell, err := x.client.Sell(trading.SellRequest{TradeRequest: req})
+		if err != nil {
+			return order.Order{}, err
+		}
+		res = sell.TradeResponse
+	}
+
+	now := time.Now().UTC()
+	child := order.Order{
+		ID:            uuid.NewString(),
+		Exchange:      parent.Exchange,
+		Side:          parent.Side,
+		Base:          parent.Base,
+		Quote:         parent.Quote,
+		Amount:        amount,
+		Type:          req.Type,
+		Price:         req.Price,
+		TimeInForce:   req.TimeInForce,
+		ClientOrderID: req.ClientOrderID,
+		OrderID:       res.OrderID,
+		ParentID:      parent.ID,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	return child, e.tracker.Store().Save(child)
+}
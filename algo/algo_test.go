@@ -0,0 +1,519 @@
+package algo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/order"
+	"trading-aggregator/simulator"
+	"trading-aggregator/trading"
+)
+
+// newEngine runs an engine on a simulated exchange named "sim" whose orders
+// are polled every few milliseconds.
+func newEngine(t *testing.T, config Config) (*Engine, *order.Tracker, *simulator.Exchange) {
+	t.Helper()
+
+	sim := simulator.New()
+	sim.SetPrice("BTC", "USDT", decimal.NewFromInt(100))
+
+	resolve := func(exchange string) (trading.Client, bool) {
+		return sim, exchange == "sim"
+	}
+	tracker := order.NewTracker(order.NewMemoryStore(), resolve, 5*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go tracker.Run(ctx)
+
+	engine := NewEngine(tracker, resolve, config)
+	t.Cleanup(func() {
+		engine.Close()
+		cancel()
+	})
+
+	return engine, tracker, sim
+}
+
+func parent(side string, amount int64) order.Order {
+	return order.Order{
+		ID:       side + "-parent",
+		Exchange: "sim",
+		Side:     side,
+		Base:     "BTC",
+		Quote:    "USDT",
+		Amount:   decimal.NewFromInt(amount),
+	}
+}
+
+func waitForStatus(t *testing.T, tracker *order.Tracker, id string, statuses ...string) order.Order {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		o, err := tracker.Store().Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, status := range statuses {
+			if o.Detail.Status == status {
+				return o
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	o, _ := tracker.Store().Get(id)
+	t.Fatalf("order %s never reached %v, got %+v", id, statuses, o)
+	return o
+}
+
+func TestEngine_TWAP(t *testing.T) {
+	engine, tracker, sim := newEngine(t, Config{})
+
+	twap, err := NewTWAP(100*time.Millisecond, 4, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = engine.Start(parent("buy", 2), twap, Child{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := waitForStatus(t, tracker, "buy-parent", order.StatusFilled)
+	if !o.Detail.ExecutedBase.Equal(decimal.NewFromInt(2)) || !o.Detail.ExecutedQuote.Equal(decimal.NewFromInt(200)) {
+		t.Fatalf("got detail %+v", o.Detail)
+	}
+	if o.Algo.Children != 4 || o.Algo.Failures != 0 || !o.Algo.Pending.IsZero() {
+		t.Fatalf("got algo %+v", o.Algo)
+	}
+
+	fills := sim.Fills()
+	if len(fills) != 4 {
+		t.Fatalf("got %d fills", len(fills))
+	}
+	for _, fill := range fills {
+		if fill.Base.String() != "0.5" {
+			t.Fatalf("got fill %+v", fill)
+		}
+	}
+	if elapsed := fills[3].Time.Sub(fills[0].Time); elapsed < 70*time.Millisecond {
+		t.Fatalf("slices were %s apart", elapsed)
+	}
+
+	orders, _ := tracker.Store().List()
+	children := 0
+	for _, child := range orders {
+		if child.ParentID == "buy-parent" {
+			children++
+		}
+	}
+	if children != 4 {
+		t.Fatalf("got %d children", children)
+	}
+}
+
+func TestEngine_LimitChildrenMakeUpShortFills(t *testing.T) {
+	engine, tracker, sim := newEngine(t, Config{})
+	sim.SetLiquidity(decimal.RequireFromString("0.3"))
+
+	twap, err := NewTWAP(60*time.Millisecond, 3, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = engine.Start(parent("sell", 1), twap, Child{
+		Type:        trading.OrderTypeLimit,
+		LimitOffset: decimal.RequireFromString("0.01"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := waitForStatus(t, tracker, "sell-parent", order.StatusFilled)
+	if !o.Detail.ExecutedBase.Equal(decimal.NewFromInt(1)) || o.Algo.Children < 4 {
+		t.Fatalf("got %+v", o)
+	}
+
+	orders, _ := tracker.Store().List()
+	for _, child := range orders {
+		if child.ParentID == "sell-parent" && (!child.Price.Equal(decimal.NewFromInt(99)) || child.TimeInForce != trading.ImmediateOrCancel) {
+			t.Fatalf("got child %+v", child)
+		}
+	}
+}
+
+func TestEngine_FailsAfterConsecutiveFailures(t *testing.T) {
+	engine, tracker, sim := newEngine(t, Config{MaxFailures: 2})
+	sim.FailWith(func(string, trading.TradeRequest) error {
+		return errors.New("rejected")
+	})
+
+	twap, err := NewTWAP(20*time.Millisecond, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = engine.Start(parent("buy", 1), twap, Child{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := waitForStatus(t, tracker, "buy-parent", order.StatusFailed)
+	if o.Algo.Children != 2 || o.Algo.Failures != 2 || !o.Detail.ExecutedBase.IsZero() {
+		t.Fatalf("got %+v", o)
+	}
+}
+
+func TestEngine_PauseResumeCancel(t *testing.T) {
+	engine, tracker, sim := newEngine(t, Config{})
+
+	twap, err := NewTWAP(200*time.Millisecond, 4, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = engine.Start(parent("buy", 4), twap, Child{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitForStatus(t, tracker, "buy-parent", order.StatusRunning)
+	err = engine.Pause("buy-parent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, tracker, "buy-parent", order.StatusPaused)
+
+	paused := len(sim.Fills())
+	time.Sleep(250 * time.Millisecond)
+	if len(sim.Fills()) != paused {
+		t.Fatalf("placed %d children while paused", len(sim.Fills())-paused)
+	}
+
+	err = engine.Resume("buy-parent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, tracker, "buy-parent", order.StatusRunning)
+
+	err = engine.Cancel("buy-parent")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := waitForStatus(t, tracker, "buy-parent", order.StatusCanceled)
+	if o.Detail.ExecutedBase.GreaterThanOrEqual(decimal.NewFromInt(4)) || !o.Algo.Pending.IsZero() {
+		t.Fatalf("got %+v", o)
+	}
+
+	err = engine.Pause("buy-parent")
+	if !errors.Is(err, ErrNotRunning) {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func TestTWAP_Next(t *testing.T) {
+	twap, err := NewTWAP(time.Minute, 3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := State{Amount: decimal.NewFromInt(9)}
+	amount, wait := twap.Next(state)
+	if amount.String() != "3" || wait != 20*time.Second {
+		t.Fatalf("got %s after %s", amount, wait)
+	}
+
+	state.Elapsed = 10 * time.Second
+	amount, wait = twap.Next(state)
+	if !amount.IsZero() || wait != 10*time.Second {
+		t.Fatalf("got %s after %s", amount, wait)
+	}
+
+	// The first slice filled only 1, so the others grow.
+	state.Executed = decimal.NewFromInt(1)
+	state.Elapsed = 20 * time.Second
+	amount, _ = twap.Next(state)
+	if amount.String() != "4" {
+		t.Fatalf("got %s", amount)
+	}
+
+	_, err = NewTWAP(time.Minute, 3, 2)
+	if err == nil {
+		t.Fatal("accepted a jitter above 1")
+	}
+}
+
+func TestEngine_VWAP(t *testing.T) {
+	engine, tracker, sim := newEngine(t, Config{})
+
+	// A flat profile over the last day makes VWAP slice evenly.
+	now := time.Now().UTC().Truncate(ProfileBucket)
+	var klines []trading.Kline
+	for at := now.Add(-day); at.Before(now); at = at.Add(ProfileBucket) {
+		klines = append(klines, trading.Kline{Time: at, Volume: decimal.NewFromInt(10)})
+	}
+	sim.SetKlines("BTC", "USDT", klines)
+
+	vwap, err := NewVWAP(100*time.Millisecond, 4, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = engine.Start(parent("buy", 2), vwap, Child{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := waitForStatus(t, tracker, "buy-parent", order.StatusFilled)
+	if !o.Detail.ExecutedBase.Equal(decimal.NewFromInt(2)) || o.Algo.Name != "vwap" {
+		t.Fatalf("got %+v", o)
+	}
+	for _, fill := range sim.Fills() {
+		if !fill.Base.Round(6).Equal(decimal.RequireFromString("0.5")) {
+			t.Fatalf("got fill %+v", fill)
+		}
+	}
+}
+
+func TestVWAP_FollowsProfile(t *testing.T) {
+	sim := simulator.New()
+
+	// Over two days, the hour from 10:00 trades 30 a day and the next 10.
+	now := time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC)
+	var klines []trading.Kline
+	for _, date := range []time.Time{now.Add(-2 * day), now.Add(-day)} {
+		for i := 0; i < 4; i++ {
+			klines = append(klines,
+				trading.Kline{Time: date.Add(10*time.Hour + time.Duration(i)*ProfileBucket), Volume: decimal.RequireFromString("7.5")},
+				trading.Kline{Time: date.Add(11*time.Hour + time.Duration(i)*ProfileBucket), Volume: decimal.RequireFromString("2.5")},
+			)
+		}
+	}
+	sim.SetKlines("BTC", "USDT", klines)
+
+	profile, err := LoadVolumeProfile(sim, "BTC", "USDT", ProfileBucket, 2, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := now.Add(10 * time.Hour)
+	if volume := profile.Volume(start, start.Add(2*time.Hour)); volume.String() != "40" {
+		t.Fatalf("got volume %s", volume)
+	}
+	if volume := profile.Volume(start.Add(50*time.Minute), start.Add(70*time.Minute)); volume.Round(6).String() != "6.666667" {
+		t.Fatalf("got volume %s", volume)
+	}
+
+	vwap, err := NewVWAP(2*time.Hour, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vwap.profile = profile
+	vwap.start = start
+	vwap.total = profile.Volume(start, start.Add(2*time.Hour))
+
+	state := State{Amount: decimal.NewFromInt(8)}
+	amount, wait := vwap.Next(state)
+	if amount.String() != "6" || wait != time.Hour {
+		t.Fatalf("got %s after %s", amount, wait)
+	}
+
+	state.Executed = decimal.NewFromInt(6)
+	state.Elapsed = time.Hour
+	amount, _ = vwap.Next(state)
+	if amount.String() != "2" {
+		t.Fatalf("got %s", amount)
+	}
+}
+
+func TestEngine_POV(t *testing.T) {
+	engine, tracker, sim := newEngine(t, Config{})
+
+	pov, err := NewPOV(decimal.RequireFromString("0.2"), 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = engine.Start(parent("sell", 2), pov, Child{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Others trading 4 let the parent trade 1, a fifth of the 5 in total.
+	sim.Trade("BTC", "USDT", decimal.NewFromInt(100), decimal.NewFromInt(4))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !pov.Volume().Mul(decimal.RequireFromString("0.2")).Sub(decimal.RequireFromString("0.99")).IsPositive() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	o, _ := tracker.Store().Get("sell-parent")
+	executed := o.Detail.ExecutedBase
+	if executed.LessThan(decimal.RequireFromString("0.99")) || executed.GreaterThan(decimal.NewFromInt(1)) {
+		t.Fatalf("executed %s of a volume of %s", executed, pov.Volume())
+	}
+	if o.Detail.Status != order.StatusRunning {
+		t.Fatalf("got %+v", o)
+	}
+
+	sim.Trade("BTC", "USDT", decimal.NewFromInt(100), decimal.NewFromInt(8))
+	o = waitForStatus(t, tracker, "sell-parent", order.StatusFilled)
+	if !o.Detail.ExecutedBase.Equal(decimal.NewFromInt(2)) {
+		t.Fatalf("got %+v", o)
+	}
+}
+
+func children(t *testing.T, tracker *order.Tracker, parentID string) []order.Order {
+	t.Helper()
+
+	orders, err := tracker.Store().List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var children []order.Order
+	for _, o := range orders {
+		if o.ParentID == parentID {
+			children = append(children, o)
+		}
+	}
+	return children
+}
+
+func waitForChildren(t *testing.T, tracker *order.Tracker, parentID string, n int) []order.Order {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if c := children(t, tracker, parentID); len(c) >= n {
+			return c
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatalf("parent %s never placed %d children", parentID, n)
+	return nil
+}
+
+func TestEngine_Iceberg(t *testing.T) {
+	engine, tracker, sim := newEngine(t, Config{})
+
+	iceberg, err := NewIceberg(decimal.NewFromInt(110), decimal.NewFromInt(1), nil, 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = engine.Start(parent("sell", 3), iceberg, Child{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Below the limit only the first child is shown, and it rests.
+	waitForChildren(t, tracker, "sell-parent", 1)
+	time.Sleep(50 * time.Millisecond)
+	shown := children(t, tracker, "sell-parent")
+	if len(shown) != 1 || len(sim.Fills()) != 0 {
+		t.Fatalf("got children %+v and fills %+v", shown, sim.Fills())
+	}
+	if !shown[0].Amount.Equal(decimal.NewFromInt(1)) || !shown[0].Price.Equal(decimal.NewFromInt(110)) || shown[0].TimeInForce != trading.GoodTillCanceled {
+		t.Fatalf("got %+v", shown[0])
+	}
+
+	sim.SetPrice("BTC", "USDT", decimal.NewFromInt(110))
+	o := waitForStatus(t, tracker, "sell-parent", order.StatusFilled)
+	if !o.Detail.ExecutedBase.Equal(decimal.NewFromInt(3)) || o.Algo.Children != 3 {
+		t.Fatalf("got %+v", o)
+	}
+	for _, fill := range sim.Fills() {
+		if fill.Base.GreaterThan(decimal.NewFromInt(1)) {
+			t.Fatalf("filled %s at once", fill.Base)
+		}
+	}
+}
+
+func TestEngine_IcebergRepegsAndCancels(t *testing.T) {
+	engine, tracker, sim := newEngine(t, Config{})
+
+	iceberg, err := NewIceberg(decimal.NewFromInt(105), decimal.NewFromInt(1), &Peg{
+		Offset:    decimal.RequireFromString("0.01"),
+		Threshold: decimal.RequireFromString("0.005"),
+	}, 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = engine.Start(parent("buy", 2), iceberg, Child{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := waitForChildren(t, tracker, "buy-parent", 1)[0]
+	if !first.Price.Equal(decimal.NewFromInt(99)) {
+		t.Fatalf("got %+v", first)
+	}
+
+	// The market moving past the threshold replaces the child.
+	sim.SetPrice("BTC", "USDT", decimal.NewFromInt(102))
+	repegged := waitForChildren(t, tracker, "buy-parent", 2)
+	waitForStatus(t, tracker, first.ID, order.StatusCanceled)
+	for _, child := range repegged {
+		if child.ID != first.ID && !child.Price.Equal(decimal.RequireFromString("100.98")) {
+			t.Fatalf("got %+v", child)
+		}
+	}
+
+	err = engine.Cancel("buy-parent")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := waitForStatus(t, tracker, "buy-parent", order.StatusCanceled)
+	if !o.Detail.ExecutedBase.IsZero() || o.Algo.Failures != 0 || len(sim.Fills()) != 0 {
+		t.Fatalf("got %+v", o)
+	}
+	for _, child := range children(t, tracker, "buy-parent") {
+		if child.Detail.Status != order.StatusCanceled {
+			t.Fatalf("left %+v", child)
+		}
+	}
+}
+
+func TestIceberg_Price(t *testing.T) {
+	sim := simulator.New()
+	sim.SetPrice("BTC", "USDT", decimal.NewFromInt(100))
+
+	iceberg, err := NewIceberg(decimal.NewFromInt(98), decimal.NewFromInt(1), &Peg{
+		Offset:    decimal.RequireFromString("0.01"),
+		Threshold: decimal.RequireFromString("0.01"),
+	}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = iceberg.Start(context.Background(), parent("buy", 2), sim)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The peg of 99 is past the limit.
+	price, err := iceberg.Price()
+	if err != nil || !price.Equal(decimal.NewFromInt(98)) {
+		t.Fatalf("got %s, %v", price, err)
+	}
+
+	sim.SetPrice("BTC", "USDT", decimal.NewFromInt(96))
+	price, err = iceberg.Price()
+	if err != nil || !price.Equal(decimal.RequireFromString("95.04")) {
+		t.Fatalf("got %s, %v", price, err)
+	}
+	if !iceberg.Stale(decimal.NewFromInt(98)) || iceberg.Stale(decimal.RequireFromString("95.5")) {
+		t.Fatal("got the wrong staleness")
+	}
+}
@@ -0,0 +1,119 @@
+package algo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/order"
+	"trading-aggregator/trading"
+)
+
+// Peg keeps an iceberg's visible child near the market: buys rest Offset, a
+// fraction, below the current price and sells above it, never past the
+// parent's limit. A resting child is re-priced once the pegged price moved
+// more than Threshold, a fraction, away from it.
+type Peg struct {
+	Offset    decimal.Decimal
+	Threshold decimal.Decimal
+}
+
+// Iceberg shows only part of a limit parent on the book: a single resting
+// child of at most display, replaced by the next one as soon as it fills.
+// Without a peg every child rests at the parent's limit. The price is
+// checked every interval.
+type Iceberg struct {
+	limit    decimal.Decimal
+	display  decimal.Decimal
+	peg      *Peg
+	interval time.Duration
+
+	side   string
+	base   string
+	quote  string
+	prices trading.PriceClient
+}
+
+func NewIceberg(limit, display decimal.Decimal, peg *Peg, interval time.Duration) (*Iceberg, error) {
+	if !limit.IsPositive() {
+		return nil, fmt.Errorf("limit must be positive, got %s", limit)
+	}
+	if !display.IsPositive() {
+		return nil, fmt.Errorf("display must be positive, got %s", display)
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("interval must be positive, got %s", interval)
+	}
+	if peg != nil && (peg.Offset.IsNegative() || peg.Threshold.IsNegative()) {
+		return nil, fmt.Errorf("peg offset and threshold must not be negative, got %s and %s", peg.Offset, peg.Threshold)
+	}
+
+	return &Iceberg{limit: limit, display: display, peg: peg, interval: interval}, nil
+}
+
+func (i *Iceberg) Name() string {
+	return "iceberg"
+}
+
+func (i *Iceberg) Start(ctx context.Context, parent order.Order, client trading.Client) error {
+	i.side = parent.Side
+	i.base = parent.Base
+	i.quote = parent.Quote
+
+	if i.peg == nil {
+		return nil
+	}
+
+	prices, ok := client.(trading.PriceClient)
+	if !ok {
+		return errors.New("pegged iceberg needs prices, which the exchange does not serve")
+	}
+	i.prices = prices
+
+	return nil
+}
+
+// Price is the limit, or the pegged price if it is better.
+func (i *Iceberg) Price() (decimal.Decimal, error) {
+	if i.peg == nil {
+		return i.limit, nil
+	}
+
+	res, err := i.prices.GetPrice(trading.GetPriceRequest{Base: i.base, Quote: i.quote})
+	if err != nil {
+		return decimal.Decimal{}, err
+	}
+
+	one := decimal.NewFromInt(1)
+	if i.side == "buy" {
+		return decimal.Min(res.Price.Mul(one.Sub(i.peg.Offset)), i.limit), nil
+	}
+
+	return decimal.Max(res.Price.Mul(one.Add(i.peg.Offset)), i.limit), nil
+}
+
+// Stale reports whether the pegged price moved more than the threshold away
+// from price. Unpegged children are never stale.
+func (i *Iceberg) Stale(price decimal.Decimal) bool {
+	if i.peg == nil || !price.IsPositive() {
+		return false
+	}
+
+	pegged, err := i.Price()
+	if err != nil {
+		return false
+	}
+
+	return pegged.Sub(price).Abs().Div(price).GreaterThan(i.peg.Threshold)
+}
+
+func (i *Iceberg) Next(s State) (decimal.Decimal, time.Duration) {
+	if s.Pending.IsPositive() {
+		return decimal.Zero, i.interval
+	}
+
+	return decimal.Min(i.display, s.Remaining()), i.interval
+}
@@ -0,0 +1,81 @@
+package algo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/order"
+	"trading-aggregator/trading"
+)
+
+// POV participates in the market: it follows the venue's public trades from
+// the moment the parent starts and, every interval, tops the parent up to
+// Rate of the volume traded since. The volume includes the parent's own
+// fills, so that they make up Rate of all trading. A POV parent has no end
+// time and runs until it is filled or canceled.
+type POV struct {
+	rate     decimal.Decimal
+	interval time.Duration
+
+	mu     sync.Mutex
+	volume decimal.Decimal
+}
+
+func NewPOV(rate decimal.Decimal, interval time.Duration) (*POV, error) {
+	if !rate.IsPositive() || !rate.LessThan(decimal.NewFromInt(1)) {
+		return nil, fmt.Errorf("rate must be between 0 and 1, got %s", rate)
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("interval must be positive, got %s", interval)
+	}
+
+	return &POV{rate: rate, interval: interval}, nil
+}
+
+func (p *POV) Name() string {
+	return "pov"
+}
+
+func (p *POV) Start(ctx context.Context, parent order.Order, client trading.Client) error {
+	streamer, ok := client.(trading.TradeStreamer)
+	if !ok {
+		return errors.New("pov needs public trades, which the exchange does not stream")
+	}
+
+	trades, err := streamer.StreamTrades(ctx, trading.NewInstrument(parent.Base, parent.Quote))
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for trade := range trades {
+			p.mu.Lock()
+			p.volume = p.volume.Add(trade.Size)
+			p.mu.Unlock()
+		}
+	}()
+
+	return nil
+}
+
+// Volume is the volume traded since the parent started.
+func (p *POV) Volume() decimal.Decimal {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.volume
+}
+
+func (p *POV) Next(s State) (decimal.Decimal, time.Duration) {
+	amount := p.Volume().Mul(p.rate).Sub(s.Executed).Sub(s.Pending)
+	if !amount.IsPositive() {
+		return decimal.Zero, p.interval
+	}
+
+	return amount, p.interval
+}
@@ -0,0 +1,82 @@
+package algo
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// schedule spaces slices evenly over a duration. After the last slice,
+// slices are due once per interval to retry whatever did not fill.
+type schedule struct {
+	duration time.Duration
+	interval time.Duration
+	times    []time.Duration
+	next     int
+}
+
+// newSchedule moves each slice randomly by up to half of jitter, a fraction
+// in [0, 1], times the slice interval, so that child orders do not arrive at
+// a predictable rhythm.
+func newSchedule(duration time.Duration, slices int, jitter float64) (schedule, error) {
+	if duration <= 0 {
+		return schedule{}, fmt.Errorf("duration must be positive, got %s", duration)
+	}
+	if slices <= 0 {
+		return schedule{}, fmt.Errorf("slices must be positive, got %d", slices)
+	}
+	if jitter < 0 || jitter > 1 {
+		return schedule{}, fmt.Errorf("jitter must be between 0 and 1, got %g", jitter)
+	}
+
+	s := schedule{
+		duration: duration,
+		interval: duration / time.Duration(slices),
+		times:    make([]time.Duration, slices),
+	}
+	for i := range s.times {
+		at := time.Duration(i)*s.interval + time.Duration((rand.Float64()-0.5)*jitter*float64(s.interval))
+		if at < 0 {
+			at = 0
+		}
+		s.times[i] = at
+	}
+
+	return s, nil
+}
+
+// due reports whether a slice is due after elapsed running time and, if so,
+// moves past it; slice is its index, len(times) or more for the retries
+// after the schedule. wait is the time until the next slice is due.
+func (s *schedule) due(elapsed time.Duration) (slice int, wait time.Duration, ok bool) {
+	if s.next >= len(s.times) {
+		s.next++
+		return s.next - 1, s.interval, true
+	}
+
+	if elapsed < s.times[s.next] {
+		return 0, s.times[s.next] - elapsed, false
+	}
+
+	slice = s.next
+	s.next++
+
+	wait = s.interval
+	if s.next < len(s.times) {
+		wait = s.times[s.next] - elapsed
+		if wait < 0 {
+			wait = 0
+		}
+	}
+
+	return slice, wait, true
+}
+
+// end is the running time by which a slice should be done.
+func (s *schedule) end(slice int) time.Duration {
+	if slice+1 < len(s.times) {
+		return s.times[slice+1]
+	}
+
+	return s.duration
+}
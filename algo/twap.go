@@ -0,0 +1,44 @@
+package algo
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// TWAP spreads a parent evenly over a duration in a number of slices. Each
+// slice is the remaining amount divided by the slices left, so that a slice
+// that failed or filled short is made up by the later ones. Whatever remains
+// after the last slice is retried once per slice interval.
+type TWAP struct {
+	schedule schedule
+}
+
+// NewTWAP schedules the slices, moved randomly by up to half of jitter, a
+// fraction in [0, 1], times the slice interval.
+func NewTWAP(duration time.Duration, slices int, jitter float64) (*TWAP, error) {
+	s, err := newSchedule(duration, slices, jitter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TWAP{schedule: s}, nil
+}
+
+func (t *TWAP) Name() string {
+	return "twap"
+}
+
+func (t *TWAP) Next(s State) (decimal.Decimal, time.Duration) {
+	slice, wait, ok := t.schedule.due(s.Elapsed)
+	if !ok {
+		return decimal.Zero, wait
+	}
+
+	slicesLeft := int64(len(t.schedule.times) - slice)
+	if slicesLeft <= 1 {
+		return s.Remaining(), wait
+	}
+
+	return s.Remaining().Div(decimal.NewFromInt(slicesLeft)), wait
+}
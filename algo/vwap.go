@@ -0,0 +1,159 @@
+package algo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/order"
+	"trading-aggregator/trading"
+)
+
+const day = 24 * time.Hour
+
+// ProfileBucket is the kline interval VWAP profiles are built from; every
+// supported venue serves it.
+const ProfileBucket = 15 * time.Minute
+
+// VolumeProfile is the average volume traded in each bucket of a UTC day.
+type VolumeProfile struct {
+	Bucket  time.Duration
+	Volumes []decimal.Decimal
+}
+
+// LoadVolumeProfile averages the klines of the days before now per time of
+// day.
+func LoadVolumeProfile(client trading.KlineClient, base, quote string, bucket time.Duration, days int, now time.Time) (VolumeProfile, error) {
+	if bucket <= 0 || day%bucket != 0 {
+		return VolumeProfile{}, fmt.Errorf("bucket %s does not divide a day", bucket)
+	}
+	if days <= 0 {
+		return VolumeProfile{}, fmt.Errorf("days must be positive, got %d", days)
+	}
+
+	end := now.UTC().Truncate(bucket)
+	klines, err := client.GetKlines(trading.KlinesRequest{
+		Base:     base,
+		Quote:    quote,
+		Interval: bucket,
+		Start:    end.Add(-time.Duration(days) * day),
+		End:      end,
+	})
+	if err != nil {
+		return VolumeProfile{}, err
+	}
+
+	profile := VolumeProfile{
+		Bucket:  bucket,
+		Volumes: make([]decimal.Decimal, day/bucket),
+	}
+	for _, kline := range klines {
+		i := profile.bucket(kline.Time)
+		profile.Volumes[i] = profile.Volumes[i].Add(kline.Volume)
+	}
+	for i := range profile.Volumes {
+		profile.Volumes[i] = profile.Volumes[i].Div(decimal.NewFromInt(int64(days)))
+	}
+
+	return profile, nil
+}
+
+func (p VolumeProfile) bucket(t time.Time) int {
+	return int(t.UTC().Sub(t.UTC().Truncate(day)) / p.Bucket)
+}
+
+// Volume is the volume expected between from and to, taking the part of a
+// bucket's volume that the range covers.
+func (p VolumeProfile) Volume(from, to time.Time) decimal.Decimal {
+	var volume decimal.Decimal
+	for t := from; t.Before(to); {
+		next := t.Truncate(p.Bucket).Add(p.Bucket)
+		if next.After(to) {
+			next = to
+		}
+
+		share := decimal.NewFromInt(int64(next.Sub(t))).Div(decimal.NewFromInt(int64(p.Bucket)))
+		volume = volume.Add(p.Volumes[p.bucket(t)].Mul(share))
+		t = next
+	}
+
+	return volume
+}
+
+// VWAP spreads a parent over a duration in proportion to the volume usually
+// traded in each part of it, so that it follows the day's volume curve. The
+// profile is loaded from the venue's klines of the last days when the parent
+// starts. Each slice tops the parent up to the share of the expected volume
+// up to the end of the slice, so that short fills are made up later, and
+// what remains after the last slice is retried once per slice interval.
+type VWAP struct {
+	schedule schedule
+	days     int
+	profile  VolumeProfile
+	start    time.Time
+	total    decimal.Decimal
+}
+
+func NewVWAP(duration time.Duration, slices, days int) (*VWAP, error) {
+	s, err := newSchedule(duration, slices, 0)
+	if err != nil {
+		return nil, err
+	}
+	if days <= 0 {
+		return nil, fmt.Errorf("days must be positive, got %d", days)
+	}
+
+	return &VWAP{schedule: s, days: days}, nil
+}
+
+func (v *VWAP) Name() string {
+	return "vwap"
+}
+
+func (v *VWAP) Start(ctx context.Context, parent order.Order, client trading.Client) error {
+	klineClient, ok := client.(trading.KlineClient)
+	if !ok {
+		return errors.New("vwap needs klines, which the exchange does not serve")
+	}
+
+	v.start = time.Now()
+	profile, err := LoadVolumeProfile(klineClient, parent.Base, parent.Quote, ProfileBucket, v.days, v.start)
+	if err != nil {
+		return err
+	}
+	v.profile = profile
+	v.total = profile.Volume(v.start, v.start.Add(v.schedule.duration))
+
+	return nil
+}
+
+// share is the fraction of the parent's expected volume traded in its first
+// elapsed running time. Without any expected volume it falls back to time.
+func (v *VWAP) share(elapsed time.Duration) decimal.Decimal {
+	if elapsed >= v.schedule.duration {
+		return decimal.NewFromInt(1)
+	}
+	if !v.total.IsPositive() {
+		return decimal.NewFromInt(int64(elapsed)).Div(decimal.NewFromInt(int64(v.schedule.duration)))
+	}
+
+	return v.profile.Volume(v.start, v.start.Add(elapsed)).Div(v.total)
+}
+
+func (v *VWAP) Next(s State) (decimal.Decimal, time.Duration) {
+	slice, wait, ok := v.schedule.due(s.Elapsed)
+	if !ok {
+		return decimal.Zero, wait
+	}
+
+	target := s.Amount.Mul(v.share(v.schedule.end(slice)))
+	amount := target.Sub(s.Executed).Sub(s.Pending)
+	if !amount.IsPositive() {
+		return decimal.Zero, wait
+	}
+
+	return amount, wait
+}
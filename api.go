@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"trading-aggregator/auth"
+)
+
+// apiClient calls the API of a running service, signing the requests with
+// an API key given by flags or the environment.
+type apiClient struct {
+	address *string
+	keyID   *string
+	secret  *string
+}
+
+func newAPIClient(flags *flag.FlagSet, keyUsage string) apiClient {
+	return apiClient{
+		address: flags.String("address", "http://localhost:8888", "base url of the service"),
+		keyID:   flags.String("key", os.Getenv("AGGREGATOR_API_KEY"), keyUsage),
+		secret:  flags.String("secret", os.Getenv("AGGREGATOR_API_SECRET"), "secret of the API key"),
+	}
+}
+
+// do sends a signed request and returns the status and body of the response.
+func (c apiClient) do(method, target string, body []byte) (int, []byte, error) {
+	req, err := http.NewRequest(method, *c.address+target, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	nonce := uuid.NewString()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(auth.APIKeyHeader, *c.keyID)
+	req.Header.Set(auth.TimestampHeader, timestamp)
+	req.Header.Set(auth.NonceHeader, nonce)
+	req.Header.Set(auth.SignatureHeader, auth.Sign(*c.secret, timestamp, nonce, method, req.URL.RequestURI(), body))
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return res.StatusCode, resBody, nil
+}
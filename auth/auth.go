@@ -0,0 +1,285 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/trading"
+)
+
+const (
+	APIKeyHeader    = "X-API-Key"
+	TimestampHeader = "X-API-Timestamp"
+	NonceHeader     = "X-API-Nonce"
+	SignatureHeader = "X-API-Signature"
+
+	PermissionRead  = "read"
+	PermissionBuy   = "buy"
+	PermissionSell  = "sell"
+	PermissionAdmin = "admin"
+
+	Wildcard = "*"
+)
+
+var (
+	ErrUnauthenticated = errors.New("unauthenticated")
+	ErrForbidden       = errors.New("forbidden")
+)
+
+// Key is an API key and the scopes it is allowed to act on. Exchanges and
+// Symbols accept "*" to allow everything; symbols are written as BASE/QUOTE.
+// MaxNotional is expressed in the quote asset of the order and left empty for
+// no limit.
+type Key struct {
+	ID          string   `json:"id" yaml:"id" toml:"id"`
+	Secret      string   `json:"secret" yaml:"secret" toml:"secret"`
+	Exchanges   []string `json:"exchanges" yaml:"exchanges" toml:"exchanges"`
+	Symbols     []string `json:"symbols" yaml:"symbols" toml:"symbols"`
+	Permissions []string `json:"permissions" yaml:"permissions" toml:"permissions"`
+	MaxNotional string   `json:"max_notional" yaml:"max_notional" toml:"max_notional"`
+}
+
+func (k Key) Validate() error {
+	if k.ID == "" {
+		return errors.New("api key has no id")
+	}
+	if k.Secret == "" {
+		return fmt.Errorf("api key %s has no secret", k.ID)
+	}
+	for _, p := range k.Permissions {
+		if p != PermissionRead && p != PermissionBuy && p != PermissionSell && p != PermissionAdmin {
+			return fmt.Errorf("api key %s has unknown permission %q", k.ID, p)
+		}
+	}
+	if k.MaxNotional != "" {
+		_, err := decimal.NewFromString(k.MaxNotional)
+		if err != nil {
+			return fmt.Errorf("api key %s has invalid max notional: %w", k.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (k Key) CanRead() bool {
+	return len(k.Permissions) > 0
+}
+
+// IsAdmin reports whether the key may operate the service as a whole, such
+// as engaging the kill switch.
+func (k Key) IsAdmin() bool {
+	for _, p := range k.Permissions {
+		if p == PermissionAdmin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AuthorizeExchange accepts an exchange account such as "binance:hedge" when
+// the key allows either that account or the whole exchange.
+func (k Key) AuthorizeExchange(account string) error {
+	exchange, _ := trading.ParseAccount(account)
+	if !contains(k.Exchanges, trading.AccountName(account)) && !contains(k.Exchanges, exchange) {
+		return fmt.Errorf("%w: exchange %s is not allowed", ErrForbidden, account)
+	}
+
+	return nil
+}
+
+// AuthorizeTrade checks every scope of the key except the notional, which
+// needs a price and is checked by AuthorizeNotional.
+func (k Key) AuthorizeTrade(exchange, side, base, quote string) error {
+	err := k.AuthorizeExchange(exchange)
+	if err != nil {
+		return err
+	}
+
+	side = strings.ToLower(side)
+	if !contains(k.Permissions, side) {
+		return fmt.Errorf("%w: %s is not allowed", ErrForbidden, side)
+	}
+
+	symbol := trading.NewInstrument(base, quote).String()
+	if !contains(k.Symbols, symbol) {
+		return fmt.Errorf("%w: symbol %s is not allowed", ErrForbidden, symbol)
+	}
+
+	return nil
+}
+
+func (k Key) HasMaxNotional() bool {
+	return k.MaxNotional != ""
+}
+
+func (k Key) AuthorizeNotional(notional decimal.Decimal) error {
+	if !k.HasMaxNotional() {
+		return nil
+	}
+
+	maxNotional, err := decimal.NewFromString(k.MaxNotional)
+	if err != nil {
+		return err
+	}
+	if notional.GreaterThan(maxNotional) {
+		return fmt.Errorf("%w: notional %s exceeds max notional %s", ErrForbidden, notional, maxNotional)
+	}
+
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == Wildcard || strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type Config struct {
+	Keys []Key
+	// Window is how far the request timestamp may drift from the server clock.
+	// Nonces are remembered for the same duration.
+	Window time.Duration
+}
+
+// Authenticator verifies requests signed as
+// hex(HMAC-SHA256(secret, timestamp + nonce + method + requestURI + body)).
+type Authenticator struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu     sync.Mutex
+	keys   map[string]Key
+	nonces map[string]time.Time
+}
+
+func NewAuthenticator(config Config) (*Authenticator, error) {
+	if config.Window <= 0 {
+		config.Window = 30 * time.Second
+	}
+
+	a := &Authenticator{
+		window: config.Window,
+		now:    time.Now,
+		nonces: make(map[string]time.Time),
+	}
+
+	err := a.SetKeys(config.Keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func (a *Authenticator) SetKeys(keys []Key) error {
+	byID := make(map[string]Key, len(keys))
+	for _, k := range keys {
+		err := k.Validate()
+		if err != nil {
+			return err
+		}
+		if _, ok := byID[k.ID]; ok {
+			return fmt.Errorf("duplicate api key %s", k.ID)
+		}
+		byID[k.ID] = k
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.keys = byID
+	return nil
+}
+
+// Key returns the current key with the given ID, e.g. to act on its behalf
+// later with the permissions it has by then.
+func (a *Authenticator) Key(id string) (Key, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	k, ok := a.keys[id]
+	return k, ok
+}
+
+func (a *Authenticator) Authenticate(r *http.Request, body []byte) (Key, error) {
+	keyID := r.Header.Get(APIKeyHeader)
+	timestamp := r.Header.Get(TimestampHeader)
+	nonce := r.Header.Get(NonceHeader)
+	signature := r.Header.Get(SignatureHeader)
+	if keyID == "" || timestamp == "" || nonce == "" || signature == "" {
+		return Key{}, fmt.Errorf("%w: missing authentication headers", ErrUnauthenticated)
+	}
+
+	millis, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return Key{}, fmt.Errorf("%w: invalid timestamp", ErrUnauthenticated)
+	}
+
+	now := a.now()
+	drift := now.Sub(time.UnixMilli(millis))
+	if drift > a.window || drift < -a.window {
+		return Key{}, fmt.Errorf("%w: timestamp outside of window", ErrUnauthenticated)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key, ok := a.keys[keyID]
+	if !ok {
+		return Key{}, fmt.Errorf("%w: unknown api key", ErrUnauthenticated)
+	}
+
+	expected := Sign(key.Secret, timestamp, nonce, r.Method, r.URL.RequestURI(), body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return Key{}, fmt.Errorf("%w: invalid signature", ErrUnauthenticated)
+	}
+
+	for n, t := range a.nonces {
+		if now.Sub(t) > 2*a.window {
+			delete(a.nonces, n)
+		}
+	}
+
+	nonceKey := keyID + ":" + nonce
+	if _, ok := a.nonces[nonceKey]; ok {
+		return Key{}, fmt.Errorf("%w: nonce already used", ErrUnauthenticated)
+	}
+	a.nonces[nonceKey] = now
+
+	return key, nil
+}
+
+func Sign(secret, timestamp, nonce, method, requestURI string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + nonce + method + requestURI))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+type contextKey struct{}
+
+func WithKey(ctx context.Context, key Key) context.Context {
+	return context.WithValue(ctx, contextKey{}, key)
+}
+
+func KeyFromContext(ctx context.Context) (Key, bool) {
+	key, ok := ctx.Value(contextKey{}).(Key)
+	return key, ok
+}
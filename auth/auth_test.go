@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAuthenticator_Authenticate(t *testing.T) {
+	key := Key{ID: "key", Secret: "secret", Permissions: []string{PermissionRead}}
+	a, err := NewAuthenticator(Config{Keys: []Key{key}, Window: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	a.now = func() time.Time { return now }
+
+	request := func(timestamp time.Time, nonce, secret string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/orders/1?x=y", nil)
+		ts := strconv.FormatInt(timestamp.UnixMilli(), 10)
+		r.Header.Set(APIKeyHeader, key.ID)
+		r.Header.Set(TimestampHeader, ts)
+		r.Header.Set(NonceHeader, nonce)
+		r.Header.Set(SignatureHeader, Sign(secret, ts, nonce, r.Method, r.URL.RequestURI(), nil))
+		return r
+	}
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		ok   bool
+	}{
+		{"valid", request(now, "1", "secret"), true},
+		{"replayed nonce", request(now, "1", "secret"), false},
+		{"wrong secret", request(now, "2", "wrong"), false},
+		{"stale timestamp", request(now.Add(-2*time.Minute), "3", "secret"), false},
+		{"future timestamp", request(now.Add(2*time.Minute), "4", "secret"), false},
+		{"missing headers", httptest.NewRequest(http.MethodGet, "/orders/1", nil), false},
+	}
+
+	for _, tt := range tests {
+		_, err := a.Authenticate(tt.req, nil)
+		if tt.ok && err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("%s: got error %v", tt.name, err)
+		}
+	}
+}
+
+func TestNewAuthenticator_InvalidKey(t *testing.T) {
+	_, err := NewAuthenticator(Config{Keys: []Key{{ID: "key", Secret: "secret", Permissions: []string{"withdraw"}}}})
+	if err == nil {
+		t.Fatal("expected error for unknown permission")
+	}
+}
@@ -0,0 +1,49 @@
+package binance
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/trading"
+)
+
+type accountResponse struct {
+	Balances []struct {
+		Asset  string          `json:"asset"`
+		Free   decimal.Decimal `json:"free"`
+		Locked decimal.Decimal `json:"locked"`
+	} `json:"balances"`
+}
+
+func (c *client) GetBalances() ([]trading.Balance, error) {
+	q := c.timestampQuery()
+	q.Set("omitZeroBalances", "true")
+
+	resBody, err := c.signed(http.MethodGet, "/api/v3/account", q.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	var account accountResponse
+	err = json.Unmarshal(resBody, &account)
+	if err != nil {
+		return nil, err
+	}
+
+	var balances []trading.Balance
+	for _, b := range account.Balances {
+		if b.Free.IsZero() && b.Locked.IsZero() {
+			continue
+		}
+
+		balances = append(balances, trading.Balance{
+			Asset:  b.Asset,
+			Free:   b.Free,
+			Locked: b.Locked,
+		})
+	}
+
+	return balances, nil
+}
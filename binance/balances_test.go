@@ -0,0 +1,30 @@
+package binance
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"trading-aggregator/trading"
+)
+
+func TestClient_GetBalances(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/account", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, `{"balances":[{"asset":"BTC","free":"0.5","locked":"0.1"},{"asset":"ETH","free":"0","locked":"0"}]}`)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient(Config{URL: server.URL, APIKey: "key", APISecret: "secret"}, server.Client())
+
+	balances, err := c.(trading.BalanceClient).GetBalances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(balances) != 1 || balances[0].Asset != "BTC" || balances[0].Free.String() != "0.5" || balances[0].Locked.String() != "0.1" {
+		t.Fatalf("got %+v", balances)
+	}
+}
@@ -11,23 +11,31 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
 
+	"github.com/shopspring/decimal"
+
 	"trading-aggregator/trading"
 )
 
 type Config struct {
-	URL       string
-	APIKey    string
-	APISecret string
+	URL           string
+	StreamURL     string
+	MarketDataURL string
+	APIKey        string
+	APISecret     string
 }
 
 type placeOrderRequest struct {
 	Symbol        string `json:"symbol"`
 	Side          string `json:"side"`
 	Quantity      string `json:"quantity"`
+	QuoteOrderQty string `json:"quoteOrderQty"`
 	Type          string `json:"type"`
+	Price         string `json:"price"`
+	TimeInForce   string `json:"timeInForce"`
+	StopPrice     string `json:"stopPrice"`
 	ClientOrderID string `json:"newClientOrderId"`
 	Timestamp     int64  `json:"timestamp"`
 }
@@ -42,7 +50,18 @@ func (r *placeOrderRequest) String() string {
 	u["symbol"] = []string{r.Symbol}
 	u["side"] = []string{r.Side}
 	u["type"] = []string{r.Type}
-	u["quantity"] = []string{r.Quantity}
+	if r.QuoteOrderQty != "" {
+		u["quoteOrderQty"] = []string{r.QuoteOrderQty}
+	} else {
+		u["quantity"] = []string{r.Quantity}
+	}
+	if r.Price != "" {
+		u["price"] = []string{r.Price}
+		u["timeInForce"] = []string{r.TimeInForce}
+	}
+	if r.StopPrice != "" {
+		u["stopPrice"] = []string{r.StopPrice}
+	}
 	u["newClientOrderId"] = []string{r.ClientOrderID}
 	u["timestamp"] = []string{strconv.FormatInt(r.Timestamp, 10)}
 
@@ -57,11 +76,11 @@ type getOrderDetailRequest struct {
 }
 
 type getOrderDetailResponse struct {
-	Symbol              string `json:"symbol"`
-	ClientOrderID       string `json:"clientOrderId"`
-	Status              string `json:"status"`
-	ExecutedQty         string `json:"executedQty"`
-	CummulativeQuoteQty string `json:"cummulativeQuoteQty"`
+	Symbol              string          `json:"symbol"`
+	ClientOrderID       string          `json:"clientOrderId"`
+	Status              string          `json:"status"`
+	ExecutedQty         decimal.Decimal `json:"executedQty"`
+	CummulativeQuoteQty decimal.Decimal `json:"cummulativeQuoteQty"`
 }
 
 func (r *getOrderDetailRequest) String() string {
@@ -78,33 +97,69 @@ func (r *getOrderDetailRequest) String() string {
 	return u.Encode()
 }
 
-type errorResponse struct {
-	Code int    `json:"code"`
-	Msg  string `json:"msg"`
+type client struct {
+	config      Config
+	hmacMu      sync.Mutex
+	hmac        hash.Hash
+	httpClient  *http.Client
+	clock       clock
+	instruments *trading.Instruments
 }
 
-type client struct {
-	config     Config
-	hmac       hash.Hash
-	httpClient *http.Client
+func init() {
+	trading.RegisterAdapter(trading.Adapter{
+		Name: "binance",
+		Capabilities: trading.Capabilities{
+			Spot:             true,
+			LimitOrders:      true,
+			QuoteSizeOrders:  true,
+			StopOrders:       true,
+			StopMarketOrders: true,
+			OCOOrders:        true,
+			WebSocket:        true,
+			OrderBook:        true,
+			Klines:           true,
+			Trades:           true,
+		},
+		Factory: func(config trading.AdapterConfig) (trading.Client, error) {
+			return NewClient(Config{
+				URL:           config.URL,
+				StreamURL:     config.StreamURL,
+				MarketDataURL: config.MarketDataURL,
+				APIKey:        config.APIKey,
+				APISecret:     config.APISecret,
+			}, config.HTTPClient), nil
+		},
+	})
 }
 
 func NewClient(config Config, httpClient *http.Client) trading.Client {
+	c := newClient(config, httpClient, "/api/v3/time")
+	c.instruments = trading.NewInstruments(c.getInstruments, time.Hour)
+
+	return c
+}
+
+// newClient returns the REST client shared by the spot and futures
+// adapters, whose server time is at timePath.
+func newClient(config Config, httpClient *http.Client, timePath string) *client {
 	return &client{
 		config:     config,
 		hmac:       hmac.New(sha256.New, []byte(config.APISecret)),
 		httpClient: httpClient,
+		clock:      clock{path: timePath},
 	}
 }
 
 func (c *client) Sell(req trading.SellRequest) (trading.SellResponse, error) {
-	body := placeOrderRequest{
-		Symbol:        fmt.Sprintf("%s%s", req.Base, req.Quote),
-		Side:          "SELL",
-		Quantity:      req.Amount,
-		Type:          "MARKET",
-		ClientOrderID: req.ClientOrderID,
-		Timestamp:     time.Now().UTC().UnixMilli(),
+	listing, err := c.instruments.Tradable(trading.NewInstrument(req.Base, req.Quote))
+	if err != nil {
+		return trading.SellResponse{}, err
+	}
+
+	body, err := newPlaceOrderRequest(listing, "SELL", req.TradeRequest)
+	if err != nil {
+		return trading.SellResponse{}, err
 	}
 
 	sellResponse, err := c.placeOrder(body)
@@ -120,13 +175,14 @@ func (c *client) Sell(req trading.SellRequest) (trading.SellResponse, error) {
 }
 
 func (c *client) Buy(req trading.BuyRequest) (trading.BuyResponse, error) {
-	body := placeOrderRequest{
-		Symbol:        fmt.Sprintf("%s%s", req.Base, req.Quote),
-		Side:          "BUY",
-		Quantity:      req.Amount,
-		Type:          "MARKET",
-		ClientOrderID: req.ClientOrderID,
-		Timestamp:     time.Now().UTC().UnixMilli(),
+	listing, err := c.instruments.Tradable(trading.NewInstrument(req.Base, req.Quote))
+	if err != nil {
+		return trading.BuyResponse{}, err
+	}
+
+	body, err := newPlaceOrderRequest(listing, "BUY", req.TradeRequest)
+	if err != nil {
+		return trading.BuyResponse{}, err
 	}
 
 	sellResponse, err := c.placeOrder(body)
@@ -141,45 +197,76 @@ func (c *client) Buy(req trading.BuyRequest) (trading.BuyResponse, error) {
 	}, nil
 }
 
-func (c *client) placeOrder(req placeOrderRequest) (placeOrderResponse, error) {
-	u, err := url.Parse(c.config.URL + "/api/v3/order")
+func newPlaceOrderRequest(listing trading.Listing, side string, req trading.TradeRequest) (placeOrderRequest, error) {
+	err := req.Validate()
 	if err != nil {
-		return placeOrderResponse{}, err
+		return placeOrderRequest{}, err
 	}
 
-	bodyStr := req.String()
-
-	signature := c.sign("", bodyStr)
+	body := placeOrderRequest{
+		Symbol:        listing.Symbol,
+		Side:          side,
+		Type:          "MARKET",
+		ClientOrderID: req.ClientOrderID,
+	}
 
-	query := u.Query()
-	query.Add("signature", signature)
-	u.RawQuery = query.Encode()
+	if req.IsQuoteSized() {
+		body.QuoteOrderQty, err = listing.FormatQuote(req.QuoteAmount)
+		return body, err
+	}
 
-	httpReq, err := http.NewRequest(http.MethodPost, u.String(), strings.NewReader(bodyStr))
+	body.Quantity, err = listing.FormatBase(req.Amount)
 	if err != nil {
-		return placeOrderResponse{}, err
+		return placeOrderRequest{}, err
 	}
 
-	httpReq.Header = c.createHeader()
+	if req.IsLimit() {
+		body.Type = "LIMIT"
+		body.TimeInForce = string(trading.GoodTillCanceled)
+		if req.TimeInForce != "" {
+			body.TimeInForce = string(req.TimeInForce)
+		}
 
-	res, err := c.httpClient.Do(httpReq)
-	if err != nil {
-		return placeOrderResponse{}, err
+		body.Price, err = listing.FormatLimitPrice(req.Price, side == "SELL")
+		if err != nil {
+			return placeOrderRequest{}, err
+		}
 	}
 
-	resBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		return placeOrderResponse{}, err
-	}
+	if req.IsStop() {
+		// Binance infers the direction from the type and the side: a sell
+		// STOP_LOSS triggers on a falling price, a sell TAKE_PROFIT on a
+		// rising one, and the reverse for buys.
+		stopLoss := (side == "SELL") == (req.StopDirection == trading.StopFalling)
+		body.Type = stopType(stopLoss, req.IsLimit())
 
-	if res.StatusCode != http.StatusOK {
-		var errorResponse errorResponse
-		err = json.Unmarshal(resBody, &errorResponse)
-		if err == nil {
-			return placeOrderResponse{}, fmt.Errorf("get http response code %d and error %v", res.StatusCode, errorResponse)
+		body.StopPrice, err = listing.FormatPrice(req.StopPrice)
+		if err != nil {
+			return placeOrderRequest{}, err
 		}
+	}
+
+	return body, nil
+}
+
+func stopType(stopLoss, limit bool) string {
+	t := "TAKE_PROFIT"
+	if stopLoss {
+		t = "STOP_LOSS"
+	}
+	if limit {
+		t += "_LIMIT"
+	}
+
+	return t
+}
 
-		return placeOrderResponse{}, fmt.Errorf("get http response code %d and body %s", res.StatusCode, resBody)
+func (c *client) placeOrder(req placeOrderRequest) (placeOrderResponse, error) {
+	req.Timestamp = c.now().UnixMilli()
+
+	resBody, err := c.send(http.MethodPost, "/api/v3/order", "", req.String())
+	if err != nil {
+		return placeOrderResponse{}, err
 	}
 
 	var response placeOrderResponse
@@ -192,47 +279,23 @@ func (c *client) placeOrder(req placeOrderRequest) (placeOrderResponse, error) {
 }
 
 func (c *client) GetOrderDetail(req trading.GetOrderDetailRequest) (trading.GetOrderDetailResponse, error) {
-	u, err := url.Parse(c.config.URL + "/api/v3/order")
+	symbol, err := c.instruments.Symbol(trading.NewInstrument(req.Base, req.Quote))
 	if err != nil {
 		return trading.GetOrderDetailResponse{}, err
 	}
 
 	q := getOrderDetailRequest{
-		Symbol:        fmt.Sprintf("%s%s", req.Base, req.Quote),
+		Symbol:        symbol,
 		OrderID:       req.OrderID,
 		ClientOrderID: req.ClientOrderID,
-		Timestamp:     time.Now().UTC().UnixMilli(),
+		Timestamp:     c.now().UnixMilli(),
 	}
-	qStr := q.String()
-	u.RawQuery = qStr
-
-	signature := c.sign(qStr, "")
 
-	query := u.Query()
-	query.Add("signature", signature)
-	u.RawQuery = query.Encode()
-
-	httpReq, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	resBody, err := c.signed(http.MethodGet, "/api/v3/order", q.String())
 	if err != nil {
 		return trading.GetOrderDetailResponse{}, err
 	}
 
-	httpReq.Header = c.createHeader()
-
-	res, err := c.httpClient.Do(httpReq)
-	if err != nil {
-		return trading.GetOrderDetailResponse{}, err
-	}
-
-	resBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		return trading.GetOrderDetailResponse{}, err
-	}
-
-	if res.StatusCode != http.StatusOK {
-		return trading.GetOrderDetailResponse{}, fmt.Errorf("get http response code %d and body %s", res.StatusCode, resBody)
-	}
-
 	var getOrderStatusResponse getOrderDetailResponse
 	err = json.Unmarshal(resBody, &getOrderStatusResponse)
 	if err != nil {
@@ -247,6 +310,9 @@ func (c *client) GetOrderDetail(req trading.GetOrderDetailRequest) (trading.GetO
 }
 
 func (c *client) sign(query, body string) string {
+	c.hmacMu.Lock()
+	defer c.hmacMu.Unlock()
+
 	c.hmac.Reset()
 	c.hmac.Write([]byte(query + body))
 
@@ -259,3 +325,144 @@ func (c *client) createHeader() http.Header {
 	header.Set("X-MBX-APIKEY", c.config.APIKey)
 	return header
 }
+
+type getPriceResponse struct {
+	Symbol string          `json:"symbol"`
+	Price  decimal.Decimal `json:"price"`
+}
+
+func (c *client) GetPrice(req trading.GetPriceRequest) (trading.GetPriceResponse, error) {
+	u, err := url.Parse(c.config.URL + "/api/v3/ticker/price")
+	if err != nil {
+		return trading.GetPriceResponse{}, err
+	}
+
+	symbol, err := c.instruments.Symbol(trading.NewInstrument(req.Base, req.Quote))
+	if err != nil {
+		return trading.GetPriceResponse{}, err
+	}
+
+	query := u.Query()
+	query.Add("symbol", symbol)
+	u.RawQuery = query.Encode()
+
+	httpReq, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return trading.GetPriceResponse{}, err
+	}
+
+	res, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return trading.GetPriceResponse{}, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return trading.GetPriceResponse{}, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return trading.GetPriceResponse{}, fmt.Errorf("get http response code %d and body %s", res.StatusCode, resBody)
+	}
+
+	var getPriceResponse getPriceResponse
+	err = json.Unmarshal(resBody, &getPriceResponse)
+	if err != nil {
+		return trading.GetPriceResponse{}, err
+	}
+
+	return trading.GetPriceResponse{
+		Price: getPriceResponse.Price,
+	}, nil
+}
+
+type exchangeInfoResponse struct {
+	Symbols []struct {
+		Symbol              string         `json:"symbol"`
+		Status              string         `json:"status"`
+		BaseAsset           string         `json:"baseAsset"`
+		QuoteAsset          string         `json:"quoteAsset"`
+		QuoteAssetPrecision int32          `json:"quoteAssetPrecision"`
+		ContractType        string         `json:"contractType"` // futures only
+		Filters             []symbolFilter `json:"filters"`
+	} `json:"symbols"`
+}
+
+type symbolFilter struct {
+	FilterType string          `json:"filterType"`
+	MinQty     decimal.Decimal `json:"minQty"`
+	StepSize   decimal.Decimal `json:"stepSize"`
+	TickSize   decimal.Decimal `json:"tickSize"`
+}
+
+func (c *client) ListInstruments() ([]trading.Listing, error) {
+	return c.instruments.List()
+}
+
+func (c *client) getInstruments() ([]trading.Listing, error) {
+	return c.exchangeInfo("/api/v3/exchangeInfo", "")
+}
+
+// exchangeInfo lists the symbols at path of the contract type, which spot
+// symbols have none of.
+func (c *client) exchangeInfo(path, contractType string) ([]trading.Listing, error) {
+	u, err := url.Parse(c.config.URL + path)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get http response code %d and body %s", res.StatusCode, resBody)
+	}
+
+	var exchangeInfoResponse exchangeInfoResponse
+	err = json.Unmarshal(resBody, &exchangeInfoResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	listings := make([]trading.Listing, 0, len(exchangeInfoResponse.Symbols))
+	for _, symbol := range exchangeInfoResponse.Symbols {
+		if symbol.ContractType != contractType {
+			continue
+		}
+
+		listing := trading.Listing{
+			Instrument:     trading.NewInstrument(symbol.BaseAsset, symbol.QuoteAsset),
+			Symbol:         symbol.Symbol,
+			Tradable:       symbol.Status == "TRADING",
+			QuoteIncrement: decimal.New(1, -symbol.QuoteAssetPrecision),
+		}
+
+		for _, filter := range symbol.Filters {
+			switch filter.FilterType {
+			case "LOT_SIZE":
+				listing.BaseIncrement = filter.StepSize
+				listing.MinBase = filter.MinQty
+			case "PRICE_FILTER":
+				listing.PriceIncrement = filter.TickSize
+			}
+		}
+
+		listings = append(listings, listing)
+	}
+
+	return listings, nil
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 
 	"trading-aggregator/trading"
 )
@@ -27,7 +28,7 @@ func TestClient_GetOrderDetail(t *testing.T) {
 		TradeRequest: trading.TradeRequest{
 			Base:          "SOL",
 			Quote:         "USDT",
-			Amount:        "0.0001",
+			Amount:        decimal.RequireFromString("0.0001"),
 			ClientOrderID: uuid.NewString(),
 		},
 	})
@@ -39,7 +40,7 @@ func TestClient_GetOrderDetail(t *testing.T) {
 		TradeRequest: trading.TradeRequest{
 			Base:          "SOL",
 			Quote:         "USDT",
-			Amount:        "0.0001",
+			Amount:        decimal.RequireFromString("0.0001"),
 			ClientOrderID: uuid.NewString(),
 		},
 	})
@@ -0,0 +1,66 @@
+package binance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"trading-aggregator/trading"
+)
+
+type openOrder struct {
+	Symbol  string `json:"symbol"`
+	OrderID int64  `json:"orderId"`
+}
+
+func (c *client) CancelOrder(req trading.CancelOrderRequest) error {
+	symbol, err := c.instruments.Symbol(trading.NewInstrument(req.Base, req.Quote))
+	if err != nil {
+		return err
+	}
+
+	// Cancellation takes the same parameters as the order query.
+	q := getOrderDetailRequest{
+		Symbol:        symbol,
+		OrderID:       req.OrderID,
+		ClientOrderID: req.ClientOrderID,
+		Timestamp:     c.now().UnixMilli(),
+	}
+
+	_, err = c.signed(http.MethodDelete, "/api/v3/order", q.String())
+	return err
+}
+
+// CancelAllOrders cancels the open orders symbol by symbol, since Binance
+// only cancels all orders of one symbol at a time.
+func (c *client) CancelAllOrders() error {
+	resBody, err := c.signed(http.MethodGet, "/api/v3/openOrders", c.timestampQuery().Encode())
+	if err != nil {
+		return err
+	}
+
+	var orders []openOrder
+	err = json.Unmarshal(resBody, &orders)
+	if err != nil {
+		return err
+	}
+
+	symbols := map[string]bool{}
+	var errs []error
+	for _, o := range orders {
+		if symbols[o.Symbol] {
+			continue
+		}
+		symbols[o.Symbol] = true
+
+		q := c.timestampQuery()
+		q.Set("symbol", o.Symbol)
+		_, err = c.signed(http.MethodDelete, "/api/v3/openOrders", q.Encode())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cancel %s orders: %w", o.Symbol, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
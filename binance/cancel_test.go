@@ -0,0 +1,77 @@
+package binance
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"trading-aggregator/trading"
+)
+
+func TestClient_CancelOrder(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/exchangeInfo", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, `{"symbols":[{"symbol":"SOLUSDT","status":"TRADING","baseAsset":"SOL","quoteAsset":"USDT"}]}`)
+	})
+	mux.HandleFunc("/api/v3/order", func(rw http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.Method != http.MethodDelete || query.Get("symbol") != "SOLUSDT" || query.Get("signature") == "" {
+			t.Errorf("got %s %s", r.Method, r.URL.RawQuery)
+		}
+		if query.Get("orderId") != "42" {
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(rw, `{"code":-2011,"msg":"Unknown order sent."}`)
+			return
+		}
+
+		fmt.Fprint(rw, `{"symbol":"SOLUSDT","orderId":42,"status":"CANCELED"}`)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient(Config{URL: server.URL, APIKey: "key", APISecret: "secret"}, server.Client())
+
+	err := c.(trading.Canceler).CancelOrder(trading.CancelOrderRequest{Base: "SOL", Quote: "USDT", OrderID: "42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.(trading.Canceler).CancelOrder(trading.CancelOrderRequest{Base: "SOL", Quote: "USDT", OrderID: "43"})
+	if err == nil {
+		t.Fatal("canceled an unknown order")
+	}
+}
+
+func TestClient_CancelAllOrders(t *testing.T) {
+	var canceled []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/openOrders", func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("signature") == "" {
+			t.Errorf("unsigned request %s", r.URL.RawQuery)
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			fmt.Fprint(rw, `[{"symbol":"SOLUSDT","orderId":1},{"symbol":"BTCUSDT","orderId":2},{"symbol":"SOLUSDT","orderId":3}]`)
+		case http.MethodDelete:
+			canceled = append(canceled, r.URL.Query().Get("symbol"))
+			fmt.Fprint(rw, `[]`)
+		}
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient(Config{URL: server.URL, APIKey: "key", APISecret: "secret"}, server.Client())
+
+	err := c.(trading.CancelAller).CancelAllOrders()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(canceled) != 2 || canceled[0] != "SOLUSDT" || canceled[1] != "BTCUSDT" {
+		t.Fatalf("canceled %v", canceled)
+	}
+}
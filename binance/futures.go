@@ -0,0 +1,509 @@
+package binance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/trading"
+)
+
+// Error codes of the futures API for changes that were already made.
+const (
+	codeNoNeedToChangeMarginType = -4046
+)
+
+// incomeLimit is the most income records one request returns.
+const incomeLimit = 1000
+
+// futuresClient trades USDⓈ-M perpetuals on fapi.binance.com. It signs,
+// keeps time and maps errors like the spot client, whose REST client it
+// uses, but has endpoints of its own.
+type futuresClient struct {
+	rest        *client
+	instruments *trading.Instruments
+}
+
+func init() {
+	trading.RegisterAdapter(trading.Adapter{
+		Name: "binance_futures",
+		Capabilities: trading.Capabilities{
+			Derivatives:      true,
+			LimitOrders:      true,
+			StopOrders:       true,
+			StopMarketOrders: true,
+		},
+		Factory: func(config trading.AdapterConfig) (trading.Client, error) {
+			return NewFuturesClient(Config{
+				URL:       config.URL,
+				APIKey:    config.APIKey,
+				APISecret: config.APISecret,
+			}, config.HTTPClient), nil
+		},
+	})
+}
+
+// NewFuturesClient returns a trading.DerivativesClient of the USDⓈ-M futures
+// API at config.URL.
+func NewFuturesClient(config Config, httpClient *http.Client) trading.DerivativesClient {
+	c := &futuresClient{rest: newClient(config, httpClient, "/fapi/v1/time")}
+	c.instruments = trading.NewInstruments(func() ([]trading.Listing, error) {
+		return c.rest.exchangeInfo("/fapi/v1/exchangeInfo", "PERPETUAL")
+	}, time.Hour)
+
+	return c
+}
+
+func (c *futuresClient) ListInstruments() ([]trading.Listing, error) {
+	return c.instruments.List()
+}
+
+func (c *futuresClient) Sell(req trading.SellRequest) (trading.SellResponse, error) {
+	res, err := c.placeOrder("SELL", req.TradeRequest)
+	return trading.SellResponse{TradeResponse: res}, err
+}
+
+func (c *futuresClient) Buy(req trading.BuyRequest) (trading.BuyResponse, error) {
+	res, err := c.placeOrder("BUY", req.TradeRequest)
+	return trading.BuyResponse{TradeResponse: res}, err
+}
+
+func (c *futuresClient) placeOrder(side string, req trading.TradeRequest) (trading.TradeResponse, error) {
+	listing, err := c.instruments.Tradable(trading.NewInstrument(req.Base, req.Quote))
+	if err != nil {
+		return trading.TradeResponse{}, err
+	}
+
+	q, err := newFuturesOrderQuery(listing, side, req)
+	if err != nil {
+		return trading.TradeResponse{}, err
+	}
+	q.Set("timestamp", strconv.FormatInt(c.rest.now().UnixMilli(), 10))
+
+	resBody, err := c.rest.send(http.MethodPost, "/fapi/v1/order", "", q.Encode())
+	if err != nil {
+		return trading.TradeResponse{}, err
+	}
+
+	var response placeOrderResponse
+	err = json.Unmarshal(resBody, &response)
+	if err != nil {
+		return trading.TradeResponse{}, err
+	}
+
+	return trading.TradeResponse{OrderID: strconv.FormatInt(response.OrderID, 10)}, nil
+}
+
+func newFuturesOrderQuery(listing trading.Listing, side string, req trading.TradeRequest) (url.Values, error) {
+	err := req.Validate()
+	if err != nil {
+		return nil, err
+	}
+	if req.IsQuoteSized() {
+		return nil, errors.New("binance futures does not take quote sized orders")
+	}
+
+	quantity, err := listing.FormatBase(req.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	q := url.Values{}
+	q.Set("symbol", listing.Symbol)
+	q.Set("side", side)
+	q.Set("quantity", quantity)
+	q.Set("type", "MARKET")
+	if req.ClientOrderID != "" {
+		q.Set("newClientOrderId", req.ClientOrderID)
+	}
+
+	// In hedge mode the position side says whether an order opens or closes,
+	// and Binance rejects reduceOnly.
+	switch req.PositionIdx {
+	case trading.LongPosition:
+		q.Set("positionSide", "LONG")
+	case trading.ShortPosition:
+		q.Set("positionSide", "SHORT")
+	}
+	if req.ReduceOnly {
+		if req.PositionIdx != trading.OneWayPosition {
+			return nil, errors.New("reduce-only orders cannot pick a position in hedge mode")
+		}
+		q.Set("reduceOnly", "true")
+	}
+
+	if req.IsLimit() {
+		q.Set("type", "LIMIT")
+		timeInForce := trading.GoodTillCanceled
+		if req.TimeInForce != "" {
+			timeInForce = req.TimeInForce
+		}
+		q.Set("timeInForce", string(timeInForce))
+
+		price, err := listing.FormatLimitPrice(req.Price, side == "SELL")
+		if err != nil {
+			return nil, err
+		}
+		q.Set("price", price)
+	}
+
+	if req.IsStop() {
+		// Like spot, the direction follows from the type and the side, but
+		// futures stop types have no _LOSS and take _MARKET for market orders.
+		stopLoss := (side == "SELL") == (req.StopDirection == trading.StopFalling)
+		orderType := "TAKE_PROFIT"
+		if stopLoss {
+			orderType = "STOP"
+		}
+		if !req.IsLimit() {
+			orderType += "_MARKET"
+		}
+		q.Set("type", orderType)
+
+		stopPrice, err := listing.FormatPrice(req.StopPrice)
+		if err != nil {
+			return nil, err
+		}
+		q.Set("stopPrice", stopPrice)
+	}
+
+	return q, nil
+}
+
+type futuresOrderResponse struct {
+	Status      string          `json:"status"`
+	ExecutedQty decimal.Decimal `json:"executedQty"`
+	CumQuote    decimal.Decimal `json:"cumQuote"`
+}
+
+func (c *futuresClient) GetOrderDetail(req trading.GetOrderDetailRequest) (trading.GetOrderDetailResponse, error) {
+	q, err := c.orderQuery(req.Base, req.Quote, req.OrderID, req.ClientOrderID)
+	if err != nil {
+		return trading.GetOrderDetailResponse{}, err
+	}
+
+	resBody, err := c.rest.signed(http.MethodGet, "/fapi/v1/order", q)
+	if err != nil {
+		return trading.GetOrderDetailResponse{}, err
+	}
+
+	var response futuresOrderResponse
+	err = json.Unmarshal(resBody, &response)
+	if err != nil {
+		return trading.GetOrderDetailResponse{}, err
+	}
+
+	return trading.GetOrderDetailResponse{
+		Status:        response.Status,
+		ExecutedBase:  response.ExecutedQty,
+		ExecutedQuote: response.CumQuote,
+	}, nil
+}
+
+func (c *futuresClient) CancelOrder(req trading.CancelOrderRequest) error {
+	q, err := c.orderQuery(req.Base, req.Quote, req.OrderID, req.ClientOrderID)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.rest.signed(http.MethodDelete, "/fapi/v1/order", q)
+	return err
+}
+
+// orderQuery is the signed query of an order of the instrument, which
+// querying and canceling share.
+func (c *futuresClient) orderQuery(base, quote, orderID, clientOrderID string) (string, error) {
+	symbol, err := c.instruments.Symbol(trading.NewInstrument(base, quote))
+	if err != nil {
+		return "", err
+	}
+
+	q := getOrderDetailRequest{
+		Symbol:        symbol,
+		OrderID:       orderID,
+		ClientOrderID: clientOrderID,
+		Timestamp:     c.rest.now().UnixMilli(),
+	}
+
+	return q.String(), nil
+}
+
+// CancelAllOrders cancels the open orders symbol by symbol, like spot.
+func (c *futuresClient) CancelAllOrders() error {
+	resBody, err := c.rest.signed(http.MethodGet, "/fapi/v1/openOrders", c.rest.timestampQuery().Encode())
+	if err != nil {
+		return err
+	}
+
+	var orders []openOrder
+	err = json.Unmarshal(resBody, &orders)
+	if err != nil {
+		return err
+	}
+
+	symbols := map[string]bool{}
+	var errs []error
+	for _, o := range orders {
+		if symbols[o.Symbol] {
+			continue
+		}
+		symbols[o.Symbol] = true
+
+		q := c.rest.timestampQuery()
+		q.Set("symbol", o.Symbol)
+		_, err = c.rest.signed(http.MethodDelete, "/fapi/v1/allOpenOrders", q.Encode())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cancel %s orders: %w", o.Symbol, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *futuresClient) GetPrice(req trading.GetPriceRequest) (trading.GetPriceResponse, error) {
+	symbol, err := c.instruments.Symbol(trading.NewInstrument(req.Base, req.Quote))
+	if err != nil {
+		return trading.GetPriceResponse{}, err
+	}
+
+	resBody, err := c.rest.public("/fapi/v1/ticker/price", url.Values{"symbol": {symbol}})
+	if err != nil {
+		return trading.GetPriceResponse{}, err
+	}
+
+	var response getPriceResponse
+	err = json.Unmarshal(resBody, &response)
+	if err != nil {
+		return trading.GetPriceResponse{}, err
+	}
+
+	return trading.GetPriceResponse{Price: response.Price}, nil
+}
+
+type futuresBalance struct {
+	Asset            string          `json:"asset"`
+	Balance          decimal.Decimal `json:"balance"`
+	AvailableBalance decimal.Decimal `json:"availableBalance"`
+}
+
+// GetBalances reports the wallet balances of the futures account; what is
+// not available is held as margin.
+func (c *futuresClient) GetBalances() ([]trading.Balance, error) {
+	resBody, err := c.rest.signed(http.MethodGet, "/fapi/v2/balance", c.rest.timestampQuery().Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	var response []futuresBalance
+	err = json.Unmarshal(resBody, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	var balances []trading.Balance
+	for _, b := range response {
+		if b.Balance.IsZero() {
+			continue
+		}
+
+		balances = append(balances, trading.Balance{
+			Asset:  b.Asset,
+			Free:   b.AvailableBalance,
+			Locked: b.Balance.Sub(b.AvailableBalance),
+		})
+	}
+
+	return balances, nil
+}
+
+// SetLeverage sets the leverage of the instrument, which Binance only takes
+// in whole numbers.
+func (c *futuresClient) SetLeverage(req trading.SetLeverageRequest) error {
+	if !req.Leverage.IsPositive() || !req.Leverage.IsInteger() {
+		return fmt.Errorf("leverage must be a positive whole number, got %s", req.Leverage)
+	}
+
+	symbol, err := c.instruments.Symbol(trading.NewInstrument(req.Base, req.Quote))
+	if err != nil {
+		return err
+	}
+
+	q := c.rest.timestampQuery()
+	q.Set("symbol", symbol)
+	q.Set("leverage", req.Leverage.String())
+	_, err = c.rest.signed(http.MethodPost, "/fapi/v1/leverage", q.Encode())
+	return err
+}
+
+func (c *futuresClient) SetMarginType(req trading.SetMarginTypeRequest) error {
+	var marginType string
+	switch req.MarginType {
+	case trading.CrossMargin:
+		marginType = "CROSSED"
+	case trading.IsolatedMargin:
+		marginType = "ISOLATED"
+	default:
+		return fmt.Errorf("unknown margin type %q", req.MarginType)
+	}
+
+	symbol, err := c.instruments.Symbol(trading.NewInstrument(req.Base, req.Quote))
+	if err != nil {
+		return err
+	}
+
+	q := c.rest.timestampQuery()
+	q.Set("symbol", symbol)
+	q.Set("marginType", marginType)
+	_, err = c.rest.signed(http.MethodPost, "/fapi/v1/marginType", q.Encode())
+
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && apiErr.Code == codeNoNeedToChangeMarginType {
+		return nil
+	}
+
+	return err
+}
+
+type positionRisk struct {
+	Symbol           string          `json:"symbol"`
+	PositionSide     string          `json:"positionSide"`
+	PositionAmt      decimal.Decimal `json:"positionAmt"`
+	EntryPrice       decimal.Decimal `json:"entryPrice"`
+	MarkPrice        decimal.Decimal `json:"markPrice"`
+	LiquidationPrice decimal.Decimal `json:"liquidationPrice"`
+	Leverage         decimal.Decimal `json:"leverage"`
+	UnRealizedProfit decimal.Decimal `json:"unRealizedProfit"`
+	MarginType       string          `json:"marginType"`
+}
+
+// GetPositions reports the open positions of /fapi/v2/positionRisk, which
+// lists every symbol, open or not.
+func (c *futuresClient) GetPositions(req trading.GetPositionsRequest) ([]trading.Position, error) {
+	q := c.rest.timestampQuery()
+	if req.Base != "" || req.Quote != "" {
+		symbol, err := c.instruments.Symbol(trading.NewInstrument(req.Base, req.Quote))
+		if err != nil {
+			return nil, err
+		}
+		q.Set("symbol", symbol)
+	}
+
+	resBody, err := c.rest.signed(http.MethodGet, "/fapi/v2/positionRisk", q.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	var response []positionRisk
+	err = json.Unmarshal(resBody, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	var positions []trading.Position
+	for _, p := range response {
+		if p.PositionAmt.IsZero() {
+			continue
+		}
+
+		position := trading.Position{
+			Symbol:           p.Symbol,
+			Instrument:       c.instrument(p.Symbol),
+			Size:             p.PositionAmt,
+			EntryPrice:       p.EntryPrice,
+			MarkPrice:        p.MarkPrice,
+			LiquidationPrice: p.LiquidationPrice,
+			Leverage:         p.Leverage,
+			UnrealizedPnL:    p.UnRealizedProfit,
+			MarginType:       trading.CrossMargin,
+		}
+		if strings.EqualFold(p.MarginType, "isolated") {
+			position.MarginType = trading.IsolatedMargin
+		}
+		switch p.PositionSide {
+		case "LONG":
+			position.PositionIdx = trading.LongPosition
+		case "SHORT":
+			position.PositionIdx = trading.ShortPosition
+		}
+
+		positions = append(positions, position)
+	}
+
+	return positions, nil
+}
+
+type income struct {
+	Symbol string          `json:"symbol"`
+	Income decimal.Decimal `json:"income"`
+	Asset  string          `json:"asset"`
+	Time   int64           `json:"time"`
+}
+
+// GetFundingHistory lists the FUNDING_FEE records of /fapi/v1/income, whose
+// income is positive when received. Without Start, Binance returns the last
+// week.
+func (c *futuresClient) GetFundingHistory(req trading.GetFundingHistoryRequest) ([]trading.FundingPayment, error) {
+	q := url.Values{}
+	q.Set("incomeType", "FUNDING_FEE")
+	q.Set("limit", strconv.Itoa(incomeLimit))
+	if req.Base != "" || req.Quote != "" {
+		symbol, err := c.instruments.Symbol(trading.NewInstrument(req.Base, req.Quote))
+		if err != nil {
+			return nil, err
+		}
+		q.Set("symbol", symbol)
+	}
+	if !req.Start.IsZero() {
+		q.Set("startTime", strconv.FormatInt(req.Start.UnixMilli(), 10))
+	}
+	if !req.End.IsZero() {
+		q.Set("endTime", strconv.FormatInt(req.End.UnixMilli(), 10))
+	}
+
+	var payments []trading.FundingPayment
+	for {
+		q.Set("timestamp", strconv.FormatInt(c.rest.now().UnixMilli(), 10))
+		resBody, err := c.rest.signed(http.MethodGet, "/fapi/v1/income", q.Encode())
+		if err != nil {
+			return nil, err
+		}
+
+		var response []income
+		err = json.Unmarshal(resBody, &response)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, i := range response {
+			payments = append(payments, trading.FundingPayment{
+				Symbol:     i.Symbol,
+				Instrument: c.instrument(i.Symbol),
+				Asset:      i.Asset,
+				Amount:     i.Income,
+				Time:       time.UnixMilli(i.Time).UTC(),
+			})
+		}
+
+		// Records come oldest first; a full page may have more after it.
+		if len(response) < incomeLimit {
+			return payments, nil
+		}
+		q.Set("startTime", strconv.FormatInt(response[len(response)-1].Time+1, 10))
+	}
+}
+
+func (c *futuresClient) instrument(symbol string) trading.Instrument {
+	listing, err := c.instruments.LookupSymbol(symbol)
+	if err != nil {
+		return trading.Instrument{}
+	}
+
+	return listing.Instrument
+}
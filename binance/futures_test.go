@@ -0,0 +1,178 @@
+package binance
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/trading"
+)
+
+func TestFuturesClient(t *testing.T) {
+	serverTime := time.Now().Add(time.Minute)
+	var orders []url.Values
+	var leverage, marginType string
+	var incomeStarts []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fapi/v1/time", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(rw, `{"serverTime":%d}`, serverTime.UnixMilli())
+	})
+	mux.HandleFunc("/fapi/v1/exchangeInfo", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, `{"symbols":[
+			{"symbol":"BTCUSDT","status":"TRADING","contractType":"PERPETUAL","baseAsset":"BTC","quoteAsset":"USDT","filters":[{"filterType":"PRICE_FILTER","tickSize":"0.10"},{"filterType":"LOT_SIZE","stepSize":"0.001"}]},
+			{"symbol":"BTCUSDT_250627","status":"TRADING","contractType":"CURRENT_QUARTER","baseAsset":"BTC","quoteAsset":"USDT","filters":[]}
+		]}`)
+	})
+	mux.HandleFunc("/fapi/v1/order", func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		values, _ := url.ParseQuery(string(body))
+		if r.URL.Query().Get("signature") == "" || r.Header.Get("X-MBX-APIKEY") != "key" {
+			t.Errorf("unsigned order %s", r.URL)
+		}
+		timestamp, _ := strconv.ParseInt(values.Get("timestamp"), 10, 64)
+		if d := time.UnixMilli(timestamp).Sub(serverTime); d < -5*time.Second || d > 5*time.Second {
+			t.Errorf("timestamp %d is off the server time by %s", timestamp, d)
+		}
+		orders = append(orders, values)
+		fmt.Fprint(rw, `{"orderId":42}`)
+	})
+	mux.HandleFunc("/fapi/v1/leverage", func(rw http.ResponseWriter, r *http.Request) {
+		leverage = r.URL.Query().Get("leverage")
+		fmt.Fprint(rw, `{"leverage":5,"symbol":"BTCUSDT"}`)
+	})
+	mux.HandleFunc("/fapi/v1/marginType", func(rw http.ResponseWriter, r *http.Request) {
+		if marginType == r.URL.Query().Get("marginType") {
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(rw, `{"code":-4046,"msg":"No need to change margin type."}`)
+			return
+		}
+		marginType = r.URL.Query().Get("marginType")
+		fmt.Fprint(rw, `{"code":200,"msg":"success"}`)
+	})
+	mux.HandleFunc("/fapi/v2/positionRisk", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, `[
+			{"symbol":"BTCUSDT","positionSide":"BOTH","positionAmt":"-0.250","entryPrice":"60000.0","markPrice":"59000.0","liquidationPrice":"70000.0","leverage":"5","unRealizedProfit":"250.0","marginType":"isolated"},
+			{"symbol":"ETHUSDT","positionSide":"BOTH","positionAmt":"0.000","entryPrice":"0.0","markPrice":"3000.0","liquidationPrice":"0","leverage":"20","unRealizedProfit":"0.0","marginType":"cross"}
+		]`)
+	})
+	mux.HandleFunc("/fapi/v1/income", func(rw http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("incomeType") != "FUNDING_FEE" || q.Get("symbol") != "BTCUSDT" {
+			t.Errorf("got income query %s", r.URL.RawQuery)
+		}
+		incomeStarts = append(incomeStarts, q.Get("startTime"))
+		if len(incomeStarts) > 1 {
+			fmt.Fprint(rw, `[{"symbol":"BTCUSDT","income":"1.5","asset":"USDT","time":1704067200000}]`)
+			return
+		}
+
+		rw.Write([]byte("["))
+		for i := 0; i < incomeLimit; i++ {
+			if i > 0 {
+				rw.Write([]byte(","))
+			}
+			fmt.Fprintf(rw, `{"symbol":"BTCUSDT","income":"-0.1","asset":"USDT","time":%d}`, 1704000000000+int64(i))
+		}
+		rw.Write([]byte("]"))
+	})
+	mux.HandleFunc("/fapi/v1/ticker/price", func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(rw, `{"code":-1121,"msg":"Invalid symbol."}`)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewFuturesClient(Config{URL: server.URL, APIKey: "key", APISecret: "secret"}, server.Client())
+
+	limit := trading.TradeRequest{Base: "BTC", Quote: "USDT", Amount: decimal.RequireFromString("0.25"), Type: trading.OrderTypeLimit, Price: decimal.NewFromInt(61000), ReduceOnly: true}
+	res, err := c.Buy(trading.BuyRequest{TradeRequest: limit})
+	if err != nil || res.OrderID != "42" {
+		t.Fatalf("got %+v and error %v", res, err)
+	}
+	stop := trading.TradeRequest{Base: "BTC", Quote: "USDT", Amount: decimal.NewFromInt(1), StopPrice: decimal.NewFromInt(55000), StopDirection: trading.StopFalling, PositionIdx: trading.LongPosition}
+	_, err = c.Sell(trading.SellRequest{TradeRequest: stop})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 2 {
+		t.Fatalf("got orders %v", orders)
+	}
+	want := []map[string]string{
+		{"side": "BUY", "type": "LIMIT", "quantity": "0.250", "price": "61000.0", "timeInForce": "GTC", "reduceOnly": "true", "positionSide": ""},
+		{"side": "SELL", "type": "STOP_MARKET", "quantity": "1.000", "stopPrice": "55000.0", "reduceOnly": "", "positionSide": "LONG"},
+	}
+	for i, w := range want {
+		for k, v := range w {
+			if orders[i].Get(k) != v {
+				t.Errorf("order %d: got %s=%q, want %q", i, k, orders[i].Get(k), v)
+			}
+		}
+	}
+
+	stop.ReduceOnly = true
+	_, err = c.Sell(trading.SellRequest{TradeRequest: stop})
+	if err == nil {
+		t.Fatal("expected a reduce-only hedge order to be rejected")
+	}
+	_, err = c.Buy(trading.BuyRequest{TradeRequest: trading.TradeRequest{Base: "BTC", Quote: "USD", Amount: decimal.NewFromInt(1)}})
+	if !errors.Is(err, trading.ErrUnknownInstrument) {
+		t.Fatalf("got error %v for a quarterly contract", err)
+	}
+
+	err = c.SetLeverage(trading.SetLeverageRequest{Base: "BTC", Quote: "USDT", Leverage: decimal.RequireFromString("2.5")})
+	if err == nil {
+		t.Fatal("expected fractional leverage to be rejected")
+	}
+	err = c.SetLeverage(trading.SetLeverageRequest{Base: "BTC", Quote: "USDT", Leverage: decimal.NewFromInt(5)})
+	if err != nil || leverage != "5" {
+		t.Fatalf("got leverage %q and error %v", leverage, err)
+	}
+
+	setter := c.(trading.MarginTypeSetter)
+	for i := 0; i < 2; i++ {
+		err = setter.SetMarginType(trading.SetMarginTypeRequest{Base: "BTC", Quote: "USDT", MarginType: trading.IsolatedMargin})
+		if err != nil || marginType != "ISOLATED" {
+			t.Fatalf("got margin type %q and error %v", marginType, err)
+		}
+	}
+
+	positions, err := c.GetPositions(trading.GetPositionsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) != 1 {
+		t.Fatalf("got positions %+v", positions)
+	}
+	p := positions[0]
+	if p.Instrument != trading.NewInstrument("BTC", "USDT") || p.Size.String() != "-0.25" || p.LiquidationPrice.String() != "70000" ||
+		p.UnrealizedPnL.String() != "250" || p.MarginType != trading.IsolatedMargin || p.PositionIdx != trading.OneWayPosition {
+		t.Fatalf("got position %+v", p)
+	}
+
+	payments, err := c.GetFundingHistory(trading.GetFundingHistoryRequest{Base: "BTC", Quote: "USDT", Start: time.UnixMilli(1704000000000)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payments) != incomeLimit+1 || len(incomeStarts) != 2 || incomeStarts[1] != strconv.FormatInt(1704000000000+incomeLimit, 10) {
+		t.Fatalf("got %d payments from starts %v", len(payments), incomeStarts)
+	}
+	last := payments[len(payments)-1]
+	if last.Amount.String() != "1.5" || last.Asset != "USDT" || !last.Time.Equal(time.UnixMilli(1704067200000)) {
+		t.Fatalf("got payment %+v", last)
+	}
+
+	_, err = c.(trading.PriceClient).GetPrice(trading.GetPriceRequest{Base: "BTC", Quote: "USDT"})
+	if !errors.Is(err, trading.ErrUnknownInstrument) {
+		t.Fatalf("got error %v, want an unknown instrument", err)
+	}
+}
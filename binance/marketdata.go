@@ -0,0 +1,151 @@
+package binance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/stream"
+	"trading-aggregator/trading"
+)
+
+const depthSnapshotLimit = 1000
+
+type depthSnapshot struct {
+	LastUpdateID int64                `json:"lastUpdateId"`
+	Bids         [][2]decimal.Decimal `json:"bids"`
+	Asks         [][2]decimal.Decimal `json:"asks"`
+}
+
+type depthUpdate struct {
+	EventType     string               `json:"e"`
+	EventTime     int64                `json:"E"`
+	Symbol        string               `json:"s"`
+	FirstUpdateID int64                `json:"U"`
+	FinalUpdateID int64                `json:"u"`
+	Bids          [][2]decimal.Decimal `json:"b"`
+	Asks          [][2]decimal.Decimal `json:"a"`
+}
+
+// SubscribeOrderBook follows the diff depth stream and syncs it with a REST
+// snapshot as Binance documents: updates up to the snapshot's lastUpdateId are
+// dropped, and a gap between an update's first id and the previous final id
+// triggers a new snapshot.
+func (c *client) SubscribeOrderBook(ctx context.Context, instrument trading.Instrument) (*trading.OrderBook, error) {
+	symbol, err := c.instruments.Symbol(instrument)
+	if err != nil {
+		return nil, err
+	}
+
+	book := trading.NewOrderBook(instrument)
+
+	var snapshot *depthSnapshot
+	var updateID int64
+	go stream.Run(ctx, stream.Config{
+		URL: func(context.Context) (string, error) {
+			book.Reset()
+			snapshot = nil
+			updateID = 0
+
+			return strings.TrimRight(c.config.MarketDataURL, "/") + "/ws/" + strings.ToLower(symbol) + "@depth@100ms", nil
+		},
+		OnMessage: func(data []byte) error {
+			var update depthUpdate
+			err := json.Unmarshal(data, &update)
+			if err != nil {
+				return err
+			}
+
+			if update.EventType != "depthUpdate" || update.FinalUpdateID <= updateID {
+				return nil
+			}
+
+			if updateID != 0 && update.FirstUpdateID > updateID+1 {
+				book.Reset()
+				updateID = 0
+			}
+
+			if updateID == 0 {
+				if snapshot == nil || update.FirstUpdateID > snapshot.LastUpdateID+1 {
+					snapshot, err = c.getDepthSnapshot(ctx, symbol)
+					if err != nil {
+						return err
+					}
+				}
+
+				if update.FinalUpdateID <= snapshot.LastUpdateID {
+					return nil
+				}
+				if update.FirstUpdateID > snapshot.LastUpdateID+1 {
+					return fmt.Errorf("depth snapshot %d is older than update %d", snapshot.LastUpdateID, update.FirstUpdateID)
+				}
+
+				book.Snapshot(levels(snapshot.Bids), levels(snapshot.Asks), time.UnixMilli(update.EventTime).UTC())
+				snapshot = nil
+			}
+
+			book.Update(levels(update.Bids), levels(update.Asks), time.UnixMilli(update.EventTime).UTC())
+			updateID = update.FinalUpdateID
+
+			return nil
+		},
+	})
+
+	return book, nil
+}
+
+func levels(pairs [][2]decimal.Decimal) []trading.Level {
+	list := make([]trading.Level, len(pairs))
+	for i, pair := range pairs {
+		list[i] = trading.Level{Price: pair[0], Size: pair[1]}
+	}
+
+	return list
+}
+
+func (c *client) getDepthSnapshot(ctx context.Context, symbol string) (*depthSnapshot, error) {
+	u, err := url.Parse(c.config.URL + "/api/v3/depth")
+	if err != nil {
+		return nil, err
+	}
+
+	query := u.Query()
+	query.Add("symbol", symbol)
+	query.Add("limit", fmt.Sprint(depthSnapshotLimit))
+	u.RawQuery = query.Encode()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get http response code %d and body %s", res.StatusCode, resBody)
+	}
+
+	var snapshot depthSnapshot
+	err = json.Unmarshal(resBody, &snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
@@ -0,0 +1,106 @@
+package binance
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"trading-aggregator/trading"
+)
+
+func TestClient_SubscribeOrderBook(t *testing.T) {
+	var snapshots int32
+	upgrader := websocket.Upgrader{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/exchangeInfo", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, `{"symbols":[{"symbol":"SOLUSDT","status":"TRADING","baseAsset":"SOL","quoteAsset":"USDT"}]}`)
+	})
+	mux.HandleFunc("/api/v3/depth", func(rw http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&snapshots, 1) == 1 {
+			fmt.Fprint(rw, `{"lastUpdateId":100,"bids":[["99","1"]],"asks":[["101","1"]]}`)
+			return
+		}
+		fmt.Fprint(rw, `{"lastUpdateId":111,"bids":[["95","7"]],"asks":[["105","7"]]}`)
+	})
+	mux.HandleFunc("/ws/solusdt@depth@100ms", func(rw http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(rw, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		messages := []string{
+			// Covered by the snapshot.
+			`{"e":"depthUpdate","E":1,"s":"SOLUSDT","U":95,"u":99,"b":[["1","1"]],"a":[]}`,
+			`{"e":"depthUpdate","E":2,"s":"SOLUSDT","U":100,"u":102,"b":[["99","2"]],"a":[]}`,
+			`{"e":"depthUpdate","E":3,"s":"SOLUSDT","U":103,"u":104,"b":[],"a":[["100","3"]]}`,
+			// Updates 105 to 109 are lost, so the book is rebuilt from the
+			// second snapshot.
+			`{"e":"depthUpdate","E":4,"s":"SOLUSDT","U":110,"u":111,"b":[["98","1"]],"a":[]}`,
+			`{"e":"depthUpdate","E":5,"s":"SOLUSDT","U":112,"u":112,"b":[["96","2"]],"a":[]}`,
+		}
+		for _, message := range messages {
+			if ws.WriteMessage(websocket.TextMessage, []byte(message)) != nil {
+				return
+			}
+		}
+
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient(Config{
+		URL:           server.URL,
+		MarketDataURL: "ws" + strings.TrimPrefix(server.URL, "http"),
+	}, server.Client())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	book, err := c.(trading.MarketDataClient).SubscribeOrderBook(ctx, trading.NewInstrument("SOL", "USDT"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ticker, err := book.Ticker()
+		if err == nil && ticker.Bid.String() == "96" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got ticker %+v, %v", ticker, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	bids, asks, err := book.Depth(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bids) != 2 || bids[1].Price.String() != "95" || len(asks) != 1 || asks[0].Price.String() != "105" {
+		t.Fatalf("got bids %v asks %v", bids, asks)
+	}
+	if atomic.LoadInt32(&snapshots) != 2 {
+		t.Fatalf("got %d snapshots", snapshots)
+	}
+
+	_, err = c.(trading.MarketDataClient).SubscribeOrderBook(ctx, trading.NewInstrument("DOGE", "USDT"))
+	if err == nil {
+		t.Fatal("expected error for unlisted instrument")
+	}
+}
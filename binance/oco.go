@@ -0,0 +1,125 @@
+package binance
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"trading-aggregator/trading"
+)
+
+type ocoResponse struct {
+	OrderListID int64 `json:"orderListId"`
+	Orders      []struct {
+		OrderID       int64  `json:"orderId"`
+		ClientOrderID string `json:"clientOrderId"`
+	} `json:"orders"`
+}
+
+// PlaceOCO places an order list on /api/v3/orderList/oco. The stop leg is a
+// STOP_LOSS order and the other leg a TAKE_PROFIT order, or a LIMIT_MAKER
+// order when it has no stop price; legs with both prices are their _LIMIT
+// variants.
+func (c *client) PlaceOCO(req trading.OCORequest) (trading.OCOResponse, error) {
+	err := req.Validate()
+	if err != nil {
+		return trading.OCOResponse{}, err
+	}
+
+	listing, err := c.instruments.Tradable(trading.NewInstrument(req.Base, req.Quote))
+	if err != nil {
+		return trading.OCOResponse{}, err
+	}
+
+	quantity, err := listing.FormatBase(req.Amount)
+	if err != nil {
+		return trading.OCOResponse{}, err
+	}
+
+	sell := strings.EqualFold(req.Side, "sell")
+	q := c.timestampQuery()
+	q.Set("symbol", listing.Symbol)
+	q.Set("side", strings.ToUpper(req.Side))
+	q.Set("quantity", quantity)
+	if req.ClientOrderID != "" {
+		q.Set("listClientOrderId", req.ClientOrderID)
+	}
+
+	legs := []struct {
+		name string
+		leg  *trading.OCOLeg
+		stop bool
+	}{
+		{"above", &req.Above, !sell},
+		{"below", &req.Below, sell},
+	}
+	for _, l := range legs {
+		if l.leg.ClientOrderID == "" {
+			l.leg.ClientOrderID = uuid.NewString()
+		}
+		err = setOCOLeg(q, l.name, listing, *l.leg, sell, l.stop)
+		if err != nil {
+			return trading.OCOResponse{}, err
+		}
+	}
+
+	resBody, err := c.signed(http.MethodPost, "/api/v3/orderList/oco", q.Encode())
+	if err != nil {
+		return trading.OCOResponse{}, err
+	}
+
+	var response ocoResponse
+	err = json.Unmarshal(resBody, &response)
+	if err != nil {
+		return trading.OCOResponse{}, err
+	}
+
+	res := trading.OCOResponse{ListID: strconv.FormatInt(response.OrderListID, 10)}
+	for _, o := range response.Orders {
+		switch o.ClientOrderID {
+		case req.Above.ClientOrderID:
+			res.Above.OrderID = strconv.FormatInt(o.OrderID, 10)
+		case req.Below.ClientOrderID:
+			res.Below.OrderID = strconv.FormatInt(o.OrderID, 10)
+		}
+	}
+	if res.Above.OrderID == "" || res.Below.OrderID == "" {
+		return trading.OCOResponse{}, fmt.Errorf("order list %s is missing a leg", res.ListID)
+	}
+
+	return res, nil
+}
+
+func setOCOLeg(q url.Values, name string, listing trading.Listing, leg trading.OCOLeg, sell, stopLoss bool) error {
+	limit := leg.Price.IsPositive()
+	orderType := "LIMIT_MAKER"
+	if leg.StopPrice.IsPositive() {
+		orderType = stopType(stopLoss, limit)
+
+		stopPrice, err := listing.FormatPrice(leg.StopPrice)
+		if err != nil {
+			return err
+		}
+		q.Set(name+"StopPrice", stopPrice)
+	}
+	q.Set(name+"Type", orderType)
+	q.Set(name+"ClientOrderId", leg.ClientOrderID)
+
+	if limit {
+		price, err := listing.FormatLimitPrice(leg.Price, sell)
+		if err != nil {
+			return err
+		}
+		q.Set(name+"Price", price)
+		if orderType != "LIMIT_MAKER" {
+			q.Set(name+"TimeInForce", string(trading.GoodTillCanceled))
+		}
+	}
+
+	return nil
+}
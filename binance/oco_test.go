@@ -0,0 +1,112 @@
+package binance
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/trading"
+)
+
+func TestClient_StopOrders(t *testing.T) {
+	var orders []url.Values
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/exchangeInfo", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, `{"symbols":[{"symbol":"SOLUSDT","status":"TRADING","baseAsset":"SOL","quoteAsset":"USDT","filters":[{"filterType":"PRICE_FILTER","tickSize":"0.01"}]}]}`)
+	})
+	mux.HandleFunc("/api/v3/order", func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		values, _ := url.ParseQuery(string(body))
+		orders = append(orders, values)
+		fmt.Fprint(rw, `{"orderId":1}`)
+	})
+	mux.HandleFunc("/api/v3/orderList/oco", func(rw http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.Method != http.MethodPost || query.Get("signature") == "" {
+			t.Errorf("got %s %s", r.Method, r.URL.RawQuery)
+		}
+		want := map[string]string{
+			"side": "SELL", "quantity": "1",
+			"aboveType": "LIMIT_MAKER", "abovePrice": "120.01", "aboveClientOrderId": "tp",
+			"belowType": "STOP_LOSS_LIMIT", "belowPrice": "89.00", "belowStopPrice": "90.00", "belowTimeInForce": "GTC",
+		}
+		for k, v := range want {
+			if query.Get(k) != v {
+				t.Errorf("got %s=%q, want %q", k, query.Get(k), v)
+			}
+		}
+
+		fmt.Fprintf(rw, `{"orderListId":7,"orders":[{"orderId":8,"clientOrderId":%q},{"orderId":9,"clientOrderId":"tp"}]}`, query.Get("belowClientOrderId"))
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient(Config{URL: server.URL, APIKey: "key", APISecret: "secret"}, server.Client())
+
+	stop := trading.TradeRequest{Base: "SOL", Quote: "USDT", Amount: decimal.NewFromInt(1), StopPrice: decimal.NewFromInt(90), StopDirection: trading.StopFalling}
+	_, err := c.Sell(trading.SellRequest{TradeRequest: stop})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop.Type = trading.OrderTypeLimit
+	stop.Price = decimal.NewFromInt(91)
+	stop.StopDirection = trading.StopRising
+	_, err = c.Buy(trading.BuyRequest{TradeRequest: stop})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 2 || orders[0].Get("type") != "STOP_LOSS" || orders[0].Get("stopPrice") != "90.00" ||
+		orders[1].Get("type") != "STOP_LOSS_LIMIT" || orders[1].Get("price") != "91.00" || orders[1].Get("timeInForce") != "GTC" {
+		t.Fatalf("got orders %v", orders)
+	}
+
+	res, err := c.(trading.OCOPlacer).PlaceOCO(trading.OCORequest{
+		Side:   "sell",
+		Base:   "SOL",
+		Quote:  "USDT",
+		Amount: decimal.NewFromInt(1),
+		Above:  trading.OCOLeg{Price: decimal.RequireFromString("120.005"), ClientOrderID: "tp"},
+		Below:  trading.OCOLeg{Price: decimal.NewFromInt(89), StopPrice: decimal.NewFromInt(90)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ListID != "7" || res.Above.OrderID != "9" || res.Below.OrderID != "8" {
+		t.Fatalf("got %+v", res)
+	}
+}
+
+func TestNewPlaceOrderRequest_QuoteSized(t *testing.T) {
+	listing := trading.Listing{
+		Instrument:     trading.NewInstrument("BTC", "USDT"),
+		Symbol:         "BTCUSDT",
+		QuoteIncrement: decimal.RequireFromString("0.00000001"),
+	}
+
+	body, err := newPlaceOrderRequest(listing, "BUY", trading.TradeRequest{QuoteAmount: decimal.NewFromInt(50)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, _ := url.ParseQuery(body.String())
+	if q.Get("quoteOrderQty") != "50.00000000" || q.Has("quantity") || q.Get("type") != "MARKET" {
+		t.Fatalf("got %s", body.String())
+	}
+
+	_, err = newPlaceOrderRequest(listing, "BUY", trading.TradeRequest{QuoteAmount: decimal.NewFromInt(50), Type: trading.OrderTypeLimit, Price: decimal.NewFromInt(1)})
+	if err == nil {
+		t.Fatal("accepted a quote sized limit order")
+	}
+
+	spot, _ := trading.LookupAdapter("binance")
+	futures, _ := trading.LookupAdapter("binance_futures")
+	if !spot.Capabilities.QuoteSizeOrders || futures.Capabilities.QuoteSizeOrders {
+		t.Fatalf("got capabilities %+v and %+v", spot.Capabilities, futures.Capabilities)
+	}
+}
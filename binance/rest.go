@@ -0,0 +1,197 @@
+package binance
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"trading-aggregator/trading"
+)
+
+// clockSyncInterval is how often the offset of the venue's clock is
+// measured again.
+const clockSyncInterval = time.Hour
+
+// Error codes the spot and futures APIs share.
+const (
+	codeTimestampOutsideRecvWindow = -1021
+	codeInvalidSymbol              = -1121
+)
+
+// apiError is an error response of the REST API. Codes with a trading
+// equivalent unwrap to it.
+type apiError struct {
+	StatusCode int
+	Code       int    `json:"code"`
+	Msg        string `json:"msg"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("get http response code %d and error {%d %s}", e.StatusCode, e.Code, e.Msg)
+}
+
+func (e *apiError) Unwrap() error {
+	if e.Code == codeInvalidSymbol {
+		return trading.ErrUnknownInstrument
+	}
+
+	return nil
+}
+
+// clock keeps the offset of the venue's clock from ours, since signed
+// requests whose timestamp is off by more than the receive window are
+// rejected.
+type clock struct {
+	path     string
+	mu       sync.Mutex
+	offset   time.Duration
+	syncedAt time.Time
+}
+
+// now is the venue's time by the last measured offset. The offset is
+// measured again every clockSyncInterval and after the venue rejected a
+// timestamp; until a measurement succeeds, the last offset is used.
+func (c *client) now() time.Time {
+	c.clock.mu.Lock()
+	stale := time.Since(c.clock.syncedAt) > clockSyncInterval
+	if stale {
+		c.clock.syncedAt = time.Now()
+	}
+	offset := c.clock.offset
+	c.clock.mu.Unlock()
+
+	if stale {
+		measured, err := c.measureClockOffset()
+		if err == nil {
+			c.clock.mu.Lock()
+			c.clock.offset = measured
+			c.clock.mu.Unlock()
+			offset = measured
+		}
+	}
+
+	return time.Now().Add(offset).UTC()
+}
+
+func (c *client) measureClockOffset() (time.Duration, error) {
+	start := time.Now()
+	res, err := c.httpClient.Get(c.config.URL + c.clock.path)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	end := time.Now()
+
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("get http response code %d", res.StatusCode)
+	}
+
+	var response struct {
+		ServerTime int64 `json:"serverTime"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&response)
+	if err != nil {
+		return 0, err
+	}
+
+	// The server read its clock about halfway through the round trip.
+	local := start.Add(end.Sub(start) / 2)
+	return time.UnixMilli(response.ServerTime).Sub(local), nil
+}
+
+func (c *client) timestampQuery() url.Values {
+	return url.Values{"timestamp": []string{strconv.FormatInt(c.now().UnixMilli(), 10)}}
+}
+
+// signed sends a signed request with the query and returns the body of a
+// successful response.
+func (c *client) signed(method, path, query string) ([]byte, error) {
+	return c.send(method, path, query, "")
+}
+
+// send sends a request signed over the query and the form encoded body and
+// returns the body of a successful response.
+func (c *client) send(method, path, query, body string) ([]byte, error) {
+	u, err := url.Parse(c.config.URL + path)
+	if err != nil {
+		return nil, err
+	}
+
+	signature := "signature=" + c.sign(query, body)
+	if query != "" {
+		u.RawQuery = query + "&" + signature
+	} else {
+		u.RawQuery = signature
+	}
+
+	httpReq, err := http.NewRequest(method, u.String(), strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.Header = c.createHeader()
+
+	res, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		apiErr := &apiError{StatusCode: res.StatusCode}
+		if json.Unmarshal(resBody, apiErr) != nil || apiErr.Code == 0 {
+			return nil, fmt.Errorf("get http response code %d and body %s", res.StatusCode, resBody)
+		}
+		if apiErr.Code == codeTimestampOutsideRecvWindow {
+			c.clock.mu.Lock()
+			c.clock.syncedAt = time.Time{}
+			c.clock.mu.Unlock()
+		}
+
+		return nil, apiErr
+	}
+
+	return resBody, nil
+}
+
+// public sends an unsigned GET request with the query and returns the body of
+// a successful response.
+func (c *client) public(path string, query url.Values) ([]byte, error) {
+	u, err := url.Parse(c.config.URL + path)
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = query.Encode()
+
+	res, err := c.httpClient.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		apiErr := &apiError{StatusCode: res.StatusCode}
+		if json.Unmarshal(resBody, apiErr) != nil || apiErr.Code == 0 {
+			return nil, fmt.Errorf("get http response code %d and body %s", res.StatusCode, resBody)
+		}
+		return nil, apiErr
+	}
+
+	return resBody, nil
+}
@@ -0,0 +1,194 @@
+package binance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/stream"
+	"trading-aggregator/trading"
+)
+
+const listenKeyKeepAlive = 30 * time.Minute
+
+type listenKeyResponse struct {
+	ListenKey string `json:"listenKey"`
+}
+
+// encoding/json matches keys case-insensitively, so every key that differs
+// from a decoded one only by case is declared to keep it from overwriting it.
+type userDataEvent struct {
+	EventType string `json:"e"`
+	EventTime int64  `json:"E"`
+}
+
+type executionReport struct {
+	userDataEvent
+	Symbol                string          `json:"s"`
+	ClientOrderID         string          `json:"c"`
+	Side                  string          `json:"S"`
+	ExecutionType         string          `json:"x"`
+	Status                string          `json:"X"`
+	OrderID               int64           `json:"i"`
+	Ignore                int64           `json:"I"`
+	LastExecutedQty       decimal.Decimal `json:"l"`
+	CumulativeFilledQty   decimal.Decimal `json:"z"`
+	LastExecutedPrice     decimal.Decimal `json:"L"`
+	CumulativeQuoteQty    decimal.Decimal `json:"Z"`
+	OriginalClientOrderID string          `json:"C"`
+}
+
+func (c *client) StreamOrderUpdates(ctx context.Context) (<-chan trading.OrderUpdate, error) {
+	updates := make(chan trading.OrderUpdate, 64)
+
+	go func() {
+		defer close(updates)
+
+		var listenKey string
+		stream.Run(ctx, stream.Config{
+			URL: func(ctx context.Context) (string, error) {
+				key, err := c.listenKey(ctx, http.MethodPost, "")
+				if err != nil {
+					return "", err
+				}
+				listenKey = key
+
+				return strings.TrimRight(c.config.StreamURL, "/") + "/ws/" + listenKey, nil
+			},
+			OnConnect: func(ctx context.Context, conn *stream.Conn) error {
+				go c.keepAliveListenKey(ctx, listenKey)
+				return nil
+			},
+			OnMessage: func(data []byte) error {
+				update, ok, err := c.parseUserDataEvent(data)
+				if err != nil || !ok {
+					return err
+				}
+
+				select {
+				case updates <- update:
+				case <-ctx.Done():
+				}
+				return nil
+			},
+		})
+	}()
+
+	return updates, nil
+}
+
+func (c *client) parseUserDataEvent(data []byte) (trading.OrderUpdate, bool, error) {
+	var event userDataEvent
+	err := json.Unmarshal(data, &event)
+	if err != nil {
+		return trading.OrderUpdate{}, false, err
+	}
+
+	switch event.EventType {
+	case "executionReport":
+	case "listenKeyExpired":
+		return trading.OrderUpdate{}, false, fmt.Errorf("listen key expired")
+	default:
+		return trading.OrderUpdate{}, false, nil
+	}
+
+	var report executionReport
+	err = json.Unmarshal(data, &report)
+	if err != nil {
+		return trading.OrderUpdate{}, false, err
+	}
+
+	// Cancellations carry a new client order id in c and the one the order was
+	// placed with in C.
+	clientOrderID := report.ClientOrderID
+	if report.OriginalClientOrderID != "" {
+		clientOrderID = report.OriginalClientOrderID
+	}
+
+	update := trading.OrderUpdate{
+		Symbol:        report.Symbol,
+		OrderID:       strconv.FormatInt(report.OrderID, 10),
+		ClientOrderID: clientOrderID,
+		Side:          report.Side,
+		Status:        report.Status,
+		ExecutedBase:  report.CumulativeFilledQty,
+		ExecutedQuote: report.CumulativeQuoteQty,
+		LastBase:      report.LastExecutedQty,
+		LastPrice:     report.LastExecutedPrice,
+		Time:          time.UnixMilli(report.EventTime).UTC(),
+	}
+
+	listing, err := c.instruments.LookupSymbol(report.Symbol)
+	if err == nil {
+		update.Instrument = listing.Instrument
+	}
+
+	return update, true, nil
+}
+
+func (c *client) keepAliveListenKey(ctx context.Context, listenKey string) {
+	ticker := time.NewTicker(listenKeyKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// A failed keep-alive ends in listenKeyExpired, which reconnects
+			// with a new key.
+			_, _ = c.listenKey(ctx, http.MethodPut, listenKey)
+		}
+	}
+}
+
+func (c *client) listenKey(ctx context.Context, method, listenKey string) (string, error) {
+	u, err := url.Parse(c.config.URL + "/api/v3/userDataStream")
+	if err != nil {
+		return "", err
+	}
+
+	if listenKey != "" {
+		query := u.Query()
+		query.Add("listenKey", listenKey)
+		u.RawQuery = query.Encode()
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	httpReq.Header = c.createHeader()
+
+	res, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("get http response code %d and body %s", res.StatusCode, resBody)
+	}
+
+	var listenKeyResponse listenKeyResponse
+	err = json.Unmarshal(resBody, &listenKeyResponse)
+	if err != nil {
+		return "", err
+	}
+
+	return listenKeyResponse.ListenKey, nil
+}
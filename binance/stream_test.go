@@ -0,0 +1,93 @@
+package binance
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"trading-aggregator/trading"
+)
+
+func TestClient_StreamOrderUpdates(t *testing.T) {
+	var listenKeys int32
+	upgrader := websocket.Upgrader{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/userDataStream", func(rw http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-MBX-APIKEY") != "key" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		n := atomic.AddInt32(&listenKeys, 1)
+		fmt.Fprintf(rw, `{"listenKey":"key-%d"}`, n)
+	})
+	mux.HandleFunc("/api/v3/exchangeInfo", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, `{"symbols":[{"symbol":"SOLUSDT","status":"TRADING","baseAsset":"SOL","quoteAsset":"USDT"}]}`)
+	})
+	mux.HandleFunc("/ws/", func(rw http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(rw, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		switch strings.TrimPrefix(r.URL.Path, "/ws/") {
+		case "key-1":
+			_ = ws.WriteMessage(websocket.TextMessage, []byte(`{"e":"outboundAccountPosition"}`))
+			_ = ws.WriteMessage(websocket.TextMessage, []byte(`{"e":"listenKeyExpired"}`))
+		case "key-2":
+			_ = ws.WriteMessage(websocket.TextMessage, []byte(`{"e":"executionReport","E":1700000000000,"s":"SOLUSDT","c":"web_123","S":"BUY","x":"TRADE","X":"FILLED","i":42,"I":99,"l":"1.5","z":"2","L":"100.5","Z":"200.75","C":""}`))
+			for {
+				if _, _, err := ws.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient(Config{
+		URL:       server.URL,
+		StreamURL: "ws" + strings.TrimPrefix(server.URL, "http"),
+		APIKey:    "key",
+		APISecret: "secret",
+	}, server.Client())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updates, err := c.(trading.OrderStreamer).StreamOrderUpdates(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var update trading.OrderUpdate
+	select {
+	case update = <-updates:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no update after listen key expiry")
+	}
+
+	if update.OrderID != "42" || update.ClientOrderID != "web_123" || update.Status != "FILLED" {
+		t.Fatalf("got update %+v", update)
+	}
+	if update.Instrument != trading.NewInstrument("SOL", "USDT") {
+		t.Fatalf("got instrument %v", update.Instrument)
+	}
+	if update.ExecutedQuote.String() != "200.75" || update.LastPrice.String() != "100.5" {
+		t.Fatalf("got amounts %+v", update)
+	}
+
+	cancel()
+	for range updates {
+	}
+}
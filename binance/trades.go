@@ -0,0 +1,183 @@
+package binance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/stream"
+	"trading-aggregator/trading"
+)
+
+const klinesLimit = 1000
+
+var klineIntervals = map[time.Duration]string{
+	time.Minute:        "1m",
+	3 * time.Minute:    "3m",
+	5 * time.Minute:    "5m",
+	15 * time.Minute:   "15m",
+	30 * time.Minute:   "30m",
+	time.Hour:          "1h",
+	2 * time.Hour:      "2h",
+	4 * time.Hour:      "4h",
+	6 * time.Hour:      "6h",
+	8 * time.Hour:      "8h",
+	12 * time.Hour:     "12h",
+	24 * time.Hour:     "1d",
+	3 * 24 * time.Hour: "3d",
+}
+
+// tradeEvent declares every key of the trade stream that clashes with
+// another by case, as for userDataEvent.
+type tradeEvent struct {
+	EventType     string          `json:"e"`
+	EventTime     int64           `json:"E"`
+	Symbol        string          `json:"s"`
+	TradeID       int64           `json:"t"`
+	Price         decimal.Decimal `json:"p"`
+	Quantity      decimal.Decimal `json:"q"`
+	TradeTime     int64           `json:"T"`
+	IsBuyerMaker  bool            `json:"m"`
+	IgnoreIsMatch bool            `json:"M"`
+}
+
+func (c *client) GetKlines(req trading.KlinesRequest) ([]trading.Kline, error) {
+	symbol, err := c.instruments.Symbol(trading.NewInstrument(req.Base, req.Quote))
+	if err != nil {
+		return nil, err
+	}
+
+	interval, ok := klineIntervals[req.Interval]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", trading.ErrUnsupportedInterval, req.Interval)
+	}
+
+	return trading.PageKlines(req, klinesLimit, func(start, end time.Time) ([]trading.Kline, error) {
+		return c.getKlines(symbol, interval, start, end)
+	})
+}
+
+func (c *client) getKlines(symbol, interval string, start, end time.Time) ([]trading.Kline, error) {
+	u, err := url.Parse(c.config.URL + "/api/v3/klines")
+	if err != nil {
+		return nil, err
+	}
+
+	query := u.Query()
+	query.Add("symbol", symbol)
+	query.Add("interval", interval)
+	query.Add("startTime", strconv.FormatInt(start.UnixMilli(), 10))
+	query.Add("endTime", strconv.FormatInt(end.UnixMilli()-1, 10))
+	query.Add("limit", strconv.Itoa(klinesLimit))
+	u.RawQuery = query.Encode()
+
+	httpReq, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get http response code %d and body %s", res.StatusCode, resBody)
+	}
+
+	// Each kline is an array of its open time in milliseconds followed by
+	// open, high, low, close and volume as strings, and fields not used here.
+	var rows [][]json.RawMessage
+	err = json.Unmarshal(resBody, &rows)
+	if err != nil {
+		return nil, err
+	}
+
+	klines := make([]trading.Kline, 0, len(rows))
+	for _, row := range rows {
+		if len(row) < 6 {
+			return nil, fmt.Errorf("kline has %d fields", len(row))
+		}
+
+		var openTime int64
+		var values [5]decimal.Decimal
+		err := json.Unmarshal(row[0], &openTime)
+		if err != nil {
+			return nil, err
+		}
+		for i := range values {
+			err := json.Unmarshal(row[i+1], &values[i])
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		klines = append(klines, trading.Kline{
+			Time:   time.UnixMilli(openTime).UTC(),
+			Open:   values[0],
+			High:   values[1],
+			Low:    values[2],
+			Close:  values[3],
+			Volume: values[4],
+		})
+	}
+
+	return klines, nil
+}
+
+// StreamTrades follows the trade stream of the instrument.
+func (c *client) StreamTrades(ctx context.Context, instrument trading.Instrument) (<-chan trading.Trade, error) {
+	symbol, err := c.instruments.Symbol(instrument)
+	if err != nil {
+		return nil, err
+	}
+
+	trades := make(chan trading.Trade, 256)
+	go func() {
+		defer close(trades)
+
+		stream.Run(ctx, stream.Config{
+			URL: func(context.Context) (string, error) {
+				return strings.TrimRight(c.config.MarketDataURL, "/") + "/ws/" + strings.ToLower(symbol) + "@trade", nil
+			},
+			OnMessage: func(data []byte) error {
+				var event tradeEvent
+				err := json.Unmarshal(data, &event)
+				if err != nil {
+					return err
+				}
+
+				if event.EventType != "trade" {
+					return nil
+				}
+
+				select {
+				case trades <- trading.Trade{
+					Instrument: instrument,
+					Price:      event.Price,
+					Size:       event.Quantity,
+					Time:       time.UnixMilli(event.TradeTime).UTC(),
+				}:
+				case <-ctx.Done():
+				}
+				return nil
+			},
+		})
+	}()
+
+	return trades, nil
+}
@@ -0,0 +1,112 @@
+package binance
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"trading-aggregator/trading"
+)
+
+func TestClient_GetKlines(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var pages []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/exchangeInfo", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, `{"symbols":[{"symbol":"SOLUSDT","status":"TRADING","baseAsset":"SOL","quoteAsset":"USDT"}]}`)
+	})
+	mux.HandleFunc("/api/v3/klines", func(rw http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		pages = append(pages, query.Get("startTime"))
+		if query.Get("symbol") != "SOLUSDT" || query.Get("interval") != "15m" {
+			t.Errorf("got query %s", r.URL.RawQuery)
+		}
+
+		fmt.Fprintf(rw, `[[%s,"10","12","9","11","250.5",0,"2755.5",12,"1","11","0"]]`, query.Get("startTime"))
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient(Config{URL: server.URL}, server.Client())
+
+	// 1500 klines take two pages of 1000.
+	klines, err := c.(trading.KlineClient).GetKlines(trading.KlinesRequest{
+		Base:     "SOL",
+		Quote:    "USDT",
+		Interval: 15 * time.Minute,
+		Start:    start,
+		End:      start.Add(1500 * 15 * time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pages) != 2 || len(klines) != 2 {
+		t.Fatalf("got pages %v and klines %+v", pages, klines)
+	}
+	if !klines[0].Time.Equal(start) || klines[0].Close.String() != "11" || klines[0].Volume.String() != "250.5" {
+		t.Fatalf("got kline %+v", klines[0])
+	}
+
+	_, err = c.(trading.KlineClient).GetKlines(trading.KlinesRequest{Base: "SOL", Quote: "USDT", Interval: 7 * time.Minute})
+	if err == nil {
+		t.Fatal("expected error for unsupported interval")
+	}
+}
+
+func TestClient_StreamTrades(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/exchangeInfo", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, `{"symbols":[{"symbol":"SOLUSDT","status":"TRADING","baseAsset":"SOL","quoteAsset":"USDT"}]}`)
+	})
+	mux.HandleFunc("/ws/solusdt@trade", func(rw http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(rw, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		_ = ws.WriteMessage(websocket.TextMessage, []byte(`{"e":"trade","E":1700000000100,"s":"SOLUSDT","t":12345,"p":"101.5","q":"3","T":1700000000000,"m":true,"M":true}`))
+
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient(Config{
+		URL:           server.URL,
+		MarketDataURL: "ws" + strings.TrimPrefix(server.URL, "http"),
+	}, server.Client())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	trades, err := c.(trading.TradeStreamer).StreamTrades(ctx, trading.NewInstrument("SOL", "USDT"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case trade := <-trades:
+		if trade.Price.String() != "101.5" || trade.Size.String() != "3" || trade.Time.UnixMilli() != 1700000000000 {
+			t.Fatalf("got trade %+v", trade)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no trade")
+	}
+}
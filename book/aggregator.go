@@ -0,0 +1,174 @@
+package book
+
+import (
+	"context"
+	"sync"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/trading"
+)
+
+type Config struct {
+	// TakerFees maps an exchange name to its taker fee rate, e.g. 0.001 for
+	// 0.1%. Levels of exchanges without a fee are taken at face value.
+	TakerFees map[string]decimal.Decimal
+	// Depth is the number of levels taken from each venue, 50 by default.
+	Depth int
+}
+
+type subscription struct {
+	venue string
+	book  *trading.OrderBook
+}
+
+// consolidated caches the merged book of an instrument together with the
+// versions of the venue books it was merged from.
+type consolidated struct {
+	subscriptions []subscription
+
+	mu       sync.Mutex
+	versions []uint64
+	book     *Book
+}
+
+// Aggregator consolidates the order books of every exchange in the registry
+// that streams market data. Books are subscribed on first use of an
+// instrument and kept in sync until Close.
+type Aggregator struct {
+	registry *trading.Registry
+	config   Config
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu    sync.Mutex
+	books map[trading.Instrument]*consolidated
+}
+
+func NewAggregator(registry *trading.Registry, config Config) *Aggregator {
+	if config.Depth <= 0 {
+		config.Depth = 50
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Aggregator{
+		registry: registry,
+		config:   config,
+		ctx:      ctx,
+		cancel:   cancel,
+		books:    map[trading.Instrument]*consolidated{},
+	}
+}
+
+// Close ends every book subscription.
+func (a *Aggregator) Close() {
+	a.cancel()
+}
+
+// Book returns the consolidated book of instrument from the venues that are
+// currently in sync. It fails with trading.ErrUnknownInstrument if no venue
+// streams the instrument and trading.ErrBookNotSynced until one of them is in
+// sync. The merged book is only rebuilt after a venue book changed, and must
+// not be modified.
+func (a *Aggregator) Book(instrument trading.Instrument) (*Book, error) {
+	instrument = trading.NewInstrument(instrument.Base, instrument.Quote)
+
+	c, err := a.subscribe(instrument)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stale := c.book == nil
+	for i, s := range c.subscriptions {
+		if s.book.Version() != c.versions[i] {
+			stale = true
+		}
+	}
+	if !stale {
+		return c.book, nil
+	}
+
+	books := make([]venueBook, 0, len(c.subscriptions))
+	for i, s := range c.subscriptions {
+		// The version is read first so that a change racing with the copy
+		// below leaves the cache stale rather than outdated.
+		c.versions[i] = s.book.Version()
+
+		ticker, err := s.book.Ticker()
+		if err != nil {
+			continue
+		}
+
+		bids, asks, err := s.book.Depth(a.config.Depth)
+		if err != nil {
+			continue
+		}
+
+		books = append(books, venueBook{
+			venue: s.venue,
+			fee:   a.config.TakerFees[s.venue],
+			bids:  bids,
+			asks:  asks,
+			time:  ticker.Time,
+		})
+	}
+	if len(books) == 0 {
+		c.book = nil
+		return nil, trading.ErrBookNotSynced
+	}
+
+	c.book = merge(instrument, books)
+
+	return c.book, nil
+}
+
+// subscribe subscribes one account per exchange listing instrument. Several
+// accounts of an exchange see the same public book.
+func (a *Aggregator) subscribe(instrument trading.Instrument) (*consolidated, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if c, ok := a.books[instrument]; ok {
+		return c, nil
+	}
+
+	c := &consolidated{}
+	venues := map[string]bool{}
+	for _, listing := range a.registry.Listings(instrument) {
+		account, err := a.registry.Account(listing.Account)
+		if err != nil || venues[account.Exchange] {
+			continue
+		}
+
+		client, ok := account.Client.(trading.MarketDataClient)
+		if !ok {
+			continue
+		}
+
+		book, err := client.SubscribeOrderBook(a.ctx, instrument)
+		if err != nil {
+			continue
+		}
+
+		venues[account.Exchange] = true
+		c.subscriptions = append(c.subscriptions, subscription{
+			venue: account.Exchange,
+			book:  book,
+		})
+	}
+
+	// Nothing is remembered for an unknown instrument since the venues may
+	// list it later.
+	if len(c.subscriptions) == 0 {
+		return nil, trading.ErrUnknownInstrument
+	}
+	c.versions = make([]uint64, len(c.subscriptions))
+	a.books[instrument] = c
+
+	return c, nil
+}
@@ -0,0 +1,260 @@
+package book
+
+import (
+	"errors"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/trading"
+)
+
+var ErrInsufficientLiquidity = errors.New("insufficient liquidity")
+
+// Level is a price level of one venue. EffectivePrice includes the venue's
+// taker fee, i.e. what a buyer pays or a seller receives per unit, and equals
+// Price when no fee is configured.
+type Level struct {
+	Venue          string          `json:"venue"`
+	Price          decimal.Decimal `json:"price"`
+	Size           decimal.Decimal `json:"size"`
+	EffectivePrice decimal.Decimal `json:"effective_price"`
+
+	fee decimal.Decimal
+}
+
+// Book is the consolidated order book of an instrument across venues, with
+// the best effective price first on each side.
+type Book struct {
+	Instrument trading.Instrument `json:"instrument"`
+	Venues     []string           `json:"venues"`
+	Bids       []Level            `json:"bids"`
+	Asks       []Level            `json:"asks"`
+	Time       time.Time          `json:"time"`
+}
+
+type VenueFill struct {
+	Venue string          `json:"venue"`
+	Base  decimal.Decimal `json:"base"`
+	Quote decimal.Decimal `json:"quote"`
+	Fee   decimal.Decimal `json:"fee"`
+}
+
+// Fill is the outcome of walking the book. Quote excludes fees and
+// AveragePrice is Quote over Base.
+type Fill struct {
+	Base         decimal.Decimal `json:"base"`
+	Quote        decimal.Decimal `json:"quote"`
+	Fee          decimal.Decimal `json:"fee"`
+	AveragePrice decimal.Decimal `json:"average_price"`
+	Venues       []VenueFill     `json:"venues"`
+}
+
+type venueBook struct {
+	venue string
+	fee   decimal.Decimal
+	bids  []trading.Level
+	asks  []trading.Level
+	time  time.Time
+}
+
+// merge consolidates venue books. Each venue side is already sorted and one
+// fee applies to the whole venue, so the sides are merged rather than sorted.
+func merge(instrument trading.Instrument, books []venueBook) *Book {
+	b := &Book{
+		Instrument: instrument,
+		Venues:     make([]string, 0, len(books)),
+	}
+
+	one := decimal.NewFromInt(1)
+	bids := make([][]Level, 0, len(books))
+	asks := make([][]Level, 0, len(books))
+	for _, vb := range books {
+		b.Venues = append(b.Venues, vb.venue)
+		if vb.time.After(b.Time) {
+			b.Time = vb.time
+		}
+
+		bids = append(bids, venueLevels(vb, vb.bids, one.Sub(vb.fee)))
+		asks = append(asks, venueLevels(vb, vb.asks, one.Add(vb.fee)))
+	}
+
+	b.Bids = mergeLevels(bids, func(a, b Level) bool { return a.EffectivePrice.GreaterThan(b.EffectivePrice) })
+	b.Asks = mergeLevels(asks, func(a, b Level) bool { return a.EffectivePrice.LessThan(b.EffectivePrice) })
+
+	return b
+}
+
+func venueLevels(vb venueBook, levels []trading.Level, factor decimal.Decimal) []Level {
+	list := make([]Level, len(levels))
+	for i, level := range levels {
+		effectivePrice := level.Price
+		if !vb.fee.IsZero() {
+			effectivePrice = level.Price.Mul(factor)
+		}
+
+		list[i] = Level{
+			Venue:          vb.venue,
+			Price:          level.Price,
+			Size:           level.Size,
+			EffectivePrice: effectivePrice,
+			fee:            vb.fee,
+		}
+	}
+
+	return list
+}
+
+// mergeLevels merges sorted lists, taking from the earlier list on ties.
+func mergeLevels(lists [][]Level, better func(a, b Level) bool) []Level {
+	n := 0
+	for _, list := range lists {
+		n += len(list)
+	}
+
+	merged := make([]Level, 0, n)
+	for len(merged) < n {
+		best := -1
+		for i, list := range lists {
+			if len(list) > 0 && (best < 0 || better(list[0], lists[best][0])) {
+				best = i
+			}
+		}
+
+		merged = append(merged, lists[best][0])
+		lists[best] = lists[best][1:]
+	}
+
+	return merged
+}
+
+// Buy walks the asks to answer what buying base would cost.
+func (b *Book) Buy(base decimal.Decimal) (Fill, error) {
+	return walk(b.Asks, base, nil)
+}
+
+// Sell walks the bids to answer what selling base would return.
+func (b *Book) Sell(base decimal.Decimal) (Fill, error) {
+	return walk(b.Bids, base, nil)
+}
+
+// BuyWithin is Buy taking at most caps[venue] of base from each venue, and
+// nothing from venues without a cap.
+func (b *Book) BuyWithin(base decimal.Decimal, caps map[string]decimal.Decimal) (Fill, error) {
+	return walk(b.Asks, base, caps)
+}
+
+// SellWithin is Sell giving at most caps[venue] of base to each venue, and
+// nothing to venues without a cap.
+func (b *Book) SellWithin(base decimal.Decimal, caps map[string]decimal.Decimal) (Fill, error) {
+	return walk(b.Bids, base, caps)
+}
+
+// Depth returns a copy of the book with at most limit levels per side.
+func (b *Book) Depth(limit int) *Book {
+	depth := *b
+	if limit > 0 && len(depth.Bids) > limit {
+		depth.Bids = depth.Bids[:limit]
+	}
+	if limit > 0 && len(depth.Asks) > limit {
+		depth.Asks = depth.Asks[:limit]
+	}
+
+	return &depth
+}
+
+// Venue returns the part of the book resting on one venue.
+func (b *Book) Venue(venue string) *Book {
+	v := &Book{
+		Instrument: b.Instrument,
+		Venues:     []string{venue},
+		Bids:       []Level{},
+		Asks:       []Level{},
+		Time:       b.Time,
+	}
+	for _, level := range b.Bids {
+		if level.Venue == venue {
+			v.Bids = append(v.Bids, level)
+		}
+	}
+	for _, level := range b.Asks {
+		if level.Venue == venue {
+			v.Asks = append(v.Asks, level)
+		}
+	}
+
+	return v
+}
+
+// Mid returns the midpoint of the best bid and ask before fees, or false if a
+// side is empty.
+func (b *Book) Mid() (decimal.Decimal, bool) {
+	if len(b.Bids) == 0 || len(b.Asks) == 0 {
+		return decimal.Zero, false
+	}
+
+	// Fees can rank a venue's better price behind another's, so the first
+	// level is not necessarily the best price.
+	bid, ask := b.Bids[0].Price, b.Asks[0].Price
+	for _, level := range b.Bids {
+		bid = decimal.Max(bid, level.Price)
+	}
+	for _, level := range b.Asks {
+		ask = decimal.Min(ask, level.Price)
+	}
+
+	return bid.Add(ask).Div(decimal.NewFromInt(2)), true
+}
+
+// walk fills base from the best level on, within the caps of the venues
+// unless caps is nil. If the levels run out it returns what could be filled
+// along with ErrInsufficientLiquidity.
+func walk(levels []Level, base decimal.Decimal, caps map[string]decimal.Decimal) (Fill, error) {
+	fill := Fill{Venues: []VenueFill{}}
+
+	venues := map[string]int{}
+	remaining := base
+	for _, level := range levels {
+		if !remaining.IsPositive() {
+			break
+		}
+
+		size := decimal.Min(level.Size, remaining)
+		if caps != nil {
+			left := caps[level.Venue]
+			if i, ok := venues[level.Venue]; ok {
+				left = left.Sub(fill.Venues[i].Base)
+			}
+			size = decimal.Min(size, left)
+			if !size.IsPositive() {
+				continue
+			}
+		}
+		quote := size.Mul(level.Price)
+		fee := quote.Mul(level.fee)
+
+		i, ok := venues[level.Venue]
+		if !ok {
+			i = len(fill.Venues)
+			venues[level.Venue] = i
+			fill.Venues = append(fill.Venues, VenueFill{Venue: level.Venue})
+		}
+		fill.Venues[i].Base = fill.Venues[i].Base.Add(size)
+		fill.Venues[i].Quote = fill.Venues[i].Quote.Add(quote)
+		fill.Venues[i].Fee = fill.Venues[i].Fee.Add(fee)
+
+		fill.Base = fill.Base.Add(size)
+		fill.Quote = fill.Quote.Add(quote)
+		fill.Fee = fill.Fee.Add(fee)
+		remaining = remaining.Sub(size)
+	}
+
+	if fill.Base.IsPositive() {
+		fill.AveragePrice = fill.Quote.Div(fill.Base)
+	}
+	if remaining.IsPositive() {
+		return fill, ErrInsufficientLiquidity
+	}
+
+	return fill, nil
+}
@@ -0,0 +1,157 @@
+package book
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/trading"
+)
+
+var btcUSDT = trading.NewInstrument("BTC", "USDT")
+
+type venueClient struct {
+	book *trading.OrderBook
+}
+
+func (c *venueClient) Sell(trading.SellRequest) (trading.SellResponse, error) {
+	return trading.SellResponse{}, nil
+}
+
+func (c *venueClient) Buy(trading.BuyRequest) (trading.BuyResponse, error) {
+	return trading.BuyResponse{}, nil
+}
+
+func (c *venueClient) GetOrderDetail(trading.GetOrderDetailRequest) (trading.GetOrderDetailResponse, error) {
+	return trading.GetOrderDetailResponse{}, nil
+}
+
+func (c *venueClient) ListInstruments() ([]trading.Listing, error) {
+	return []trading.Listing{{Instrument: btcUSDT, Symbol: "BTCUSDT", Tradable: true}}, nil
+}
+
+func (c *venueClient) SubscribeOrderBook(ctx context.Context, instrument trading.Instrument) (*trading.OrderBook, error) {
+	return c.book, nil
+}
+
+func levels(pairs ...string) []trading.Level {
+	var list []trading.Level
+	for i := 0; i < len(pairs); i += 2 {
+		list = append(list, trading.Level{
+			Price: decimal.RequireFromString(pairs[i]),
+			Size:  decimal.RequireFromString(pairs[i+1]),
+		})
+	}
+
+	return list
+}
+
+func newVenue(bids, asks []trading.Level) *venueClient {
+	book := trading.NewOrderBook(btcUSDT)
+	book.Snapshot(bids, asks, time.Now())
+
+	return &venueClient{book: book}
+}
+
+func TestAggregator_Book(t *testing.T) {
+	binance := newVenue(levels("99", "1", "98", "2"), levels("101", "1", "103", "5"))
+
+	registry := trading.NewRegistry()
+	registry.Set("binance", binance)
+	registry.Set("binance:hedge", newVenue(levels("200", "1"), levels("1", "1")))
+	registry.Set("bybit", newVenue(levels("99.5", "1"), levels("100.5", "1")))
+	registry.Set("coinbase", &venueClient{book: trading.NewOrderBook(btcUSDT)})
+
+	aggregator := NewAggregator(registry, Config{
+		TakerFees: map[string]decimal.Decimal{"bybit": decimal.RequireFromString("0.01")},
+	})
+	defer aggregator.Close()
+
+	b, err := aggregator.Book(btcUSDT)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Coinbase is not synced yet and binance:hedge shares binance's book.
+	if len(b.Venues) != 2 {
+		t.Fatalf("got venues %v", b.Venues)
+	}
+
+	// With its 1% fee bybit's 100.5 ask costs 101.505, more than binance's
+	// 101, and its 99.5 bid returns 98.505.
+	wantAsks := []string{"binance", "bybit", "binance"}
+	for i, venue := range wantAsks {
+		if b.Asks[i].Venue != venue {
+			t.Fatalf("got asks %+v", b.Asks)
+		}
+	}
+	if b.Asks[1].EffectivePrice.String() != "101.505" || b.Bids[0].Venue != "binance" || b.Bids[1].EffectivePrice.String() != "98.505" {
+		t.Fatalf("got bids %+v asks %+v", b.Bids, b.Asks)
+	}
+
+	fill, err := b.Buy(decimal.RequireFromString("3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fill.Quote.String() != "304.5" || fill.Fee.String() != "1.005" || fill.AveragePrice.String() != "101.5" {
+		t.Fatalf("got fill %+v", fill)
+	}
+	if len(fill.Venues) != 2 || fill.Venues[0].Base.String() != "2" || fill.Venues[1].Base.String() != "1" {
+		t.Fatalf("got venue fills %+v", fill.Venues)
+	}
+
+	fill, err = b.Sell(decimal.RequireFromString("10"))
+	if !errors.Is(err, ErrInsufficientLiquidity) || fill.Base.String() != "4" {
+		t.Fatalf("got fill %+v and error %v", fill, err)
+	}
+
+	if len(b.Depth(1).Asks) != 1 || len(b.Asks) != 3 {
+		t.Fatal("depth did not limit a copy of the book")
+	}
+
+	cached, _ := aggregator.Book(btcUSDT)
+	if cached != b {
+		t.Fatal("unchanged book was merged again")
+	}
+
+	binance.book.Update(nil, levels("100", "1"), time.Now())
+	b, err = aggregator.Book(btcUSDT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Asks[0].Price.String() != "100" {
+		t.Fatalf("got asks %+v after an update", b.Asks)
+	}
+
+	_, err = aggregator.Book(trading.NewInstrument("ETH", "USDT"))
+	if !errors.Is(err, trading.ErrUnknownInstrument) {
+		t.Fatalf("got error %v for unlisted instrument", err)
+	}
+}
+
+func BenchmarkBook_Buy(b *testing.B) {
+	registry := trading.NewRegistry()
+	for _, venue := range []string{"binance", "bybit", "coinbase"} {
+		var bids, asks []string
+		for i := 0; i < 50; i++ {
+			bids = append(bids, decimal.NewFromInt(int64(1000-i)).String(), "0.5")
+			asks = append(asks, decimal.NewFromInt(int64(1001+i)).String(), "0.5")
+		}
+		registry.Set(venue, newVenue(levels(bids...), levels(asks...)))
+	}
+
+	aggregator := NewAggregator(registry, Config{})
+	defer aggregator.Close()
+
+	amount := decimal.NewFromInt(10)
+	for i := 0; i < b.N; i++ {
+		book, err := aggregator.Book(btcUSDT)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, _ = book.Buy(amount)
+	}
+}
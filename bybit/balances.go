@@ -0,0 +1,104 @@
+package bybit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/trading"
+)
+
+type walletBalanceResponse struct {
+	RetCode int    `json:"retCode"`
+	RetMsg  string `json:"retMsg"`
+	Result  struct {
+		List []struct {
+			Coin []struct {
+				Coin          string          `json:"coin"`
+				WalletBalance decimal.Decimal `json:"walletBalance"`
+				Locked        decimal.Decimal `json:"locked"`
+			} `json:"coin"`
+		} `json:"list"`
+	} `json:"result"`
+}
+
+// GetBalances reports the coins of the unified trading account.
+func (c *client) GetBalances() ([]trading.Balance, error) {
+	q := url.Values{}
+	q.Set("accountType", "UNIFIED")
+
+	resBody, err := c.get("/v5/account/wallet-balance", q.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	var response walletBalanceResponse
+	err = json.Unmarshal(resBody, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.RetCode != 0 {
+		return nil, fmt.Errorf("get ret code %d and message %s", response.RetCode, response.RetMsg)
+	}
+
+	var balances []trading.Balance
+	for _, account := range response.Result.List {
+		for _, coin := range account.Coin {
+			if coin.WalletBalance.IsZero() {
+				continue
+			}
+
+			balances = append(balances, trading.Balance{
+				Asset:  coin.Coin,
+				Free:   coin.WalletBalance.Sub(coin.Locked),
+				Locked: coin.Locked,
+			})
+		}
+	}
+
+	return balances, nil
+}
+
+// get sends a signed GET request with the query and returns the body of a
+// successful response.
+func (c *client) get(path, query string) ([]byte, error) {
+	u, err := url.Parse(c.config.URL + path)
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = query
+
+	recvWindow := int64(10000)
+	timestamp := time.Now().UnixMilli()
+	signature := c.sign(query, "", timestamp, recvWindow)
+
+	httpReq, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.Header = c.createHeader(signature, timestamp, recvWindow)
+
+	res, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get http response code %d and body %s", res.StatusCode, resBody)
+	}
+
+	return resBody, nil
+}
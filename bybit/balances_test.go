@@ -0,0 +1,34 @@
+package bybit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"trading-aggregator/trading"
+)
+
+func TestClient_GetBalances(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v5/account/wallet-balance", func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("accountType") != "UNIFIED" {
+			t.Errorf("got query %s", r.URL.RawQuery)
+		}
+
+		fmt.Fprint(rw, `{"retCode":0,"result":{"list":[{"coin":[{"coin":"SOL","walletBalance":"10","locked":"2"},{"coin":"ETH","walletBalance":"0","locked":"0"}]}]}}`)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient(Config{URL: server.URL, APIKey: "key", APISecret: "secret"}, server.Client())
+
+	balances, err := c.(trading.BalanceClient).GetBalances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(balances) != 1 || balances[0].Asset != "SOL" || balances[0].Free.String() != "8" || balances[0].Locked.String() != "2" {
+		t.Fatalf("got %+v", balances)
+	}
+}
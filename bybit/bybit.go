@@ -6,12 +6,15 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"hash"
 	"io"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"trading-aggregator/trading"
@@ -20,24 +23,49 @@ import (
 )
 
 type Config struct {
-	URL       string
-	APIKey    string
-	APISecret string
+	URL           string
+	StreamURL     string
+	MarketDataURL string
+	APIKey        string
+	APISecret     string
+	// Category is "spot", the default, "linear" for USDT and USDC perpetuals
+	// or "inverse" for coin-margined perpetuals.
+	Category string
 }
 
+const (
+	categorySpot    = "spot"
+	categoryLinear  = "linear"
+	categoryInverse = "inverse"
+)
+
 type client struct {
-	config     Config
-	hmac       hash.Hash
-	httpClient *http.Client
+	config      Config
+	hmacMu      sync.Mutex
+	hmac        hash.Hash
+	httpClient  *http.Client
+	instruments *trading.Instruments
 }
 
 type orderRequest struct {
-	Category    string `json:"category"`
-	Symbol      string `json:"symbol"`
-	Side        string `json:"side"`
-	Qty         string `json:"qty"`
-	OrderType   string `json:"orderType"`
-	OrderLinkID string `json:"orderLinkId"`
+	Category  string `json:"category"`
+	Symbol    string `json:"symbol"`
+	Side      string `json:"side"`
+	Qty       string `json:"qty"`
+	OrderType string `json:"orderType"`
+	// MarketUnit says which asset Qty is in for spot market orders. Without
+	// it Bybit reads the Qty of a spot market buy as a quote amount.
+	MarketUnit  string `json:"marketUnit,omitempty"`
+	Price       string `json:"price,omitempty"`
+	TimeInForce string `json:"timeInForce,omitempty"`
+	// TriggerPrice with the tpslOrder filter makes a spot TP/SL order;
+	// derivatives conditional orders take a TriggerDirection instead.
+	TriggerPrice     string `json:"triggerPrice,omitempty"`
+	TriggerDirection int    `json:"triggerDirection,omitempty"`
+	OrderFilter      string `json:"orderFilter,omitempty"`
+	ReduceOnly       bool   `json:"reduceOnly,omitempty"`
+	PositionIdx      int    `json:"positionIdx,omitempty"`
+	OrderLinkID      string `json:"orderLinkId"`
 }
 
 type orderResponse struct {
@@ -93,22 +121,79 @@ type orderData struct {
 	RejectedReason string `json:"rejectReason"`
 }
 
+func init() {
+	trading.RegisterAdapter(trading.Adapter{
+		Name: "bybit",
+		Capabilities: trading.Capabilities{
+			Spot:             true,
+			Derivatives:      true,
+			LimitOrders:      true,
+			StopOrders:       true,
+			StopMarketOrders: true,
+			WebSocket:        true,
+			OrderBook:        true,
+			Klines:           true,
+			Trades:           true,
+		},
+		Factory: func(config trading.AdapterConfig) (trading.Client, error) {
+			switch config.Category {
+			case "", categorySpot, categoryLinear, categoryInverse:
+			default:
+				return nil, fmt.Errorf("unknown bybit category %q", config.Category)
+			}
+
+			return NewClient(Config{
+				URL:           config.URL,
+				StreamURL:     config.StreamURL,
+				MarketDataURL: config.MarketDataURL,
+				APIKey:        config.APIKey,
+				APISecret:     config.APISecret,
+				Category:      config.Category,
+			}, config.HTTPClient), nil
+		},
+	})
+}
+
+// NewClient returns a client of the category in config. Linear and inverse
+// clients are trading.DerivativesClients.
 func NewClient(config Config, httpClient *http.Client) trading.Client {
-	return &client{
+	if config.Category == "" {
+		config.Category = categorySpot
+	}
+
+	c := &client{
 		config:     config,
 		hmac:       hmac.New(sha256.New, []byte(config.APISecret)),
 		httpClient: httpClient,
 	}
+	c.instruments = trading.NewInstruments(c.getInstruments, time.Hour)
+
+	if c.isDerivatives() {
+		return &derivativesClient{client: c}
+	}
+
+	return c
+}
+
+func (c *client) isDerivatives() bool {
+	return c.config.Category != categorySpot
+}
+
+// QuoteSized reports whether order quantities are USD contracts, which they
+// are on inverse perpetuals.
+func (c *client) QuoteSized() bool {
+	return c.config.Category == categoryInverse
 }
 
 func (c *client) Sell(req trading.SellRequest) (trading.SellResponse, error) {
-	body := orderRequest{
-		Category:    "spot",
-		Symbol:      fmt.Sprintf("%s%s", req.Base, req.Quote),
-		Side:        "Sell",
-		Qty:         req.Amount,
-		OrderType:   "Market",
-		OrderLinkID: req.ClientOrderID,
+	listing, err := c.instruments.Tradable(trading.NewInstrument(req.Base, req.Quote))
+	if err != nil {
+		return trading.SellResponse{}, err
+	}
+
+	body, err := newOrderRequest(c.config.Category, listing, "Sell", req.TradeRequest)
+	if err != nil {
+		return trading.SellResponse{}, err
 	}
 
 	response, err := c.placeOrder(body)
@@ -124,13 +209,14 @@ func (c *client) Sell(req trading.SellRequest) (trading.SellResponse, error) {
 }
 
 func (c *client) Buy(req trading.BuyRequest) (trading.BuyResponse, error) {
-	body := orderRequest{
-		Category:    "spot",
-		Symbol:      fmt.Sprintf("%s%s", req.Base, req.Quote),
-		Side:        "Buy",
-		Qty:         req.Amount,
-		OrderType:   "Market",
-		OrderLinkID: req.ClientOrderID,
+	listing, err := c.instruments.Tradable(trading.NewInstrument(req.Base, req.Quote))
+	if err != nil {
+		return trading.BuyResponse{}, err
+	}
+
+	body, err := newOrderRequest(c.config.Category, listing, "Buy", req.TradeRequest)
+	if err != nil {
+		return trading.BuyResponse{}, err
 	}
 
 	response, err := c.placeOrder(body)
@@ -145,6 +231,70 @@ func (c *client) Buy(req trading.BuyRequest) (trading.BuyResponse, error) {
 	}, nil
 }
 
+func newOrderRequest(category string, listing trading.Listing, side string, req trading.TradeRequest) (orderRequest, error) {
+	err := req.Validate()
+	if err != nil {
+		return orderRequest{}, err
+	}
+	if category == categorySpot && (req.ReduceOnly || req.PositionIdx != trading.OneWayPosition) {
+		return orderRequest{}, errors.New("reduce-only orders and position indexes need a linear or inverse account")
+	}
+	if req.IsQuoteSized() {
+		return orderRequest{}, errors.New("bybit does not take quote sized orders")
+	}
+
+	qty, err := listing.FormatBase(req.Amount)
+	if err != nil {
+		return orderRequest{}, err
+	}
+
+	body := orderRequest{
+		Category:    category,
+		Symbol:      listing.Symbol,
+		Side:        side,
+		Qty:         qty,
+		OrderType:   "Market",
+		ReduceOnly:  req.ReduceOnly,
+		PositionIdx: int(req.PositionIdx),
+		OrderLinkID: req.ClientOrderID,
+	}
+
+	if req.IsLimit() {
+		body.OrderType = "Limit"
+		body.TimeInForce = string(trading.GoodTillCanceled)
+		if req.TimeInForce != "" {
+			body.TimeInForce = string(req.TimeInForce)
+		}
+
+		body.Price, err = listing.FormatLimitPrice(req.Price, side == "Sell")
+		if err != nil {
+			return orderRequest{}, err
+		}
+	} else if category == categorySpot {
+		body.MarketUnit = "baseCoin"
+	}
+
+	// Spot TP/SL orders trigger on whichever side of the last price the
+	// trigger price is, so the direction needs no parameter of its own.
+	if req.IsStop() {
+		body.TriggerPrice, err = listing.FormatPrice(req.StopPrice)
+		if err != nil {
+			return orderRequest{}, err
+		}
+
+		switch {
+		case category == categorySpot:
+			body.OrderFilter = "tpslOrder"
+		case req.StopDirection == trading.StopRising:
+			body.TriggerDirection = 1
+		default:
+			body.TriggerDirection = 2
+		}
+	}
+
+	return body, nil
+}
+
 func (c *client) placeOrder(req orderRequest) (orderResponse, error) {
 	u, err := url.Parse(c.config.URL + "/v5/order/create")
 	if err != nil {
@@ -187,6 +337,11 @@ func (c *client) placeOrder(req orderRequest) (orderResponse, error) {
 		return orderResponse{}, err
 	}
 
+	// Rejections such as insufficient margin come back with status 200.
+	if response.RetCode != 0 {
+		return orderResponse{}, &retCodeError{Code: response.RetCode, Message: response.RetMsg}
+	}
+
 	return response, nil
 }
 
@@ -197,7 +352,7 @@ func (c *client) GetOrderDetail(req trading.GetOrderDetailRequest) (trading.GetO
 	}
 
 	q := getOrderDetailRequest{
-		Category:    "spot",
+		Category:    c.config.Category,
 		OrderID:     req.OrderID,
 		OrderLinkID: req.ClientOrderID,
 	}
@@ -235,19 +390,43 @@ func (c *client) GetOrderDetail(req trading.GetOrderDetailRequest) (trading.GetO
 		return trading.GetOrderDetailResponse{}, err
 	}
 
-	executedQuote, err := c.getExecutedQuote(getOrderDetailResponse.Result.List[0])
+	if getOrderDetailResponse.RetCode != 0 {
+		return trading.GetOrderDetailResponse{}, &retCodeError{Code: getOrderDetailResponse.RetCode, Message: getOrderDetailResponse.RetMsg}
+	}
+
+	// Unknown orders, and orders too old for the realtime endpoint, come back
+	// as an empty list.
+	if len(getOrderDetailResponse.Result.List) == 0 {
+		return trading.GetOrderDetailResponse{}, fmt.Errorf("order %s not found", orderRef(req.OrderID, req.ClientOrderID))
+	}
+	order := getOrderDetailResponse.Result.List[0]
+
+	executedBase, executedQuote, err := c.getExecuted(order)
 	if err != nil {
 		return trading.GetOrderDetailResponse{}, err
 	}
 
 	return trading.GetOrderDetailResponse{
-		Status:        getOrderDetailResponse.Result.List[0].OrderStatus,
-		ExecutedBase:  getOrderDetailResponse.Result.List[0].CumExecQty,
-		ExecutedQuote: executedQuote.String(),
+		Status:        order.OrderStatus,
+		ExecutedBase:  executedBase,
+		ExecutedQuote: executedQuote,
 	}, nil
 }
 
+// orderRef names an order by its exchange ID, or its client order ID when the
+// exchange ID is not known.
+func orderRef(orderID, clientOrderID string) string {
+	if orderID != "" {
+		return orderID
+	}
+
+	return clientOrderID
+}
+
 func (c *client) sign(query, body string, timestamp, recvWindow int64) string {
+	c.hmacMu.Lock()
+	defer c.hmacMu.Unlock()
+
 	c.hmac.Reset()
 	c.hmac.Write([]byte(strconv.FormatInt(timestamp, 10) + c.config.APIKey + strconv.FormatInt(recvWindow, 10) + query + body))
 
@@ -265,6 +444,35 @@ func (c *client) createHeader(signature string, timestamp, recvWindow int64) htt
 	return header
 }
 
+// getExecuted returns the executed base and quote amounts of an order.
+// Inverse quantities are in quote currency contracts and their value in the
+// base coin, the other way around.
+func (c *client) getExecuted(order orderData) (decimal.Decimal, decimal.Decimal, error) {
+	if c.config.Category == categoryInverse {
+		executedQuote, err := decimal.NewFromString(order.CumExecQty)
+		if err != nil {
+			return decimal.Decimal{}, decimal.Decimal{}, err
+		}
+		executedBase, err := decimal.NewFromString(order.CumExecValue)
+		if err != nil {
+			return decimal.Decimal{}, decimal.Decimal{}, err
+		}
+		return executedBase, executedQuote, nil
+	}
+
+	executedQuote, err := c.getExecutedQuote(order)
+	if err != nil {
+		return decimal.Decimal{}, decimal.Decimal{}, err
+	}
+
+	executedBase, err := decimal.NewFromString(order.CumExecQty)
+	if err != nil {
+		return decimal.Decimal{}, decimal.Decimal{}, err
+	}
+
+	return executedBase, executedQuote, nil
+}
+
 func (c *client) getExecutedQuote(order orderData) (decimal.Decimal, error) {
 	if order.AvgPrice != "" {
 		cumExecQtc, err := decimal.NewFromString(order.CumExecQty)
@@ -280,3 +488,178 @@ func (c *client) getExecutedQuote(order orderData) (decimal.Decimal, error) {
 
 	return decimal.NewFromString(order.CumExecValue)
 }
+
+type getTickersResponse struct {
+	RetCode int    `json:"retCode"`
+	RetMsg  string `json:"retMsg"`
+	Result  struct {
+		Category string `json:"category"`
+		List     []struct {
+			Symbol    string          `json:"symbol"`
+			LastPrice decimal.Decimal `json:"lastPrice"`
+		} `json:"list"`
+	} `json:"result"`
+}
+
+func (c *client) GetPrice(req trading.GetPriceRequest) (trading.GetPriceResponse, error) {
+	u, err := url.Parse(c.config.URL + "/v5/market/tickers")
+	if err != nil {
+		return trading.GetPriceResponse{}, err
+	}
+
+	symbol, err := c.instruments.Symbol(trading.NewInstrument(req.Base, req.Quote))
+	if err != nil {
+		return trading.GetPriceResponse{}, err
+	}
+
+	query := u.Query()
+	query.Add("category", c.config.Category)
+	query.Add("symbol", symbol)
+	u.RawQuery = query.Encode()
+
+	httpReq, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return trading.GetPriceResponse{}, err
+	}
+
+	res, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return trading.GetPriceResponse{}, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return trading.GetPriceResponse{}, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return trading.GetPriceResponse{}, fmt.Errorf("get http response code %d and body %s", res.StatusCode, resBody)
+	}
+
+	var getTickersResponse getTickersResponse
+	err = json.Unmarshal(resBody, &getTickersResponse)
+	if err != nil {
+		return trading.GetPriceResponse{}, err
+	}
+
+	if getTickersResponse.RetCode != 0 {
+		return trading.GetPriceResponse{}, fmt.Errorf("get ret code %d and message %s", getTickersResponse.RetCode, getTickersResponse.RetMsg)
+	}
+
+	if len(getTickersResponse.Result.List) == 0 {
+		return trading.GetPriceResponse{}, fmt.Errorf("no ticker for symbol %s", symbol)
+	}
+
+	return trading.GetPriceResponse{
+		Price: getTickersResponse.Result.List[0].LastPrice,
+	}, nil
+}
+
+type getInstrumentsResponse struct {
+	RetCode int    `json:"retCode"`
+	RetMsg  string `json:"retMsg"`
+	Result  struct {
+		Category string `json:"category"`
+		List     []struct {
+			Symbol        string `json:"symbol"`
+			BaseCoin      string `json:"baseCoin"`
+			QuoteCoin     string `json:"quoteCoin"`
+			Status        string `json:"status"`
+			ContractType  string `json:"contractType"`
+			LotSizeFilter struct {
+				BasePrecision  decimal.Decimal `json:"basePrecision"`
+				QuotePrecision decimal.Decimal `json:"quotePrecision"`
+				QtyStep        decimal.Decimal `json:"qtyStep"`
+				MinOrderQty    decimal.Decimal `json:"minOrderQty"`
+			} `json:"lotSizeFilter"`
+			PriceFilter struct {
+				TickSize decimal.Decimal `json:"tickSize"`
+			} `json:"priceFilter"`
+		} `json:"list"`
+		NextPageCursor string `json:"nextPageCursor"`
+	} `json:"result"`
+}
+
+func (c *client) ListInstruments() ([]trading.Listing, error) {
+	return c.instruments.List()
+}
+
+func (c *client) getInstruments() ([]trading.Listing, error) {
+	var listings []trading.Listing
+
+	cursor := ""
+	for {
+		u, err := url.Parse(c.config.URL + "/v5/market/instruments-info")
+		if err != nil {
+			return nil, err
+		}
+
+		query := u.Query()
+		query.Add("category", c.config.Category)
+		if cursor != "" {
+			query.Add("cursor", cursor)
+		}
+		u.RawQuery = query.Encode()
+
+		httpReq, err := http.NewRequest(http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := c.httpClient.Do(httpReq)
+		if err != nil {
+			return nil, err
+		}
+
+		// Close each page here rather than deferring to the end of the loop.
+		resBody, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("get http response code %d and body %s", res.StatusCode, resBody)
+		}
+
+		var getInstrumentsResponse getInstrumentsResponse
+		err = json.Unmarshal(resBody, &getInstrumentsResponse)
+		if err != nil {
+			return nil, err
+		}
+
+		if getInstrumentsResponse.RetCode != 0 {
+			return nil, fmt.Errorf("get ret code %d and message %s", getInstrumentsResponse.RetCode, getInstrumentsResponse.RetMsg)
+		}
+
+		for _, instrument := range getInstrumentsResponse.Result.List {
+			// Dated futures share their base and quote with the perpetual.
+			if c.isDerivatives() && !strings.HasSuffix(instrument.ContractType, "Perpetual") {
+				continue
+			}
+
+			// Derivatives quantities step by qtyStep, in contracts for
+			// inverse perpetuals.
+			baseIncrement := instrument.LotSizeFilter.BasePrecision
+			if c.isDerivatives() {
+				baseIncrement = instrument.LotSizeFilter.QtyStep
+			}
+
+			listings = append(listings, trading.Listing{
+				Instrument:     trading.NewInstrument(instrument.BaseCoin, instrument.QuoteCoin),
+				Symbol:         instrument.Symbol,
+				Tradable:       instrument.Status == "Trading",
+				BaseIncrement:  baseIncrement,
+				QuoteIncrement: instrument.LotSizeFilter.QuotePrecision,
+				PriceIncrement: instrument.PriceFilter.TickSize,
+				MinBase:        instrument.LotSizeFilter.MinOrderQty,
+			})
+		}
+
+		cursor = getInstrumentsResponse.Result.NextPageCursor
+		if cursor == "" {
+			return listings, nil
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package bybit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"trading-aggregator/trading"
+)
+
+type cancelOrderRequest struct {
+	Category    string `json:"category"`
+	Symbol      string `json:"symbol"`
+	OrderID     string `json:"orderId,omitempty"`
+	OrderLinkID string `json:"orderLinkId,omitempty"`
+}
+
+func (c *client) CancelOrder(req trading.CancelOrderRequest) error {
+	symbol, err := c.instruments.Symbol(trading.NewInstrument(req.Base, req.Quote))
+	if err != nil {
+		return err
+	}
+
+	return c.post("/v5/order/cancel", cancelOrderRequest{
+		Category:    c.config.Category,
+		Symbol:      symbol,
+		OrderID:     req.OrderID,
+		OrderLinkID: req.ClientOrderID,
+	})
+}
+
+type cancelAllOrdersRequest struct {
+	Category   string `json:"category"`
+	BaseCoin   string `json:"baseCoin,omitempty"`
+	SettleCoin string `json:"settleCoin,omitempty"`
+}
+
+// CancelAllOrders cancels the open orders of every symbol of the client's
+// category. Derivatives orders can only be canceled by settle or base coin,
+// so linear orders are canceled per settle coin and inverse ones per base
+// coin.
+func (c *client) CancelAllOrders() error {
+	var requests []cancelAllOrdersRequest
+	switch c.config.Category {
+	case categoryLinear:
+		for _, coin := range linearSettleCoins {
+			requests = append(requests, cancelAllOrdersRequest{Category: categoryLinear, SettleCoin: coin})
+		}
+	case categoryInverse:
+		listings, err := c.instruments.List()
+		if err != nil {
+			return err
+		}
+
+		seen := map[string]bool{}
+		for _, listing := range listings {
+			if !seen[listing.Instrument.Base] {
+				seen[listing.Instrument.Base] = true
+				requests = append(requests, cancelAllOrdersRequest{Category: categoryInverse, BaseCoin: listing.Instrument.Base})
+			}
+		}
+	default:
+		requests = append(requests, cancelAllOrdersRequest{Category: c.config.Category})
+	}
+
+	var errs []error
+	for _, req := range requests {
+		err := c.post("/v5/order/cancel-all", req)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// post sends a signed request whose response carries nothing but its return
+// code.
+func (c *client) post(path string, req interface{}) error {
+	u, err := url.Parse(c.config.URL + path)
+	if err != nil {
+		return err
+	}
+
+	bodyStr, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	recvWindow := int64(10000)
+	timestamp := time.Now().UnixMilli()
+	signature := c.sign("", string(bodyStr), timestamp, recvWindow)
+
+	httpReq, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(bodyStr))
+	if err != nil {
+		return err
+	}
+
+	httpReq.Header = c.createHeader(signature, timestamp, recvWindow)
+
+	res, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("get http response code %d and body %s", res.StatusCode, resBody)
+	}
+
+	var response orderResponse
+	err = json.Unmarshal(resBody, &response)
+	if err != nil {
+		return err
+	}
+
+	if response.RetCode != 0 {
+		return &retCodeError{Code: response.RetCode, Message: response.RetMsg}
+	}
+
+	return nil
+}
+
+// retCodeError is a response whose return code is not 0, for callers that
+// accept some codes as success.
+type retCodeError struct {
+	Code    int
+	Message string
+}
+
+func (e *retCodeError) Error() string {
+	return fmt.Sprintf("get ret code %d and message %s", e.Code, e.Message)
+}
@@ -0,0 +1,39 @@
+package bybit
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"trading-aggregator/trading"
+)
+
+func TestClient_CancelAllOrders(t *testing.T) {
+	var body string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v5/order/cancel-all", func(rw http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		if r.Header.Get("X-BAPI-SIGN") == "" {
+			t.Error("unsigned request")
+		}
+
+		fmt.Fprint(rw, `{"retCode":0,"retMsg":"OK","result":{"list":[]}}`)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient(Config{URL: server.URL, APIKey: "key", APISecret: "secret"}, server.Client())
+
+	err := c.(trading.CancelAller).CancelAllOrders()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != `{"category":"spot"}` {
+		t.Fatalf("got body %s", body)
+	}
+}
@@ -0,0 +1,283 @@
+package bybit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/trading"
+)
+
+// linearSettleCoins are the settle coins of linear perpetuals, which queries
+// across symbols have to name.
+var linearSettleCoins = []string{"USDT", "USDC"}
+
+// retCodeLeverageNotModified is returned when the leverage is already set.
+const retCodeLeverageNotModified = 110043
+
+// fundingHistoryWindow is the longest time range of one transaction log
+// query.
+const fundingHistoryWindow = 7 * 24 * time.Hour
+
+// derivativesClient is a client of a linear or inverse perpetuals account.
+type derivativesClient struct {
+	*client
+}
+
+type setLeverageRequest struct {
+	Category     string `json:"category"`
+	Symbol       string `json:"symbol"`
+	BuyLeverage  string `json:"buyLeverage"`
+	SellLeverage string `json:"sellLeverage"`
+}
+
+// SetLeverage sets the leverage of both sides of the instrument's position.
+func (c *derivativesClient) SetLeverage(req trading.SetLeverageRequest) error {
+	if !req.Leverage.IsPositive() {
+		return fmt.Errorf("leverage must be positive, got %s", req.Leverage)
+	}
+
+	symbol, err := c.instruments.Symbol(trading.NewInstrument(req.Base, req.Quote))
+	if err != nil {
+		return err
+	}
+
+	err = c.post("/v5/position/set-leverage", setLeverageRequest{
+		Category:     c.config.Category,
+		Symbol:       symbol,
+		BuyLeverage:  req.Leverage.String(),
+		SellLeverage: req.Leverage.String(),
+	})
+
+	var retCode *retCodeError
+	if errors.As(err, &retCode) && retCode.Code == retCodeLeverageNotModified {
+		return nil
+	}
+
+	return err
+}
+
+type positionListResponse struct {
+	RetCode int    `json:"retCode"`
+	RetMsg  string `json:"retMsg"`
+	Result  struct {
+		List           []positionData `json:"list"`
+		NextPageCursor string         `json:"nextPageCursor"`
+	} `json:"result"`
+}
+
+// positionData has its numbers as strings since Bybit leaves those that do
+// not apply empty, such as the liquidation price of a hedged position.
+type positionData struct {
+	PositionIdx   int    `json:"positionIdx"`
+	Symbol        string `json:"symbol"`
+	Side          string `json:"side"`
+	Size          string `json:"size"`
+	AvgPrice      string `json:"avgPrice"`
+	MarkPrice     string `json:"markPrice"`
+	LiqPrice      string `json:"liqPrice"`
+	Leverage      string `json:"leverage"`
+	UnrealisedPnl string `json:"unrealisedPnl"`
+	TradeMode     int    `json:"tradeMode"`
+}
+
+// GetPositions reports the open positions on /v5/position/list. Linear
+// positions of all symbols are listed per settle coin.
+func (c *derivativesClient) GetPositions(req trading.GetPositionsRequest) ([]trading.Position, error) {
+	var queries []url.Values
+	if req.Base != "" || req.Quote != "" {
+		symbol, err := c.instruments.Symbol(trading.NewInstrument(req.Base, req.Quote))
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, url.Values{"symbol": {symbol}})
+	} else if c.config.Category == categoryLinear {
+		for _, coin := range linearSettleCoins {
+			queries = append(queries, url.Values{"settleCoin": {coin}})
+		}
+	} else {
+		queries = append(queries, url.Values{})
+	}
+
+	var positions []trading.Position
+	for _, q := range queries {
+		q.Set("category", c.config.Category)
+		q.Set("limit", "200")
+
+		for {
+			resBody, err := c.get("/v5/position/list", q.Encode())
+			if err != nil {
+				return nil, err
+			}
+
+			var response positionListResponse
+			err = json.Unmarshal(resBody, &response)
+			if err != nil {
+				return nil, err
+			}
+
+			if response.RetCode != 0 {
+				return nil, &retCodeError{Code: response.RetCode, Message: response.RetMsg}
+			}
+
+			for _, p := range response.Result.List {
+				position, err := c.position(p)
+				if err != nil {
+					return nil, err
+				}
+				if !position.Size.IsZero() {
+					positions = append(positions, position)
+				}
+			}
+
+			if response.Result.NextPageCursor == "" {
+				break
+			}
+			q.Set("cursor", response.Result.NextPageCursor)
+		}
+	}
+
+	return positions, nil
+}
+
+func (c *derivativesClient) position(p positionData) (trading.Position, error) {
+	position := trading.Position{
+		Symbol:      p.Symbol,
+		Instrument:  c.streamInstrument(p.Symbol),
+		PositionIdx: trading.PositionIdx(p.PositionIdx),
+		MarginType:  trading.CrossMargin,
+	}
+	if p.TradeMode == 1 {
+		position.MarginType = trading.IsolatedMargin
+	}
+
+	fields := map[*decimal.Decimal]string{
+		&position.Size:             p.Size,
+		&position.EntryPrice:       p.AvgPrice,
+		&position.MarkPrice:        p.MarkPrice,
+		&position.LiquidationPrice: p.LiqPrice,
+		&position.Leverage:         p.Leverage,
+		&position.UnrealizedPnL:    p.UnrealisedPnl,
+	}
+	for field, value := range fields {
+		if value == "" {
+			continue
+		}
+
+		d, err := decimal.NewFromString(value)
+		if err != nil {
+			return trading.Position{}, fmt.Errorf("position %s: %w", p.Symbol, err)
+		}
+		*field = d
+	}
+
+	if p.Side == "Sell" {
+		position.Size = position.Size.Neg()
+	}
+
+	return position, nil
+}
+
+type transactionLogResponse struct {
+	RetCode int    `json:"retCode"`
+	RetMsg  string `json:"retMsg"`
+	Result  struct {
+		List []struct {
+			Symbol          string          `json:"symbol"`
+			Currency        string          `json:"currency"`
+			Funding         decimal.Decimal `json:"funding"`
+			FeeRate         decimal.Decimal `json:"feeRate"`
+			TransactionTime string          `json:"transactionTime"`
+		} `json:"list"`
+		NextPageCursor string `json:"nextPageCursor"`
+	} `json:"result"`
+}
+
+// GetFundingHistory lists the funding settlements of the unified account's
+// transaction log, which Bybit reports as fees: positive when paid. Ranges
+// longer than a week are queried a week at a time; without Start, the last
+// day is.
+func (c *derivativesClient) GetFundingHistory(req trading.GetFundingHistoryRequest) ([]trading.FundingPayment, error) {
+	var symbol string
+	q := url.Values{}
+	if req.Base != "" || req.Quote != "" {
+		listing, err := c.instruments.Tradable(trading.NewInstrument(req.Base, req.Quote))
+		if err != nil {
+			return nil, err
+		}
+		symbol = listing.Symbol
+		q.Set("baseCoin", listing.Instrument.Base)
+	}
+
+	end := req.End
+	if end.IsZero() {
+		end = time.Now()
+	}
+	start := req.Start
+	if start.IsZero() {
+		start = end.Add(-24 * time.Hour)
+	}
+	if !start.Before(end) {
+		return nil, fmt.Errorf("funding history start %s is not before its end %s", start, end)
+	}
+
+	q.Set("accountType", "UNIFIED")
+	q.Set("category", c.config.Category)
+	q.Set("type", "SETTLEMENT")
+	q.Set("limit", "50")
+
+	var payments []trading.FundingPayment
+	for from := start; from.Before(end); from = from.Add(fundingHistoryWindow) {
+		to := from.Add(fundingHistoryWindow)
+		if to.After(end) {
+			to = end
+		}
+		q.Set("startTime", strconv.FormatInt(from.UnixMilli(), 10))
+		q.Set("endTime", strconv.FormatInt(to.UnixMilli(), 10))
+		q.Del("cursor")
+
+		for {
+			resBody, err := c.get("/v5/account/transaction-log", q.Encode())
+			if err != nil {
+				return nil, err
+			}
+
+			var response transactionLogResponse
+			err = json.Unmarshal(resBody, &response)
+			if err != nil {
+				return nil, err
+			}
+
+			if response.RetCode != 0 {
+				return nil, &retCodeError{Code: response.RetCode, Message: response.RetMsg}
+			}
+
+			for _, t := range response.Result.List {
+				if symbol != "" && t.Symbol != symbol {
+					continue
+				}
+
+				payments = append(payments, trading.FundingPayment{
+					Symbol:     t.Symbol,
+					Instrument: c.streamInstrument(t.Symbol),
+					Asset:      t.Currency,
+					Amount:     t.Funding.Neg(),
+					Rate:       t.FeeRate,
+					Time:       parseMillis(t.TransactionTime),
+				})
+			}
+
+			if response.Result.NextPageCursor == "" {
+				break
+			}
+			q.Set("cursor", response.Result.NextPageCursor)
+		}
+	}
+
+	return payments, nil
+}
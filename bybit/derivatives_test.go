@@ -0,0 +1,115 @@
+package bybit
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/trading"
+)
+
+func TestDerivativesClient(t *testing.T) {
+	var orderBody, leverageBody string
+	queries := map[string][]string{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v5/market/instruments-info", func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("category") != "linear" {
+			t.Errorf("got query %s", r.URL.RawQuery)
+		}
+		fmt.Fprint(rw, `{"retCode":0,"result":{"category":"linear","list":[
+			{"symbol":"BTCUSDT","baseCoin":"BTC","quoteCoin":"USDT","status":"Trading","contractType":"LinearPerpetual","lotSizeFilter":{"qtyStep":"0.001","minOrderQty":"0.001"},"priceFilter":{"tickSize":"0.10"}},
+			{"symbol":"BTC-27DEC24","baseCoin":"BTC","quoteCoin":"USDT","status":"Trading","contractType":"LinearFutures","lotSizeFilter":{"qtyStep":"0.01","minOrderQty":"0.01"},"priceFilter":{"tickSize":"0.5"}}
+		]}}`)
+	})
+	mux.HandleFunc("/v5/order/create", func(rw http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		orderBody = string(b)
+		fmt.Fprint(rw, `{"retCode":0,"result":{"orderId":"1"}}`)
+	})
+	mux.HandleFunc("/v5/position/set-leverage", func(rw http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		leverageBody = string(b)
+		fmt.Fprint(rw, `{"retCode":110043,"retMsg":"leverage not modified"}`)
+	})
+	mux.HandleFunc("/v5/position/list", func(rw http.ResponseWriter, r *http.Request) {
+		queries["positions"] = append(queries["positions"], r.URL.Query().Get("settleCoin"))
+		if r.URL.Query().Get("settleCoin") != "USDT" {
+			fmt.Fprint(rw, `{"retCode":0,"result":{"list":[]}}`)
+			return
+		}
+		fmt.Fprint(rw, `{"retCode":0,"result":{"list":[
+			{"positionIdx":2,"symbol":"BTCUSDT","side":"Sell","size":"0.5","avgPrice":"60000","markPrice":"59000","liqPrice":"","leverage":"10","unrealisedPnl":"500","tradeMode":1},
+			{"positionIdx":1,"symbol":"BTCUSDT","side":"","size":"0","avgPrice":"0","markPrice":"59000","liqPrice":"","leverage":"10","unrealisedPnl":"0","tradeMode":1}
+		]}}`)
+	})
+	mux.HandleFunc("/v5/account/transaction-log", func(rw http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		queries["funding"] = append(queries["funding"], q.Get("startTime")+"-"+q.Get("endTime"))
+		if q.Get("type") != "SETTLEMENT" || q.Get("baseCoin") != "BTC" {
+			t.Errorf("got query %s", r.URL.RawQuery)
+		}
+		fmt.Fprint(rw, `{"retCode":0,"result":{"list":[
+			{"symbol":"BTCUSDT","currency":"USDT","funding":"-1.5","feeRate":"0.0001","transactionTime":"1704067200000"},
+			{"symbol":"BTCPERP","currency":"USDC","funding":"2","feeRate":"0.0001","transactionTime":"1704067200000"}
+		]}}`)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c, ok := NewClient(Config{URL: server.URL, APIKey: "key", APISecret: "secret", Category: "linear"}, server.Client()).(trading.DerivativesClient)
+	if !ok {
+		t.Fatal("linear client is not a derivatives client")
+	}
+
+	_, err := c.Sell(trading.SellRequest{TradeRequest: trading.TradeRequest{
+		Base:          "BTC",
+		Quote:         "USDT",
+		Amount:        decimal.RequireFromString("0.5"),
+		StopPrice:     decimal.NewFromInt(61000),
+		StopDirection: trading.StopRising,
+		ReduceOnly:    true,
+		PositionIdx:   trading.LongPosition,
+		ClientOrderID: "tp",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"category":"linear","symbol":"BTCUSDT","side":"Sell","qty":"0.500","orderType":"Market","triggerPrice":"61000.0","triggerDirection":1,"reduceOnly":true,"positionIdx":1,"orderLinkId":"tp"}`
+	if orderBody != want {
+		t.Fatalf("got order %s", orderBody)
+	}
+
+	err = c.SetLeverage(trading.SetLeverageRequest{Base: "BTC", Quote: "USDT", Leverage: decimal.NewFromInt(10)})
+	if err != nil || leverageBody != `{"category":"linear","symbol":"BTCUSDT","buyLeverage":"10","sellLeverage":"10"}` {
+		t.Fatalf("got %v and body %s", err, leverageBody)
+	}
+
+	positions, err := c.GetPositions(trading.GetPositionsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) != 1 || len(queries["positions"]) != 2 {
+		t.Fatalf("got positions %+v from queries %v", positions, queries["positions"])
+	}
+	p := positions[0]
+	if p.Instrument != trading.NewInstrument("BTC", "USDT") || p.PositionIdx != trading.ShortPosition || p.Size.String() != "-0.5" ||
+		!p.LiquidationPrice.IsZero() || p.MarginType != trading.IsolatedMargin {
+		t.Fatalf("got position %+v", p)
+	}
+
+	end := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	payments, err := c.GetFundingHistory(trading.GetFundingHistoryRequest{Base: "BTC", Quote: "USDT", Start: end.Add(-9 * 24 * time.Hour), End: end})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queries["funding"]) != 2 || len(payments) != 2 || payments[0].Amount.String() != "1.5" || payments[0].Asset != "USDT" {
+		t.Fatalf("got payments %+v from queries %v", payments, queries["funding"])
+	}
+}
@@ -0,0 +1,114 @@
+package bybit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/stream"
+	"trading-aggregator/trading"
+)
+
+const orderBookDepth = 50
+
+type orderBookMessage struct {
+	Topic string `json:"topic"`
+	Type  string `json:"type"`
+	Ts    int64  `json:"ts"`
+	Data  struct {
+		Symbol   string               `json:"s"`
+		Bids     [][2]decimal.Decimal `json:"b"`
+		Asks     [][2]decimal.Decimal `json:"a"`
+		UpdateID int64                `json:"u"`
+		Seq      int64                `json:"seq"`
+	} `json:"data"`
+}
+
+// SubscribeOrderBook follows the orderbook.50 topic. Bybit sends a snapshot
+// after subscribing and deltas numbered by consecutive update ids; a gap
+// reconnects, which brings a fresh snapshot.
+func (c *client) SubscribeOrderBook(ctx context.Context, instrument trading.Instrument) (*trading.OrderBook, error) {
+	symbol, err := c.instruments.Symbol(instrument)
+	if err != nil {
+		return nil, err
+	}
+
+	topic := fmt.Sprintf("orderbook.%d.%s", orderBookDepth, symbol)
+	book := trading.NewOrderBook(instrument)
+
+	var updateID int64
+	go stream.Run(ctx, stream.Config{
+		URL: func(context.Context) (string, error) {
+			book.Reset()
+			updateID = 0
+
+			return strings.TrimRight(c.config.MarketDataURL, "/") + "/v5/public/" + c.config.Category, nil
+		},
+		OnConnect: func(ctx context.Context, conn *stream.Conn) error {
+			return conn.WriteJSON(streamOperation{
+				Op:   "subscribe",
+				Args: []interface{}{topic},
+			})
+		},
+		OnMessage: func(data []byte) error {
+			var message streamMessage
+			err := json.Unmarshal(data, &message)
+			if err != nil {
+				return err
+			}
+
+			if message.Success != nil && !*message.Success {
+				return fmt.Errorf("%s failed: %s", message.Op, message.RetMsg)
+			}
+			if message.Topic != topic {
+				return nil
+			}
+
+			var update orderBookMessage
+			err = json.Unmarshal(data, &update)
+			if err != nil {
+				return err
+			}
+
+			t := time.UnixMilli(update.Ts).UTC()
+			bids, asks := levels(update.Data.Bids), levels(update.Data.Asks)
+
+			// An update id of 1 means Bybit restarted its book service and the
+			// delta is to be taken as a snapshot.
+			if update.Type == "snapshot" || update.Data.UpdateID == 1 {
+				book.Snapshot(bids, asks, t)
+				updateID = update.Data.UpdateID
+				return nil
+			}
+
+			if updateID == 0 {
+				return nil
+			}
+			if update.Data.UpdateID != updateID+1 {
+				book.Reset()
+				return fmt.Errorf("order book update %d after %d", update.Data.UpdateID, updateID)
+			}
+
+			book.Update(bids, asks, t)
+			updateID = update.Data.UpdateID
+
+			return nil
+		},
+		PingMessage: []byte(`{"op":"ping"}`),
+	})
+
+	return book, nil
+}
+
+func levels(pairs [][2]decimal.Decimal) []trading.Level {
+	list := make([]trading.Level, len(pairs))
+	for i, pair := range pairs {
+		list[i] = trading.Level{Price: pair[0], Size: pair[1]}
+	}
+
+	return list
+}
@@ -0,0 +1,99 @@
+package bybit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"trading-aggregator/trading"
+)
+
+func TestClient_SubscribeOrderBook(t *testing.T) {
+	var connections int32
+	upgrader := websocket.Upgrader{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v5/market/instruments-info", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, `{"retCode":0,"result":{"category":"spot","list":[{"symbol":"SOLUSDT","baseCoin":"SOL","quoteCoin":"USDT","status":"Trading"}]}}`)
+	})
+	mux.HandleFunc("/v5/public/spot", func(rw http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(rw, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		var subscribe streamOperation
+		if ws.ReadJSON(&subscribe) != nil || subscribe.Op != "subscribe" || subscribe.Args[0] != "orderbook.50.SOLUSDT" {
+			return
+		}
+
+		var messages []string
+		if atomic.AddInt32(&connections, 1) == 1 {
+			messages = []string{
+				`{"op":"subscribe","success":true}`,
+				`{"topic":"orderbook.50.SOLUSDT","type":"snapshot","ts":1,"data":{"s":"SOLUSDT","b":[["99","1"]],"a":[["101","1"]],"u":10}}`,
+				`{"topic":"orderbook.50.SOLUSDT","type":"delta","ts":2,"data":{"s":"SOLUSDT","b":[["100","1"]],"a":[],"u":11}}`,
+				`{"topic":"orderbook.50.SOLUSDT","type":"delta","ts":3,"data":{"s":"SOLUSDT","b":[["99.5","1"]],"a":[],"u":13}}`,
+			}
+		} else {
+			messages = []string{
+				`{"topic":"orderbook.50.SOLUSDT","type":"snapshot","ts":4,"data":{"s":"SOLUSDT","b":[["97","1"]],"a":[["103","1"]],"u":20}}`,
+				`{"topic":"orderbook.50.SOLUSDT","type":"delta","ts":5,"data":{"s":"SOLUSDT","b":[],"a":[["102","2"]],"u":21}}`,
+			}
+		}
+		for _, message := range messages {
+			if ws.WriteMessage(websocket.TextMessage, []byte(message)) != nil {
+				return
+			}
+		}
+
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient(Config{
+		URL:           server.URL,
+		MarketDataURL: "ws" + strings.TrimPrefix(server.URL, "http"),
+	}, server.Client())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	book, err := c.(trading.MarketDataClient).SubscribeOrderBook(ctx, trading.NewInstrument("SOL", "USDT"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ticker, err := book.Ticker()
+		if err == nil && ticker.Ask.String() == "102" {
+			if ticker.Bid.String() != "97" {
+				t.Fatalf("got ticker %+v", ticker)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got ticker %+v, %v", ticker, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if atomic.LoadInt32(&connections) != 2 {
+		t.Fatalf("got %d connections, want a resync after the gap", connections)
+	}
+}
@@ -0,0 +1,118 @@
+package bybit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/trading"
+)
+
+func TestNewOrderRequest_Stop(t *testing.T) {
+	listing := trading.Listing{
+		Instrument:     trading.NewInstrument("BTC", "USDT"),
+		Symbol:         "BTCUSDT",
+		BaseIncrement:  decimal.RequireFromString("0.001"),
+		PriceIncrement: decimal.RequireFromString("0.1"),
+	}
+
+	body, err := newOrderRequest(categorySpot, listing, "Sell", trading.TradeRequest{
+		Amount:        decimal.RequireFromString("0.5"),
+		Type:          trading.OrderTypeLimit,
+		Price:         decimal.NewFromInt(59000),
+		StopPrice:     decimal.NewFromInt(60000),
+		StopDirection: trading.StopFalling,
+		ClientOrderID: "sl",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := json.Marshal(body)
+	want := `{"category":"spot","symbol":"BTCUSDT","side":"Sell","qty":"0.500","orderType":"Limit","price":"59000.0","timeInForce":"GTC","triggerPrice":"60000.0","orderFilter":"tpslOrder","orderLinkId":"sl"}`
+	if string(b) != want {
+		t.Fatalf("got %s", b)
+	}
+
+	_, err = newOrderRequest(categorySpot, listing, "Sell", trading.TradeRequest{Amount: decimal.NewFromInt(1), StopPrice: decimal.NewFromInt(60000)})
+	if err == nil {
+		t.Fatal("accepted a stop order without a direction")
+	}
+}
+
+func TestClient_Buy_SpotMarket(t *testing.T) {
+	var orderBody string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v5/market/instruments-info", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, `{"retCode":0,"result":{"category":"spot","list":[
+			{"symbol":"BTCUSDT","baseCoin":"BTC","quoteCoin":"USDT","status":"Trading","lotSizeFilter":{"basePrecision":"0.000001","quotePrecision":"0.01","minOrderQty":"0.000048"},"priceFilter":{"tickSize":"0.01"}}
+		]}}`)
+	})
+	mux.HandleFunc("/v5/order/create", func(rw http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		orderBody = string(b)
+		fmt.Fprint(rw, `{"retCode":0,"result":{"orderId":"1"}}`)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient(Config{URL: server.URL, APIKey: "key", APISecret: "secret"}, server.Client())
+
+	_, err := c.Buy(trading.BuyRequest{TradeRequest: trading.TradeRequest{
+		Base:          "BTC",
+		Quote:         "USDT",
+		Amount:        decimal.RequireFromString("0.5"),
+		ClientOrderID: "buy",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Bybit reads the qty of a spot market buy as USDT unless told otherwise.
+	want := `{"category":"spot","symbol":"BTCUSDT","side":"Buy","qty":"0.500000","orderType":"Market","marketUnit":"baseCoin","orderLinkId":"buy"}`
+	if orderBody != want {
+		t.Fatalf("got order %s", orderBody)
+	}
+}
+
+func TestClient_GetOrderDetail_NotFound(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v5/order/realtime", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, `{"retCode":0,"retMsg":"OK","result":{"list":[],"category":"spot"}}`)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient(Config{URL: server.URL, APIKey: "key", APISecret: "secret"}, server.Client())
+
+	_, err := c.GetOrderDetail(trading.GetOrderDetailRequest{Base: "BTC", Quote: "USDT", ClientOrderID: "gone"})
+	if err == nil || !strings.Contains(err.Error(), "order gone not found") {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func TestClient_PlaceOrder_Rejected(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v5/order/create", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, `{"retCode":110007,"retMsg":"ab not enough for new order","result":{}}`)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient(Config{URL: server.URL, APIKey: "key", APISecret: "secret"}, server.Client()).(*client)
+
+	_, err := c.placeOrder(orderRequest{Category: categorySpot, Symbol: "BTCUSDT", Side: "Buy", OrderType: "Market", Qty: "1"})
+	if err == nil || !strings.Contains(err.Error(), "110007") {
+		t.Fatalf("got error %v", err)
+	}
+}
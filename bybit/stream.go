@@ -0,0 +1,204 @@
+package bybit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/stream"
+	"trading-aggregator/trading"
+)
+
+type streamOperation struct {
+	Op   string        `json:"op"`
+	Args []interface{} `json:"args"`
+}
+
+type streamMessage struct {
+	Op      string          `json:"op"`
+	Success *bool           `json:"success"`
+	RetMsg  string          `json:"ret_msg"`
+	Topic   string          `json:"topic"`
+	Data    json.RawMessage `json:"data"`
+}
+
+type orderStreamData struct {
+	Category    string `json:"category"`
+	Symbol      string `json:"symbol"`
+	OrderID     string `json:"orderId"`
+	OrderLinkID string `json:"orderLinkId"`
+	Side        string `json:"side"`
+	OrderStatus string `json:"orderStatus"`
+	AvgPrice    string `json:"avgPrice"`
+	CumExecQty  string `json:"cumExecQty"`
+	CumExecVal  string `json:"cumExecValue"`
+	UpdatedTime string `json:"updatedTime"`
+}
+
+type executionStreamData struct {
+	Category    string          `json:"category"`
+	Symbol      string          `json:"symbol"`
+	OrderID     string          `json:"orderId"`
+	OrderLinkID string          `json:"orderLinkId"`
+	Side        string          `json:"side"`
+	ExecPrice   decimal.Decimal `json:"execPrice"`
+	ExecQty     decimal.Decimal `json:"execQty"`
+	ExecTime    string          `json:"execTime"`
+}
+
+func (c *client) StreamOrderUpdates(ctx context.Context) (<-chan trading.OrderUpdate, error) {
+	updates := make(chan trading.OrderUpdate, 64)
+
+	go func() {
+		defer close(updates)
+
+		stream.Run(ctx, stream.Config{
+			URL: func(context.Context) (string, error) {
+				return strings.TrimRight(c.config.StreamURL, "/") + "/v5/private", nil
+			},
+			OnConnect: func(ctx context.Context, conn *stream.Conn) error {
+				expires := time.Now().Add(10 * time.Second).UnixMilli()
+				err := conn.WriteJSON(streamOperation{
+					Op:   "auth",
+					Args: []interface{}{c.config.APIKey, expires, c.signStream(expires)},
+				})
+				if err != nil {
+					return err
+				}
+
+				return conn.WriteJSON(streamOperation{
+					Op:   "subscribe",
+					Args: []interface{}{"order", "execution"},
+				})
+			},
+			OnMessage: func(data []byte) error {
+				list, err := c.parseStreamMessage(data)
+				if err != nil {
+					return err
+				}
+
+				for _, update := range list {
+					select {
+					case updates <- update:
+					case <-ctx.Done():
+						return nil
+					}
+				}
+				return nil
+			},
+			PingMessage: []byte(`{"op":"ping"}`),
+		})
+	}()
+
+	return updates, nil
+}
+
+func (c *client) signStream(expires int64) string {
+	mac := hmac.New(sha256.New, []byte(c.config.APISecret))
+	mac.Write([]byte("GET/realtime" + strconv.FormatInt(expires, 10)))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (c *client) parseStreamMessage(data []byte) ([]trading.OrderUpdate, error) {
+	var message streamMessage
+	err := json.Unmarshal(data, &message)
+	if err != nil {
+		return nil, err
+	}
+
+	if message.Success != nil && !*message.Success {
+		return nil, fmt.Errorf("%s failed: %s", message.Op, message.RetMsg)
+	}
+
+	switch message.Topic {
+	case "order":
+		var orders []orderStreamData
+		err = json.Unmarshal(message.Data, &orders)
+		if err != nil {
+			return nil, err
+		}
+
+		updates := make([]trading.OrderUpdate, 0, len(orders))
+		for _, o := range orders {
+			if o.Category != "" && o.Category != c.config.Category {
+				continue
+			}
+
+			executedBase, executedQuote, err := c.getExecuted(orderData{
+				AvgPrice:     o.AvgPrice,
+				CumExecQty:   o.CumExecQty,
+				CumExecValue: o.CumExecVal,
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			updates = append(updates, trading.OrderUpdate{
+				Symbol:        o.Symbol,
+				Instrument:    c.streamInstrument(o.Symbol),
+				OrderID:       o.OrderID,
+				ClientOrderID: o.OrderLinkID,
+				Side:          o.Side,
+				Status:        o.OrderStatus,
+				ExecutedBase:  executedBase,
+				ExecutedQuote: executedQuote,
+				Time:          parseMillis(o.UpdatedTime),
+			})
+		}
+		return updates, nil
+	case "execution":
+		var executions []executionStreamData
+		err = json.Unmarshal(message.Data, &executions)
+		if err != nil {
+			return nil, err
+		}
+
+		updates := make([]trading.OrderUpdate, 0, len(executions))
+		for _, e := range executions {
+			if e.Category != "" && e.Category != c.config.Category {
+				continue
+			}
+
+			updates = append(updates, trading.OrderUpdate{
+				Symbol:        e.Symbol,
+				Instrument:    c.streamInstrument(e.Symbol),
+				OrderID:       e.OrderID,
+				ClientOrderID: e.OrderLinkID,
+				Side:          e.Side,
+				LastBase:      e.ExecQty,
+				LastPrice:     e.ExecPrice,
+				Time:          parseMillis(e.ExecTime),
+			})
+		}
+		return updates, nil
+	}
+
+	return nil, nil
+}
+
+func (c *client) streamInstrument(symbol string) trading.Instrument {
+	listing, err := c.instruments.LookupSymbol(symbol)
+	if err != nil {
+		return trading.Instrument{}
+	}
+
+	return listing.Instrument
+}
+
+func parseMillis(s string) time.Time {
+	millis, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.UnixMilli(millis).UTC()
+}
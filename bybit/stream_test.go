@@ -0,0 +1,121 @@
+package bybit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"trading-aggregator/trading"
+)
+
+func TestClient_StreamOrderUpdates(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v5/market/instruments-info", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, `{"retCode":0,"result":{"category":"spot","list":[{"symbol":"SOLUSDT","baseCoin":"SOL","quoteCoin":"USDT","status":"Trading"}]}}`)
+	})
+	mux.HandleFunc("/v5/private", func(rw http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(rw, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		var auth, subscribe streamOperation
+		if ws.ReadJSON(&auth) != nil || ws.ReadJSON(&subscribe) != nil {
+			return
+		}
+		if auth.Op != "auth" || len(auth.Args) != 3 || auth.Args[0] != "key" {
+			_ = ws.WriteMessage(websocket.TextMessage, []byte(`{"op":"auth","success":false,"ret_msg":"bad auth"}`))
+			return
+		}
+		expires := int64(auth.Args[1].(float64))
+		if auth.Args[2] != (&client{config: Config{APISecret: "secret"}}).signStream(expires) {
+			_ = ws.WriteMessage(websocket.TextMessage, []byte(`{"op":"auth","success":false,"ret_msg":"bad signature"}`))
+			return
+		}
+		if subscribe.Op != "subscribe" {
+			return
+		}
+
+		messages := []interface{}{
+			map[string]interface{}{"op": "auth", "success": true},
+			map[string]interface{}{"topic": "execution", "data": []map[string]string{{
+				"category": "spot", "symbol": "SOLUSDT", "orderId": "42", "orderLinkId": "web_123",
+				"side": "Buy", "execPrice": "100.5", "execQty": "1.5", "execTime": "1700000000000",
+			}}},
+			map[string]interface{}{"topic": "order", "data": []map[string]string{{
+				"category": "linear", "symbol": "SOLUSDT", "orderId": "43", "orderStatus": "Filled",
+			}, {
+				"category": "spot", "symbol": "SOLUSDT", "orderId": "42", "orderLinkId": "web_123",
+				"side": "Buy", "orderStatus": "Filled", "avgPrice": "100.5", "cumExecQty": "2",
+				"cumExecValue": "201", "updatedTime": "1700000000001",
+			}}},
+		}
+		for _, message := range messages {
+			data, _ := json.Marshal(message)
+			if ws.WriteMessage(websocket.TextMessage, data) != nil {
+				return
+			}
+		}
+
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient(Config{
+		URL:       server.URL,
+		StreamURL: "ws" + strings.TrimPrefix(server.URL, "http"),
+		APIKey:    "key",
+		APISecret: "secret",
+	}, server.Client())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updates, err := c.(trading.OrderStreamer).StreamOrderUpdates(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := func() trading.OrderUpdate {
+		select {
+		case update := <-updates:
+			return update
+		case <-time.After(5 * time.Second):
+			t.Fatal("no update")
+			return trading.OrderUpdate{}
+		}
+	}
+
+	fill := next()
+	if fill.Status != "" || fill.OrderID != "42" || fill.LastBase.String() != "1.5" || fill.LastPrice.String() != "100.5" {
+		t.Fatalf("got fill %+v", fill)
+	}
+	if fill.Instrument != trading.NewInstrument("SOL", "USDT") {
+		t.Fatalf("got instrument %v", fill.Instrument)
+	}
+
+	order := next()
+	if order.Status != "Filled" || order.ClientOrderID != "web_123" || order.ExecutedBase.String() != "2" || order.ExecutedQuote.String() != "201" {
+		t.Fatalf("got order %+v", order)
+	}
+
+	cancel()
+	for range updates {
+	}
+}
@@ -0,0 +1,215 @@
+package bybit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/stream"
+	"trading-aggregator/trading"
+)
+
+const klinesLimit = 1000
+
+var klineIntervals = map[time.Duration]string{
+	time.Minute:      "1",
+	3 * time.Minute:  "3",
+	5 * time.Minute:  "5",
+	15 * time.Minute: "15",
+	30 * time.Minute: "30",
+	time.Hour:        "60",
+	2 * time.Hour:    "120",
+	4 * time.Hour:    "240",
+	6 * time.Hour:    "360",
+	12 * time.Hour:   "720",
+	24 * time.Hour:   "D",
+}
+
+type getKlinesResponse struct {
+	RetCode int    `json:"retCode"`
+	RetMsg  string `json:"retMsg"`
+	Result  struct {
+		// List holds start time in milliseconds, open, high, low, close,
+		// volume and turnover as strings, newest first.
+		List [][]string `json:"list"`
+	} `json:"result"`
+}
+
+// publicTrade declares both "s" and "S" since encoding/json would otherwise
+// decode the side into the symbol.
+type publicTrade struct {
+	Time   int64           `json:"T"`
+	Symbol string          `json:"s"`
+	Side   string          `json:"S"`
+	Size   decimal.Decimal `json:"v"`
+	Price  decimal.Decimal `json:"p"`
+}
+
+func (c *client) GetKlines(req trading.KlinesRequest) ([]trading.Kline, error) {
+	symbol, err := c.instruments.Symbol(trading.NewInstrument(req.Base, req.Quote))
+	if err != nil {
+		return nil, err
+	}
+
+	interval, ok := klineIntervals[req.Interval]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", trading.ErrUnsupportedInterval, req.Interval)
+	}
+
+	return trading.PageKlines(req, klinesLimit, func(start, end time.Time) ([]trading.Kline, error) {
+		return c.getKlines(symbol, interval, start, end)
+	})
+}
+
+func (c *client) getKlines(symbol, interval string, start, end time.Time) ([]trading.Kline, error) {
+	u, err := url.Parse(c.config.URL + "/v5/market/kline")
+	if err != nil {
+		return nil, err
+	}
+
+	query := u.Query()
+	query.Add("category", c.config.Category)
+	query.Add("symbol", symbol)
+	query.Add("interval", interval)
+	query.Add("start", strconv.FormatInt(start.UnixMilli(), 10))
+	query.Add("end", strconv.FormatInt(end.UnixMilli()-1, 10))
+	query.Add("limit", strconv.Itoa(klinesLimit))
+	u.RawQuery = query.Encode()
+
+	httpReq, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get http response code %d and body %s", res.StatusCode, resBody)
+	}
+
+	var getKlinesResponse getKlinesResponse
+	err = json.Unmarshal(resBody, &getKlinesResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	if getKlinesResponse.RetCode != 0 {
+		return nil, fmt.Errorf("get ret code %d and message %s", getKlinesResponse.RetCode, getKlinesResponse.RetMsg)
+	}
+
+	klines := make([]trading.Kline, 0, len(getKlinesResponse.Result.List))
+	for _, row := range getKlinesResponse.Result.List {
+		if len(row) < 6 {
+			return nil, fmt.Errorf("kline has %d fields", len(row))
+		}
+
+		startTime, err := strconv.ParseInt(row[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		var values [5]decimal.Decimal
+		for i := range values {
+			values[i], err = decimal.NewFromString(row[i+1])
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		klines = append(klines, trading.Kline{
+			Time:   time.UnixMilli(startTime).UTC(),
+			Open:   values[0],
+			High:   values[1],
+			Low:    values[2],
+			Close:  values[3],
+			Volume: values[4],
+		})
+	}
+
+	sort.Slice(klines, func(i, j int) bool {
+		return klines[i].Time.Before(klines[j].Time)
+	})
+
+	return klines, nil
+}
+
+// StreamTrades follows the publicTrade topic of the instrument.
+func (c *client) StreamTrades(ctx context.Context, instrument trading.Instrument) (<-chan trading.Trade, error) {
+	symbol, err := c.instruments.Symbol(instrument)
+	if err != nil {
+		return nil, err
+	}
+
+	topic := "publicTrade." + symbol
+	trades := make(chan trading.Trade, 256)
+	go func() {
+		defer close(trades)
+
+		stream.Run(ctx, stream.Config{
+			URL: func(context.Context) (string, error) {
+				return strings.TrimRight(c.config.MarketDataURL, "/") + "/v5/public/" + c.config.Category, nil
+			},
+			OnConnect: func(ctx context.Context, conn *stream.Conn) error {
+				return conn.WriteJSON(streamOperation{
+					Op:   "subscribe",
+					Args: []interface{}{topic},
+				})
+			},
+			OnMessage: func(data []byte) error {
+				var message streamMessage
+				err := json.Unmarshal(data, &message)
+				if err != nil {
+					return err
+				}
+
+				if message.Success != nil && !*message.Success {
+					return fmt.Errorf("%s failed: %s", message.Op, message.RetMsg)
+				}
+				if message.Topic != topic {
+					return nil
+				}
+
+				var list []publicTrade
+				err = json.Unmarshal(message.Data, &list)
+				if err != nil {
+					return err
+				}
+
+				for _, trade := range list {
+					select {
+					case trades <- trading.Trade{
+						Instrument: instrument,
+						Price:      trade.Price,
+						Size:       trade.Size,
+						Time:       time.UnixMilli(trade.Time).UTC(),
+					}:
+					case <-ctx.Done():
+						return nil
+					}
+				}
+				return nil
+			},
+			PingMessage: []byte(`{"op":"ping"}`),
+		})
+	}()
+
+	return trades, nil
+}
@@ -0,0 +1,110 @@
+package bybit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"trading-aggregator/trading"
+)
+
+const solInstruments = `{"retCode":0,"result":{"category":"spot","list":[{"symbol":"SOLUSDT","baseCoin":"SOL","quoteCoin":"USDT","status":"Trading"}]}}`
+
+func TestClient_GetKlines(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v5/market/instruments-info", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, solInstruments)
+	})
+	mux.HandleFunc("/v5/market/kline", func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("interval") != "60" || r.URL.Query().Get("category") != "spot" {
+			t.Errorf("got query %s", r.URL.RawQuery)
+		}
+
+		// Newest first.
+		fmt.Fprintf(rw, `{"retCode":0,"result":{"list":[["%d","11","12","10","12","5","60"],["%d","10","11","9","11","4","40"]]}}`,
+			start.Add(time.Hour).UnixMilli(), start.UnixMilli())
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient(Config{URL: server.URL}, server.Client())
+
+	klines, err := c.(trading.KlineClient).GetKlines(trading.KlinesRequest{
+		Base:     "SOL",
+		Quote:    "USDT",
+		Interval: time.Hour,
+		Start:    start,
+		End:      start.Add(2 * time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(klines) != 2 || !klines[0].Time.Equal(start) || klines[0].Volume.String() != "4" || klines[1].Close.String() != "12" {
+		t.Fatalf("got klines %+v", klines)
+	}
+}
+
+func TestClient_StreamTrades(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v5/market/instruments-info", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, solInstruments)
+	})
+	mux.HandleFunc("/v5/public/spot", func(rw http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(rw, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		var subscribe streamOperation
+		if ws.ReadJSON(&subscribe) != nil || subscribe.Args[0] != "publicTrade.SOLUSDT" {
+			return
+		}
+
+		_ = ws.WriteMessage(websocket.TextMessage, []byte(`{"success":true,"op":"subscribe"}`))
+		_ = ws.WriteMessage(websocket.TextMessage, []byte(`{"topic":"publicTrade.SOLUSDT","type":"snapshot","ts":1700000000100,"data":[{"T":1700000000000,"s":"SOLUSDT","S":"Buy","v":"2.5","p":"101","L":"PlusTick","i":"1","BT":false}]}`))
+
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient(Config{
+		URL:           server.URL,
+		MarketDataURL: "ws" + strings.TrimPrefix(server.URL, "http"),
+	}, server.Client())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	trades, err := c.(trading.TradeStreamer).StreamTrades(ctx, trading.NewInstrument("SOL", "USDT"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case trade := <-trades:
+		if trade.Price.String() != "101" || trade.Size.String() != "2.5" || trade.Time.UnixMilli() != 1700000000000 {
+			t.Fatalf("got trade %+v", trade)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no trade")
+	}
+}
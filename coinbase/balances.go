@@ -0,0 +1,98 @@
+package coinbase
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/trading"
+)
+
+type listAccountsResponse struct {
+	Accounts []struct {
+		Currency         string `json:"currency"`
+		AvailableBalance struct {
+			Value decimal.Decimal `json:"value"`
+		} `json:"available_balance"`
+		Hold struct {
+			Value decimal.Decimal `json:"value"`
+		} `json:"hold"`
+	} `json:"accounts"`
+	HasNext bool   `json:"has_next"`
+	Cursor  string `json:"cursor"`
+}
+
+func (c *client) GetBalances() ([]trading.Balance, error) {
+	var balances []trading.Balance
+	query := url.Values{"limit": []string{"250"}}
+	for {
+		resBody, err := c.get("/api/v3/brokerage/accounts", query)
+		if err != nil {
+			return nil, err
+		}
+
+		var response listAccountsResponse
+		err = json.Unmarshal(resBody, &response)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, account := range response.Accounts {
+			if account.AvailableBalance.Value.IsZero() && account.Hold.Value.IsZero() {
+				continue
+			}
+
+			balances = append(balances, trading.Balance{
+				Asset:  account.Currency,
+				Free:   account.AvailableBalance.Value,
+				Locked: account.Hold.Value,
+			})
+		}
+		if !response.HasNext || response.Cursor == "" {
+			return balances, nil
+		}
+		query.Set("cursor", response.Cursor)
+	}
+}
+
+// get sends a signed GET request and returns the body of a successful
+// response. The signature covers the path without the query.
+func (c *client) get(path string, query url.Values) ([]byte, error) {
+	u, err := url.Parse(c.config.URL + path)
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = query.Encode()
+
+	timestamp := time.Now().Unix()
+	signature := c.sign("", timestamp, http.MethodGet, u.Path)
+
+	httpReq, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.Header = c.createHeader(signature, timestamp)
+
+	res, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get http response code %d and body %s", res.StatusCode, resBody)
+	}
+
+	return resBody, nil
+}
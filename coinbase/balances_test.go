@@ -0,0 +1,30 @@
+package coinbase
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"trading-aggregator/trading"
+)
+
+func TestClient_GetBalances(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/brokerage/accounts", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, `{"accounts":[{"currency":"BTC","available_balance":{"value":"1.5","currency":"BTC"},"hold":{"value":"0.5","currency":"BTC"}},{"currency":"ETH","available_balance":{"value":"0"},"hold":{"value":"0"}}],"has_next":false}`)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient(Config{URL: server.URL, APIKey: "key", APISecret: "secret"}, server.Client())
+
+	balances, err := c.(trading.BalanceClient).GetBalances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(balances) != 1 || balances[0].Asset != "BTC" || balances[0].Free.String() != "1.5" || balances[0].Locked.String() != "0.5" {
+		t.Fatalf("got %+v", balances)
+	}
+}
@@ -0,0 +1,146 @@
+package coinbase
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"trading-aggregator/trading"
+)
+
+type batchCancelRequest struct {
+	OrderIDs []string `json:"order_ids"`
+}
+
+type batchCancelResponse struct {
+	Results []struct {
+		Success       bool   `json:"success"`
+		FailureReason string `json:"failure_reason"`
+		OrderID       string `json:"order_id"`
+	} `json:"results"`
+}
+
+type listOrdersResponse struct {
+	Orders []struct {
+		OrderID string `json:"order_id"`
+	} `json:"orders"`
+	HasNext bool   `json:"has_next"`
+	Cursor  string `json:"cursor"`
+}
+
+// batchCancelLimit is the most orders batch_cancel takes at once.
+const batchCancelLimit = 100
+
+// CancelOrder needs the order id, since Coinbase cancels by order id only.
+func (c *client) CancelOrder(req trading.CancelOrderRequest) error {
+	if req.OrderID == "" {
+		return errors.New("coinbase cancels orders by order id only")
+	}
+
+	return c.batchCancel([]string{req.OrderID})
+}
+
+// CancelAllOrders lists the open orders page by page and cancels them in
+// batches.
+func (c *client) CancelAllOrders() error {
+	var orderIDs []string
+	query := url.Values{"order_status": []string{"OPEN"}}
+	for {
+		resBody, err := c.get("/api/v3/brokerage/orders/historical/batch", query)
+		if err != nil {
+			return err
+		}
+
+		var response listOrdersResponse
+		err = json.Unmarshal(resBody, &response)
+		if err != nil {
+			return err
+		}
+
+		for _, o := range response.Orders {
+			orderIDs = append(orderIDs, o.OrderID)
+		}
+		if !response.HasNext || response.Cursor == "" {
+			break
+		}
+		query.Set("cursor", response.Cursor)
+	}
+
+	var errs []error
+	for start := 0; start < len(orderIDs); start += batchCancelLimit {
+		end := start + batchCancelLimit
+		if end > len(orderIDs) {
+			end = len(orderIDs)
+		}
+
+		err := c.batchCancel(orderIDs[start:end])
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// batchCancel cancels the orders and fails with the reasons of the ones that
+// could not be canceled.
+func (c *client) batchCancel(orderIDs []string) error {
+	u, err := url.Parse(c.config.URL + "/api/v3/brokerage/orders/batch_cancel")
+	if err != nil {
+		return err
+	}
+
+	bodyStr, err := json.Marshal(batchCancelRequest{OrderIDs: orderIDs})
+	if err != nil {
+		return err
+	}
+
+	timestamp := time.Now().Unix()
+	signature := c.sign(string(bodyStr), timestamp, http.MethodPost, u.Path)
+
+	httpReq, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(bodyStr))
+	if err != nil {
+		return err
+	}
+
+	httpReq.Header = c.createHeader(signature, timestamp)
+
+	res, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("get http response code %d and body %s", res.StatusCode, resBody)
+	}
+
+	var response batchCancelResponse
+	err = json.Unmarshal(resBody, &response)
+	if err != nil {
+		return err
+	}
+
+	var failures []string
+	for _, result := range response.Results {
+		if !result.Success {
+			failures = append(failures, result.OrderID+": "+result.FailureReason)
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("cancel failed for %s", strings.Join(failures, ", "))
+	}
+
+	return nil
+}
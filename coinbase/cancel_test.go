@@ -0,0 +1,51 @@
+package coinbase
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"trading-aggregator/trading"
+)
+
+func TestClient_CancelAllOrders(t *testing.T) {
+	var canceled []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/brokerage/orders/historical/batch", func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("order_status") != "OPEN" {
+			t.Errorf("got query %s", r.URL.RawQuery)
+		}
+
+		if r.URL.Query().Get("cursor") == "" {
+			fmt.Fprint(rw, `{"orders":[{"order_id":"a"},{"order_id":"b"}],"has_next":true,"cursor":"next"}`)
+			return
+		}
+		fmt.Fprint(rw, `{"orders":[{"order_id":"c"}],"has_next":false}`)
+	})
+	mux.HandleFunc("/api/v3/brokerage/orders/batch_cancel", func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		var req batchCancelRequest
+		_ = json.Unmarshal(body, &req)
+		canceled = append(canceled, req.OrderIDs...)
+
+		fmt.Fprint(rw, `{"results":[{"success":true,"order_id":"a"},{"success":false,"failure_reason":"UNKNOWN_CANCEL_ORDER","order_id":"c"}]}`)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient(Config{URL: server.URL, APIKey: "key", APISecret: "secret"}, server.Client())
+
+	err := c.(trading.CancelAller).CancelAllOrders()
+	if err == nil {
+		t.Fatal("ignored the failed cancellation")
+	}
+	if len(canceled) != 3 {
+		t.Fatalf("canceled %v", canceled)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"hash"
 	"io"
@@ -13,21 +14,28 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/shopspring/decimal"
+
 	"trading-aggregator/trading"
 )
 
 type Config struct {
-	URL       string
-	APIKey    string
-	APISecret string
+	URL           string
+	StreamURL     string
+	MarketDataURL string
+	APIKey        string
+	APISecret     string
 }
 
 type client struct {
-	config     Config
-	hmac       hash.Hash
-	httpClient *http.Client
+	config      Config
+	hmacMu      sync.Mutex
+	hmac        hash.Hash
+	httpClient  *http.Client
+	instruments *trading.Instruments
 }
 
 type orderRequest struct {
@@ -38,46 +46,111 @@ type orderRequest struct {
 }
 
 type orderResponse struct {
-	OrderID string `json:"order_id"`
+	Success         bool   `json:"success"`
+	OrderID         string `json:"order_id"`
+	SuccessResponse struct {
+		OrderID string `json:"order_id"`
+	} `json:"success_response"`
+	ErrorResponse struct {
+		Error                 string `json:"error"`
+		Message               string `json:"message"`
+		ErrorDetails          string `json:"error_details"`
+		NewOrderFailureReason string `json:"new_order_failure_reason"`
+	} `json:"error_response"`
+}
+
+// orderError is an order Coinbase rejected with status 200 and
+// success false.
+type orderError struct {
+	Reason  string
+	Message string
+	Details string
+}
+
+func (e *orderError) Error() string {
+	return fmt.Sprintf("order rejected with %s: %s %s", e.Reason, e.Message, e.Details)
 }
 
 type orderConfiguration struct {
-	MarketMarketIOC marketMarketIOC `json:"market_market_ioc"`
+	MarketMarketIOC *marketMarketIOC `json:"market_market_ioc,omitempty"`
+	LimitLimitGTC   *limitOrder      `json:"limit_limit_gtc,omitempty"`
+	SORLimitIOC     *limitOrder      `json:"sor_limit_ioc,omitempty"`
+
+	StopLimitStopLimitGTC *stopLimitOrder `json:"stop_limit_stop_limit_gtc,omitempty"`
 }
 
 type marketMarketIOC struct {
-	QuoteSize string `json:"quote_size"`
-	BaseSize  string `json:"base_size"`
+	QuoteSize string `json:"quote_size,omitempty"`
+	BaseSize  string `json:"base_size,omitempty"`
+}
+
+type limitOrder struct {
+	BaseSize   string `json:"base_size"`
+	LimitPrice string `json:"limit_price"`
+}
+
+type stopLimitOrder struct {
+	BaseSize      string `json:"base_size"`
+	LimitPrice    string `json:"limit_price"`
+	StopPrice     string `json:"stop_price"`
+	StopDirection string `json:"stop_direction"`
 }
 
 type getOrderDetailResponse struct {
 	Order struct {
-		OrderID       string `json:"order_id"`
-		ClientOrderID string `json:"client_order_id"`
-		Status        string `json:"status"`
-		FilledSize    string `json:"filled_size"`
-		FilledValue   string `json:"filled_value"`
+		OrderID       string          `json:"order_id"`
+		ClientOrderID string          `json:"client_order_id"`
+		Status        string          `json:"status"`
+		FilledSize    decimal.Decimal `json:"filled_size"`
+		FilledValue   decimal.Decimal `json:"filled_value"`
 	} `json:"order"`
 }
 
+func init() {
+	trading.RegisterAdapter(trading.Adapter{
+		Name: "coinbase",
+		Capabilities: trading.Capabilities{
+			Spot:            true,
+			LimitOrders:     true,
+			QuoteSizeOrders: true,
+			StopOrders:      true,
+			WebSocket:       true,
+			OrderBook:       true,
+			Klines:          true,
+			Trades:          true,
+		},
+		Factory: func(config trading.AdapterConfig) (trading.Client, error) {
+			return NewClient(Config{
+				URL:           config.URL,
+				StreamURL:     config.StreamURL,
+				MarketDataURL: config.MarketDataURL,
+				APIKey:        config.APIKey,
+				APISecret:     config.APISecret,
+			}, config.HTTPClient), nil
+		},
+	})
+}
+
 func NewClient(config Config, httpClient *http.Client) trading.Client {
-	return &client{
+	c := &client{
 		config:     config,
 		hmac:       hmac.New(sha256.New, []byte(config.APISecret)),
 		httpClient: httpClient,
 	}
+	c.instruments = trading.NewInstruments(c.getInstruments, time.Hour)
+
+	return c
 }
 
 func (c *client) Sell(req trading.SellRequest) (trading.SellResponse, error) {
-	body := orderRequest{
-		ProductID: fmt.Sprintf("%s-%s", req.Base, req.Quote),
-		Side:      "SELL",
-		OrderConfiguration: orderConfiguration{
-			MarketMarketIOC: marketMarketIOC{
-				BaseSize: req.Amount,
-			},
-		},
-		ClientOrderID: req.ClientOrderID,
+	listing, err := c.instruments.Tradable(trading.NewInstrument(req.Base, req.Quote))
+	if err != nil {
+		return trading.SellResponse{}, err
+	}
+
+	body, err := newOrderRequest(listing, "SELL", req.TradeRequest)
+	if err != nil {
+		return trading.SellResponse{}, err
 	}
 
 	response, err := c.placeOrder(body)
@@ -93,15 +166,14 @@ func (c *client) Sell(req trading.SellRequest) (trading.SellResponse, error) {
 }
 
 func (c *client) Buy(req trading.BuyRequest) (trading.BuyResponse, error) {
-	body := orderRequest{
-		ProductID: fmt.Sprintf("%s-%s", req.Base, req.Quote),
-		Side:      "BUY",
-		OrderConfiguration: orderConfiguration{
-			MarketMarketIOC: marketMarketIOC{
-				BaseSize: req.Amount,
-			},
-		},
-		ClientOrderID: req.ClientOrderID,
+	listing, err := c.instruments.Tradable(trading.NewInstrument(req.Base, req.Quote))
+	if err != nil {
+		return trading.BuyResponse{}, err
+	}
+
+	body, err := newOrderRequest(listing, "BUY", req.TradeRequest)
+	if err != nil {
+		return trading.BuyResponse{}, err
 	}
 
 	response, err := c.placeOrder(body)
@@ -116,6 +188,80 @@ func (c *client) Buy(req trading.BuyRequest) (trading.BuyResponse, error) {
 	}, nil
 }
 
+func newOrderRequest(listing trading.Listing, side string, req trading.TradeRequest) (orderRequest, error) {
+	err := req.Validate()
+	if err != nil {
+		return orderRequest{}, err
+	}
+
+	body := orderRequest{
+		ProductID:     listing.Symbol,
+		Side:          side,
+		ClientOrderID: req.ClientOrderID,
+	}
+
+	if req.IsQuoteSized() {
+		if side != "BUY" {
+			return orderRequest{}, errors.New("coinbase only takes quote sizes on market buys")
+		}
+
+		quoteSize, err := listing.FormatQuote(req.QuoteAmount)
+		if err != nil {
+			return orderRequest{}, err
+		}
+		body.OrderConfiguration.MarketMarketIOC = &marketMarketIOC{QuoteSize: quoteSize}
+		return body, nil
+	}
+
+	baseSize, err := listing.FormatBase(req.Amount)
+	if err != nil {
+		return orderRequest{}, err
+	}
+
+	if req.IsStop() && !req.IsLimit() {
+		return orderRequest{}, errors.New("coinbase only supports stop-limit orders")
+	}
+
+	if !req.IsLimit() {
+		body.OrderConfiguration.MarketMarketIOC = &marketMarketIOC{BaseSize: baseSize}
+		return body, nil
+	}
+
+	limitPrice, err := listing.FormatLimitPrice(req.Price, side == "SELL")
+	if err != nil {
+		return orderRequest{}, err
+	}
+
+	if req.IsStop() {
+		stopPrice, err := listing.FormatPrice(req.StopPrice)
+		if err != nil {
+			return orderRequest{}, err
+		}
+
+		direction := "STOP_DIRECTION_STOP_DOWN"
+		if req.StopDirection == trading.StopRising {
+			direction = "STOP_DIRECTION_STOP_UP"
+		}
+
+		body.OrderConfiguration.StopLimitStopLimitGTC = &stopLimitOrder{
+			BaseSize:      baseSize,
+			LimitPrice:    limitPrice,
+			StopPrice:     stopPrice,
+			StopDirection: direction,
+		}
+		return body, nil
+	}
+
+	limit := &limitOrder{BaseSize: baseSize, LimitPrice: limitPrice}
+	if req.TimeInForce == trading.ImmediateOrCancel {
+		body.OrderConfiguration.SORLimitIOC = limit
+	} else {
+		body.OrderConfiguration.LimitLimitGTC = limit
+	}
+
+	return body, nil
+}
+
 func (c *client) placeOrder(req orderRequest) (orderResponse, error) {
 	u, err := url.Parse(c.config.URL + "/api/v3/brokerage/orders")
 	if err != nil {
@@ -157,11 +303,23 @@ func (c *client) placeOrder(req orderRequest) (orderResponse, error) {
 		return orderResponse{}, err
 	}
 
+	if !response.Success {
+		e := response.ErrorResponse
+		reason := e.Error
+		if reason == "" {
+			reason = e.NewOrderFailureReason
+		}
+		return orderResponse{}, &orderError{Reason: reason, Message: e.Message, Details: e.ErrorDetails}
+	}
+	if response.OrderID == "" {
+		response.OrderID = response.SuccessResponse.OrderID
+	}
+
 	return response, nil
 }
 
 func (c *client) GetOrderDetail(req trading.GetOrderDetailRequest) (trading.GetOrderDetailResponse, error) {
-	u, err := url.Parse(c.config.URL + fmt.Sprintf("/api/v3/brokerage/orders/historical/%s", req.IdempotencyKey))
+	u, err := url.Parse(c.config.URL + fmt.Sprintf("/api/v3/brokerage/orders/historical/%s", req.OrderID))
 	if err != nil {
 		return trading.GetOrderDetailResponse{}, err
 	}
@@ -204,6 +362,9 @@ func (c *client) GetOrderDetail(req trading.GetOrderDetailRequest) (trading.GetO
 }
 
 func (c *client) sign(body string, timestamp int64, requestMethod, path string) string {
+	c.hmacMu.Lock()
+	defer c.hmacMu.Unlock()
+
 	c.hmac.Reset()
 	c.hmac.Write([]byte(strconv.FormatInt(timestamp, 10) + requestMethod + path + body))
 
@@ -218,3 +379,138 @@ func (c *client) createHeader(signature string, timestamp int64) http.Header {
 	header.Set("CB-ACCESS-TIMESTAMP", strconv.FormatInt(timestamp, 10))
 	return header
 }
+
+type getProductResponse struct {
+	ProductID string          `json:"product_id"`
+	Price     decimal.Decimal `json:"price"`
+}
+
+func (c *client) GetPrice(req trading.GetPriceRequest) (trading.GetPriceResponse, error) {
+	productID, err := c.instruments.Symbol(trading.NewInstrument(req.Base, req.Quote))
+	if err != nil {
+		return trading.GetPriceResponse{}, err
+	}
+
+	u, err := url.Parse(c.config.URL + fmt.Sprintf("/api/v3/brokerage/products/%s", productID))
+	if err != nil {
+		return trading.GetPriceResponse{}, err
+	}
+
+	timestamp := time.Now().Unix()
+	signature := c.sign("", timestamp, http.MethodGet, strings.Split(u.Path, "?")[0])
+
+	httpReq, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return trading.GetPriceResponse{}, err
+	}
+
+	httpReq.Header = c.createHeader(signature, timestamp)
+
+	res, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return trading.GetPriceResponse{}, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return trading.GetPriceResponse{}, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return trading.GetPriceResponse{}, fmt.Errorf("get http response code %d and body %s", res.StatusCode, resBody)
+	}
+
+	var getProductResponse getProductResponse
+	err = json.Unmarshal(resBody, &getProductResponse)
+	if err != nil {
+		return trading.GetPriceResponse{}, err
+	}
+
+	return trading.GetPriceResponse{
+		Price: getProductResponse.Price,
+	}, nil
+}
+
+type listProductsResponse struct {
+	Products []struct {
+		ProductID       string `json:"product_id"`
+		BaseCurrencyID  string `json:"base_currency_id"`
+		QuoteCurrencyID string `json:"quote_currency_id"`
+		Status          string `json:"status"`
+		TradingDisabled bool   `json:"trading_disabled"`
+		IsDisabled      bool   `json:"is_disabled"`
+		BaseIncrement   string `json:"base_increment"`
+		QuoteIncrement  string `json:"quote_increment"`
+		PriceIncrement  string `json:"price_increment"`
+		BaseMinSize     string `json:"base_min_size"`
+	} `json:"products"`
+}
+
+func (c *client) ListInstruments() ([]trading.Listing, error) {
+	return c.instruments.List()
+}
+
+func (c *client) getInstruments() ([]trading.Listing, error) {
+	u, err := url.Parse(c.config.URL + "/api/v3/brokerage/products")
+	if err != nil {
+		return nil, err
+	}
+
+	query := u.Query()
+	query.Add("product_type", "SPOT")
+	u.RawQuery = query.Encode()
+
+	timestamp := time.Now().Unix()
+	signature := c.sign("", timestamp, http.MethodGet, strings.Split(u.Path, "?")[0])
+
+	httpReq, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.Header = c.createHeader(signature, timestamp)
+
+	res, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get http response code %d and body %s", res.StatusCode, resBody)
+	}
+
+	var listProductsResponse listProductsResponse
+	err = json.Unmarshal(resBody, &listProductsResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	listings := make([]trading.Listing, 0, len(listProductsResponse.Products))
+	for _, product := range listProductsResponse.Products {
+		// Increments are parsed leniently since Coinbase leaves them empty
+		// for some products, which simply disables rounding.
+		baseIncrement, _ := decimal.NewFromString(product.BaseIncrement)
+		quoteIncrement, _ := decimal.NewFromString(product.QuoteIncrement)
+		priceIncrement, _ := decimal.NewFromString(product.PriceIncrement)
+		baseMinSize, _ := decimal.NewFromString(product.BaseMinSize)
+
+		listings = append(listings, trading.Listing{
+			Instrument:     trading.NewInstrument(product.BaseCurrencyID, product.QuoteCurrencyID),
+			Symbol:         product.ProductID,
+			Tradable:       product.Status == "online" && !product.TradingDisabled && !product.IsDisabled,
+			BaseIncrement:  baseIncrement,
+			QuoteIncrement: quoteIncrement,
+			PriceIncrement: priceIncrement,
+			MinBase:        baseMinSize,
+		})
+	}
+
+	return listings, nil
+}
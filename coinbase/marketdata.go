@@ -0,0 +1,114 @@
+package coinbase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"trading-aggregator/stream"
+	"trading-aggregator/trading"
+)
+
+type level2Update struct {
+	Side        string    `json:"side"`
+	EventTime   time.Time `json:"event_time"`
+	PriceLevel  string    `json:"price_level"`
+	NewQuantity string    `json:"new_quantity"`
+}
+
+// SubscribeOrderBook follows the level2 channel. Coinbase numbers every
+// message of a connection, heartbeats included, so a gap in sequence_num
+// means lost book updates; reconnecting brings a fresh snapshot.
+func (c *client) SubscribeOrderBook(ctx context.Context, instrument trading.Instrument) (*trading.OrderBook, error) {
+	productID, err := c.instruments.Symbol(instrument)
+	if err != nil {
+		return nil, err
+	}
+
+	book := trading.NewOrderBook(instrument)
+
+	var sequence int64
+	go stream.Run(ctx, stream.Config{
+		URL: func(context.Context) (string, error) {
+			book.Reset()
+			sequence = -1
+
+			return c.config.MarketDataURL, nil
+		},
+		OnConnect: func(ctx context.Context, conn *stream.Conn) error {
+			err := conn.WriteJSON(c.subscribeMessage("heartbeats"))
+			if err != nil {
+				return err
+			}
+
+			return conn.WriteJSON(c.subscribeMessage("level2", productID))
+		},
+		OnMessage: func(data []byte) error {
+			var message streamMessage
+			err := json.Unmarshal(data, &message)
+			if err != nil {
+				return err
+			}
+
+			if message.Type == "error" {
+				return errors.New(message.Message)
+			}
+
+			if sequence >= 0 && message.SequenceNum > sequence+1 {
+				book.Reset()
+				return fmt.Errorf("sequence gap from %d to %d", sequence, message.SequenceNum)
+			}
+			sequence = message.SequenceNum
+
+			if message.Channel != "l2_data" {
+				return nil
+			}
+
+			for _, event := range message.Events {
+				if event.ProductID != productID {
+					continue
+				}
+
+				bids, asks, err := level2Levels(event.Updates)
+				if err != nil {
+					return err
+				}
+
+				if event.Type == "snapshot" {
+					book.Snapshot(bids, asks, message.Timestamp)
+				} else if book.Synced() {
+					book.Update(bids, asks, message.Timestamp)
+				}
+			}
+			return nil
+		},
+	})
+
+	return book, nil
+}
+
+func level2Levels(updates []level2Update) (bids, asks []trading.Level, err error) {
+	for _, update := range updates {
+		price, err := parseDecimal(update.PriceLevel)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		size, err := parseDecimal(update.NewQuantity)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		level := trading.Level{Price: price, Size: size}
+		switch update.Side {
+		case "bid":
+			bids = append(bids, level)
+		case "offer", "ask":
+			asks = append(asks, level)
+		}
+	}
+
+	return bids, asks, nil
+}
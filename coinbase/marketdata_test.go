@@ -0,0 +1,113 @@
+package coinbase
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"trading-aggregator/trading"
+)
+
+func TestClient_SubscribeOrderBook(t *testing.T) {
+	var connections int32
+	upgrader := websocket.Upgrader{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/brokerage/products", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, `{"products":[{"product_id":"SOL-USD","base_currency_id":"SOL","quote_currency_id":"USD","status":"online"}]}`)
+	})
+	mux.HandleFunc("/ws", func(rw http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(rw, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		channels := map[string]bool{}
+		for i := 0; i < 2; i++ {
+			var subscribe subscribeMessage
+			if ws.ReadJSON(&subscribe) != nil {
+				return
+			}
+			channels[subscribe.Channel] = subscribe.Type == "subscribe"
+			if subscribe.Channel == "level2" && (len(subscribe.ProductIDs) != 1 || subscribe.ProductIDs[0] != "SOL-USD") {
+				return
+			}
+		}
+		if !channels["heartbeats"] || !channels["level2"] {
+			return
+		}
+
+		var messages []string
+		if atomic.AddInt32(&connections, 1) == 1 {
+			// Skips sequence 3, which has to drop the book and reconnect
+			// before the update of sequence 4 is applied.
+			messages = []string{
+				`{"channel":"heartbeats","sequence_num":0}`,
+				`{"channel":"l2_data","timestamp":"2023-11-14T22:13:20Z","sequence_num":1,"events":[{"type":"snapshot","product_id":"SOL-USD","updates":[{"side":"bid","price_level":"99","new_quantity":"1"},{"side":"offer","price_level":"101","new_quantity":"1"}]}]}`,
+				`{"channel":"l2_data","timestamp":"2023-11-14T22:13:21Z","sequence_num":2,"events":[{"type":"update","product_id":"SOL-USD","updates":[{"side":"bid","price_level":"100","new_quantity":"1"}]}]}`,
+				`{"channel":"l2_data","timestamp":"2023-11-14T22:13:22Z","sequence_num":4,"events":[{"type":"update","product_id":"SOL-USD","updates":[{"side":"bid","price_level":"99.5","new_quantity":"1"}]}]}`,
+			}
+		} else {
+			messages = []string{
+				`{"channel":"l2_data","timestamp":"2023-11-14T22:13:23Z","sequence_num":0,"events":[{"type":"snapshot","product_id":"SOL-USD","updates":[{"side":"bid","price_level":"97","new_quantity":"1"},{"side":"offer","price_level":"103","new_quantity":"1"}]}]}`,
+				`{"channel":"l2_data","timestamp":"2023-11-14T22:13:24Z","sequence_num":1,"events":[{"type":"update","product_id":"SOL-USD","updates":[{"side":"offer","price_level":"102","new_quantity":"2"}]}]}`,
+			}
+		}
+		for _, message := range messages {
+			if ws.WriteMessage(websocket.TextMessage, []byte(message)) != nil {
+				return
+			}
+		}
+
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient(Config{
+		URL:           server.URL,
+		MarketDataURL: "ws" + strings.TrimPrefix(server.URL, "http") + "/ws",
+		APIKey:        "key",
+		APISecret:     "secret",
+	}, server.Client())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	book, err := c.(trading.MarketDataClient).SubscribeOrderBook(ctx, trading.NewInstrument("SOL", "USD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ticker, err := book.Ticker()
+		if err == nil && ticker.Ask.String() == "102" {
+			if ticker.Bid.String() != "97" {
+				t.Fatalf("got ticker %+v", ticker)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got ticker %+v, %v", ticker, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if atomic.LoadInt32(&connections) != 2 {
+		t.Fatalf("got %d connections, want a resync after the gap", connections)
+	}
+}
@@ -0,0 +1,107 @@
+package coinbase
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/trading"
+)
+
+func TestNewOrderRequest_Stop(t *testing.T) {
+	listing := trading.Listing{
+		Instrument:     trading.NewInstrument("BTC", "USD"),
+		Symbol:         "BTC-USD",
+		BaseIncrement:  decimal.RequireFromString("0.0001"),
+		PriceIncrement: decimal.RequireFromString("0.01"),
+	}
+
+	body, err := newOrderRequest(listing, "BUY", trading.TradeRequest{
+		Amount:        decimal.NewFromInt(1),
+		Type:          trading.OrderTypeLimit,
+		Price:         decimal.NewFromInt(70100),
+		StopPrice:     decimal.NewFromInt(70000),
+		StopDirection: trading.StopRising,
+		ClientOrderID: "breakout",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := json.Marshal(body.OrderConfiguration)
+	want := `{"stop_limit_stop_limit_gtc":{"base_size":"1.0000","limit_price":"70100.00","stop_price":"70000.00","stop_direction":"STOP_DIRECTION_STOP_UP"}}`
+	if string(b) != want {
+		t.Fatalf("got %s", b)
+	}
+
+	_, err = newOrderRequest(listing, "SELL", trading.TradeRequest{
+		Amount:        decimal.NewFromInt(1),
+		StopPrice:     decimal.NewFromInt(60000),
+		StopDirection: trading.StopFalling,
+	})
+	if err == nil {
+		t.Fatal("accepted a stop-market order")
+	}
+}
+
+func TestNewOrderRequest_QuoteSized(t *testing.T) {
+	listing := trading.Listing{
+		Instrument:     trading.NewInstrument("BTC", "USD"),
+		Symbol:         "BTC-USD",
+		QuoteIncrement: decimal.RequireFromString("0.01"),
+	}
+	req := trading.TradeRequest{QuoteAmount: decimal.RequireFromString("50.005")}
+
+	body, err := newOrderRequest(listing, "BUY", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(body.OrderConfiguration)
+	if string(b) != `{"market_market_ioc":{"quote_size":"50.00"}}` {
+		t.Fatalf("got %s", b)
+	}
+
+	_, err = newOrderRequest(listing, "SELL", req)
+	if err == nil {
+		t.Fatal("accepted a quote sized sell")
+	}
+
+	adapter, _ := trading.LookupAdapter("coinbase")
+	if !adapter.Capabilities.QuoteSizeOrders {
+		t.Fatalf("got capabilities %+v", adapter.Capabilities)
+	}
+}
+
+func TestClient_PlaceOrder(t *testing.T) {
+	responses := []string{
+		`{"success":true,"success_response":{"order_id":"11111-000000-000000"}}`,
+		`{"success":false,"error_response":{"error":"INSUFFICIENT_FUND","message":"Insufficient balance in source account","error_details":""}}`,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/brokerage/orders", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, responses[0])
+		responses = responses[1:]
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient(Config{URL: server.URL, APIKey: "key", APISecret: "secret"}, server.Client()).(*client)
+
+	req := orderRequest{ProductID: "BTC-USD", Side: "BUY"}
+	res, err := c.placeOrder(req)
+	if err != nil || res.OrderID != "11111-000000-000000" {
+		t.Fatalf("got %+v and error %v", res, err)
+	}
+
+	_, err = c.placeOrder(req)
+	if err == nil || !strings.Contains(err.Error(), "INSUFFICIENT_FUND") {
+		t.Fatalf("got error %v", err)
+	}
+}
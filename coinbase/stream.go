@@ -0,0 +1,181 @@
+package coinbase
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/stream"
+	"trading-aggregator/trading"
+)
+
+type subscribeMessage struct {
+	Type       string   `json:"type"`
+	ProductIDs []string `json:"product_ids"`
+	Channel    string   `json:"channel"`
+	APIKey     string   `json:"api_key"`
+	Timestamp  string   `json:"timestamp"`
+	Signature  string   `json:"signature"`
+}
+
+type streamMessage struct {
+	Type        string    `json:"type"`
+	Message     string    `json:"message"`
+	Channel     string    `json:"channel"`
+	Timestamp   time.Time `json:"timestamp"`
+	SequenceNum int64     `json:"sequence_num"`
+	Events      []struct {
+		Type      string            `json:"type"`
+		Orders    []userOrderUpdate `json:"orders"`
+		ProductID string            `json:"product_id"`
+		Updates   []level2Update    `json:"updates"`
+		Trades    []marketTrade     `json:"trades"`
+	} `json:"events"`
+}
+
+type userOrderUpdate struct {
+	OrderID            string `json:"order_id"`
+	ClientOrderID      string `json:"client_order_id"`
+	ProductID          string `json:"product_id"`
+	OrderSide          string `json:"order_side"`
+	Status             string `json:"status"`
+	CumulativeQuantity string `json:"cumulative_quantity"`
+	AvgPrice           string `json:"avg_price"`
+	FilledValue        string `json:"filled_value"`
+}
+
+func (c *client) StreamOrderUpdates(ctx context.Context) (<-chan trading.OrderUpdate, error) {
+	updates := make(chan trading.OrderUpdate, 64)
+
+	go func() {
+		defer close(updates)
+
+		var sequence int64
+		stream.Run(ctx, stream.Config{
+			URL: func(context.Context) (string, error) {
+				sequence = -1
+				return c.config.StreamURL, nil
+			},
+			OnConnect: func(ctx context.Context, conn *stream.Conn) error {
+				for _, channel := range []string{"heartbeats", "user"} {
+					err := conn.WriteJSON(c.subscribeMessage(channel))
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			OnMessage: func(data []byte) error {
+				var message streamMessage
+				err := json.Unmarshal(data, &message)
+				if err != nil {
+					return err
+				}
+
+				if message.Type == "error" {
+					return errors.New(message.Message)
+				}
+
+				// A gap in the sequence means updates were lost; reconnecting
+				// makes the venue send a fresh snapshot of the open orders.
+				if sequence >= 0 && message.SequenceNum > sequence+1 {
+					return fmt.Errorf("sequence gap from %d to %d", sequence, message.SequenceNum)
+				}
+				sequence = message.SequenceNum
+
+				if message.Channel != "user" {
+					return nil
+				}
+
+				for _, event := range message.Events {
+					for _, o := range event.Orders {
+						update, err := c.orderUpdate(o, message.Timestamp)
+						if err != nil {
+							return err
+						}
+
+						select {
+						case updates <- update:
+						case <-ctx.Done():
+							return nil
+						}
+					}
+				}
+				return nil
+			},
+		})
+	}()
+
+	return updates, nil
+}
+
+func (c *client) subscribeMessage(channel string, productIDs ...string) subscribeMessage {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(c.config.APISecret))
+	mac.Write([]byte(timestamp + channel + strings.Join(productIDs, ",")))
+
+	return subscribeMessage{
+		Type:       "subscribe",
+		ProductIDs: append([]string{}, productIDs...),
+		Channel:    channel,
+		APIKey:     c.config.APIKey,
+		Timestamp:  timestamp,
+		Signature:  hex.EncodeToString(mac.Sum(nil)),
+	}
+}
+
+func (c *client) orderUpdate(o userOrderUpdate, timestamp time.Time) (trading.OrderUpdate, error) {
+	executedBase, err := parseDecimal(o.CumulativeQuantity)
+	if err != nil {
+		return trading.OrderUpdate{}, err
+	}
+
+	executedQuote, err := parseDecimal(o.FilledValue)
+	if err != nil {
+		return trading.OrderUpdate{}, err
+	}
+
+	if executedQuote.IsZero() {
+		avgPrice, err := parseDecimal(o.AvgPrice)
+		if err != nil {
+			return trading.OrderUpdate{}, err
+		}
+		executedQuote = executedBase.Mul(avgPrice)
+	}
+
+	update := trading.OrderUpdate{
+		Symbol:        o.ProductID,
+		OrderID:       o.OrderID,
+		ClientOrderID: o.ClientOrderID,
+		Side:          o.OrderSide,
+		Status:        o.Status,
+		ExecutedBase:  executedBase,
+		ExecutedQuote: executedQuote,
+		Time:          timestamp,
+	}
+
+	listing, err := c.instruments.LookupSymbol(o.ProductID)
+	if err == nil {
+		update.Instrument = listing.Instrument
+	}
+
+	return update, nil
+}
+
+func parseDecimal(s string) (decimal.Decimal, error) {
+	if strings.TrimSpace(s) == "" {
+		return decimal.Zero, nil
+	}
+
+	return decimal.NewFromString(s)
+}
@@ -0,0 +1,111 @@
+package coinbase
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"trading-aggregator/trading"
+)
+
+func TestClient_StreamOrderUpdates(t *testing.T) {
+	var connections int32
+	upgrader := websocket.Upgrader{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/brokerage/products", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, `{"products":[{"product_id":"SOL-USD","base_currency_id":"SOL","quote_currency_id":"USD","status":"online"}]}`)
+	})
+	mux.HandleFunc("/ws", func(rw http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(rw, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		channels := map[string]bool{}
+		for i := 0; i < 2; i++ {
+			var subscribe subscribeMessage
+			if ws.ReadJSON(&subscribe) != nil {
+				return
+			}
+			channels[subscribe.Channel] = subscribe.Type == "subscribe" && subscribe.APIKey == "key" && subscribe.Signature != ""
+		}
+		if !channels["heartbeats"] || !channels["user"] {
+			return
+		}
+
+		var messages []string
+		if atomic.AddInt32(&connections, 1) == 1 {
+			// Skips sequence 1, which has to force a reconnect.
+			messages = []string{
+				`{"channel":"heartbeats","sequence_num":0}`,
+				`{"channel":"user","sequence_num":2,"events":[{"type":"update","orders":[{"order_id":"lost","status":"OPEN"}]}]}`,
+			}
+		} else {
+			messages = []string{
+				`{"channel":"user","sequence_num":0,"timestamp":"2023-11-14T22:13:20Z","events":[{"type":"snapshot","orders":[{"order_id":"42","client_order_id":"web_123","product_id":"SOL-USD","order_side":"BUY","status":"FILLED","cumulative_quantity":"2","avg_price":"100.5","filled_value":""}]}]}`,
+			}
+		}
+		for _, message := range messages {
+			if ws.WriteMessage(websocket.TextMessage, []byte(message)) != nil {
+				return
+			}
+		}
+
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient(Config{
+		URL:       server.URL,
+		StreamURL: "ws" + strings.TrimPrefix(server.URL, "http") + "/ws",
+		APIKey:    "key",
+		APISecret: "secret",
+	}, server.Client())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updates, err := c.(trading.OrderStreamer).StreamOrderUpdates(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var update trading.OrderUpdate
+	select {
+	case update = <-updates:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no update")
+	}
+
+	if update.OrderID != "42" || update.ClientOrderID != "web_123" || update.Status != "FILLED" {
+		t.Fatalf("got update %+v", update)
+	}
+	if update.Instrument != trading.NewInstrument("SOL", "USD") {
+		t.Fatalf("got instrument %v", update.Instrument)
+	}
+	if update.ExecutedQuote.String() != "201" {
+		t.Fatalf("got executed quote %s", update.ExecutedQuote)
+	}
+	if atomic.LoadInt32(&connections) != 2 {
+		t.Fatalf("got %d connections, want a reconnect after the sequence gap", connections)
+	}
+
+	cancel()
+	for range updates {
+	}
+}
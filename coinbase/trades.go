@@ -0,0 +1,213 @@
+package coinbase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/stream"
+	"trading-aggregator/trading"
+)
+
+const candlesLimit = 350
+
+var granularities = map[time.Duration]string{
+	time.Minute:      "ONE_MINUTE",
+	5 * time.Minute:  "FIVE_MINUTE",
+	15 * time.Minute: "FIFTEEN_MINUTE",
+	30 * time.Minute: "THIRTY_MINUTE",
+	time.Hour:        "ONE_HOUR",
+	2 * time.Hour:    "TWO_HOUR",
+	6 * time.Hour:    "SIX_HOUR",
+	24 * time.Hour:   "ONE_DAY",
+}
+
+type getCandlesResponse struct {
+	Candles []struct {
+		Start  string          `json:"start"`
+		Low    decimal.Decimal `json:"low"`
+		High   decimal.Decimal `json:"high"`
+		Open   decimal.Decimal `json:"open"`
+		Close  decimal.Decimal `json:"close"`
+		Volume decimal.Decimal `json:"volume"`
+	} `json:"candles"`
+}
+
+type marketTrade struct {
+	ProductID string    `json:"product_id"`
+	Price     string    `json:"price"`
+	Size      string    `json:"size"`
+	Time      time.Time `json:"time"`
+}
+
+func (c *client) GetKlines(req trading.KlinesRequest) ([]trading.Kline, error) {
+	productID, err := c.instruments.Symbol(trading.NewInstrument(req.Base, req.Quote))
+	if err != nil {
+		return nil, err
+	}
+
+	granularity, ok := granularities[req.Interval]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", trading.ErrUnsupportedInterval, req.Interval)
+	}
+
+	return trading.PageKlines(req, candlesLimit, func(start, end time.Time) ([]trading.Kline, error) {
+		return c.getCandles(productID, granularity, start, end)
+	})
+}
+
+func (c *client) getCandles(productID, granularity string, start, end time.Time) ([]trading.Kline, error) {
+	u, err := url.Parse(c.config.URL + fmt.Sprintf("/api/v3/brokerage/products/%s/candles", productID))
+	if err != nil {
+		return nil, err
+	}
+
+	query := u.Query()
+	query.Add("start", strconv.FormatInt(start.Unix(), 10))
+	query.Add("end", strconv.FormatInt(end.Unix()-1, 10))
+	query.Add("granularity", granularity)
+	u.RawQuery = query.Encode()
+
+	timestamp := time.Now().Unix()
+	signature := c.sign("", timestamp, http.MethodGet, u.Path)
+
+	httpReq, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.Header = c.createHeader(signature, timestamp)
+
+	res, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get http response code %d and body %s", res.StatusCode, resBody)
+	}
+
+	var getCandlesResponse getCandlesResponse
+	err = json.Unmarshal(resBody, &getCandlesResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	klines := make([]trading.Kline, 0, len(getCandlesResponse.Candles))
+	for _, candle := range getCandlesResponse.Candles {
+		startTime, err := strconv.ParseInt(candle.Start, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		klines = append(klines, trading.Kline{
+			Time:   time.Unix(startTime, 0).UTC(),
+			Open:   candle.Open,
+			High:   candle.High,
+			Low:    candle.Low,
+			Close:  candle.Close,
+			Volume: candle.Volume,
+		})
+	}
+
+	// Candles come newest first.
+	sort.Slice(klines, func(i, j int) bool {
+		return klines[i].Time.Before(klines[j].Time)
+	})
+
+	return klines, nil
+}
+
+// StreamTrades follows the market_trades channel of the instrument. The
+// snapshot of recent trades sent after subscribing is skipped, since those
+// trades happened before the stream started.
+func (c *client) StreamTrades(ctx context.Context, instrument trading.Instrument) (<-chan trading.Trade, error) {
+	productID, err := c.instruments.Symbol(instrument)
+	if err != nil {
+		return nil, err
+	}
+
+	trades := make(chan trading.Trade, 256)
+	go func() {
+		defer close(trades)
+
+		stream.Run(ctx, stream.Config{
+			URL: func(context.Context) (string, error) {
+				return c.config.MarketDataURL, nil
+			},
+			OnConnect: func(ctx context.Context, conn *stream.Conn) error {
+				err := conn.WriteJSON(c.subscribeMessage("heartbeats"))
+				if err != nil {
+					return err
+				}
+
+				return conn.WriteJSON(c.subscribeMessage("market_trades", productID))
+			},
+			OnMessage: func(data []byte) error {
+				var message streamMessage
+				err := json.Unmarshal(data, &message)
+				if err != nil {
+					return err
+				}
+
+				if message.Type == "error" {
+					return errors.New(message.Message)
+				}
+				if message.Channel != "market_trades" {
+					return nil
+				}
+
+				for _, event := range message.Events {
+					if event.Type != "update" {
+						continue
+					}
+
+					for _, trade := range event.Trades {
+						if trade.ProductID != productID {
+							continue
+						}
+
+						price, err := parseDecimal(trade.Price)
+						if err != nil {
+							return err
+						}
+
+						size, err := parseDecimal(trade.Size)
+						if err != nil {
+							return err
+						}
+
+						select {
+						case trades <- trading.Trade{
+							Instrument: instrument,
+							Price:      price,
+							Size:       size,
+							Time:       trade.Time,
+						}:
+						case <-ctx.Done():
+							return nil
+						}
+					}
+				}
+				return nil
+			},
+		})
+	}()
+
+	return trades, nil
+}
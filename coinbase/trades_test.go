@@ -0,0 +1,131 @@
+package coinbase
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"trading-aggregator/trading"
+)
+
+const solProducts = `{"products":[{"product_id":"SOL-USD","base_currency_id":"SOL","quote_currency_id":"USD","status":"online"}]}`
+
+func TestClient_GetKlines(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(2 * time.Hour)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/brokerage/products", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, solProducts)
+	})
+	mux.HandleFunc("/api/v3/brokerage/products/SOL-USD/candles", func(rw http.ResponseWriter, r *http.Request) {
+		// The end is inclusive, so it stops a second short of the next
+		// candle.
+		query := r.URL.Query()
+		if query.Get("granularity") != "ONE_HOUR" || query.Get("start") != strconv.FormatInt(start.Unix(), 10) ||
+			query.Get("end") != strconv.FormatInt(end.Unix()-1, 10) {
+			t.Errorf("got query %s", r.URL.RawQuery)
+		}
+
+		// Newest first.
+		fmt.Fprintf(rw, `{"candles":[{"start":"%d","low":"10","high":"12","open":"11","close":"12","volume":"5"},{"start":"%d","low":"9","high":"11","open":"10","close":"11","volume":"4"}]}`,
+			start.Add(time.Hour).Unix(), start.Unix())
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient(Config{URL: server.URL, APIKey: "key", APISecret: "secret"}, server.Client())
+
+	klines, err := c.(trading.KlineClient).GetKlines(trading.KlinesRequest{
+		Base:     "SOL",
+		Quote:    "USD",
+		Interval: time.Hour,
+		Start:    start,
+		End:      end,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(klines) != 2 || !klines[0].Time.Equal(start) || klines[0].Volume.String() != "4" || klines[1].Close.String() != "12" {
+		t.Fatalf("got klines %+v", klines)
+	}
+
+	_, err = c.(trading.KlineClient).GetKlines(trading.KlinesRequest{Base: "SOL", Quote: "USD", Interval: 3 * time.Minute, Start: start, End: end})
+	if err == nil {
+		t.Fatal("accepted an interval Coinbase has no candles for")
+	}
+}
+
+func TestClient_StreamTrades(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/brokerage/products", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, solProducts)
+	})
+	mux.HandleFunc("/ws", func(rw http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(rw, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		channels := map[string]bool{}
+		for i := 0; i < 2; i++ {
+			var subscribe subscribeMessage
+			if ws.ReadJSON(&subscribe) != nil {
+				return
+			}
+			channels[subscribe.Channel] = subscribe.Type == "subscribe"
+		}
+		if !channels["heartbeats"] || !channels["market_trades"] {
+			return
+		}
+
+		// The snapshot holds trades from before the subscription.
+		_ = ws.WriteMessage(websocket.TextMessage, []byte(`{"channel":"market_trades","sequence_num":0,"events":[{"type":"snapshot","trades":[{"product_id":"SOL-USD","price":"99","size":"1","time":"2023-11-14T22:13:19Z"}]}]}`))
+		_ = ws.WriteMessage(websocket.TextMessage, []byte(`{"channel":"market_trades","sequence_num":1,"events":[{"type":"update","trades":[{"product_id":"SOL-USD","price":"101","size":"2.5","time":"2023-11-14T22:13:20Z"}]}]}`))
+
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient(Config{
+		URL:           server.URL,
+		MarketDataURL: "ws" + strings.TrimPrefix(server.URL, "http") + "/ws",
+		APIKey:        "key",
+		APISecret:     "secret",
+	}, server.Client())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	trades, err := c.(trading.TradeStreamer).StreamTrades(ctx, trading.NewInstrument("SOL", "USD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case trade := <-trades:
+		if trade.Price.String() != "101" || trade.Size.String() != "2.5" || trade.Time.Unix() != 1700000000 {
+			t.Fatalf("got trade %+v", trade)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no trade")
+	}
+}
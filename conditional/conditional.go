@@ -0,0 +1,488 @@
+// Package conditional emulates stop, take-profit and trailing-stop orders,
+// alone or paired one-cancels-the-other, by watching the market and placing
+// a plain order once the trigger is hit.
+package conditional
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/order"
+	"trading-aggregator/trading"
+)
+
+var ErrNotPending = errors.New("trigger is not pending")
+
+type Kind string
+
+const (
+	// Stop fires once the price moves against the order: sells at or below
+	// the trigger price, buys at or above it.
+	Stop Kind = "stop"
+	// TakeProfit fires once the price moves in favor of the order: sells at
+	// or above the trigger price, buys at or below it.
+	TakeProfit Kind = "take_profit"
+	// TrailingStop is a stop that follows the best price seen, staying
+	// TrailAmount or TrailPercent away from it.
+	TrailingStop Kind = "trailing_stop"
+)
+
+const (
+	StatusPending   = "PENDING"
+	StatusTriggered = "TRIGGERED"
+	StatusFailed    = "FAILED"
+	StatusCanceled  = "CANCELED"
+)
+
+type Config struct {
+	// Path is the JSON file triggers are kept in; empty keeps them in
+	// memory.
+	Path string `yaml:"path" toml:"path"`
+	// PollInterval is how often prices are polled on venues that do not
+	// stream trades, and how long to wait before reopening a closed stream.
+	PollInterval time.Duration `yaml:"poll_interval" toml:"poll_interval"`
+}
+
+func (c Config) Validate() error {
+	if c.PollInterval < 0 {
+		return errors.New("poll_interval: must not be negative")
+	}
+
+	return nil
+}
+
+// Trigger places an order of Amount on Exchange, an account name, once the
+// last price hits it: a market order, or a limit order at LimitPrice if set.
+// Triggers of the same OCO group cancel each other once one has placed its
+// order.
+type Trigger struct {
+	ID           string          `json:"id"`
+	KeyID        string          `json:"key_id,omitempty"`
+	OCO          string          `json:"oco,omitempty"`
+	Exchange     string          `json:"exchange"`
+	Side         string          `json:"side"`
+	Base         string          `json:"base"`
+	Quote        string          `json:"quote"`
+	Amount       decimal.Decimal `json:"amount"`
+	Kind         Kind            `json:"kind"`
+	TriggerPrice decimal.Decimal `json:"trigger_price,omitempty"`
+	TrailAmount  decimal.Decimal `json:"trail_amount,omitempty"`
+	TrailPercent decimal.Decimal `json:"trail_percent,omitempty"`
+	LimitPrice   decimal.Decimal `json:"limit_price,omitempty"`
+	// Extreme is the best price a trailing stop has seen: the highest for
+	// sells, the lowest for buys.
+	Extreme     decimal.Decimal `json:"extreme,omitempty"`
+	Status      string          `json:"status"`
+	Price       decimal.Decimal `json:"price,omitempty"`
+	OrderID     string          `json:"order_id,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	TriggeredAt time.Time       `json:"triggered_at,omitempty"`
+}
+
+func (t Trigger) Validate() error {
+	var errs []error
+
+	if t.Exchange == "" {
+		errs = append(errs, errors.New("exchange: required"))
+	}
+	if t.Side != "buy" && t.Side != "sell" {
+		errs = append(errs, fmt.Errorf("unknown side %q", t.Side))
+	}
+	if t.Base == "" || t.Quote == "" {
+		errs = append(errs, errors.New("base and quote: required"))
+	}
+	if !t.Amount.IsPositive() {
+		errs = append(errs, fmt.Errorf("amount: must be positive, got %s", t.Amount))
+	}
+	if t.LimitPrice.IsNegative() {
+		errs = append(errs, errors.New("limit_price: must not be negative"))
+	}
+
+	switch t.Kind {
+	case Stop, TakeProfit:
+		if !t.TriggerPrice.IsPositive() {
+			errs = append(errs, errors.New("trigger_price: must be positive"))
+		}
+		if !t.TrailAmount.IsZero() || !t.TrailPercent.IsZero() {
+			errs = append(errs, fmt.Errorf("trail_amount and trail_percent: only for %s", TrailingStop))
+		}
+	case TrailingStop:
+		if t.TrailAmount.IsPositive() == t.TrailPercent.IsPositive() {
+			errs = append(errs, errors.New("trail_amount or trail_percent: exactly one required"))
+		}
+		if t.TrailAmount.IsNegative() || t.TrailPercent.IsNegative() || !t.TrailPercent.LessThan(decimal.NewFromInt(1)) {
+			errs = append(errs, errors.New("trail_amount and trail_percent: out of range"))
+		}
+		if !t.TriggerPrice.IsZero() {
+			errs = append(errs, fmt.Errorf("trigger_price: not for %s", TrailingStop))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown kind %q", t.Kind))
+	}
+
+	return errors.Join(errs...)
+}
+
+// observe moves a trailing stop along with price and reports whether it
+// moved and whether price hits the trigger.
+func (t *Trigger) observe(price decimal.Decimal) (moved, hit bool) {
+	sell := t.Side == "sell"
+
+	switch t.Kind {
+	case Stop:
+		return false, (sell && price.LessThanOrEqual(t.TriggerPrice)) || (!sell && price.GreaterThanOrEqual(t.TriggerPrice))
+	case TakeProfit:
+		return false, (sell && price.GreaterThanOrEqual(t.TriggerPrice)) || (!sell && price.LessThanOrEqual(t.TriggerPrice))
+	}
+
+	if t.Extreme.IsZero() || (sell && price.GreaterThan(t.Extreme)) || (!sell && price.LessThan(t.Extreme)) {
+		t.Extreme = price
+		moved = true
+	}
+
+	distance := t.TrailAmount
+	if t.TrailPercent.IsPositive() {
+		distance = t.Extreme.Mul(t.TrailPercent)
+	}
+	if sell {
+		return moved, price.LessThanOrEqual(t.Extreme.Sub(distance))
+	}
+
+	return moved, price.GreaterThanOrEqual(t.Extreme.Add(distance))
+}
+
+// Placer places the order of a trigger that was hit, returning its ID.
+type Placer func(Trigger) (orderID string, err error)
+
+// watch is a price feed, of an instrument as seen by an account.
+type watch struct {
+	account    string
+	instrument trading.Instrument
+}
+
+// Engine watches the prices of the pending triggers and places their orders
+// once they are hit. Prices are the venue's public trades where it streams
+// them, and its last price polled otherwise.
+type Engine struct {
+	store   Store
+	resolve order.ClientResolver
+	place   Placer
+	config  Config
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// mu serializes changes to triggers, and so the firing of OCO groups.
+	mu       sync.Mutex
+	pending  map[string]*Trigger
+	watchers map[watch]context.CancelFunc
+}
+
+func New(store Store, resolve order.ClientResolver, place Placer, config Config) *Engine {
+	if config.PollInterval <= 0 {
+		config.PollInterval = 5 * time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Engine{
+		store:    store,
+		resolve:  resolve,
+		place:    place,
+		config:   config,
+		ctx:      ctx,
+		cancel:   cancel,
+		pending:  map[string]*Trigger{},
+		watchers: map[watch]context.CancelFunc{},
+	}
+}
+
+// Resume watches the pending triggers of the store, such as those left by a
+// previous run. Triggers of accounts that are gone fail.
+func (e *Engine) Resume() error {
+	triggers, err := e.store.List()
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, t := range triggers {
+		if t.Status != StatusPending || e.pending[t.ID] != nil {
+			continue
+		}
+
+		t := t
+		err := e.watch(&t)
+		if err != nil {
+			t.Status = StatusFailed
+			t.Error = err.Error()
+			t.UpdatedAt = time.Now().UTC()
+			_ = e.store.Save(t)
+		}
+	}
+
+	return nil
+}
+
+// Close stops watching prices. Pending triggers stay pending in the store.
+func (e *Engine) Close() {
+	e.cancel()
+}
+
+func (e *Engine) Create(t Trigger) (Trigger, error) {
+	triggers, err := e.create([]Trigger{t})
+	if err != nil {
+		return Trigger{}, err
+	}
+
+	return triggers[0], nil
+}
+
+// CreateOCO pairs two triggers on the same account and instrument, such as
+// a stop-loss and a take-profit, so that the one hit first cancels the
+// other.
+func (e *Engine) CreateOCO(a, b Trigger) ([]Trigger, error) {
+	if a.Exchange != b.Exchange || !strings.EqualFold(a.Base, b.Base) || !strings.EqualFold(a.Quote, b.Quote) {
+		return nil, errors.New("oco triggers must share the exchange, base and quote")
+	}
+
+	group := uuid.NewString()
+	a.OCO = group
+	b.OCO = group
+
+	return e.create([]Trigger{a, b})
+}
+
+func (e *Engine) create(triggers []Trigger) ([]Trigger, error) {
+	now := time.Now().UTC()
+	for i := range triggers {
+		t := &triggers[i]
+		t.Side = strings.ToLower(t.Side)
+		t.Base = strings.ToUpper(t.Base)
+		t.Quote = strings.ToUpper(t.Quote)
+
+		err := t.Validate()
+		if err != nil {
+			return nil, err
+		}
+
+		t.ID = uuid.NewString()
+		t.Status = StatusPending
+		t.Extreme = decimal.Zero
+		t.CreatedAt = now
+		t.UpdatedAt = now
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i := range triggers {
+		t := triggers[i]
+		err := e.watch(&t)
+		if err != nil {
+			for _, created := range triggers[:i] {
+				delete(e.pending, created.ID)
+			}
+			e.stopIdle()
+			return nil, err
+		}
+	}
+	for _, t := range triggers {
+		err := e.store.Save(t)
+		if err != nil {
+			for _, created := range triggers {
+				delete(e.pending, created.ID)
+			}
+			e.stopIdle()
+			return nil, err
+		}
+	}
+
+	return triggers, nil
+}
+
+func (e *Engine) Get(id string) (Trigger, error) {
+	return e.store.Get(id)
+}
+
+func (e *Engine) List() ([]Trigger, error) {
+	return e.store.List()
+}
+
+// Cancel cancels a pending trigger along with the rest of its OCO group.
+func (e *Engine) Cancel(id string) (Trigger, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	t, ok := e.pending[id]
+	if !ok {
+		return Trigger{}, ErrNotPending
+	}
+
+	e.end(t, StatusCanceled)
+	e.cancelGroup(t)
+	e.stopIdle()
+
+	return *t, nil
+}
+
+// CancelAll cancels every pending trigger.
+func (e *Engine) CancelAll() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, t := range e.pending {
+		e.end(t, StatusCanceled)
+	}
+	e.stopIdle()
+}
+
+// watch adds a trigger to the pending ones, watching its price unless
+// another trigger already does. Called with mu held.
+func (e *Engine) watch(t *Trigger) error {
+	client, ok := e.resolve(t.Exchange)
+	if !ok {
+		return fmt.Errorf("unknown exchange %q", t.Exchange)
+	}
+
+	w := watch{account: t.Exchange, instrument: trading.NewInstrument(t.Base, t.Quote)}
+	if _, ok := e.watchers[w]; !ok {
+		streamer, _ := client.(trading.TradeStreamer)
+		priceClient, _ := client.(trading.PriceClient)
+		if streamer == nil && priceClient == nil {
+			return fmt.Errorf("%s neither streams trades nor quotes prices", t.Exchange)
+		}
+
+		ctx, cancel := context.WithCancel(e.ctx)
+		e.watchers[w] = cancel
+		go e.follow(ctx, w, streamer, priceClient)
+	}
+
+	e.pending[t.ID] = t
+	return nil
+}
+
+// follow feeds the prices of w to observe until ctx is done.
+func (e *Engine) follow(ctx context.Context, w watch, streamer trading.TradeStreamer, priceClient trading.PriceClient) {
+	for {
+		if streamer != nil {
+			trades, err := streamer.StreamTrades(ctx, w.instrument)
+			if err == nil {
+				for trade := range trades {
+					e.observe(w, trade.Price)
+				}
+			}
+		} else {
+			res, err := priceClient.GetPrice(trading.GetPriceRequest{Base: w.instrument.Base, Quote: w.instrument.Quote})
+			if err == nil && res.Price.IsPositive() {
+				e.observe(w, res.Price)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.config.PollInterval):
+		}
+	}
+}
+
+// observe checks the pending triggers of w against price and fires those
+// that are hit. Orders are placed without holding mu, since placing one may
+// engage the kill switch, which cancels every trigger.
+func (e *Engine) observe(w watch, price decimal.Decimal) {
+	e.mu.Lock()
+	var hit []*Trigger
+	groups := map[string]bool{}
+	for _, t := range e.pending {
+		if t.Exchange != w.account || trading.NewInstrument(t.Base, t.Quote) != w.instrument {
+			continue
+		}
+
+		moved, ok := t.observe(price)
+		switch {
+		case ok && (t.OCO == "" || !groups[t.OCO]):
+			groups[t.OCO] = true
+			// Taken off the pending triggers so that nothing else ends it
+			// while its order is placed.
+			delete(e.pending, t.ID)
+			hit = append(hit, t)
+		case moved:
+			t.UpdatedAt = time.Now().UTC()
+			_ = e.store.Save(*t)
+		}
+	}
+	e.mu.Unlock()
+
+	for _, t := range hit {
+		e.fire(t, price)
+	}
+}
+
+// fire places the order of a trigger. Once it is placed the rest of the
+// group is canceled; if it fails the rest of the group stays pending, so
+// that the position is not left unprotected.
+func (e *Engine) fire(t *Trigger, price decimal.Decimal) {
+	t.Price = price
+	t.TriggeredAt = time.Now().UTC()
+	orderID, err := e.place(*t)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err != nil {
+		t.Error = err.Error()
+		e.end(t, StatusFailed)
+	} else {
+		t.OrderID = orderID
+		e.end(t, StatusTriggered)
+		e.cancelGroup(t)
+	}
+	e.stopIdle()
+}
+
+// cancelGroup cancels the pending triggers of the OCO group of t.
+func (e *Engine) cancelGroup(t *Trigger) {
+	if t.OCO == "" {
+		return
+	}
+
+	for _, other := range e.pending {
+		if other.OCO == t.OCO {
+			e.end(other, StatusCanceled)
+		}
+	}
+}
+
+func (e *Engine) end(t *Trigger, status string) {
+	t.Status = status
+	t.UpdatedAt = time.Now().UTC()
+	delete(e.pending, t.ID)
+	_ = e.store.Save(*t)
+}
+
+// stopIdle stops watching the prices no pending trigger needs anymore.
+func (e *Engine) stopIdle() {
+	needed := map[watch]bool{}
+	for _, t := range e.pending {
+		needed[watch{account: t.Exchange, instrument: trading.NewInstrument(t.Base, t.Quote)}] = true
+	}
+
+	for w, cancel := range e.watchers {
+		if !needed[w] {
+			cancel()
+			delete(e.watchers, w)
+		}
+	}
+}
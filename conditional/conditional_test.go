@@ -0,0 +1,198 @@
+package conditional
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/simulator"
+	"trading-aggregator/trading"
+)
+
+func newEngine(t *testing.T, store Store) (*Engine, *simulator.Exchange, chan Trigger) {
+	t.Helper()
+
+	sim := simulator.New()
+	sim.SetPrice("BTC", "USDT", decimal.NewFromInt(100))
+
+	placed := make(chan Trigger, 10)
+	place := func(t Trigger) (string, error) {
+		placed <- t
+		return "order-" + t.ID, nil
+	}
+	resolve := func(exchange string) (trading.Client, bool) {
+		return sim, exchange == "binance:default"
+	}
+
+	e := New(store, resolve, place, Config{PollInterval: 10 * time.Millisecond})
+	t.Cleanup(e.Close)
+
+	return e, sim, placed
+}
+
+var btc = watch{account: "binance:default", instrument: trading.NewInstrument("BTC", "USDT")}
+
+func TestEngine_OCO(t *testing.T) {
+	e, sim, placed := newEngine(t, NewMemoryStore())
+
+	legs, err := e.CreateOCO(
+		Trigger{Exchange: "binance:default", Side: "sell", Base: "btc", Quote: "usdt", Amount: decimal.NewFromInt(1), Kind: Stop, TriggerPrice: decimal.NewFromInt(90)},
+		Trigger{Exchange: "binance:default", Side: "sell", Base: "BTC", Quote: "USDT", Amount: decimal.NewFromInt(1), Kind: TakeProfit, TriggerPrice: decimal.NewFromInt(120)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if legs[0].OCO == "" || legs[0].OCO != legs[1].OCO || legs[0].Status != StatusPending {
+		t.Fatalf("got legs %+v", legs)
+	}
+
+	// Trades are streamed once the engine has subscribed.
+	deadline := time.After(5 * time.Second)
+	var fired Trigger
+	for fired.ID == "" {
+		sim.Trade("BTC", "USDT", decimal.NewFromInt(125), decimal.NewFromInt(1))
+		select {
+		case fired = <-placed:
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("take-profit not triggered")
+		}
+	}
+	if fired.ID != legs[1].ID || !fired.Price.Equal(decimal.NewFromInt(125)) {
+		t.Fatalf("fired %+v", fired)
+	}
+
+	tp, _ := e.Get(legs[1].ID)
+	stop, _ := e.Get(legs[0].ID)
+	if tp.Status != StatusTriggered || tp.OrderID != "order-"+tp.ID || stop.Status != StatusCanceled {
+		t.Fatalf("got take-profit %+v and stop %+v", tp, stop)
+	}
+
+	e.observe(btc, decimal.NewFromInt(80))
+	select {
+	case fired = <-placed:
+		t.Fatalf("canceled stop fired: %+v", fired)
+	default:
+	}
+	if _, err = e.Cancel(stop.ID); !errors.Is(err, ErrNotPending) {
+		t.Fatalf("canceled an ended trigger: %v", err)
+	}
+}
+
+func TestEngine_TrailingStop(t *testing.T) {
+	e, _, placed := newEngine(t, NewMemoryStore())
+
+	sell, err := e.Create(Trigger{Exchange: "binance:default", Side: "sell", Base: "BTC", Quote: "USDT", Amount: decimal.NewFromInt(1), Kind: TrailingStop, TrailPercent: decimal.RequireFromString("0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buy, err := e.Create(Trigger{Exchange: "binance:default", Side: "buy", Base: "BTC", Quote: "USDT", Amount: decimal.NewFromInt(1), Kind: TrailingStop, TrailAmount: decimal.NewFromInt(15)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, price := range []int64{100, 110, 100} {
+		e.observe(btc, decimal.NewFromInt(price))
+	}
+	if len(placed) != 0 {
+		t.Fatalf("fired %+v", <-placed)
+	}
+	if got, _ := e.Get(sell.ID); !got.Extreme.Equal(decimal.NewFromInt(110)) {
+		t.Fatalf("got extreme %s", got.Extreme)
+	}
+
+	e.observe(btc, decimal.NewFromInt(99))
+	if fired := <-placed; fired.ID != sell.ID {
+		t.Fatalf("fired %+v", fired)
+	}
+
+	e.observe(btc, decimal.NewFromInt(114))
+	if fired := <-placed; fired.ID != buy.ID || !fired.Extreme.Equal(decimal.NewFromInt(99)) {
+		t.Fatalf("fired %+v", fired)
+	}
+}
+
+func TestEngine_Resume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "triggers.json")
+
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, _, _ := newEngine(t, store)
+	stop, err := e.Create(Trigger{Exchange: "binance:default", Side: "buy", Base: "BTC", Quote: "USDT", Amount: decimal.NewFromInt(1), Kind: Stop, TriggerPrice: decimal.NewFromInt(110)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gone, err := e.Create(Trigger{Exchange: "binance:default", Side: "sell", Base: "BTC", Quote: "USDT", Amount: decimal.NewFromInt(1), Kind: Stop, TriggerPrice: decimal.NewFromInt(90)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Close()
+
+	// The second trigger's account is gone after the restart.
+	gone.Exchange = "kraken:default"
+	_ = store.Save(gone)
+
+	store, err = NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, _, placed := newEngine(t, store)
+	if err = e.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := e.Get(gone.ID); got.Status != StatusFailed || !strings.Contains(got.Error, "unknown exchange") {
+		t.Fatalf("got %+v", got)
+	}
+
+	e.observe(btc, decimal.NewFromInt(111))
+	if fired := <-placed; fired.ID != stop.ID {
+		t.Fatalf("fired %+v", fired)
+	}
+}
+
+func TestEngine_FailedPlacement(t *testing.T) {
+	e, _, _ := newEngine(t, NewMemoryStore())
+	e.place = func(Trigger) (string, error) { return "", errors.New("kill switch engaged") }
+
+	legs, err := e.CreateOCO(
+		Trigger{Exchange: "binance:default", Side: "sell", Base: "BTC", Quote: "USDT", Amount: decimal.NewFromInt(1), Kind: Stop, TriggerPrice: decimal.NewFromInt(90)},
+		Trigger{Exchange: "binance:default", Side: "sell", Base: "BTC", Quote: "USDT", Amount: decimal.NewFromInt(1), Kind: TakeProfit, TriggerPrice: decimal.NewFromInt(120)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e.observe(btc, decimal.NewFromInt(85))
+	stop, _ := e.Get(legs[0].ID)
+	tp, _ := e.Get(legs[1].ID)
+	if stop.Status != StatusFailed || stop.Error != "kill switch engaged" || tp.Status != StatusPending {
+		t.Fatalf("got stop %+v and take-profit %+v", stop, tp)
+	}
+
+	e.CancelAll()
+	if tp, _ = e.Get(tp.ID); tp.Status != StatusCanceled {
+		t.Fatalf("got take-profit %+v", tp)
+	}
+}
+
+func TestTrigger_Validate(t *testing.T) {
+	err := Trigger{Side: "short", Amount: decimal.NewFromInt(-1), Kind: TrailingStop, TriggerPrice: decimal.NewFromInt(1)}.Validate()
+	for _, want := range []string{"exchange", "side", "base and quote", "amount", "exactly one", "trigger_price"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %s: %v", want, err)
+		}
+	}
+
+	if _, err := New(NewMemoryStore(), nil, nil, Config{}).CreateOCO(
+		Trigger{Exchange: "binance:default", Base: "BTC", Quote: "USDT"},
+		Trigger{Exchange: "binance:default", Base: "ETH", Quote: "USDT"},
+	); err == nil {
+		t.Error("paired triggers of different instruments")
+	}
+}
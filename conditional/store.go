@@ -0,0 +1,57 @@
+package conditional
+
+import (
+	"errors"
+	"time"
+
+	"trading-aggregator/jsonstore"
+)
+
+var ErrNotFound = errors.New("trigger not found")
+
+type Store interface {
+	Save(Trigger) error
+	Get(id string) (Trigger, error)
+	List() ([]Trigger, error)
+}
+
+type store struct {
+	triggers *jsonstore.Store[Trigger]
+}
+
+func triggerID(t Trigger) string { return t.ID }
+
+func triggerCreatedAt(t Trigger) time.Time { return t.CreatedAt }
+
+func NewMemoryStore() Store {
+	return store{triggers: jsonstore.NewMemory(triggerID, triggerCreatedAt)}
+}
+
+// NewFileStore loads the triggers from the JSON file at path and writes them
+// back on every change.
+func NewFileStore(path string) (Store, error) {
+	triggers, err := jsonstore.NewFile(path, triggerID, triggerCreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return store{triggers: triggers}, nil
+}
+
+func (s store) Save(t Trigger) error {
+	return s.triggers.Save(t)
+}
+
+func (s store) Get(id string) (Trigger, error) {
+	t, ok := s.triggers.Get(id)
+	if !ok {
+		return Trigger{}, ErrNotFound
+	}
+
+	return t, nil
+}
+
+// List returns the triggers oldest first.
+func (s store) List() ([]Trigger, error) {
+	return s.triggers.List(), nil
+}
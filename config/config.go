@@ -0,0 +1,568 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/shopspring/decimal"
+	"gopkg.in/yaml.v3"
+
+	"trading-aggregator/accounting"
+	"trading-aggregator/auth"
+	"trading-aggregator/conditional"
+	"trading-aggregator/dca"
+	"trading-aggregator/portfolio"
+	"trading-aggregator/rebalance"
+	"trading-aggregator/risk"
+	"trading-aggregator/secret"
+	"trading-aggregator/trading"
+)
+
+const envPrefix = "AGGREGATOR_"
+
+type Config struct {
+	ListenAddress string             `yaml:"listen_address" toml:"listen_address"`
+	PollInterval  time.Duration      `yaml:"poll_interval" toml:"poll_interval"`
+	Exchanges     ExchangesConfig    `yaml:"exchanges" toml:"exchanges"`
+	Callback      CallbackConfig     `yaml:"callback" toml:"callback"`
+	TradingView   TradingViewConfig  `yaml:"tradingview" toml:"tradingview"`
+	APIKeys       []auth.Key         `yaml:"api_keys" toml:"api_keys"`
+	Risk          risk.Config        `yaml:"risk" toml:"risk"`
+	KillSwitch    KillSwitchConfig   `yaml:"kill_switch" toml:"kill_switch"`
+	Portfolio     portfolio.Config   `yaml:"portfolio" toml:"portfolio"`
+	Accounting    accounting.Config  `yaml:"accounting" toml:"accounting"`
+	Rebalance     rebalance.Config   `yaml:"rebalance" toml:"rebalance"`
+	DCA           dca.Config         `yaml:"dca" toml:"dca"`
+	Conditional   conditional.Config `yaml:"conditional" toml:"conditional"`
+	Secrets       SecretsConfig      `yaml:"secrets" toml:"secrets"`
+}
+
+type ExchangesConfig struct {
+	Binance        ExchangeConfig `yaml:"binance" toml:"binance"`
+	BinanceFutures ExchangeConfig `yaml:"binance_futures" toml:"binance_futures"`
+	Bybit          ExchangeConfig `yaml:"bybit" toml:"bybit"`
+	Coinbase       ExchangeConfig `yaml:"coinbase" toml:"coinbase"`
+}
+
+// ExchangeConfig holds the credentials of an exchange as secret references,
+// see secret.Resolver. Plain values are used as they are. The top level
+// credentials belong to the default account; Accounts adds named accounts
+// such as "binance:hedge". Category picks the product of each account on
+// exchanges that trade several, such as Bybit's linear perpetuals.
+type ExchangeConfig struct {
+	Enabled       bool                     `yaml:"enabled" toml:"enabled"`
+	URL           string                   `yaml:"url" toml:"url"`
+	StreamURL     string                   `yaml:"stream_url" toml:"stream_url"`
+	MarketDataURL string                   `yaml:"market_data_url" toml:"market_data_url"`
+	TakerFee      string                   `yaml:"taker_fee" toml:"taker_fee"`
+	APIKey        string                   `yaml:"api_key" toml:"api_key"`
+	APISecret     string                   `yaml:"api_secret" toml:"api_secret"`
+	Category      string                   `yaml:"category" toml:"category"`
+	Accounts      map[string]AccountConfig `yaml:"accounts" toml:"accounts"`
+}
+
+type AccountConfig struct {
+	URL       string `yaml:"url" toml:"url"`
+	APIKey    string `yaml:"api_key" toml:"api_key"`
+	APISecret string `yaml:"api_secret" toml:"api_secret"`
+	Category  string `yaml:"category" toml:"category"`
+}
+
+// categories are the product categories of the exchanges that have more
+// than one.
+var categories = map[string][]string{
+	"bybit": {"spot", "linear", "inverse"},
+}
+
+func validateCategory(exchange, category string) error {
+	if category == "" {
+		return nil
+	}
+	for _, c := range categories[exchange] {
+		if c == category {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown category %q", category)
+}
+
+type SecretsConfig struct {
+	ReloadInterval time.Duration  `yaml:"reload_interval" toml:"reload_interval"`
+	FileDir        string         `yaml:"file_dir" toml:"file_dir"`
+	Keystore       KeystoreConfig `yaml:"keystore" toml:"keystore"`
+	Vault          VaultConfig    `yaml:"vault" toml:"vault"`
+}
+
+type KeystoreConfig struct {
+	Path       string `yaml:"path" toml:"path"`
+	Passphrase string `yaml:"passphrase" toml:"passphrase"`
+}
+
+type VaultConfig struct {
+	Address string `yaml:"address" toml:"address"`
+	Token   string `yaml:"token" toml:"token"`
+	Mount   string `yaml:"mount" toml:"mount"`
+}
+
+type CallbackConfig struct {
+	Secret         string        `yaml:"secret" toml:"secret"`
+	MaxRetries     int           `yaml:"max_retries" toml:"max_retries"`
+	Backoff        time.Duration `yaml:"backoff" toml:"backoff"`
+	DeadLetterPath string        `yaml:"dead_letter_path" toml:"dead_letter_path"`
+}
+
+type TradingViewConfig struct {
+	Passphrase      string        `yaml:"passphrase" toml:"passphrase"`
+	DefaultExchange string        `yaml:"default_exchange" toml:"default_exchange"`
+	DedupWindow     time.Duration `yaml:"dedup_window" toml:"dedup_window"`
+}
+
+// KillSwitchConfig sets up the kill switch. Flatten makes signals and risk
+// breaches sell positions into FlattenTo as well; OnBreach lists the risk
+// checks, see risk.Checks, whose rejections engage it.
+type KillSwitchConfig struct {
+	FlattenTo string   `yaml:"flatten_to" toml:"flatten_to"`
+	Flatten   bool     `yaml:"flatten" toml:"flatten"`
+	OnBreach  []string `yaml:"on_breach" toml:"on_breach"`
+}
+
+func Default() Config {
+	return Config{
+		ListenAddress: "localhost:8888",
+		PollInterval:  5 * time.Second,
+		Exchanges: ExchangesConfig{
+			Binance: ExchangeConfig{
+				URL:           "https://api.binance.com",
+				StreamURL:     "wss://stream.binance.com:9443",
+				MarketDataURL: "wss://stream.binance.com:9443",
+			},
+			BinanceFutures: ExchangeConfig{
+				URL:           "https://fapi.binance.com",
+				StreamURL:     "wss://fstream.binance.com",
+				MarketDataURL: "wss://fstream.binance.com",
+			},
+			Bybit: ExchangeConfig{
+				URL:           "https://api.bybit.com",
+				StreamURL:     "wss://stream.bybit.com",
+				MarketDataURL: "wss://stream.bybit.com",
+			},
+			Coinbase: ExchangeConfig{
+				URL:           "https://api.coinbase.com",
+				StreamURL:     "wss://advanced-trade-ws-user.coinbase.com",
+				MarketDataURL: "wss://advanced-trade-ws.coinbase.com",
+			},
+		},
+		Callback: CallbackConfig{
+			DeadLetterPath: "callback-dead-letter.jsonl",
+		},
+		Portfolio: portfolio.Config{
+			Method:            portfolio.FIFO,
+			ReconcileInterval: 15 * time.Minute,
+		},
+		Accounting: accounting.Config{
+			Method: accounting.FIFO,
+			Fiat:   "USD",
+		},
+		DCA: dca.Config{
+			Path:     "dca-plans.json",
+			Interval: 30 * time.Second,
+		},
+		Conditional: conditional.Config{
+			Path:         "triggers.json",
+			PollInterval: 5 * time.Second,
+		},
+		Secrets: SecretsConfig{
+			ReloadInterval: time.Minute,
+		},
+	}
+}
+
+// Load reads the YAML or TOML file at path on top of the defaults, then
+// applies the AGGREGATOR_* environment overrides and validates the result.
+// An empty path loads the defaults and the environment only.
+func Load(path string) (Config, error) {
+	config := Default()
+
+	if path != "" {
+		err := decodeFile(path, &config)
+		if err != nil {
+			return Config{}, fmt.Errorf("load config %s: %w", path, err)
+		}
+	}
+
+	err := applyEnv(&config, os.LookupEnv)
+	if err != nil {
+		return Config{}, err
+	}
+
+	err = config.Validate()
+	if err != nil {
+		return Config{}, err
+	}
+
+	return config, nil
+}
+
+func decodeFile(path string, config *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+		decoder.KnownFields(true)
+		err = decoder.Decode(config)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return err
+	case ".toml":
+		meta, err := toml.Decode(string(data), config)
+		if err != nil {
+			return err
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("unknown keys %v", undecoded)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported config format %q", filepath.Ext(path))
+	}
+}
+
+type lookupEnv func(key string) (string, bool)
+
+func applyEnv(config *Config, lookup lookupEnv) error {
+	var errs []error
+
+	setString := func(name string, target *string) {
+		if value, ok := lookup(envPrefix + name); ok {
+			*target = value
+		}
+	}
+	setBool := func(name string, target *bool) {
+		if value, ok := lookup(envPrefix + name); ok {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s%s: %w", envPrefix, name, err))
+				return
+			}
+			*target = b
+		}
+	}
+
+	setString("LISTEN_ADDRESS", &config.ListenAddress)
+	setString("CALLBACK_SECRET", &config.Callback.Secret)
+	setString("TRADINGVIEW_PASSPHRASE", &config.TradingView.Passphrase)
+	setString("KEYSTORE_PATH", &config.Secrets.Keystore.Path)
+	setString("KEYSTORE_PASSPHRASE", &config.Secrets.Keystore.Passphrase)
+	setString("VAULT_ADDRESS", &config.Secrets.Vault.Address)
+	setString("VAULT_TOKEN", &config.Secrets.Vault.Token)
+
+	exchanges := map[string]*ExchangeConfig{
+		"BINANCE":         &config.Exchanges.Binance,
+		"BINANCE_FUTURES": &config.Exchanges.BinanceFutures,
+		"BYBIT":           &config.Exchanges.Bybit,
+		"COINBASE":        &config.Exchanges.Coinbase,
+	}
+	for name, exchange := range exchanges {
+		setBool(name+"_ENABLED", &exchange.Enabled)
+		setString(name+"_URL", &exchange.URL)
+		setString(name+"_STREAM_URL", &exchange.StreamURL)
+		setString(name+"_MARKET_DATA_URL", &exchange.MarketDataURL)
+		setString(name+"_TAKER_FEE", &exchange.TakerFee)
+		setString(name+"_API_KEY", &exchange.APIKey)
+		setString(name+"_API_SECRET", &exchange.APISecret)
+		setString(name+"_CATEGORY", &exchange.Category)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Validate reports every problem at once so that a broken deployment can be
+// fixed in one go.
+func (c Config) Validate() error {
+	var errs []error
+
+	if _, _, err := net.SplitHostPort(c.ListenAddress); err != nil {
+		errs = append(errs, fmt.Errorf("listen_address: %w", err))
+	}
+
+	exchanges := map[string]ExchangeConfig{
+		"binance":         c.Exchanges.Binance,
+		"binance_futures": c.Exchanges.BinanceFutures,
+		"bybit":           c.Exchanges.Bybit,
+		"coinbase":        c.Exchanges.Coinbase,
+	}
+	enabled := 0
+	for name, exchange := range exchanges {
+		if !exchange.Enabled {
+			continue
+		}
+		enabled++
+
+		u, err := url.Parse(exchange.URL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("exchanges.%s.url: invalid url %q", name, exchange.URL))
+		}
+		for field, value := range map[string]string{"stream_url": exchange.StreamURL, "market_data_url": exchange.MarketDataURL} {
+			u, err = url.Parse(value)
+			if err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+				errs = append(errs, fmt.Errorf("exchanges.%s.%s: invalid websocket url %q", name, field, value))
+			}
+		}
+		if exchange.TakerFee != "" {
+			fee, err := decimal.NewFromString(exchange.TakerFee)
+			if err != nil || fee.IsNegative() || fee.GreaterThanOrEqual(decimal.NewFromInt(1)) {
+				errs = append(errs, fmt.Errorf("exchanges.%s.taker_fee: invalid fee rate %q", name, exchange.TakerFee))
+			}
+		}
+		if exchange.APIKey == "" {
+			errs = append(errs, fmt.Errorf("exchanges.%s.api_key: required", name))
+		}
+		if exchange.APISecret == "" {
+			errs = append(errs, fmt.Errorf("exchanges.%s.api_secret: required", name))
+		}
+		if err := validateCategory(name, exchange.Category); err != nil {
+			errs = append(errs, fmt.Errorf("exchanges.%s.category: %w", name, err))
+		}
+
+		for accountName, account := range exchange.Accounts {
+			prefix := fmt.Sprintf("exchanges.%s.accounts.%s", name, accountName)
+			if accountName == "" || accountName == trading.DefaultAccount || strings.Contains(accountName, ":") {
+				errs = append(errs, fmt.Errorf("%s: invalid account name", prefix))
+			}
+			if account.URL != "" {
+				u, err := url.Parse(account.URL)
+				if err != nil || u.Scheme == "" || u.Host == "" {
+					errs = append(errs, fmt.Errorf("%s.url: invalid url %q", prefix, account.URL))
+				}
+			}
+			if account.APIKey == "" {
+				errs = append(errs, fmt.Errorf("%s.api_key: required", prefix))
+			}
+			if account.APISecret == "" {
+				errs = append(errs, fmt.Errorf("%s.api_secret: required", prefix))
+			}
+			if err := validateCategory(name, account.Category); err != nil {
+				errs = append(errs, fmt.Errorf("%s.category: %w", prefix, err))
+			}
+		}
+	}
+	if enabled == 0 {
+		errs = append(errs, errors.New("exchanges: at least one exchange must be enabled"))
+	}
+
+	if c.TradingView.DefaultExchange != "" {
+		name, account := trading.ParseAccount(c.TradingView.DefaultExchange)
+		exchange, ok := exchanges[name]
+		if _, hasAccount := exchange.Accounts[account]; !ok || !exchange.Enabled || (account != trading.DefaultAccount && !hasAccount) {
+			errs = append(errs, fmt.Errorf("tradingview.default_exchange: %s is not enabled", c.TradingView.DefaultExchange))
+		}
+	}
+
+	if c.Secrets.ReloadInterval <= 0 {
+		errs = append(errs, errors.New("secrets.reload_interval: must be positive"))
+	}
+	if c.Secrets.Keystore.Path != "" && c.Secrets.Keystore.Passphrase == "" {
+		errs = append(errs, errors.New("secrets.keystore.passphrase: required"))
+	}
+	if c.Secrets.Vault.Address != "" {
+		u, err := url.Parse(c.Secrets.Vault.Address)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("secrets.vault.address: invalid url %q", c.Secrets.Vault.Address))
+		}
+	}
+
+	for i, key := range c.APIKeys {
+		if err := key.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("api_keys[%d]: %w", i, err))
+		}
+	}
+
+	if err := c.Risk.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("risk: %w", err))
+	}
+
+	if c.KillSwitch.Flatten && c.KillSwitch.FlattenTo == "" {
+		errs = append(errs, errors.New("kill_switch.flatten_to: required to flatten"))
+	}
+	for _, name := range c.KillSwitch.OnBreach {
+		if _, ok := risk.Checks[name]; !ok {
+			errs = append(errs, fmt.Errorf("kill_switch.on_breach: unknown risk check %q", name))
+		}
+	}
+
+	if err := c.Portfolio.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("portfolio: %w", err))
+	}
+	if err := c.Accounting.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("accounting: %w", err))
+	}
+	if err := c.Rebalance.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("rebalance: %w", err))
+	}
+	if err := c.DCA.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("dca: %w", err))
+	}
+	if err := c.Conditional.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("conditional: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// NewSecretResolver returns a resolver for the env: and file: schemes, plus
+// keystore: and vault: when they are configured. The keystore passphrase and
+// the vault token may themselves be env: or file: references.
+func (c Config) NewSecretResolver(ctx context.Context, httpClient *http.Client) (*secret.Resolver, error) {
+	resolver := secret.NewResolver()
+	resolver.Register("env", secret.NewEnvProvider())
+	resolver.Register("file", secret.NewFileProvider(c.Secrets.FileDir))
+
+	if c.Secrets.Keystore.Path != "" {
+		passphrase, err := resolver.GetSecret(ctx, c.Secrets.Keystore.Passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("secrets.keystore.passphrase: %w", err)
+		}
+		resolver.Register("keystore", secret.NewKeystoreProvider(c.Secrets.Keystore.Path, passphrase))
+	}
+
+	if c.Secrets.Vault.Address != "" {
+		token, err := resolver.GetSecret(ctx, c.Secrets.Vault.Token)
+		if err != nil {
+			return nil, fmt.Errorf("secrets.vault.token: %w", err)
+		}
+		resolver.Register("vault", secret.NewVaultProvider(secret.VaultConfig{
+			Address: c.Secrets.Vault.Address,
+			Token:   token,
+			Mount:   c.Secrets.Vault.Mount,
+		}, httpClient))
+	}
+
+	return resolver, nil
+}
+
+// Account is one exchange account to open in the trading.Registry. Its
+// credentials are still secret references.
+type Account struct {
+	Name          string
+	URL           string
+	StreamURL     string
+	MarketDataURL string
+	APIKey        string
+	APISecret     string
+	Category      string
+}
+
+func (c Config) Accounts() []Account {
+	exchanges := map[string]ExchangeConfig{
+		"binance":         c.Exchanges.Binance,
+		"binance_futures": c.Exchanges.BinanceFutures,
+		"bybit":           c.Exchanges.Bybit,
+		"coinbase":        c.Exchanges.Coinbase,
+	}
+
+	var accounts []Account
+	for name, exchange := range exchanges {
+		if !exchange.Enabled {
+			continue
+		}
+
+		accounts = append(accounts, Account{
+			Name:          name + ":" + trading.DefaultAccount,
+			URL:           exchange.URL,
+			StreamURL:     exchange.StreamURL,
+			MarketDataURL: exchange.MarketDataURL,
+			APIKey:        exchange.APIKey,
+			APISecret:     exchange.APISecret,
+			Category:      exchange.Category,
+		})
+
+		for accountName, account := range exchange.Accounts {
+			u := account.URL
+			if u == "" {
+				u = exchange.URL
+			}
+
+			accounts = append(accounts, Account{
+				Name:          name + ":" + accountName,
+				URL:           u,
+				StreamURL:     exchange.StreamURL,
+				MarketDataURL: exchange.MarketDataURL,
+				APIKey:        account.APIKey,
+				APISecret:     account.APISecret,
+				Category:      account.Category,
+			})
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Name < accounts[j].Name })
+
+	return accounts
+}
+
+// TakerFees returns the taker fee rate of every enabled exchange that
+// configures one.
+func (c Config) TakerFees() map[string]decimal.Decimal {
+	exchanges := map[string]ExchangeConfig{
+		"binance":         c.Exchanges.Binance,
+		"binance_futures": c.Exchanges.BinanceFutures,
+		"bybit":           c.Exchanges.Bybit,
+		"coinbase":        c.Exchanges.Coinbase,
+	}
+
+	fees := map[string]decimal.Decimal{}
+	for name, exchange := range exchanges {
+		if !exchange.Enabled || exchange.TakerFee == "" {
+			continue
+		}
+
+		fee, err := decimal.NewFromString(exchange.TakerFee)
+		if err == nil {
+			fees[name] = fee
+		}
+	}
+
+	return fees
+}
+
+func (a Account) SecretRefs() []string {
+	return []string{a.APIKey, a.APISecret}
+}
+
+func (a Account) AdapterConfig(ctx context.Context, provider secret.Provider, httpClient *http.Client) (trading.AdapterConfig, error) {
+	apiKey, err := provider.GetSecret(ctx, a.APIKey)
+	if err != nil {
+		return trading.AdapterConfig{}, fmt.Errorf("%s api_key: %w", a.Name, err)
+	}
+
+	apiSecret, err := provider.GetSecret(ctx, a.APISecret)
+	if err != nil {
+		return trading.AdapterConfig{}, fmt.Errorf("%s api_secret: %w", a.Name, err)
+	}
+
+	return trading.AdapterConfig{
+		URL:           a.URL,
+		StreamURL:     a.StreamURL,
+		MarketDataURL: a.MarketDataURL,
+		APIKey:        apiKey,
+		APISecret:     apiSecret,
+		Category:      a.Category,
+		HTTPClient:    httpClient,
+	}, nil
+}
@@ -0,0 +1,255 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"trading-aggregator/portfolio"
+	"trading-aggregator/secret"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoad_YAML(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+listen_address: 0.0.0.0:9000
+poll_interval: 2s
+exchanges:
+  binance:
+    enabled: true
+    api_key: key
+    api_secret: secret
+api_keys:
+  - id: ops
+    secret: ops-secret
+    exchanges: ["*"]
+    symbols: ["*"]
+    permissions: [read]
+risk:
+  keys:
+    ops:
+      max_notional: 5000
+      deny: [DOGE/USDT]
+  exchanges:
+    binance:
+      max_position:
+        BTC: 2
+portfolio:
+  method: average
+  tolerance: 0.001
+`)
+	t.Setenv("AGGREGATOR_BINANCE_API_SECRET", "env-secret")
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.ListenAddress != "0.0.0.0:9000" || config.PollInterval != 2*time.Second {
+		t.Fatalf("got config %+v", config)
+	}
+	accounts := config.Accounts()
+	if len(accounts) != 1 || accounts[0].Name != "binance:default" {
+		t.Fatalf("got accounts %+v", accounts)
+	}
+
+	binanceConfig, err := accounts[0].AdapterConfig(context.Background(), secret.NewResolver(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if binanceConfig.URL != "https://api.binance.com" {
+		t.Fatalf("default url not kept: %s", binanceConfig.URL)
+	}
+	if binanceConfig.APISecret != "env-secret" {
+		t.Fatalf("env override not applied: %s", binanceConfig.APISecret)
+	}
+	if len(config.APIKeys) != 1 || config.APIKeys[0].ID != "ops" {
+		t.Fatalf("got api keys %+v", config.APIKeys)
+	}
+	if config.Risk.Keys["ops"].MaxNotional.String() != "5000" || config.Risk.Exchanges["binance"].MaxPosition["BTC"].String() != "2" {
+		t.Fatalf("got risk %+v", config.Risk)
+	}
+	if config.Portfolio.Method != portfolio.AverageCost || config.Portfolio.Tolerance.String() != "0.001" || config.Portfolio.ReconcileInterval != 15*time.Minute {
+		t.Fatalf("got portfolio %+v", config.Portfolio)
+	}
+}
+
+func TestLoad_TOML(t *testing.T) {
+	path := writeFile(t, "config.toml", `
+listen_address = "localhost:8000"
+
+[exchanges.coinbase]
+enabled = true
+api_key = "key"
+api_secret = "secret"
+`)
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !config.Exchanges.Coinbase.Enabled || config.Exchanges.Coinbase.APIKey != "key" {
+		t.Fatalf("got config %+v", config.Exchanges.Coinbase)
+	}
+}
+
+func TestLoad_EnvOnly(t *testing.T) {
+	t.Setenv("AGGREGATOR_BYBIT_ENABLED", "true")
+	t.Setenv("AGGREGATOR_BYBIT_API_KEY", "key")
+	t.Setenv("AGGREGATOR_BYBIT_API_SECRET", "secret")
+	t.Setenv("AGGREGATOR_BINANCE_FUTURES_ENABLED", "true")
+	t.Setenv("AGGREGATOR_BINANCE_FUTURES_API_KEY", "futures-key")
+	t.Setenv("AGGREGATOR_BINANCE_FUTURES_API_SECRET", "futures-secret")
+	t.Setenv("AGGREGATOR_LISTEN_ADDRESS", "127.0.0.1:7000")
+
+	config, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.ListenAddress != "127.0.0.1:7000" || !config.Exchanges.Bybit.Enabled {
+		t.Fatalf("got config %+v", config)
+	}
+	accounts := config.Accounts()
+	if len(accounts) != 2 || accounts[0].Name != "binance_futures:default" || accounts[0].URL != "https://fapi.binance.com" || accounts[0].APIKey != "futures-key" {
+		t.Fatalf("got accounts %+v", accounts)
+	}
+}
+
+func TestLoad_ValidationErrors(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+listen_address: nope
+exchanges:
+  binance:
+    enabled: true
+    url: ":/bad"
+    taker_fee: "1.5"
+    category: linear
+tradingview:
+  default_exchange: bybit
+kill_switch:
+  flatten: true
+  on_breach: [max_size]
+portfolio:
+  method: hifo
+accounting:
+  method: average
+rebalance:
+  quote: USDT
+  targets:
+    BTC: 0.5
+    ETH: 0.3
+dca:
+  interval: -1s
+conditional:
+  poll_interval: -1s
+`)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+
+	for _, want := range []string{"listen_address", "exchanges.binance.url", "exchanges.binance.api_key", "exchanges.binance.api_secret", "exchanges.binance.taker_fee", "exchanges.binance.category", "tradingview.default_exchange", "kill_switch.flatten_to", "kill_switch.on_breach", "portfolio", "accounting", "rebalance: targets", "dca: interval", "conditional: poll_interval"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %s: %v", want, err)
+		}
+	}
+}
+
+func TestLoad_UnknownField(t *testing.T) {
+	path := writeFile(t, "config.yaml", "listen_adress: localhost:1\n")
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for unknown field")
+	}
+}
+
+func TestConfig_SecretReferences(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "binance_api_secret"), []byte("file-secret\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := writeFile(t, "config.yaml", `
+exchanges:
+  binance:
+    enabled: true
+    api_key: env:TEST_BINANCE_API_KEY
+    api_secret: file:binance_api_secret
+secrets:
+  file_dir: `+dir+`
+`)
+	t.Setenv("TEST_BINANCE_API_KEY", "env-key")
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolver, err := config.NewSecretResolver(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	binanceConfig, err := config.Accounts()[0].AdapterConfig(context.Background(), resolver, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if binanceConfig.APIKey != "env-key" || binanceConfig.APISecret != "file-secret" {
+		t.Fatalf("got credentials %s %s", binanceConfig.APIKey, binanceConfig.APISecret)
+	}
+}
+
+func TestConfig_Accounts(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+exchanges:
+  binance:
+    enabled: true
+    api_key: key
+    api_secret: secret
+    accounts:
+      hedge:
+        api_key: hedge-key
+        api_secret: hedge-secret
+  bybit:
+    enabled: false
+    accounts:
+      ignored:
+        api_key: key
+        api_secret: secret
+`)
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accounts := config.Accounts()
+	if len(accounts) != 2 {
+		t.Fatalf("got accounts %+v", accounts)
+	}
+	if accounts[0].Name != "binance:default" || accounts[1].Name != "binance:hedge" {
+		t.Fatalf("got accounts %+v", accounts)
+	}
+	if accounts[1].URL != "https://api.binance.com" || accounts[1].APIKey != "hedge-key" {
+		t.Fatalf("got account %+v", accounts[1])
+	}
+}
@@ -0,0 +1,143 @@
+package dca
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a cron expression of five fields, minute, hour, day of month,
+// month and day of week (0 or 7 is Sunday), evaluated in UTC. Fields take *,
+// values, ranges such as 1-5, lists and steps such as */15. The shorthands
+// @hourly, @daily, @weekly and @monthly are accepted as well.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// Like cron, a day matches either day field when both are restricted.
+	domAny, dowAny bool
+}
+
+var shorthands = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// maxSearch bounds the search for the next time, which only fails for dates
+// such as February 30.
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+func ParseSchedule(spec string) (Schedule, error) {
+	if s, ok := shorthands[strings.TrimSpace(spec)]; ok {
+		spec = s
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return Schedule{}, fmt.Errorf("schedule %q: want 5 fields, got %d", spec, len(fields))
+	}
+
+	var s Schedule
+	var err error
+	bounds := []struct {
+		bits     *uint64
+		min, max int
+	}{
+		{&s.minute, 0, 59},
+		{&s.hour, 0, 23},
+		{&s.dom, 1, 31},
+		{&s.month, 1, 12},
+		{&s.dow, 0, 7},
+	}
+	for i, b := range bounds {
+		*b.bits, err = parseField(fields[i], b.min, b.max)
+		if err != nil {
+			return Schedule{}, fmt.Errorf("schedule %q: %w", spec, err)
+		}
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny = fields[2] == "*"
+	s.dowAny = fields[4] == "*"
+
+	return s, nil
+}
+
+func parseField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			step = n
+			part = part[:i]
+		}
+
+		lo, hi := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			lo, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				hi, err = strconv.Atoi(bounds[1])
+				if err != nil {
+					return 0, fmt.Errorf("invalid value %q", part)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+// Next returns the first time of the schedule after t, or the zero time if
+// there is none.
+func (s Schedule) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxSearch)
+
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !s.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+func (s Schedule) matchDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+
+	return dom || dow
+}
@@ -0,0 +1,310 @@
+// Package dca buys a fixed amount of quote asset worth of a base asset on a
+// recurring schedule, dollar-cost averaging into it.
+package dca
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// CatchUp is what a plan does about the runs it missed while the scheduler
+// was not running.
+type CatchUp string
+
+const (
+	// CatchUpSkip drops missed runs and waits for the next one.
+	CatchUpSkip CatchUp = "skip"
+	// CatchUpOnce makes a single run for all the missed ones.
+	CatchUpOnce CatchUp = "once"
+	// CatchUpAll makes every missed run, up to maxCatchUp of them.
+	CatchUpAll CatchUp = "all"
+)
+
+func (c CatchUp) Validate() error {
+	switch c {
+	case CatchUpSkip, CatchUpOnce, CatchUpAll:
+		return nil
+	default:
+		return fmt.Errorf("unknown catch-up policy %q", c)
+	}
+}
+
+const (
+	// maxHistory is how many runs a plan keeps, oldest dropped first.
+	maxHistory = 100
+	// maxCatchUp bounds the missed runs CatchUpAll makes at once.
+	maxCatchUp = 100
+)
+
+type Config struct {
+	// Path is the JSON file plans are kept in; empty keeps them in memory.
+	Path string `yaml:"path" toml:"path"`
+	// Interval is how often plans are checked for due runs.
+	Interval time.Duration `yaml:"interval" toml:"interval"`
+}
+
+func (c Config) Validate() error {
+	if c.Interval < 0 {
+		return errors.New("interval: must not be negative")
+	}
+
+	return nil
+}
+
+// Plan buys QuoteAmount of Quote worth of Base on Exchange, an account name,
+// at every time of Schedule.
+type Plan struct {
+	ID          string          `json:"id"`
+	KeyID       string          `json:"key_id,omitempty"`
+	Exchange    string          `json:"exchange"`
+	Base        string          `json:"base"`
+	Quote       string          `json:"quote"`
+	QuoteAmount decimal.Decimal `json:"quote_amount"`
+	Schedule    string          `json:"schedule"`
+	CatchUp     CatchUp         `json:"catch_up"`
+	Paused      bool            `json:"paused"`
+	NextRun     time.Time       `json:"next_run"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	History     []Run           `json:"history"`
+}
+
+func (p Plan) Validate() error {
+	var errs []error
+
+	if p.Exchange == "" {
+		errs = append(errs, errors.New("exchange: required"))
+	}
+	if p.Base == "" || p.Quote == "" {
+		errs = append(errs, errors.New("base and quote: required"))
+	}
+	if !p.QuoteAmount.IsPositive() {
+		errs = append(errs, fmt.Errorf("quote_amount: must be positive, got %s", p.QuoteAmount))
+	}
+	if _, err := ParseSchedule(p.Schedule); err != nil {
+		errs = append(errs, err)
+	}
+	if err := p.CatchUp.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Run records a buy of a plan. Skipped counts the missed runs it stood in
+// for or that were dropped before it.
+type Run struct {
+	Scheduled time.Time       `json:"scheduled"`
+	Time      time.Time       `json:"time"`
+	OrderID   string          `json:"order_id,omitempty"`
+	Amount    decimal.Decimal `json:"amount"`
+	Skipped   int             `json:"skipped,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// Executor buys QuoteAmount worth of the plan's base asset, returning the
+// order placed and the base amount it was for, estimated at the last price
+// when the order is sized in the quote asset.
+type Executor func(plan Plan) (orderID string, amount decimal.Decimal, err error)
+
+// Scheduler runs the plans of a store as they come due.
+type Scheduler struct {
+	store    Store
+	execute  Executor
+	interval time.Duration
+	now      func() time.Time
+
+	// mu serializes changes to plans with their runs.
+	mu sync.Mutex
+}
+
+func New(store Store, execute Executor, config Config) *Scheduler {
+	if config.Interval <= 0 {
+		config.Interval = 30 * time.Second
+	}
+
+	return &Scheduler{
+		store:    store,
+		execute:  execute,
+		interval: config.Interval,
+		now:      time.Now,
+	}
+}
+
+// Create validates and stores a new plan, due at the next time of its
+// schedule. CatchUp defaults to CatchUpOnce.
+func (s *Scheduler) Create(plan Plan) (Plan, error) {
+	if plan.CatchUp == "" {
+		plan.CatchUp = CatchUpOnce
+	}
+	plan.Base = strings.ToUpper(plan.Base)
+	plan.Quote = strings.ToUpper(plan.Quote)
+
+	err := plan.Validate()
+	if err != nil {
+		return Plan{}, err
+	}
+
+	schedule, _ := ParseSchedule(plan.Schedule)
+	now := s.now().UTC()
+	plan.ID = uuid.NewString()
+	plan.NextRun = schedule.Next(now)
+	plan.CreatedAt = now
+	plan.UpdatedAt = now
+	plan.History = []Run{}
+	if plan.NextRun.IsZero() {
+		return Plan{}, fmt.Errorf("schedule %q never runs", plan.Schedule)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return plan, s.store.Save(plan)
+}
+
+func (s *Scheduler) Get(id string) (Plan, error) {
+	return s.store.Get(id)
+}
+
+func (s *Scheduler) List() ([]Plan, error) {
+	return s.store.List()
+}
+
+func (s *Scheduler) Pause(id string) (Plan, error) {
+	return s.update(id, func(p *Plan) {
+		p.Paused = true
+	})
+}
+
+// Resume unpauses a plan. The runs missed while paused are not made up for;
+// the plan is next due at the next time of its schedule.
+func (s *Scheduler) Resume(id string) (Plan, error) {
+	return s.update(id, func(p *Plan) {
+		if !p.Paused {
+			return
+		}
+		p.Paused = false
+		schedule, _ := ParseSchedule(p.Schedule)
+		p.NextRun = schedule.Next(s.now())
+	})
+}
+
+func (s *Scheduler) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store.Delete(id)
+}
+
+func (s *Scheduler) update(id string, change func(*Plan)) (Plan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	plan, err := s.store.Get(id)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	change(&plan)
+	plan.UpdatedAt = s.now().UTC()
+
+	return plan, s.store.Save(plan)
+}
+
+// Run makes the due runs every interval until ctx is done, starting with
+// the ones missed while it was not running.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.RunDue()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunDue makes the runs of every unpaused plan that are due.
+func (s *Scheduler) RunDue() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	plans, err := s.store.List()
+	if err != nil {
+		return
+	}
+
+	now := s.now().UTC()
+	for _, plan := range plans {
+		if plan.Paused || plan.NextRun.IsZero() || plan.NextRun.After(now) {
+			continue
+		}
+
+		s.runDue(plan, now)
+	}
+}
+
+// runDue makes the due runs of a plan according to its catch-up policy. A
+// run is missed rather than merely due once it is more than an interval
+// late.
+func (s *Scheduler) runDue(plan Plan, now time.Time) {
+	schedule, err := ParseSchedule(plan.Schedule)
+	if err != nil {
+		return
+	}
+
+	// Only the latest maxCatchUp runs are kept; n counts them all.
+	var due []time.Time
+	n := 0
+	for t := plan.NextRun; !t.IsZero() && !t.After(now); t = schedule.Next(t) {
+		n++
+		due = append(due, t)
+		if len(due) > maxCatchUp {
+			due = due[1:]
+		}
+	}
+
+	latest := due[len(due)-1:]
+	switch plan.CatchUp {
+	case CatchUpSkip:
+		due = latest
+		if now.Sub(latest[0]) > s.interval {
+			due = nil
+		}
+	case CatchUpOnce:
+		due = latest
+	}
+	skipped := n - len(due)
+
+	for _, scheduled := range due {
+		run := Run{Scheduled: scheduled, Time: now, Skipped: skipped}
+		skipped = 0
+
+		run.OrderID, run.Amount, err = s.execute(plan)
+		if err != nil {
+			run.Error = err.Error()
+		}
+		plan.History = append(plan.History, run)
+	}
+	if len(due) == 0 && skipped > 0 {
+		plan.History = append(plan.History, Run{Scheduled: plan.NextRun, Time: now, Skipped: skipped})
+	}
+	if len(plan.History) > maxHistory {
+		plan.History = plan.History[len(plan.History)-maxHistory:]
+	}
+
+	plan.NextRun = schedule.Next(now)
+	plan.UpdatedAt = now
+	_ = s.store.Save(plan)
+}
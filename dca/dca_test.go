@@ -0,0 +1,172 @@
+package dca
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestSchedule_Next(t *testing.T) {
+	from := time.Date(2024, 1, 31, 10, 7, 30, 0, time.UTC) // a Wednesday
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2024, 1, 31, 10, 15, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 9 * * 1-5", time.Date(2024, 2, 1, 9, 30, 0, 0, time.UTC)},
+		{"0 12 * * 0", time.Date(2024, 2, 4, 12, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2024, 2, 4, 12, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)},
+		// Either day field matches when both are restricted.
+		{"0 0 15 * 5", time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC)},
+		{"0 8,20 * * *", time.Date(2024, 1, 31, 20, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.spec)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.spec, err)
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%s: got %s, want %s", tt.spec, got, tt.want)
+		}
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("%q: parsed", spec)
+		}
+	}
+}
+
+func TestScheduler_CatchUp(t *testing.T) {
+	tests := []struct {
+		catchUp CatchUp
+		runs    int
+		skipped int
+	}{
+		{CatchUpSkip, 0, 3},
+		{CatchUpOnce, 1, 2},
+		{CatchUpAll, 3, 0},
+	}
+	for _, tt := range tests {
+		var runs int
+		execute := func(plan Plan) (string, decimal.Decimal, error) {
+			runs++
+			return "order", decimal.NewFromInt(1), nil
+		}
+
+		now := time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC)
+		s := New(NewMemoryStore(), execute, Config{Interval: time.Minute})
+		s.now = func() time.Time { return now }
+
+		plan, err := s.Create(Plan{Exchange: "binance:default", Base: "btc", Quote: "usdt", QuoteAmount: decimal.NewFromInt(10), Schedule: "@hourly", CatchUp: tt.catchUp})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Down from before 01:00 until after 03:00.
+		now = time.Date(2024, 1, 1, 3, 20, 0, 0, time.UTC)
+		s.RunDue()
+
+		plan, _ = s.Get(plan.ID)
+		skipped := 0
+		for _, run := range plan.History {
+			skipped += run.Skipped
+		}
+		if runs != tt.runs || skipped != tt.skipped || !plan.NextRun.Equal(time.Date(2024, 1, 1, 4, 0, 0, 0, time.UTC)) {
+			t.Errorf("%s: got %d runs and %d skipped, history %+v, next run %s", tt.catchUp, runs, skipped, plan.History, plan.NextRun)
+		}
+
+		// A run on time is made whatever the policy.
+		now = time.Date(2024, 1, 1, 4, 0, 30, 0, time.UTC)
+		s.RunDue()
+		if runs != tt.runs+1 {
+			t.Errorf("%s: run on time not made", tt.catchUp)
+		}
+	}
+}
+
+func TestScheduler_PauseResume(t *testing.T) {
+	var runs int
+	execute := func(plan Plan) (string, decimal.Decimal, error) {
+		runs++
+		return "", decimal.Zero, errors.New("rejected")
+	}
+
+	now := time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC)
+	s := New(NewMemoryStore(), execute, Config{})
+	s.now = func() time.Time { return now }
+
+	plan, err := s.Create(Plan{Exchange: "binance:default", Base: "BTC", Quote: "USDT", QuoteAmount: decimal.NewFromInt(10), Schedule: "0 * * * *"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Pause(plan.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	now = time.Date(2024, 1, 1, 5, 0, 0, 0, time.UTC)
+	s.RunDue()
+	if runs != 0 {
+		t.Fatalf("paused plan ran %d times", runs)
+	}
+
+	plan, err = s.Resume(plan.ID)
+	if err != nil || plan.Paused || !plan.NextRun.Equal(time.Date(2024, 1, 1, 6, 0, 0, 0, time.UTC)) {
+		t.Fatalf("got plan %+v, %v", plan, err)
+	}
+
+	now = plan.NextRun
+	s.RunDue()
+	plan, _ = s.Get(plan.ID)
+	if runs != 1 || len(plan.History) != 1 || plan.History[0].Error != "rejected" {
+		t.Fatalf("got %d runs, history %+v", runs, plan.History)
+	}
+
+	if err = s.Delete(plan.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Get(plan.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got %v for a deleted plan", err)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plans.json")
+
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(store, nil, Config{})
+	plan, err := s.Create(Plan{Exchange: "kraken:default", Base: "ETH", Quote: "EUR", QuoteAmount: decimal.NewFromInt(25), Schedule: "0 9 * * 1", CatchUp: CatchUpSkip})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Get(plan.ID)
+	if err != nil || !got.QuoteAmount.Equal(plan.QuoteAmount) || got.CatchUp != CatchUpSkip || !got.NextRun.Equal(plan.NextRun) {
+		t.Fatalf("got plan %+v, %v", got, err)
+	}
+}
+
+func TestPlan_Validate(t *testing.T) {
+	err := Plan{QuoteAmount: decimal.NewFromInt(-1), Schedule: "daily", CatchUp: "sometimes"}.Validate()
+	for _, want := range []string{"exchange", "base and quote", "quote_amount", "schedule", "catch-up"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %s: %v", want, err)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package dca
+
+import (
+	"errors"
+	"time"
+
+	"trading-aggregator/jsonstore"
+)
+
+var ErrNotFound = errors.New("plan not found")
+
+type Store interface {
+	Save(Plan) error
+	Get(id string) (Plan, error)
+	List() ([]Plan, error)
+	Delete(id string) error
+}
+
+type store struct {
+	plans *jsonstore.Store[Plan]
+}
+
+func planID(p Plan) string { return p.ID }
+
+func planCreatedAt(p Plan) time.Time { return p.CreatedAt }
+
+func NewMemoryStore() Store {
+	return store{plans: jsonstore.NewMemory(planID, planCreatedAt)}
+}
+
+// NewFileStore loads the plans from the JSON file at path and writes them
+// back on every change.
+func NewFileStore(path string) (Store, error) {
+	plans, err := jsonstore.NewFile(path, planID, planCreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return store{plans: plans}, nil
+}
+
+func (s store) Save(p Plan) error {
+	return s.plans.Save(p)
+}
+
+func (s store) Get(id string) (Plan, error) {
+	p, ok := s.plans.Get(id)
+	if !ok {
+		return Plan{}, ErrNotFound
+	}
+
+	return p, nil
+}
+
+// List returns the plans oldest first.
+func (s store) List() ([]Plan, error) {
+	return s.plans.List(), nil
+}
+
+func (s store) Delete(id string) error {
+	ok, err := s.plans.Delete(id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+
+	return nil
+}
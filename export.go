@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// runExport downloads the accounting export of a date range from a running
+// service, since the fills are kept by the service.
+func runExport(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	api := newAPIClient(flags, "id of an API key with the read permission")
+	format := flags.String("format", "csv", "csv for tax lots, koinly or cointracking for trades")
+	from := flags.String("from", "", "first day, e.g. 2024-01-01, or RFC 3339 time of the range")
+	to := flags.String("to", "", "day or time the range ends before, now by default")
+	method := flags.String("method", "", "lot matching method, fifo, lifo or hifo; the configured one by default")
+	fiat := flags.String("fiat", "", "currency to value trades in; the configured one by default")
+	output := flags.String("o", "", "file to write, standard output by default")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+
+	query := url.Values{}
+	for name, value := range map[string]string{"from": *from, "to": *to, "method": *method, "fiat": *fiat} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+
+	target := "/exports/" + url.PathEscape(*format)
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	status, body, err := api.do(http.MethodGet, target, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if status != http.StatusOK {
+		fmt.Fprintln(os.Stderr, string(bytes.TrimSpace(body)))
+		return 1
+	}
+
+	if *output == "" {
+		_, err = os.Stdout.Write(body)
+	} else {
+		err = os.WriteFile(*output, body, 0o600)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
@@ -3,7 +3,16 @@ module trading-aggregator
 go 1.21.5
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/google/uuid v1.6.0
 	github.com/gorilla/mux v1.8.1
 	github.com/shopspring/decimal v1.4.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require github.com/gorilla/websocket v1.5.3
+
+require (
+	golang.org/x/crypto v0.21.0
+	golang.org/x/sys v0.18.0 // indirect
 )
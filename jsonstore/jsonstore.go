@@ -0,0 +1,147 @@
+// Package jsonstore keeps records by ID in memory and, when given a path,
+// writes all of them to a JSON file on every change so that they survive
+// restarts.
+package jsonstore
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store keeps records of type T. id and created read the ID and the creation
+// time of a record, which List sorts by.
+type Store[T any] struct {
+	id      func(T) string
+	created func(T) time.Time
+	path    string
+
+	mu      sync.RWMutex
+	records map[string]T
+	// writeMu orders the writes of the file.
+	writeMu sync.Mutex
+}
+
+func NewMemory[T any](id func(T) string, created func(T) time.Time) *Store[T] {
+	return &Store[T]{
+		id:      id,
+		created: created,
+		records: make(map[string]T),
+	}
+}
+
+// NewFile loads the records from the JSON file at path, which is created on
+// the first change if it does not exist.
+func NewFile[T any](path string, id func(T) string, created func(T) time.Time) (*Store[T], error) {
+	s := NewMemory(id, created)
+	s.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var records []T
+	err = json.Unmarshal(data, &records)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		s.records[id(r)] = r
+	}
+
+	return s, nil
+}
+
+func (s *Store[T]) Save(r T) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.mu.Lock()
+	s.records[s.id(r)] = r
+	s.mu.Unlock()
+
+	return s.write()
+}
+
+func (s *Store[T]) Get(id string) (T, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	r, ok := s.records[id]
+	return r, ok
+}
+
+// List returns the records oldest first.
+func (s *Store[T]) List() []T {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]T, 0, len(s.records))
+	for _, r := range s.records {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		a, b := s.created(records[i]), s.created(records[j])
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return s.id(records[i]) < s.id(records[j])
+	})
+
+	return records
+}
+
+// Delete removes the record with id, reporting whether there was one.
+func (s *Store[T]) Delete(id string) (bool, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.mu.Lock()
+	_, ok := s.records[id]
+	delete(s.records, id)
+	s.mu.Unlock()
+
+	if !ok {
+		return false, nil
+	}
+
+	return true, s.write()
+}
+
+// write replaces the file through a temporary file so that a crash never
+// leaves half of it behind. Stores without a path are not written.
+func (s *Store[T]) write() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s.List(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Close()
+	}
+	if err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,54 @@
+package jsonstore
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type record struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func recordID(r record) string { return r.ID }
+
+func recordCreatedAt(r record) time.Time { return r.CreatedAt }
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.json")
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	s, err := NewFile(path, recordID, recordCreatedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []record{
+		{ID: "b", Name: "second", CreatedAt: now.Add(time.Minute)},
+		{ID: "c", Name: "third", CreatedAt: now.Add(time.Minute)},
+		{ID: "a", Name: "first", CreatedAt: now},
+	} {
+		if err := s.Save(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ok, err := s.Delete("c"); !ok || err != nil {
+		t.Fatalf("got %v, %v deleting a record", ok, err)
+	}
+	if ok, _ := s.Delete("c"); ok {
+		t.Fatal("deleted a record twice")
+	}
+
+	s, err = NewFile(path, recordID, recordCreatedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := s.List()
+	if len(list) != 2 || list[0].Name != "first" || list[1].Name != "second" {
+		t.Fatalf("got records %+v", list)
+	}
+	if _, ok := s.Get("c"); ok {
+		t.Fatal("got a deleted record")
+	}
+}
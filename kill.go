@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"trading-aggregator/killswitch"
+)
+
+// runKill engages or releases the kill switch of a running service through
+// its API, signing the request with an admin API key.
+func runKill(args []string) int {
+	flags := flag.NewFlagSet("kill", flag.ContinueOnError)
+	api := newAPIClient(flags, "id of an API key with the admin permission")
+	reason := flags.String("reason", "engaged from the command line", "why trading is stopped")
+	flatten := flags.Bool("flatten", false, "sell positions into the configured asset")
+	release := flags.Bool("release", false, "release the kill switch instead")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+
+	method := http.MethodPost
+	var body []byte
+	if *release {
+		method = http.MethodDelete
+	} else {
+		body, err = json.Marshal(map[string]interface{}{"reason": *reason, "flatten": *flatten})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	status, resBody, err := api.do(method, "/kill-switch", body)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Println(string(bytes.TrimSpace(resBody)))
+	if status != http.StatusOK {
+		return 1
+	}
+
+	return 0
+}
+
+func logKillReport(report killswitch.Report) {
+	log.Printf("kill switch engaged: %s", report.State.Reason)
+	for _, result := range report.Canceled {
+		if result.Error != "" {
+			log.Printf("cancel %s orders: %s", result.Account, result.Error)
+		}
+	}
+	for _, sale := range report.Flattened {
+		if sale.Error != "" {
+			log.Printf("flatten %s %s: %s", sale.Account, sale.Asset, sale.Error)
+		}
+	}
+}
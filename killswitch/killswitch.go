@@ -0,0 +1,287 @@
+package killswitch
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/trading"
+)
+
+var (
+	ErrEngaged     = errors.New("kill switch engaged")
+	ErrNoFlattenTo = errors.New("no asset to flatten to")
+)
+
+type Config struct {
+	// FlattenTo is the quote asset positions are sold into when flattening,
+	// e.g. "USDT".
+	FlattenTo string
+}
+
+type State struct {
+	Engaged bool      `json:"engaged"`
+	Reason  string    `json:"reason,omitempty"`
+	Since   time.Time `json:"since,omitempty"`
+}
+
+// Result is the outcome of canceling the open orders of an account.
+type Result struct {
+	Account string `json:"account"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Sale is an order placed to flatten an asset of an account. On derivatives
+// accounts it closes the position in the contract that Asset names, buying
+// back shorts.
+type Sale struct {
+	Account string          `json:"account"`
+	Asset   string          `json:"asset"`
+	Side    string          `json:"side,omitempty"`
+	Amount  decimal.Decimal `json:"amount"`
+	OrderID string          `json:"order_id,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+type Report struct {
+	State     State    `json:"state"`
+	Canceled  []Result `json:"canceled"`
+	Flattened []Sale   `json:"flattened,omitempty"`
+}
+
+// Switch stops trading on every account of a registry. Once engaged, Check
+// fails until the switch is released, and the callers placing orders are
+// expected to ask it first.
+type Switch struct {
+	registry *trading.Registry
+	config   Config
+
+	mu    sync.Mutex
+	state State
+	hooks []func(reason string)
+}
+
+func New(registry *trading.Registry, config Config) *Switch {
+	return &Switch{
+		registry: registry,
+		config:   config,
+	}
+}
+
+// OnEngage registers hook to be called whenever the switch is engaged, before
+// the open orders are canceled.
+func (s *Switch) OnEngage(hook func(reason string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.hooks = append(s.hooks, hook)
+}
+
+func (s *Switch) State() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.state
+}
+
+func (s *Switch) Check() error {
+	state := s.State()
+	if state.Engaged {
+		return fmt.Errorf("%w: %s", ErrEngaged, state.Reason)
+	}
+
+	return nil
+}
+
+// Engage blocks new orders, then cancels the open orders of every account
+// and, with flatten, sells every asset it can into the FlattenTo asset at
+// market. Engaging an engaged switch keeps its reason and cancels again.
+func (s *Switch) Engage(reason string, flatten bool) (Report, error) {
+	if flatten && s.config.FlattenTo == "" {
+		return Report{}, ErrNoFlattenTo
+	}
+
+	s.mu.Lock()
+	if !s.state.Engaged {
+		s.state = State{Engaged: true, Reason: reason, Since: time.Now().UTC()}
+	}
+	report := Report{State: s.state}
+	hooks := append([]func(string){}, s.hooks...)
+	s.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook(reason)
+	}
+
+	accounts := s.registry.Accounts()
+	results := make([]Result, len(accounts))
+	sales := make([][]Sale, len(accounts))
+
+	var wg sync.WaitGroup
+	for i, account := range accounts {
+		wg.Add(1)
+		go func(i int, account trading.Account) {
+			defer wg.Done()
+
+			results[i] = Result{Account: account.Name}
+			err := cancelAll(account.Client)
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+
+			if flatten {
+				sales[i] = s.flatten(account)
+			}
+		}(i, account)
+	}
+	wg.Wait()
+
+	report.Canceled = results
+	for _, accountSales := range sales {
+		report.Flattened = append(report.Flattened, accountSales...)
+	}
+
+	return report, nil
+}
+
+// Release lets orders through again. Canceled orders stay canceled.
+func (s *Switch) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state = State{}
+}
+
+func cancelAll(client trading.Client) error {
+	canceler, ok := client.(trading.CancelAller)
+	if !ok {
+		return errors.New("the exchange cannot cancel all orders")
+	}
+
+	return canceler.CancelAllOrders()
+}
+
+// flatten sells the free balance of every asset that the account lists
+// against the FlattenTo asset, rounded down to the venue's increment.
+// Derivatives accounts close their positions instead, as their balances are
+// margin rather than holdings.
+func (s *Switch) flatten(account trading.Account) []Sale {
+	if derivatives, ok := account.Client.(trading.DerivativesClient); ok {
+		return closePositions(account.Name, derivatives)
+	}
+
+	balanceClient, ok := account.Client.(trading.BalanceClient)
+	if !ok {
+		return []Sale{{Account: account.Name, Error: "the exchange does not report balances"}}
+	}
+	lister, ok := account.Client.(trading.InstrumentLister)
+	if !ok {
+		return []Sale{{Account: account.Name, Error: "the exchange does not list instruments"}}
+	}
+
+	balances, err := balanceClient.GetBalances()
+	if err != nil {
+		return []Sale{{Account: account.Name, Error: err.Error()}}
+	}
+	listings, err := lister.ListInstruments()
+	if err != nil {
+		return []Sale{{Account: account.Name, Error: err.Error()}}
+	}
+
+	byInstrument := map[trading.Instrument]trading.Listing{}
+	for _, listing := range listings {
+		byInstrument[listing.Instrument] = listing
+	}
+
+	var sales []Sale
+	for _, balance := range balances {
+		if strings.EqualFold(balance.Asset, s.config.FlattenTo) || !balance.Free.IsPositive() {
+			continue
+		}
+
+		listing, ok := byInstrument[trading.NewInstrument(balance.Asset, s.config.FlattenTo)]
+		if !ok {
+			continue
+		}
+
+		amount := trading.RoundDown(balance.Free, listing.BaseIncrement)
+		if !amount.IsPositive() || amount.LessThan(listing.MinBase) {
+			continue
+		}
+
+		sale := Sale{Account: account.Name, Asset: balance.Asset, Amount: amount}
+		res, err := account.Client.Sell(trading.SellRequest{TradeRequest: trading.TradeRequest{
+			Base:          listing.Instrument.Base,
+			Quote:         listing.Instrument.Quote,
+			Amount:        amount,
+			ClientOrderID: uuid.NewString(),
+		}})
+		if err != nil {
+			sale.Error = err.Error()
+		}
+		sale.OrderID = res.OrderID
+		sales = append(sales, sale)
+	}
+	sort.Slice(sales, func(i, j int) bool { return sales[i].Asset < sales[j].Asset })
+
+	return sales
+}
+
+// closePositions closes every open position of a derivatives account with
+// orders that can only reduce it: reduce-only in one-way mode, and on the
+// position's own side in hedge mode, where venues such as Binance do not
+// take reduce-only.
+func closePositions(account string, client trading.DerivativesClient) []Sale {
+	positions, err := client.GetPositions(trading.GetPositionsRequest{})
+	if err != nil {
+		return []Sale{{Account: account, Error: err.Error()}}
+	}
+
+	var sales []Sale
+	for _, position := range positions {
+		if position.Size.IsZero() {
+			continue
+		}
+
+		req := trading.TradeRequest{
+			Base:          position.Instrument.Base,
+			Quote:         position.Instrument.Quote,
+			Amount:        position.Size.Abs(),
+			ReduceOnly:    position.PositionIdx == trading.OneWayPosition,
+			PositionIdx:   position.PositionIdx,
+			ClientOrderID: uuid.NewString(),
+		}
+
+		sale := Sale{Account: account, Asset: position.Symbol, Side: "sell", Amount: req.Amount}
+		var res trading.TradeResponse
+		if position.Size.IsNegative() {
+			sale.Side = "buy"
+			var buy trading.BuyResponse
+			buy, err = client.Buy(trading.BuyRequest{TradeRequest: req})
+			res = buy.TradeResponse
+		} else {
+			var sell trading.SellResponse
+			sell, err = client.Sell(trading.SellRequest{TradeRequest: req})
+			res = sell.TradeResponse
+		}
+		if err != nil {
+			sale.Error = err.Error()
+		}
+		sale.OrderID = res.OrderID
+		sales = append(sales, sale)
+	}
+	sort.Slice(sales, func(i, j int) bool {
+		if sales[i].Asset != sales[j].Asset {
+			return sales[i].Asset < sales[j].Asset
+		}
+		return sales[i].Side < sales[j].Side
+	})
+
+	return sales
+}
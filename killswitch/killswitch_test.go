@@ -0,0 +1,142 @@
+package killswitch
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/simulator"
+	"trading-aggregator/trading"
+)
+
+func TestSwitch_Engage(t *testing.T) {
+	sim := simulator.New()
+	sim.SetPrice("BTC", "USDT", decimal.NewFromInt(100))
+	sim.SetPrice("ETH", "BTC", decimal.RequireFromString("0.05"))
+	sim.SetBalance("BTC", decimal.NewFromInt(2))
+	sim.SetBalance("ETH", decimal.NewFromInt(3))
+	sim.SetBalance("USDT", decimal.NewFromInt(50))
+
+	res, err := sim.Buy(trading.BuyRequest{TradeRequest: trading.TradeRequest{
+		Base:   "BTC",
+		Quote:  "USDT",
+		Amount: decimal.NewFromInt(1),
+		Type:   trading.OrderTypeLimit,
+		Price:  decimal.NewFromInt(90),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry := trading.NewRegistry()
+	registry.Set("sim", sim)
+
+	s := New(registry, Config{FlattenTo: "USDT"})
+	var hooked string
+	s.OnEngage(func(reason string) { hooked = reason })
+
+	if err := s.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := s.Engage("drill", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hooked != "drill" || !report.State.Engaged || len(report.Canceled) != 1 || report.Canceled[0].Error != "" {
+		t.Fatalf("got report %+v", report)
+	}
+
+	detail, err := sim.GetOrderDetail(trading.GetOrderDetailRequest{OrderID: res.OrderID})
+	if err != nil || detail.Status != simulator.StatusCanceled {
+		t.Fatalf("got %+v, %v", detail, err)
+	}
+
+	// ETH is not listed against USDT and stays.
+	if len(report.Flattened) != 1 || report.Flattened[0].Asset != "BTC" || report.Flattened[0].Error != "" {
+		t.Fatalf("got sales %+v", report.Flattened)
+	}
+	balances, _ := sim.GetBalances()
+	if len(balances) != 2 || balances[0].Asset != "ETH" || balances[1].Free.String() != "250" {
+		t.Fatalf("got balances %+v", balances)
+	}
+
+	if err := s.Check(); !errors.Is(err, ErrEngaged) {
+		t.Fatalf("got error %v", err)
+	}
+
+	// A second trigger keeps the first reason.
+	report, _ = s.Engage("again", false)
+	if report.State.Reason != "drill" || len(report.Flattened) != 0 {
+		t.Fatalf("got report %+v", report)
+	}
+
+	s.Release()
+	if err := s.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = New(registry, Config{}).Engage("drill", true)
+	if !errors.Is(err, ErrNoFlattenTo) {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+type perpetualExchange struct {
+	*simulator.Exchange
+	positions []trading.Position
+	orders    []string
+}
+
+func (e *perpetualExchange) Buy(req trading.BuyRequest) (trading.BuyResponse, error) {
+	e.orders = append(e.orders, describe("buy", req.TradeRequest))
+	return trading.BuyResponse{}, nil
+}
+
+func (e *perpetualExchange) Sell(req trading.SellRequest) (trading.SellResponse, error) {
+	e.orders = append(e.orders, describe("sell", req.TradeRequest))
+	return trading.SellResponse{}, nil
+}
+
+func (e *perpetualExchange) SetLeverage(trading.SetLeverageRequest) error { return nil }
+
+func (e *perpetualExchange) GetPositions(trading.GetPositionsRequest) ([]trading.Position, error) {
+	return e.positions, nil
+}
+
+func (e *perpetualExchange) GetFundingHistory(trading.GetFundingHistoryRequest) ([]trading.FundingPayment, error) {
+	return nil, nil
+}
+
+func describe(side string, req trading.TradeRequest) string {
+	return fmt.Sprintf("%s %s %s/%s reduce=%t idx=%d", side, req.Amount, req.Base, req.Quote, req.ReduceOnly, req.PositionIdx)
+}
+
+func TestSwitch_FlattenDerivatives(t *testing.T) {
+	sim := simulator.New()
+	sim.SetPrice("BTC", "USDT", decimal.NewFromInt(100))
+	sim.SetBalance("BTC", decimal.NewFromInt(2))
+
+	perp := &perpetualExchange{Exchange: sim, positions: []trading.Position{
+		{Symbol: "BTCUSDT", Instrument: trading.NewInstrument("BTC", "USDT"), Size: decimal.RequireFromString("-0.5")},
+		{Symbol: "ETHUSDT", Instrument: trading.NewInstrument("ETH", "USDT"), Size: decimal.NewFromInt(3), PositionIdx: trading.LongPosition},
+	}}
+	registry := trading.NewRegistry()
+	registry.Set("perp", perp)
+
+	report, err := New(registry, Config{FlattenTo: "USDT"}).Engage("drill", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The BTC margin balance is not sold, which would open a short.
+	want := []string{"buy 0.5 BTC/USDT reduce=true idx=0", "sell 3 ETH/USDT reduce=false idx=1"}
+	if fmt.Sprint(perp.orders) != fmt.Sprint(want) {
+		t.Fatalf("got orders %v", perp.orders)
+	}
+	if len(report.Flattened) != 2 || report.Flattened[0].Asset != "BTCUSDT" || report.Flattened[0].Side != "buy" {
+		t.Fatalf("got sales %+v", report.Flattened)
+	}
+}
@@ -2,24 +2,172 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
-	"trading-aggregator/binance"
+	"trading-aggregator/auth"
+	_ "trading-aggregator/binance"
+	"trading-aggregator/book"
+	_ "trading-aggregator/bybit"
+	_ "trading-aggregator/coinbase"
+	"trading-aggregator/config"
+	"trading-aggregator/portfolio"
+	"trading-aggregator/secret"
+	"trading-aggregator/trading"
 	"trading-aggregator/webhook"
 )
 
 func main() {
-	binance.NewClient(binance.Config{
-		URL:       "https://api.binance.com/api",
-		APIKey:    "XYUUr93tv7v6VEMNVVAKFH0n3AmqczOeDPUQowSTR95oMZeqQYI0npkFlzP3aTre",
-		APISecret: "2z9LTZOF76LXrmakM5Qec2ATCwmDUOQAz2WX8BjxoOK65lHOZqax1RxPEZ75Lgdn",
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "kill":
+			os.Exit(runKill(os.Args[2:]))
+		case "export":
+			os.Exit(runExport(os.Args[2:]))
+		}
+	}
+
+	configPath := flag.String("config", os.Getenv("AGGREGATOR_CONFIG"), "path to the YAML or TOML config file")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(1)
+	}
+
+	listener, err := net.Listen("tcp", cfg.ListenAddress)
+	if err != nil {
+		panic(err)
+	}
+
+	deadLetter, err := os.OpenFile(cfg.Callback.DeadLetterPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		panic(err)
+	}
+	defer deadLetter.Close()
+
+	ctx := context.Background()
+
+	resolver, err := cfg.NewSecretResolver(ctx, http.DefaultClient)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(1)
+	}
+
+	registry := trading.NewRegistry()
+	for _, account := range cfg.Accounts() {
+		adapterConfig, err := account.AdapterConfig(ctx, resolver, http.DefaultClient)
+		if err == nil {
+			err = registry.Open(account.Name, adapterConfig)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+			os.Exit(1)
+		}
+
+		account := account
+		go secret.Watch(ctx, resolver, cfg.Secrets.ReloadInterval, account.SecretRefs(), func([]string) {
+			adapterConfig, err := account.AdapterConfig(ctx, resolver, http.DefaultClient)
+			if err == nil {
+				err = registry.Open(account.Name, adapterConfig)
+			}
+			if err != nil {
+				log.Printf("reload %s credentials: %v", account.Name, err)
+				return
+			}
+			log.Printf("reloaded %s credentials", account.Name)
+		}, func(err error) {
+			log.Printf("watch %s credentials: %v", account.Name, err)
+		})
+	}
+
+	webhookServer, err := webhook.NewWebhook(listener, registry, webhookConfig(cfg, deadLetter))
+	if err != nil {
+		panic(err)
+	}
+
+	webhookServer.Portfolio().OnDrift(func(reconciliation portfolio.Reconciliation) {
+		for _, drift := range reconciliation.Drifts {
+			log.Printf("position drift on %s: %s balance is %s, expected %s",
+				drift.Account, drift.Asset, drift.Balance, drift.Expected)
+		}
 	})
 
-	listener, err := net.Listen("tcp", "localhost:8888")
+	// SIGUSR1 engages the kill switch.
+	kill := make(chan os.Signal, 1)
+	signal.Notify(kill, syscall.SIGUSR1)
+	go func() {
+		for range kill {
+			report, err := webhookServer.Kill("signal")
+			if err != nil {
+				log.Printf("kill switch: %v", err)
+				continue
+			}
+			logKillReport(report)
+		}
+	}()
+
+	// SIGHUP reloads the API keys and risk limits from the config file.
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			cfg, err := config.Load(*configPath)
+			if err == nil {
+				err = webhookServer.Reload(webhookConfig(cfg, deadLetter))
+			}
+			if err != nil {
+				log.Printf("reload config: %v", err)
+				continue
+			}
+			log.Printf("reloaded api keys and risk limits")
+		}
+	}()
+
+	err = webhookServer.Serve(ctx)
 	if err != nil {
 		panic(err)
 	}
+}
 
-	webhookServer := webhook.NewWebhook(listener)
-	webhookServer.Serve(context.Background())
+func webhookConfig(cfg config.Config, deadLetter io.Writer) webhook.Config {
+	return webhook.Config{
+		PollInterval: cfg.PollInterval,
+		Callback: webhook.CallbackConfig{
+			Secret:     cfg.Callback.Secret,
+			MaxRetries: cfg.Callback.MaxRetries,
+			Backoff:    cfg.Callback.Backoff,
+			DeadLetter: deadLetter,
+		},
+		TradingView: webhook.TradingViewConfig{
+			Passphrase:      cfg.TradingView.Passphrase,
+			DefaultExchange: cfg.TradingView.DefaultExchange,
+			DedupWindow:     cfg.TradingView.DedupWindow,
+		},
+		Auth: auth.Config{
+			Keys: cfg.APIKeys,
+		},
+		Books: book.Config{
+			TakerFees: cfg.TakerFees(),
+		},
+		Risk: cfg.Risk,
+		KillSwitch: webhook.KillSwitchConfig{
+			FlattenTo: cfg.KillSwitch.FlattenTo,
+			Flatten:   cfg.KillSwitch.Flatten,
+			OnBreach:  cfg.KillSwitch.OnBreach,
+		},
+		Portfolio:   cfg.Portfolio,
+		Accounting:  cfg.Accounting,
+		Rebalance:   cfg.Rebalance,
+		DCA:         cfg.DCA,
+		Conditional: cfg.Conditional,
+	}
 }
@@ -0,0 +1,383 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/trading"
+)
+
+var ErrNotFound = errors.New("order not found")
+
+type Order struct {
+	ID            string                         `json:"id"`
+	Exchange      string                         `json:"exchange"`
+	Side          string                         `json:"side"`
+	Base          string                         `json:"base"`
+	Quote         string                         `json:"quote"`
+	Amount        decimal.Decimal                `json:"amount"`
+	QuoteAmount   decimal.Decimal                `json:"quote_amount,omitempty"`
+	Type          trading.OrderType              `json:"type,omitempty"`
+	Price         decimal.Decimal                `json:"price"`
+	TimeInForce   trading.TimeInForce            `json:"time_in_force,omitempty"`
+	StopPrice     decimal.Decimal                `json:"stop_price,omitempty"`
+	StopDirection trading.StopDirection          `json:"stop_direction,omitempty"`
+	ListID        string                         `json:"list_id,omitempty"`
+	ReduceOnly    bool                           `json:"reduce_only,omitempty"`
+	PositionIdx   trading.PositionIdx            `json:"position_idx,omitempty"`
+	ClientOrderID string                         `json:"client_order_id"`
+	OrderID       string                         `json:"order_id"`
+	ParentID      string                         `json:"parent_id,omitempty"`
+	Algo          *Algo                          `json:"algo,omitempty"`
+	CallbackURL   string                         `json:"callback_url,omitempty"`
+	Detail        trading.GetOrderDetailResponse `json:"detail"`
+	CreatedAt     time.Time                      `json:"created_at"`
+	UpdatedAt     time.Time                      `json:"updated_at"`
+}
+
+// Statuses of parent orders, which are worked by an execution algorithm
+// rather than placed on a venue. Parents end as FILLED, CANCELED or FAILED.
+const (
+	StatusRunning  = "RUNNING"
+	StatusPaused   = "PAUSED"
+	StatusFilled   = "FILLED"
+	StatusCanceled = "CANCELED"
+	StatusFailed   = "FAILED"
+)
+
+// Algo describes the execution of a parent order. Its child orders are
+// ordinary orders whose ParentID is the parent's ID; Pending is the amount in
+// children that have not ended yet.
+type Algo struct {
+	Name     string          `json:"name"`
+	Children int             `json:"children"`
+	Failures int             `json:"failures"`
+	Pending  decimal.Decimal `json:"pending"`
+}
+
+func (o Order) IsParent() bool {
+	return o.Algo != nil
+}
+
+func (o Order) IsTerminal() bool {
+	return IsTerminalStatus(o.Detail.Status)
+}
+
+// IsTerminalStatus reports whether an exchange order status will not change
+// anymore. Statuses are compared case-insensitively because Binance, Bybit and
+// Coinbase disagree on both spelling and casing.
+func IsTerminalStatus(status string) bool {
+	switch strings.ToUpper(status) {
+	case "FILLED", "CANCELED", "CANCELLED", "REJECTED", "EXPIRED", "EXPIRED_IN_MATCH",
+		"FAILED", "PARTIALLYFILLEDCANCELED", "DEACTIVATED":
+		return true
+	}
+
+	return false
+}
+
+type Store interface {
+	Save(Order) error
+	Get(id string) (Order, error)
+	List() ([]Order, error)
+}
+
+type memoryStore struct {
+	mu     sync.RWMutex
+	orders map[string]Order
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{
+		orders: make(map[string]Order),
+	}
+}
+
+func (s *memoryStore) Save(o Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.orders[o.ID] = o
+	return nil
+}
+
+func (s *memoryStore) Get(id string) (Order, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	o, ok := s.orders[id]
+	if !ok {
+		return Order{}, ErrNotFound
+	}
+
+	return o, nil
+}
+
+func (s *memoryStore) List() ([]Order, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	orders := make([]Order, 0, len(s.orders))
+	for _, o := range s.orders {
+		orders = append(orders, o)
+	}
+
+	return orders, nil
+}
+
+// openKey identifies an open order for streamed updates. Exchange order IDs
+// are only unique per symbol on some venues and client order IDs may repeat
+// across symbols, so the instrument is part of the key.
+type openKey struct {
+	account    string
+	instrument trading.Instrument
+	orderID    string
+	clientID   string
+}
+
+// indexedStore keeps an index of the open venue orders of a Store so that
+// streamed updates do not scan every order ever saved.
+type indexedStore struct {
+	Store
+	mu   sync.RWMutex
+	open map[openKey]string
+	keys map[string][]openKey
+}
+
+func newIndexedStore(store Store) *indexedStore {
+	s := &indexedStore{
+		Store: store,
+		open:  make(map[openKey]string),
+		keys:  make(map[string][]openKey),
+	}
+
+	orders, err := store.List()
+	if err == nil {
+		for _, o := range orders {
+			s.index(o)
+		}
+	}
+
+	return s
+}
+
+func (s *indexedStore) Save(o Order) error {
+	err := s.Store.Save(o)
+	if err != nil {
+		return err
+	}
+
+	s.index(o)
+	return nil
+}
+
+func (s *indexedStore) index(o Order) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range s.keys[o.ID] {
+		delete(s.open, k)
+	}
+	delete(s.keys, o.ID)
+
+	if o.IsTerminal() || o.IsParent() {
+		return
+	}
+
+	instrument := trading.NewInstrument(o.Base, o.Quote)
+	var keys []openKey
+	if o.OrderID != "" {
+		keys = append(keys, openKey{account: o.Exchange, instrument: instrument, orderID: o.OrderID})
+	}
+	if o.ClientOrderID != "" {
+		keys = append(keys, openKey{account: o.Exchange, instrument: instrument, clientID: o.ClientOrderID})
+	}
+	for _, k := range keys {
+		s.open[k] = o.ID
+	}
+	s.keys[o.ID] = keys
+}
+
+// lookup returns the ID of the open order of account on instrument with the
+// exchange or client order ID.
+func (s *indexedStore) lookup(account string, instrument trading.Instrument, orderID, clientOrderID string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if orderID != "" {
+		id, ok := s.open[openKey{account: account, instrument: instrument, orderID: orderID}]
+		if ok {
+			return id, true
+		}
+	}
+	if clientOrderID != "" {
+		id, ok := s.open[openKey{account: account, instrument: instrument, clientID: clientOrderID}]
+		if ok {
+			return id, true
+		}
+	}
+
+	return "", false
+}
+
+type ClientResolver func(exchange string) (trading.Client, bool)
+
+type Listener func(Order)
+
+type Tracker struct {
+	store     *indexedStore
+	resolve   ClientResolver
+	interval  time.Duration
+	mu        sync.RWMutex
+	listeners []Listener
+	// updateMu serializes updates from polling and from order streams so
+	// that an order is reported terminal exactly once.
+	updateMu sync.Mutex
+}
+
+func NewTracker(store Store, resolve ClientResolver, interval time.Duration) *Tracker {
+	return &Tracker{
+		store:    newIndexedStore(store),
+		resolve:  resolve,
+		interval: interval,
+	}
+}
+
+func (t *Tracker) OnTerminal(l Listener) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.listeners = append(t.listeners, l)
+}
+
+func (t *Tracker) Store() Store {
+	return t.store
+}
+
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.Poll()
+		}
+	}
+}
+
+// Poll refreshes every non-terminal order once and notifies the listeners of
+// the orders that reached a terminal state.
+func (t *Tracker) Poll() {
+	orders, err := t.store.List()
+	if err != nil {
+		return
+	}
+
+	for _, o := range orders {
+		// Orders the venue never acknowledged have nothing to look up.
+		if o.IsTerminal() || o.IsParent() || (o.OrderID == "" && o.ClientOrderID == "") {
+			continue
+		}
+
+		client, ok := t.resolve(o.Exchange)
+		if !ok {
+			continue
+		}
+
+		detail, err := client.GetOrderDetail(trading.GetOrderDetailRequest{
+			Base:          o.Base,
+			Quote:         o.Quote,
+			OrderID:       o.OrderID,
+			ClientOrderID: o.ClientOrderID,
+		})
+		if err != nil {
+			continue
+		}
+
+		t.update(o.ID, detail)
+	}
+}
+
+// Follow applies the order updates streamed by the account until ctx is done
+// or the stream ends. Polling keeps running as a fallback for updates missed
+// while the stream reconnects.
+func (t *Tracker) Follow(ctx context.Context, account string, streamer trading.OrderStreamer) error {
+	updates, err := streamer.StreamOrderUpdates(ctx)
+	if err != nil {
+		return err
+	}
+
+	for update := range updates {
+		t.Apply(account, update)
+	}
+
+	return nil
+}
+
+// Apply updates the tracked order matching a streamed update of account on
+// the same instrument. Fill-only updates, updates without an instrument and
+// updates of unknown orders are ignored.
+func (t *Tracker) Apply(account string, update trading.OrderUpdate) {
+	if update.Status == "" || update.Instrument == (trading.Instrument{}) {
+		return
+	}
+
+	id, ok := t.store.lookup(trading.AccountName(account), update.Instrument, update.OrderID, update.ClientOrderID)
+	if !ok {
+		return
+	}
+
+	t.update(id, trading.GetOrderDetailResponse{
+		Status:        update.Status,
+		ExecutedBase:  update.ExecutedBase,
+		ExecutedQuote: update.ExecutedQuote,
+	})
+}
+
+func (t *Tracker) update(id string, detail trading.GetOrderDetailResponse) {
+	_ = t.Update(id, func(o *Order) {
+		o.Detail = detail
+	})
+}
+
+// Update changes an order that has not ended yet and notifies the listeners
+// if the change ends it. It is how orders that are not polled from a venue,
+// such as parent orders, are updated.
+func (t *Tracker) Update(id string, change func(*Order)) error {
+	t.updateMu.Lock()
+
+	o, err := t.store.Get(id)
+	if err != nil || o.IsTerminal() {
+		t.updateMu.Unlock()
+		return err
+	}
+
+	change(&o)
+	o.UpdatedAt = time.Now().UTC()
+	err = t.store.Save(o)
+	t.updateMu.Unlock()
+
+	if err == nil && o.IsTerminal() {
+		t.notify(o)
+	}
+
+	return err
+}
+
+func (t *Tracker) notify(o Order) {
+	t.mu.RLock()
+	listeners := append([]Listener(nil), t.listeners...)
+	t.mu.RUnlock()
+
+	for _, l := range listeners {
+		l(o)
+	}
+}
@@ -0,0 +1,40 @@
+package order
+
+import (
+	"testing"
+	"time"
+
+	"trading-aggregator/trading"
+)
+
+func TestTracker_Apply(t *testing.T) {
+	tracker := NewTracker(NewMemoryStore(), nil, time.Second)
+	var ended []string
+	tracker.OnTerminal(func(o Order) { ended = append(ended, o.ID) })
+
+	// Binance order IDs are unique per symbol only.
+	for _, o := range []Order{
+		{ID: "btc", Exchange: "binance:default", Base: "BTC", Quote: "USDT", OrderID: "7", ClientOrderID: "a"},
+		{ID: "eth", Exchange: "binance:default", Base: "ETH", Quote: "USDT", OrderID: "7", ClientOrderID: "b"},
+	} {
+		err := tracker.Store().Save(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tracker.Apply("binance", trading.OrderUpdate{Instrument: trading.NewInstrument("ETH", "USDT"), OrderID: "7", Status: "FILLED"})
+	tracker.Apply("binance", trading.OrderUpdate{Instrument: trading.NewInstrument("SOL", "USDT"), ClientOrderID: "a", Status: "CANCELED"})
+	tracker.Apply("binance:hedge", trading.OrderUpdate{Instrument: trading.NewInstrument("BTC", "USDT"), OrderID: "7", Status: "CANCELED"})
+	if len(ended) != 1 || ended[0] != "eth" {
+		t.Fatalf("got ended orders %v", ended)
+	}
+
+	// Ended orders leave the index.
+	tracker.Apply("binance", trading.OrderUpdate{Instrument: trading.NewInstrument("ETH", "USDT"), OrderID: "7", Status: "CANCELED"})
+	tracker.Apply("binance", trading.OrderUpdate{Instrument: trading.NewInstrument("BTC", "USDT"), ClientOrderID: "a", Status: "CANCELED"})
+	o, _ := tracker.Store().Get("eth")
+	if len(ended) != 2 || ended[1] != "btc" || o.Detail.Status != "FILLED" {
+		t.Fatalf("got ended orders %v and %+v", ended, o)
+	}
+}
@@ -0,0 +1,83 @@
+package portfolio
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// Method decides which lots a sale is matched against.
+type Method string
+
+const (
+	FIFO        Method = "fifo"
+	LIFO        Method = "lifo"
+	AverageCost Method = "average"
+)
+
+func (m Method) Validate() error {
+	switch m {
+	case FIFO, LIFO, AverageCost:
+		return nil
+	}
+
+	return fmt.Errorf("unknown lot matching method %q", m)
+}
+
+// lot is an amount bought at a total cost in the quote asset.
+type lot struct {
+	amount decimal.Decimal
+	cost   decimal.Decimal
+}
+
+// ledger holds the lots of one asset bought with one quote asset. With
+// AverageCost it holds a single lot.
+type ledger struct {
+	method   Method
+	lots     []lot
+	realized decimal.Decimal
+}
+
+func (l *ledger) buy(amount, value decimal.Decimal) {
+	if l.method == AverageCost && len(l.lots) == 1 {
+		l.lots[0].amount = l.lots[0].amount.Add(amount)
+		l.lots[0].cost = l.lots[0].cost.Add(value)
+		return
+	}
+
+	l.lots = append(l.lots, lot{amount: amount, cost: value})
+}
+
+// sell matches amount against the lots and realizes the difference between
+// its proceeds and their cost. What is sold beyond the lots has no known
+// cost, such as assets deposited rather than bought, and realizes nothing.
+func (l *ledger) sell(amount, value decimal.Decimal) {
+	price := value.Div(amount)
+
+	for amount.IsPositive() && len(l.lots) > 0 {
+		i := 0
+		if l.method == LIFO {
+			i = len(l.lots) - 1
+		}
+
+		matched := decimal.Min(amount, l.lots[i].amount)
+		cost := l.lots[i].cost.Mul(matched).Div(l.lots[i].amount)
+		l.realized = l.realized.Add(matched.Mul(price).Sub(cost))
+
+		l.lots[i].amount = l.lots[i].amount.Sub(matched)
+		l.lots[i].cost = l.lots[i].cost.Sub(cost)
+		if !l.lots[i].amount.IsPositive() {
+			l.lots = append(l.lots[:i], l.lots[i+1:]...)
+		}
+		amount = amount.Sub(matched)
+	}
+}
+
+func (l *ledger) holding() (amount, cost decimal.Decimal) {
+	for _, lot := range l.lots {
+		amount = amount.Add(lot.amount)
+		cost = cost.Add(lot.cost)
+	}
+
+	return amount, cost
+}
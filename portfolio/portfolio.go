@@ -0,0 +1,495 @@
+package portfolio
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/order"
+	"trading-aggregator/trading"
+)
+
+type Config struct {
+	// Method is the default lot matching method, FIFO unless set.
+	Method Method `yaml:"method" toml:"method"`
+	// ReconcileInterval is how often positions are reconciled against the
+	// balances of the accounts; zero only reconciles on demand.
+	ReconcileInterval time.Duration `yaml:"reconcile_interval" toml:"reconcile_interval"`
+	// Tolerance is the drift, relative to the balance, that is not reported,
+	// e.g. 0.001 for 0.1%. Fees taken from balances show up as drift.
+	Tolerance decimal.Decimal `yaml:"tolerance" toml:"tolerance"`
+}
+
+func (c Config) Validate() error {
+	var errs []error
+
+	if c.Method != "" {
+		if err := c.Method.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.ReconcileInterval < 0 {
+		errs = append(errs, errors.New("reconcile interval must not be negative"))
+	}
+	if c.Tolerance.IsNegative() {
+		errs = append(errs, errors.New("tolerance must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Fill is what an order executed, Amount of the base asset for Value of the
+// quote asset. Time is when the order was last updated, which is when it
+// filled once it ended.
+type Fill struct {
+	OrderID string          `json:"order_id"`
+	Account string          `json:"account"`
+	Side    string          `json:"side"`
+	Base    string          `json:"base"`
+	Quote   string          `json:"quote"`
+	Amount  decimal.Decimal `json:"amount"`
+	Value   decimal.Decimal `json:"value"`
+	Time    time.Time       `json:"time"`
+}
+
+// Position is the holding of an asset bought with a quote asset on an
+// account, or on all accounts when Account is empty. Cost and the PnL are in
+// the quote asset; Price, Value and Unrealized are missing if the venue could
+// not be asked for a price.
+type Position struct {
+	Account     string          `json:"account,omitempty"`
+	Asset       string          `json:"asset"`
+	Quote       string          `json:"quote"`
+	Quantity    decimal.Decimal `json:"quantity"`
+	AverageCost decimal.Decimal `json:"average_cost"`
+	Cost        decimal.Decimal `json:"cost"`
+	Realized    decimal.Decimal `json:"realized"`
+	Price       decimal.Decimal `json:"price,omitempty"`
+	Value       decimal.Decimal `json:"value,omitempty"`
+	Unrealized  decimal.Decimal `json:"unrealized,omitempty"`
+	PriceError  string          `json:"price_error,omitempty"`
+}
+
+// Drift is a change of a balance that the fills do not explain, such as a
+// deposit, a withdrawal or a trade made outside of the service.
+type Drift struct {
+	Account    string          `json:"account"`
+	Asset      string          `json:"asset"`
+	Expected   decimal.Decimal `json:"expected"`
+	Balance    decimal.Decimal `json:"balance"`
+	Difference decimal.Decimal `json:"difference"`
+}
+
+type AccountError struct {
+	Account string `json:"account"`
+	Error   string `json:"error"`
+}
+
+type Reconciliation struct {
+	Time   time.Time      `json:"time"`
+	Drifts []Drift        `json:"drifts"`
+	Errors []AccountError `json:"errors,omitempty"`
+}
+
+type ledgerKey struct {
+	account string
+	asset   string
+	quote   string
+}
+
+// Portfolio builds positions from the fills of the orders in a store. The
+// accounts trading derivatives are left out.
+//
+// Balances also hold what was there before the service traded, so the first
+// reconciliation of an account takes its balances as the baseline, and the
+// later ones report the drift from that baseline that the fills since do not
+// explain.
+type Portfolio struct {
+	store    order.Store
+	registry *trading.Registry
+	config   Config
+
+	mu        sync.Mutex
+	baselines map[string]map[string]decimal.Decimal
+	last      Reconciliation
+	hooks     []func(Reconciliation)
+}
+
+func New(store order.Store, registry *trading.Registry, config Config) *Portfolio {
+	if config.Method == "" {
+		config.Method = FIFO
+	}
+
+	return &Portfolio{
+		store:     store,
+		registry:  registry,
+		config:    config,
+		baselines: map[string]map[string]decimal.Decimal{},
+	}
+}
+
+// OnDrift registers hook to be called with every reconciliation that found
+// drift.
+func (p *Portfolio) OnDrift(hook func(Reconciliation)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.hooks = append(p.hooks, hook)
+}
+
+// Run reconciles every ReconcileInterval until ctx is done.
+func (p *Portfolio) Run(ctx context.Context) {
+	if p.config.ReconcileInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(p.config.ReconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.Reconcile()
+		}
+	}
+}
+
+// Fills lists what the orders executed, oldest order first. Parent orders
+// are left out since their children carry their fills.
+func Fills(orders []order.Order) []Fill {
+	sort.Slice(orders, func(i, j int) bool {
+		if !orders[i].CreatedAt.Equal(orders[j].CreatedAt) {
+			return orders[i].CreatedAt.Before(orders[j].CreatedAt)
+		}
+		return orders[i].ID < orders[j].ID
+	})
+
+	var fills []Fill
+	for _, o := range orders {
+		if o.IsParent() || !o.Detail.ExecutedBase.IsPositive() || !o.Detail.ExecutedQuote.IsPositive() {
+			continue
+		}
+
+		fills = append(fills, Fill{
+			OrderID: o.ID,
+			Account: o.Exchange,
+			Side:    strings.ToLower(o.Side),
+			Base:    strings.ToUpper(o.Base),
+			Quote:   strings.ToUpper(o.Quote),
+			Amount:  o.Detail.ExecutedBase,
+			Value:   o.Detail.ExecutedQuote,
+			Time:    o.UpdatedAt,
+		})
+	}
+
+	return fills
+}
+
+// SpotFills is Fills without the fills of the derivatives accounts in
+// registry, whose trades open and close positions instead of buying and
+// selling the base asset.
+func SpotFills(orders []order.Order, registry *trading.Registry) []Fill {
+	var fills []Fill
+	for _, fill := range Fills(orders) {
+		if !isDerivatives(registry, fill.Account) {
+			fills = append(fills, fill)
+		}
+	}
+
+	return fills
+}
+
+func isDerivatives(registry *trading.Registry, account string) bool {
+	client, ok := registry.Client(account)
+	if !ok {
+		return false
+	}
+	_, ok = client.(trading.DerivativesClient)
+	return ok
+}
+
+func (p *Portfolio) fills() ([]Fill, error) {
+	orders, err := p.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	return SpotFills(orders, p.registry), nil
+}
+
+// Positions lists the positions of every account with the PnL matched by
+// method, or by the configured method if it is empty. Positions that were
+// closed keep their realized PnL.
+func (p *Portfolio) Positions(method Method) ([]Position, error) {
+	if method == "" {
+		method = p.config.Method
+	}
+	if err := method.Validate(); err != nil {
+		return nil, err
+	}
+
+	fills, err := p.fills()
+	if err != nil {
+		return nil, err
+	}
+
+	ledgers := map[ledgerKey]*ledger{}
+	for _, fill := range fills {
+		key := ledgerKey{account: fill.Account, asset: fill.Base, quote: fill.Quote}
+		l, ok := ledgers[key]
+		if !ok {
+			l = &ledger{method: method}
+			ledgers[key] = l
+		}
+
+		if fill.Side == "sell" {
+			l.sell(fill.Amount, fill.Value)
+		} else {
+			l.buy(fill.Amount, fill.Value)
+		}
+	}
+
+	positions := make([]Position, 0, len(ledgers))
+	for key, l := range ledgers {
+		quantity, cost := l.holding()
+		position := Position{
+			Account:  key.account,
+			Asset:    key.asset,
+			Quote:    key.quote,
+			Quantity: quantity,
+			Cost:     cost,
+			Realized: l.realized,
+		}
+		if quantity.IsPositive() {
+			position.AverageCost = cost.Div(quantity)
+			p.value(&position)
+		}
+		positions = append(positions, position)
+	}
+	sortPositions(positions)
+
+	return positions, nil
+}
+
+// value prices the position with the account's last price.
+func (p *Portfolio) value(position *Position) {
+	client, ok := p.registry.Client(position.Account)
+	if !ok {
+		position.PriceError = "unknown account"
+		return
+	}
+	priceClient, ok := client.(trading.PriceClient)
+	if !ok {
+		position.PriceError = "the exchange does not report prices"
+		return
+	}
+
+	res, err := priceClient.GetPrice(trading.GetPriceRequest{Base: position.Asset, Quote: position.Quote})
+	if err != nil {
+		position.PriceError = err.Error()
+		return
+	}
+
+	position.Price = res.Price
+	position.Value = position.Quantity.Mul(res.Price)
+	position.Unrealized = position.Value.Sub(position.Cost)
+}
+
+// Totals nets the positions of the accounts per asset and quote asset. A
+// total is only valued if all of its positions are.
+func Totals(positions []Position) []Position {
+	totals := map[ledgerKey]*Position{}
+	for _, position := range positions {
+		key := ledgerKey{asset: position.Asset, quote: position.Quote}
+		total, ok := totals[key]
+		if !ok {
+			total = &Position{Asset: position.Asset, Quote: position.Quote}
+			totals[key] = total
+		}
+
+		total.Quantity = total.Quantity.Add(position.Quantity)
+		total.Cost = total.Cost.Add(position.Cost)
+		total.Realized = total.Realized.Add(position.Realized)
+		total.Value = total.Value.Add(position.Value)
+		if position.PriceError != "" && total.PriceError == "" {
+			total.PriceError = position.Account + ": " + position.PriceError
+		}
+	}
+
+	list := make([]Position, 0, len(totals))
+	for _, total := range totals {
+		if total.Quantity.IsPositive() {
+			total.AverageCost = total.Cost.Div(total.Quantity)
+			if total.PriceError == "" {
+				total.Price = total.Value.Div(total.Quantity)
+				total.Unrealized = total.Value.Sub(total.Cost)
+			}
+		}
+		if total.PriceError != "" {
+			total.Value = decimal.Zero
+		}
+		list = append(list, *total)
+	}
+	sortPositions(list)
+
+	return list
+}
+
+func sortPositions(positions []Position) {
+	sort.Slice(positions, func(i, j int) bool {
+		a, b := positions[i], positions[j]
+		if a.Account != b.Account {
+			return a.Account < b.Account
+		}
+		if a.Asset != b.Asset {
+			return a.Asset < b.Asset
+		}
+		return a.Quote < b.Quote
+	})
+}
+
+// LastReconciliation is the result of the last Reconcile, zero before the
+// first one.
+func (p *Portfolio) LastReconciliation() Reconciliation {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.last
+}
+
+// Rebase makes the next reconciliation take the balances as the new
+// baseline, once drift has been accounted for.
+func (p *Portfolio) Rebase() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.baselines = map[string]map[string]decimal.Decimal{}
+}
+
+// Reconcile compares the balances of every account reporting them with the
+// fills, reports the drift to the OnDrift hooks and keeps it as the last
+// reconciliation.
+func (p *Portfolio) Reconcile() Reconciliation {
+	reconciliation := Reconciliation{Time: time.Now().UTC(), Drifts: []Drift{}}
+
+	fills, err := p.fills()
+	if err != nil {
+		reconciliation.Errors = append(reconciliation.Errors, AccountError{Error: err.Error()})
+		return p.finish(reconciliation)
+	}
+
+	flows := map[string]map[string]decimal.Decimal{}
+	for _, fill := range fills {
+		flow, ok := flows[fill.Account]
+		if !ok {
+			flow = map[string]decimal.Decimal{}
+			flows[fill.Account] = flow
+		}
+
+		if fill.Side == "sell" {
+			flow[fill.Base] = flow[fill.Base].Sub(fill.Amount)
+			flow[fill.Quote] = flow[fill.Quote].Add(fill.Value)
+		} else {
+			flow[fill.Base] = flow[fill.Base].Add(fill.Amount)
+			flow[fill.Quote] = flow[fill.Quote].Sub(fill.Value)
+		}
+	}
+
+	for _, account := range p.registry.Accounts() {
+		// The balances of derivatives accounts are margin that their fills
+		// do not move, so they would drift on every trade.
+		if _, ok := account.Client.(trading.DerivativesClient); ok {
+			continue
+		}
+		balanceClient, ok := account.Client.(trading.BalanceClient)
+		if !ok {
+			continue
+		}
+
+		list, err := balanceClient.GetBalances()
+		if err != nil {
+			reconciliation.Errors = append(reconciliation.Errors, AccountError{Account: account.Name, Error: err.Error()})
+			continue
+		}
+
+		balances := map[string]decimal.Decimal{}
+		for _, balance := range list {
+			asset := strings.ToUpper(balance.Asset)
+			balances[asset] = balances[asset].Add(balance.Free).Add(balance.Locked)
+		}
+
+		reconciliation.Drifts = append(reconciliation.Drifts, p.drifts(account.Name, balances, flows[account.Name])...)
+	}
+
+	return p.finish(reconciliation)
+}
+
+// drifts compares the balances of an account less what its fills moved with
+// its baseline, taking them as the baseline if there is none yet.
+func (p *Portfolio) drifts(account string, balances, flow map[string]decimal.Decimal) []Drift {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	offsets := map[string]decimal.Decimal{}
+	for asset, balance := range balances {
+		offsets[asset] = balance.Sub(flow[asset])
+	}
+	for asset, moved := range flow {
+		if _, ok := balances[asset]; !ok {
+			offsets[asset] = moved.Neg()
+		}
+	}
+
+	baseline, ok := p.baselines[account]
+	if !ok {
+		p.baselines[account] = offsets
+		return nil
+	}
+	for asset := range baseline {
+		if _, ok := offsets[asset]; !ok {
+			offsets[asset] = decimal.Zero
+		}
+	}
+
+	var drifts []Drift
+	for asset, offset := range offsets {
+		difference := offset.Sub(baseline[asset])
+		balance := balances[asset]
+		if difference.Abs().LessThanOrEqual(balance.Abs().Mul(p.config.Tolerance)) {
+			continue
+		}
+
+		drifts = append(drifts, Drift{
+			Account:    account,
+			Asset:      asset,
+			Expected:   balance.Sub(difference),
+			Balance:    balance,
+			Difference: difference,
+		})
+	}
+	sort.Slice(drifts, func(i, j int) bool { return drifts[i].Asset < drifts[j].Asset })
+
+	return drifts
+}
+
+func (p *Portfolio) finish(reconciliation Reconciliation) Reconciliation {
+	p.mu.Lock()
+	p.last = reconciliation
+	hooks := append([]func(Reconciliation){}, p.hooks...)
+	p.mu.Unlock()
+
+	if len(reconciliation.Drifts) > 0 {
+		for _, hook := range hooks {
+			hook(reconciliation)
+		}
+	}
+
+	return reconciliation
+}
@@ -0,0 +1,166 @@
+package portfolio
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/order"
+	"trading-aggregator/simulator"
+	"trading-aggregator/trading"
+)
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// perpetual is a derivatives account reporting the same wallet as the spot
+// account, like Bybit's unified account.
+type perpetual struct {
+	*simulator.Exchange
+}
+
+func (perpetual) SetLeverage(trading.SetLeverageRequest) error { return nil }
+
+func (perpetual) GetPositions(trading.GetPositionsRequest) ([]trading.Position, error) {
+	return nil, nil
+}
+
+func (perpetual) GetFundingHistory(trading.GetFundingHistoryRequest) ([]trading.FundingPayment, error) {
+	return nil, nil
+}
+
+func fill(store order.Store, id, account, side, base, quote string) {
+	_ = store.Save(order.Order{
+		ID:       id,
+		Exchange: trading.AccountName(account),
+		Side:     side,
+		Base:     "BTC",
+		Quote:    "USDT",
+		Detail: trading.GetOrderDetailResponse{
+			Status:        order.StatusFilled,
+			ExecutedBase:  decimal.RequireFromString(base),
+			ExecutedQuote: decimal.RequireFromString(quote),
+		},
+		CreatedAt: start.Add(time.Duration(len(id)) * time.Minute),
+	})
+}
+
+func TestPortfolio_Positions(t *testing.T) {
+	sim := simulator.New()
+	sim.SetPrice("BTC", "USDT", decimal.NewFromInt(250))
+
+	registry := trading.NewRegistry()
+	registry.Set("sim", sim)
+	registry.Set("sim:hedge", sim)
+	registry.Set("sim:perp", perpetual{sim})
+
+	store := order.NewMemoryStore()
+	fill(store, "a", "sim", "buy", "1", "100")
+	fill(store, "aa", "sim", "buy", "1", "200")
+	fill(store, "aaa", "sim", "sell", "1", "300")
+	fill(store, "b", "sim:hedge", "buy", "1", "240")
+	// A short on the perpetual is no sale of BTC.
+	fill(store, "c", "sim:perp", "sell", "1", "250")
+	_ = store.Save(order.Order{
+		ID:       "parent",
+		Exchange: "sim:default",
+		Side:     "buy",
+		Base:     "BTC",
+		Quote:    "USDT",
+		Algo:     &order.Algo{Name: "twap"},
+		Detail: trading.GetOrderDetailResponse{
+			ExecutedBase:  decimal.NewFromInt(2),
+			ExecutedQuote: decimal.NewFromInt(300),
+		},
+	})
+
+	p := New(store, registry, Config{})
+
+	tests := []struct {
+		method     Method
+		cost       string
+		realized   string
+		unrealized string
+	}{
+		{FIFO, "200", "200", "50"},
+		{LIFO, "100", "100", "150"},
+		{AverageCost, "150", "150", "100"},
+	}
+	for _, tt := range tests {
+		positions, err := p.Positions(tt.method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(positions) != 2 {
+			t.Fatalf("%s: got positions %+v", tt.method, positions)
+		}
+
+		got := positions[0]
+		if got.Account != "sim:default" || !got.Quantity.Equal(decimal.NewFromInt(1)) ||
+			got.Cost.String() != tt.cost || got.Realized.String() != tt.realized ||
+			got.Unrealized.String() != tt.unrealized || got.Price.String() != "250" {
+			t.Fatalf("%s: got position %+v", tt.method, got)
+		}
+	}
+
+	positions, _ := p.Positions("")
+	totals := Totals(positions)
+	if len(totals) != 1 || totals[0].Quantity.String() != "2" || totals[0].Cost.String() != "440" ||
+		totals[0].Realized.String() != "200" || totals[0].Unrealized.String() != "60" || totals[0].AverageCost.String() != "220" {
+		t.Fatalf("got totals %+v", totals)
+	}
+
+	if _, err := p.Positions("hifo"); err == nil {
+		t.Fatal("expected error for unknown method")
+	}
+}
+
+func TestPortfolio_Reconcile(t *testing.T) {
+	sim := simulator.New()
+	sim.SetBalance("USDT", decimal.NewFromInt(1000))
+
+	registry := trading.NewRegistry()
+	registry.Set("sim", sim)
+	// The margin wallet of the perpetual account moves with the spot fills.
+	registry.Set("sim:perp", perpetual{sim})
+
+	store := order.NewMemoryStore()
+	p := New(store, registry, Config{Tolerance: decimal.RequireFromString("0.001")})
+	var drifted []Reconciliation
+	p.OnDrift(func(r Reconciliation) { drifted = append(drifted, r) })
+
+	// The first reconciliation takes the baseline.
+	if r := p.Reconcile(); len(r.Drifts) != 0 || len(r.Errors) != 0 {
+		t.Fatalf("got reconciliation %+v", r)
+	}
+
+	// A fill explains the change of the balances.
+	fill(store, "a", "sim", "buy", "1", "100")
+	sim.SetBalance("BTC", decimal.NewFromInt(1))
+	sim.SetBalance("USDT", decimal.NewFromInt(900))
+	if r := p.Reconcile(); len(r.Drifts) != 0 {
+		t.Fatalf("got drifts %+v", r.Drifts)
+	}
+
+	// Within the tolerance.
+	sim.SetBalance("USDT", decimal.RequireFromString("899.5"))
+	if r := p.Reconcile(); len(r.Drifts) != 0 {
+		t.Fatalf("got drifts %+v", r.Drifts)
+	}
+
+	sim.SetBalance("BTC", decimal.RequireFromString("1.5"))
+	r := p.Reconcile()
+	if len(r.Drifts) != 1 || r.Drifts[0].Asset != "BTC" || r.Drifts[0].Difference.String() != "0.5" ||
+		r.Drifts[0].Expected.String() != "1" || len(drifted) != 1 {
+		t.Fatalf("got reconciliation %+v", r)
+	}
+	if last := p.LastReconciliation(); len(last.Drifts) != 1 {
+		t.Fatalf("got last reconciliation %+v", last)
+	}
+
+	p.Rebase()
+	p.Reconcile()
+	if r := p.Reconcile(); len(r.Drifts) != 0 {
+		t.Fatalf("got drifts %+v", r.Drifts)
+	}
+}
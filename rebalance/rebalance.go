@@ -0,0 +1,366 @@
+package rebalance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/router"
+	"trading-aggregator/trading"
+)
+
+var ErrNoTargets = errors.New("no target weights configured")
+
+// maxReports is how many reports are kept, oldest dropped first.
+const maxReports = 100
+
+// buyMargin is the part of the quote balance of a venue kept back from buys
+// for fees and slippage.
+var buyMargin = decimal.RequireFromString("0.01")
+
+type Config struct {
+	// Targets maps assets to their target weight of the portfolio. Weights
+	// add up to 1; assets without a target are left alone.
+	Targets map[string]decimal.Decimal `yaml:"targets" toml:"targets"`
+	// Quote is the asset trades are made against and values are measured
+	// in, e.g. "USDT". It may have a target of its own.
+	Quote string `yaml:"quote" toml:"quote"`
+	// Band is how far a weight may drift from its target before the asset
+	// is traded, e.g. 0.05 for 5 percentage points.
+	Band decimal.Decimal `yaml:"band" toml:"band"`
+	// MinTrade is the smallest trade worth making, in the quote asset.
+	MinTrade decimal.Decimal `yaml:"min_trade" toml:"min_trade"`
+	// Interval is how often to rebalance; zero only rebalances on demand.
+	Interval time.Duration `yaml:"interval" toml:"interval"`
+	// DryRun makes the scheduled rebalances only plan their trades.
+	DryRun bool `yaml:"dry_run" toml:"dry_run"`
+}
+
+// Enabled reports whether there are targets to rebalance to.
+func (c Config) Enabled() bool {
+	return len(c.Targets) > 0
+}
+
+func (c Config) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+
+	var errs []error
+
+	sum := decimal.Zero
+	for asset, weight := range c.Targets {
+		if weight.IsNegative() {
+			errs = append(errs, fmt.Errorf("targets.%s: must not be negative", asset))
+		}
+		sum = sum.Add(weight)
+	}
+	if !sum.Equal(decimal.NewFromInt(1)) {
+		errs = append(errs, fmt.Errorf("targets: weights add up to %s, not 1", sum))
+	}
+	if c.Quote == "" {
+		errs = append(errs, errors.New("quote: required"))
+	}
+	if c.Band.IsNegative() {
+		errs = append(errs, errors.New("band: must not be negative"))
+	}
+	if c.MinTrade.IsNegative() {
+		errs = append(errs, errors.New("min_trade: must not be negative"))
+	}
+	if c.Interval < 0 {
+		errs = append(errs, errors.New("interval: must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Executor trades amount of asset against quote across the venues, taking
+// at most caps[venue] of asset on each, e.g. with router.Router.Execute.
+type Executor func(side, asset, quote string, amount decimal.Decimal, caps map[string]decimal.Decimal) ([]router.Child, error)
+
+// Holding is what the accounts hold of an asset with a target.
+type Holding struct {
+	Asset  string          `json:"asset"`
+	Amount decimal.Decimal `json:"amount"`
+	Price  decimal.Decimal `json:"price"`
+	Value  decimal.Decimal `json:"value"`
+	Weight decimal.Decimal `json:"weight"`
+	Target decimal.Decimal `json:"target"`
+}
+
+type Trade struct {
+	Side     string          `json:"side"`
+	Asset    string          `json:"asset"`
+	Amount   decimal.Decimal `json:"amount"`
+	Value    decimal.Decimal `json:"value"`
+	Children []router.Child  `json:"children,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// Report records a rebalance: the holdings it started from and the trades
+// it made, or would have made in a dry run.
+type Report struct {
+	ID       string          `json:"id"`
+	Time     time.Time       `json:"time"`
+	DryRun   bool            `json:"dry_run"`
+	Quote    string          `json:"quote"`
+	Total    decimal.Decimal `json:"total"`
+	Holdings []Holding       `json:"holdings"`
+	Trades   []Trade         `json:"trades"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// Rebalancer trades the balances of every account of a registry back to the
+// target weights once they drift out of their band.
+type Rebalancer struct {
+	registry *trading.Registry
+	execute  Executor
+	config   Config
+
+	// mu serializes rebalances; reportsMu guards the reports alone so that
+	// they can be read while rebalancing.
+	mu        sync.Mutex
+	reportsMu sync.Mutex
+	reports   []Report
+}
+
+func New(registry *trading.Registry, execute Executor, config Config) *Rebalancer {
+	return &Rebalancer{
+		registry: registry,
+		execute:  execute,
+		config:   config,
+	}
+}
+
+// Run rebalances every Interval until ctx is done.
+func (r *Rebalancer) Run(ctx context.Context) {
+	if !r.config.Enabled() || r.config.Interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Rebalance(r.config.DryRun)
+		}
+	}
+}
+
+// Reports lists the recorded reports, newest first.
+func (r *Rebalancer) Reports() []Report {
+	r.reportsMu.Lock()
+	defer r.reportsMu.Unlock()
+
+	reports := make([]Report, len(r.reports))
+	for i, report := range r.reports {
+		reports[len(r.reports)-1-i] = report
+	}
+
+	return reports
+}
+
+// Rebalance plans the trades back to the targets and, unless dryRun, makes
+// them: sales first, so that buys can spend what they freed. Every
+// rebalance is recorded.
+func (r *Rebalancer) Rebalance(dryRun bool) Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := Report{
+		ID:       uuid.NewString(),
+		Time:     time.Now().UTC(),
+		DryRun:   dryRun,
+		Quote:    strings.ToUpper(r.config.Quote),
+		Holdings: []Holding{},
+		Trades:   []Trade{},
+	}
+
+	err := r.rebalance(&report)
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	r.reportsMu.Lock()
+	r.reports = append(r.reports, report)
+	if len(r.reports) > maxReports {
+		r.reports = r.reports[len(r.reports)-maxReports:]
+	}
+	r.reportsMu.Unlock()
+
+	return report
+}
+
+func (r *Rebalancer) rebalance(report *Report) error {
+	if !r.config.Enabled() {
+		return ErrNoTargets
+	}
+
+	balances, err := r.balances()
+	if err != nil {
+		return err
+	}
+
+	prices := map[string]decimal.Decimal{}
+	for asset := range r.config.Targets {
+		asset = strings.ToUpper(asset)
+		prices[asset], err = r.price(asset, report.Quote)
+		if err != nil {
+			return err
+		}
+	}
+
+	for asset, target := range r.config.Targets {
+		asset = strings.ToUpper(asset)
+		amount := balances.total[asset]
+		value := amount.Mul(prices[asset])
+		report.Total = report.Total.Add(value)
+		report.Holdings = append(report.Holdings, Holding{
+			Asset:  asset,
+			Amount: amount,
+			Price:  prices[asset],
+			Value:  value,
+			Target: target,
+		})
+	}
+	sort.Slice(report.Holdings, func(i, j int) bool { return report.Holdings[i].Asset < report.Holdings[j].Asset })
+	if !report.Total.IsPositive() {
+		return errors.New("nothing to rebalance")
+	}
+
+	for i := range report.Holdings {
+		h := &report.Holdings[i]
+		h.Weight = h.Value.Div(report.Total)
+		if h.Asset == report.Quote || h.Weight.Sub(h.Target).Abs().LessThanOrEqual(r.config.Band) {
+			continue
+		}
+
+		value := h.Target.Mul(report.Total).Sub(h.Value)
+		if value.Abs().LessThan(r.config.MinTrade) {
+			continue
+		}
+
+		trade := Trade{Side: "buy", Asset: h.Asset, Amount: value.Div(h.Price), Value: value}
+		if value.IsNegative() {
+			trade = Trade{Side: "sell", Asset: h.Asset, Amount: trade.Amount.Neg(), Value: value.Neg()}
+		}
+		report.Trades = append(report.Trades, trade)
+	}
+	sort.SliceStable(report.Trades, func(i, j int) bool {
+		return report.Trades[i].Side == "sell" && report.Trades[j].Side == "buy"
+	})
+
+	if report.DryRun {
+		return nil
+	}
+
+	for i := range report.Trades {
+		trade := &report.Trades[i]
+		if trade.Side == "buy" && (i == 0 || report.Trades[i-1].Side == "sell") {
+			// Buys spend what the sales freed.
+			balances, err = r.balances()
+			if err != nil {
+				return err
+			}
+		}
+
+		caps := map[string]decimal.Decimal{}
+		for venue, free := range balances.free {
+			if trade.Side == "sell" {
+				caps[venue] = free[trade.Asset]
+			} else {
+				price := prices[trade.Asset]
+				caps[venue] = free[report.Quote].Mul(decimal.NewFromInt(1).Sub(buyMargin)).Div(price)
+			}
+		}
+
+		trade.Children, err = r.execute(trade.Side, trade.Asset, report.Quote, trade.Amount, caps)
+		if err != nil {
+			trade.Error = err.Error()
+		}
+	}
+
+	return nil
+}
+
+// holdings are the balances of all accounts per asset, with the free
+// balances of the account each venue trades on.
+type holdings struct {
+	total map[string]decimal.Decimal
+	free  map[string]map[string]decimal.Decimal
+}
+
+// balances adds up the balances of the accounts. Routed orders go to the
+// default account of a venue, so only its free balances can be traded.
+// Derivatives accounts are left out: their balances are margin, and on Bybit
+// the same unified wallet the spot account reports.
+func (r *Rebalancer) balances() (holdings, error) {
+	h := holdings{total: map[string]decimal.Decimal{}, free: map[string]map[string]decimal.Decimal{}}
+
+	for _, account := range r.registry.Accounts() {
+		if _, ok := account.Client.(trading.DerivativesClient); ok {
+			continue
+		}
+		balanceClient, ok := account.Client.(trading.BalanceClient)
+		if !ok {
+			continue
+		}
+
+		balances, err := balanceClient.GetBalances()
+		if err != nil {
+			return holdings{}, fmt.Errorf("%s balances: %w", account.Name, err)
+		}
+
+		var free map[string]decimal.Decimal
+		if account.Name == trading.AccountName(account.Exchange) {
+			free = map[string]decimal.Decimal{}
+			h.free[account.Exchange] = free
+		}
+		for _, balance := range balances {
+			asset := strings.ToUpper(balance.Asset)
+			h.total[asset] = h.total[asset].Add(balance.Free).Add(balance.Locked)
+			if free != nil {
+				free[asset] = free[asset].Add(balance.Free)
+			}
+		}
+	}
+
+	return h, nil
+}
+
+// price asks the accounts for the last price of asset in quote.
+func (r *Rebalancer) price(asset, quote string) (decimal.Decimal, error) {
+	if asset == quote {
+		return decimal.NewFromInt(1), nil
+	}
+
+	err := fmt.Errorf("no account prices %s/%s", asset, quote)
+	for _, account := range r.registry.Accounts() {
+		priceClient, ok := account.Client.(trading.PriceClient)
+		if !ok {
+			continue
+		}
+
+		var res trading.GetPriceResponse
+		res, err = priceClient.GetPrice(trading.GetPriceRequest{Base: asset, Quote: quote})
+		if err == nil && res.Price.IsPositive() {
+			return res.Price, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("%s has no %s/%s price", account.Name, asset, quote)
+		}
+	}
+
+	return decimal.Zero, err
+}
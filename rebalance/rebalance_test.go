@@ -0,0 +1,104 @@
+package rebalance
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/router"
+	"trading-aggregator/simulator"
+	"trading-aggregator/trading"
+)
+
+// perpetual is a derivatives account reporting the same wallet as the spot
+// account, like Bybit's unified account.
+type perpetual struct {
+	*simulator.Exchange
+}
+
+func (perpetual) SetLeverage(trading.SetLeverageRequest) error { return nil }
+
+func (perpetual) GetPositions(trading.GetPositionsRequest) ([]trading.Position, error) {
+	return nil, nil
+}
+
+func (perpetual) GetFundingHistory(trading.GetFundingHistoryRequest) ([]trading.FundingPayment, error) {
+	return nil, nil
+}
+
+func TestRebalancer_Rebalance(t *testing.T) {
+	sim := simulator.New()
+	sim.SetPrice("BTC", "USDT", decimal.NewFromInt(100))
+	sim.SetPrice("ETH", "USDT", decimal.NewFromInt(10))
+	sim.SetBalance("BTC", decimal.NewFromInt(2))
+	sim.SetBalance("USDT", decimal.NewFromInt(100))
+	sim.SetBalance("DOGE", decimal.NewFromInt(1000))
+
+	registry := trading.NewRegistry()
+	registry.Set("binance", sim)
+	registry.Set("bybit:perp", perpetual{sim})
+
+	var executed []string
+	execute := func(side, asset, quote string, amount decimal.Decimal, caps map[string]decimal.Decimal) ([]router.Child, error) {
+		executed = append(executed, side+" "+amount.String()+" "+asset+"/"+quote+" cap "+caps["binance"].String())
+		return []router.Child{{Venue: "binance", Amount: amount, OrderID: "1"}}, nil
+	}
+
+	r := New(registry, execute, Config{
+		Targets: map[string]decimal.Decimal{
+			"BTC":  decimal.RequireFromString("0.5"),
+			"eth":  decimal.RequireFromString("0.3"),
+			"USDT": decimal.RequireFromString("0.2"),
+		},
+		Quote:    "USDT",
+		Band:     decimal.RequireFromString("0.05"),
+		MinTrade: decimal.NewFromInt(10),
+	})
+
+	report := r.Rebalance(true)
+	if report.Error != "" || !report.Total.Equal(decimal.NewFromInt(300)) || len(report.Holdings) != 3 || len(executed) != 0 {
+		t.Fatalf("got report %+v", report)
+	}
+	if len(report.Trades) != 2 || report.Trades[0].Side != "sell" || report.Trades[0].Amount.String() != "0.5" ||
+		report.Trades[1].Asset != "ETH" || report.Trades[1].Amount.String() != "9" {
+		t.Fatalf("got trades %+v", report.Trades)
+	}
+
+	report = r.Rebalance(false)
+	if report.Error != "" || len(executed) != 2 || len(report.Trades[1].Children) != 1 {
+		t.Fatalf("got report %+v", report)
+	}
+	if executed[0] != "sell 0.5 BTC/USDT cap 2" || executed[1] != "buy 9 ETH/USDT cap 9.9" {
+		t.Fatalf("got executed %v", executed)
+	}
+
+	reports := r.Reports()
+	if len(reports) != 2 || reports[0].ID != report.ID || !reports[1].DryRun {
+		t.Fatalf("got reports %+v", reports)
+	}
+
+	// Within the band nothing is traded.
+	sim.SetBalance("BTC", decimal.RequireFromString("1.5"))
+	sim.SetBalance("ETH", decimal.NewFromInt(9))
+	sim.SetBalance("USDT", decimal.NewFromInt(60))
+	if report = r.Rebalance(false); len(report.Trades) != 0 || len(executed) != 2 {
+		t.Fatalf("got report %+v", report)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	if err := (Config{}).Validate(); err != nil {
+		t.Fatalf("disabled config: %v", err)
+	}
+
+	err := Config{
+		Targets: map[string]decimal.Decimal{"BTC": decimal.RequireFromString("0.5"), "ETH": decimal.RequireFromString("0.4")},
+		Band:    decimal.RequireFromString("-0.1"),
+	}.Validate()
+	for _, want := range []string{"add up to 0.9", "quote", "band"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %s: %v", want, err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package risk
+
+import (
+	"trading-aggregator/trading"
+)
+
+// Client checks every order against the limits of an engine before handing
+// it to the wrapped client. Only Buy and Sell are wrapped, so the optional
+// interfaces of the wrapped client are not visible through it.
+type Client struct {
+	trading.Client
+
+	engine  *Engine
+	key     string
+	account string
+}
+
+// Client wraps the client of account for the orders of an API key, empty for
+// none.
+func (e *Engine) Client(key, account string, client trading.Client) *Client {
+	return &Client{
+		Client:  client,
+		engine:  e,
+		key:     key,
+		account: account,
+	}
+}
+
+func (c *Client) Buy(req trading.BuyRequest) (trading.BuyResponse, error) {
+	err := c.reserve("buy", req.TradeRequest)
+	if err != nil {
+		return trading.BuyResponse{}, err
+	}
+
+	res, err := c.Client.Buy(req)
+	if err != nil {
+		c.engine.Release(c.account, req.ClientOrderID)
+	}
+
+	return res, err
+}
+
+func (c *Client) Sell(req trading.SellRequest) (trading.SellResponse, error) {
+	err := c.reserve("sell", req.TradeRequest)
+	if err != nil {
+		return trading.SellResponse{}, err
+	}
+
+	res, err := c.Client.Sell(req)
+	if err != nil {
+		c.engine.Release(c.account, req.ClientOrderID)
+	}
+
+	return res, err
+}
+
+func (c *Client) reserve(side string, req trading.TradeRequest) error {
+	amount := req.Amount
+	if req.IsQuoteSized() {
+		amount = req.QuoteAmount
+	}
+
+	return c.engine.Reserve(Order{
+		Key:           c.key,
+		Account:       c.account,
+		Side:          side,
+		Base:          req.Base,
+		Quote:         req.Quote,
+		Amount:        amount,
+		QuoteSized:    req.IsQuoteSized(),
+		Price:         req.Price,
+		StopPrice:     req.StopPrice,
+		ClientOrderID: req.ClientOrderID,
+	}, c.Client)
+}
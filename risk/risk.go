@@ -0,0 +1,547 @@
+package risk
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/order"
+	"trading-aggregator/trading"
+)
+
+const Wildcard = "*"
+
+// The kinds of Rejection, to be matched with errors.Is.
+var (
+	ErrSymbolNotAllowed = errors.New("symbol not allowed")
+	ErrMaxNotional      = errors.New("max order notional exceeded")
+	ErrMaxPosition      = errors.New("max position exceeded")
+	ErrDailyVolume      = errors.New("daily volume exceeded")
+	ErrPriceDeviation   = errors.New("price deviates too far from the reference price")
+	ErrNoReferencePrice = errors.New("no reference price")
+)
+
+// Checks names the kinds of Rejection for configuration.
+var Checks = map[string]error{
+	"symbol":          ErrSymbolNotAllowed,
+	"max_notional":    ErrMaxNotional,
+	"max_position":    ErrMaxPosition,
+	"daily_volume":    ErrDailyVolume,
+	"max_deviation":   ErrPriceDeviation,
+	"reference_price": ErrNoReferencePrice,
+}
+
+// Rejection is the error of an order that breaks a limit. Scope names the
+// limits it broke, such as "key ops" or "exchange binance", and Limit and
+// Value compare the limit with what the order would have reached, where the
+// check has numbers.
+type Rejection struct {
+	Err   error
+	Scope string
+	Limit decimal.Decimal
+	Value decimal.Decimal
+}
+
+func (r *Rejection) Error() string {
+	if r.Limit.IsZero() && r.Value.IsZero() {
+		return fmt.Sprintf("risk: %s: %v", r.Scope, r.Err)
+	}
+
+	return fmt.Sprintf("risk: %s: %v: %s over the limit of %s", r.Scope, r.Err, r.Value, r.Limit)
+}
+
+func (r *Rejection) Unwrap() error {
+	return r.Err
+}
+
+// Limits are the pre-trade checks of one scope; zero values disable a check.
+// Notionals and volumes are in the quote asset of the order, positions in
+// units of the asset and deviations are fractions of the reference price,
+// the venue's last price. Symbols are written as BASE/QUOTE and accept "*";
+// a symbol must be allowed, when Allow is set, and not denied.
+type Limits struct {
+	MaxNotional  decimal.Decimal            `yaml:"max_notional" toml:"max_notional"`
+	MaxPosition  map[string]decimal.Decimal `yaml:"max_position" toml:"max_position"`
+	DailyVolume  decimal.Decimal            `yaml:"daily_volume" toml:"daily_volume"`
+	Allow        []string                   `yaml:"allow" toml:"allow"`
+	Deny         []string                   `yaml:"deny" toml:"deny"`
+	MaxDeviation decimal.Decimal            `yaml:"max_deviation" toml:"max_deviation"`
+}
+
+func (l Limits) Validate() error {
+	for name, value := range map[string]decimal.Decimal{
+		"max_notional":  l.MaxNotional,
+		"daily_volume":  l.DailyVolume,
+		"max_deviation": l.MaxDeviation,
+	} {
+		if value.IsNegative() {
+			return fmt.Errorf("%s must not be negative, got %s", name, value)
+		}
+	}
+	for asset, value := range l.MaxPosition {
+		if value.IsNegative() {
+			return fmt.Errorf("max_position of %s must not be negative, got %s", asset, value)
+		}
+	}
+	for _, symbol := range append(append([]string(nil), l.Allow...), l.Deny...) {
+		if symbol == Wildcard {
+			continue
+		}
+		if _, err := trading.ParseInstrument(symbol); err != nil {
+			return fmt.Errorf("invalid symbol %q", symbol)
+		}
+	}
+
+	return nil
+}
+
+func (l Limits) needsPrice() bool {
+	return l.MaxNotional.IsPositive() || l.DailyVolume.IsPositive() || l.MaxDeviation.IsPositive()
+}
+
+// Config holds the limits of API keys, by key ID, and of exchanges, by
+// exchange such as "binance" or account such as "binance:hedge". An order
+// has to pass the limits of its key, its account and its exchange.
+type Config struct {
+	Keys      map[string]Limits `yaml:"keys" toml:"keys"`
+	Exchanges map[string]Limits `yaml:"exchanges" toml:"exchanges"`
+}
+
+func (c Config) Validate() error {
+	var errs []error
+	for id, limits := range c.Keys {
+		if err := limits.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("keys.%s: %w", id, err))
+		}
+	}
+	for name, limits := range c.Exchanges {
+		if err := limits.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("exchanges.%s: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Order is an order to check. Key is the ID of the API key placing it, empty
+// for orders placed without one. Price is set for limit orders and StopPrice
+// for stop orders, which are meant to be away from the market, so their limit
+// price is checked against the stop price instead. QuoteSized orders have
+// their Amount in the quote asset.
+type Order struct {
+	Key           string
+	Account       string
+	Side          string
+	Base          string
+	Quote         string
+	Amount        decimal.Decimal
+	QuoteSized    bool
+	Price         decimal.Decimal
+	StopPrice     decimal.Decimal
+	ClientOrderID string
+}
+
+type scope struct {
+	name   string
+	limits Limits
+}
+
+type exposure struct {
+	day       time.Time
+	volume    decimal.Decimal
+	positions map[string]decimal.Decimal
+}
+
+type reservation struct {
+	order    Order
+	scopes   []string
+	notional decimal.Decimal
+	// legs counts the orders that may still execute against the
+	// reservation, which the legs of an OCO share.
+	legs int
+}
+
+// Engine checks orders against the configured limits. Positions and daily
+// volumes count what the orders it let through executed, plus what their
+// open rest may still execute, from the moment the engine started. The legs
+// of an OCO share one reservation, which siblings maps the other legs to.
+type Engine struct {
+	now func() time.Time
+
+	mu           sync.Mutex
+	config       Config
+	exposures    map[string]*exposure
+	reservations map[string]reservation
+	siblings     map[string]string
+	listeners    []func(Order, *Rejection)
+}
+
+func NewEngine(config Config) (*Engine, error) {
+	e := &Engine{
+		now:          time.Now,
+		exposures:    make(map[string]*exposure),
+		reservations: make(map[string]reservation),
+		siblings:     make(map[string]string),
+	}
+
+	err := e.SetConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// SetConfig replaces the limits. Positions and volumes are kept.
+func (e *Engine) SetConfig(config Config) error {
+	err := config.Validate()
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.config = config
+	return nil
+}
+
+func (e *Engine) scopes(o Order) []scope {
+	account := trading.AccountName(o.Account)
+	exchange, _ := trading.ParseAccount(account)
+
+	var scopes []scope
+	if o.Key != "" {
+		scopes = append(scopes, scope{name: "key " + o.Key, limits: e.config.Keys[o.Key]})
+	}
+	scopes = append(scopes, scope{name: "account " + account})
+	for name, limits := range e.config.Exchanges {
+		if trading.AccountName(name) == account && strings.Contains(name, ":") {
+			scopes[len(scopes)-1].limits = limits
+		}
+	}
+	scopes = append(scopes, scope{name: "exchange " + exchange, limits: e.config.Exchanges[exchange]})
+
+	return scopes
+}
+
+// OnRejection registers l to be called with every rejected order.
+func (e *Engine) OnRejection(l func(Order, *Rejection)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.listeners = append(e.listeners, l)
+}
+
+// Reserve checks o and, if it passes, counts it as open until Settle or
+// Release, when it has a client order ID. client is asked for the reference
+// price.
+func (e *Engine) Reserve(o Order, client trading.Client) error {
+	err := e.reserve(o, client)
+
+	var rejection *Rejection
+	if errors.As(err, &rejection) {
+		e.mu.Lock()
+		listeners := append([]func(Order, *Rejection){}, e.listeners...)
+		e.mu.Unlock()
+
+		for _, l := range listeners {
+			l(o, rejection)
+		}
+	}
+
+	return err
+}
+
+// ReserveOCO checks every leg of an OCO, of which only one can execute, and
+// reserves the costliest of them once for all legs. The reservation is held
+// until a leg executes or every leg has ended.
+func (e *Engine) ReserveOCO(legs []Order, client trading.Client) error {
+	if len(legs) == 0 {
+		return nil
+	}
+
+	worst := 0
+	for i, leg := range legs {
+		cost := leg.Amount.Mul(decimal.Max(leg.Price, leg.StopPrice))
+		if cost.GreaterThan(legs[worst].Amount.Mul(decimal.Max(legs[worst].Price, legs[worst].StopPrice))) {
+			worst = i
+		}
+	}
+
+	for i, leg := range legs {
+		if i == worst {
+			continue
+		}
+
+		// Without a client order ID the leg is only checked.
+		leg.ClientOrderID = ""
+		err := e.Reserve(leg, client)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := e.Reserve(legs[worst], client)
+	if err != nil || legs[worst].ClientOrderID == "" {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	key := reservationKey(legs[worst].Account, legs[worst].ClientOrderID)
+	r := e.reservations[key]
+	r.legs = len(legs)
+	e.reservations[key] = r
+	for i, leg := range legs {
+		if i != worst {
+			e.siblings[reservationKey(leg.Account, leg.ClientOrderID)] = key
+		}
+	}
+
+	return nil
+}
+
+func (e *Engine) reserve(o Order, client trading.Client) error {
+	e.mu.Lock()
+	scopes := e.scopes(o)
+	e.mu.Unlock()
+
+	// Quote sized amounts are converted to the base asset, which takes a
+	// price whatever the limits.
+	quoteSized := o.QuoteSized || trading.IsQuoteSized(client)
+
+	var price decimal.Decimal
+	for _, s := range scopes {
+		if !s.limits.needsPrice() && !quoteSized {
+			continue
+		}
+
+		priceClient, ok := client.(trading.PriceClient)
+		if !ok {
+			return &Rejection{Err: ErrNoReferencePrice, Scope: s.name}
+		}
+
+		res, err := priceClient.GetPrice(trading.GetPriceRequest{Base: o.Base, Quote: o.Quote})
+		if err != nil {
+			return &Rejection{Err: fmt.Errorf("%w: %v", ErrNoReferencePrice, err), Scope: s.name}
+		}
+		price = res.Price
+		break
+	}
+
+	if reference := decimal.Max(price, o.Price); quoteSized && reference.IsPositive() {
+		o.Amount = o.Amount.Div(reference)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// The config may have been reloaded while the price was fetched.
+	scopes = e.scopes(o)
+	err := e.check(o, scopes, price)
+	if err != nil {
+		return err
+	}
+
+	if o.ClientOrderID == "" {
+		return nil
+	}
+
+	r := reservation{
+		order:    o,
+		notional: o.Amount.Mul(decimal.Max(price, o.Price, o.StopPrice)),
+		legs:     1,
+	}
+	for _, s := range scopes {
+		r.scopes = append(r.scopes, s.name)
+	}
+	e.reservations[reservationKey(o.Account, o.ClientOrderID)] = r
+
+	return nil
+}
+
+func (e *Engine) check(o Order, scopes []scope, price decimal.Decimal) error {
+	symbol := trading.NewInstrument(o.Base, o.Quote).String()
+	// A limit order may fill at its price and a stop order at its stop price
+	// rather than the market's.
+	notional := o.Amount.Mul(decimal.Max(price, o.Price, o.StopPrice))
+	reference := price
+	if o.StopPrice.IsPositive() {
+		reference = o.StopPrice
+	}
+	delta := o.Amount
+	if strings.EqualFold(o.Side, "sell") {
+		delta = delta.Neg()
+	}
+
+	for _, s := range scopes {
+		l := s.limits
+		if (len(l.Allow) > 0 && !contains(l.Allow, symbol)) || contains(l.Deny, symbol) {
+			return &Rejection{Err: fmt.Errorf("%w: %s", ErrSymbolNotAllowed, symbol), Scope: s.name}
+		}
+
+		if l.MaxNotional.IsPositive() && notional.GreaterThan(l.MaxNotional) {
+			return &Rejection{Err: ErrMaxNotional, Scope: s.name, Limit: l.MaxNotional, Value: notional}
+		}
+
+		if l.MaxDeviation.IsPositive() && o.Price.IsPositive() && reference.IsPositive() {
+			deviation := o.Price.Sub(reference).Abs().Div(reference)
+			if deviation.GreaterThan(l.MaxDeviation) {
+				return &Rejection{Err: ErrPriceDeviation, Scope: s.name, Limit: l.MaxDeviation, Value: deviation}
+			}
+		}
+
+		x := e.exposure(s.name)
+		open := e.open(s.name)
+
+		if l.DailyVolume.IsPositive() {
+			volume := x.volume.Add(open.volume).Add(notional)
+			if volume.GreaterThan(l.DailyVolume) {
+				return &Rejection{Err: ErrDailyVolume, Scope: s.name, Limit: l.DailyVolume, Value: volume}
+			}
+		}
+
+		if limit, ok := maxPosition(l, o.Base); ok {
+			// Open orders only count in the direction of this one, since
+			// they may or may not fill.
+			position := x.positions[strings.ToUpper(o.Base)].Add(delta)
+			if openDelta := open.positions[strings.ToUpper(o.Base)]; openDelta.Sign() == delta.Sign() {
+				position = position.Add(openDelta)
+			}
+			if position.Abs().GreaterThan(limit) {
+				return &Rejection{Err: fmt.Errorf("%w: %s", ErrMaxPosition, strings.ToUpper(o.Base)), Scope: s.name, Limit: limit, Value: position.Abs()}
+			}
+		}
+	}
+
+	return nil
+}
+
+func maxPosition(l Limits, asset string) (decimal.Decimal, bool) {
+	for name, limit := range l.MaxPosition {
+		if strings.EqualFold(name, asset) && limit.IsPositive() {
+			return limit, true
+		}
+	}
+
+	return decimal.Decimal{}, false
+}
+
+// exposure returns what the orders of a scope executed, today for volumes.
+func (e *Engine) exposure(name string) *exposure {
+	today := e.now().UTC().Truncate(24 * time.Hour)
+
+	x, ok := e.exposures[name]
+	if !ok {
+		x = &exposure{day: today, positions: map[string]decimal.Decimal{}}
+		e.exposures[name] = x
+	}
+	if !x.day.Equal(today) {
+		x.day = today
+		x.volume = decimal.Zero
+	}
+
+	return x
+}
+
+// open sums the open orders of a scope.
+func (e *Engine) open(name string) exposure {
+	open := exposure{positions: map[string]decimal.Decimal{}}
+	for _, r := range e.reservations {
+		if !containsScope(r.scopes, name) {
+			continue
+		}
+
+		base := strings.ToUpper(r.order.Base)
+		delta := r.order.Amount
+		if strings.EqualFold(r.order.Side, "sell") {
+			delta = delta.Neg()
+		}
+		open.volume = open.volume.Add(r.notional)
+		open.positions[base] = open.positions[base].Add(delta)
+	}
+
+	return open
+}
+
+// Release forgets an order that was not placed after all.
+func (e *Engine) Release(account, clientOrderID string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	key := reservationKey(account, clientOrderID)
+	delete(e.reservations, key)
+	delete(e.siblings, key)
+}
+
+// Settle turns the reservation of an ended order into what it executed. It
+// is meant as an order.Listener. Children of parent orders are skipped since
+// their parent is reserved and settled as a whole.
+func (e *Engine) Settle(o order.Order) {
+	if o.ParentID != "" {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	key := reservationKey(o.Exchange, o.ClientOrderID)
+	if held, ok := e.siblings[key]; ok {
+		delete(e.siblings, key)
+		key = held
+	}
+	r, ok := e.reservations[key]
+	if !ok {
+		return
+	}
+
+	// An OCO leg that ended without executing leaves the reservation to the
+	// legs that still may.
+	r.legs--
+	if r.legs > 0 && o.Detail.ExecutedBase.IsZero() {
+		e.reservations[key] = r
+		return
+	}
+	delete(e.reservations, key)
+
+	base := strings.ToUpper(o.Base)
+	delta := o.Detail.ExecutedBase
+	if strings.EqualFold(o.Side, "sell") {
+		delta = delta.Neg()
+	}
+	for _, name := range r.scopes {
+		x := e.exposure(name)
+		x.volume = x.volume.Add(o.Detail.ExecutedQuote)
+		x.positions[base] = x.positions[base].Add(delta)
+	}
+}
+
+func reservationKey(account, clientOrderID string) string {
+	return trading.AccountName(account) + "/" + clientOrderID
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == Wildcard || strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsScope(scopes []string, name string) bool {
+	for _, s := range scopes {
+		if s == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,307 @@
+package risk
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/order"
+	"trading-aggregator/simulator"
+	"trading-aggregator/trading"
+)
+
+func newEngine(t *testing.T, config Config) (*Engine, *simulator.Exchange) {
+	t.Helper()
+
+	e, err := NewEngine(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sim := simulator.New()
+	sim.SetPrice("BTC", "USDT", decimal.NewFromInt(100))
+	sim.SetPrice("DOGE", "USDT", decimal.RequireFromString("0.1"))
+
+	return e, sim
+}
+
+func buy(amount string) Order {
+	return Order{
+		Key:     "ops",
+		Account: "binance",
+		Side:    "buy",
+		Base:    "BTC",
+		Quote:   "USDT",
+		Amount:  decimal.RequireFromString(amount),
+	}
+}
+
+func filled(o Order, base, quote string) order.Order {
+	return order.Order{
+		Exchange:      trading.AccountName(o.Account),
+		Side:          o.Side,
+		Base:          o.Base,
+		Quote:         o.Quote,
+		Amount:        o.Amount,
+		ClientOrderID: o.ClientOrderID,
+		Detail: trading.GetOrderDetailResponse{
+			Status:        order.StatusFilled,
+			ExecutedBase:  decimal.RequireFromString(base),
+			ExecutedQuote: decimal.RequireFromString(quote),
+		},
+	}
+}
+
+func TestEngine_Checks(t *testing.T) {
+	e, sim := newEngine(t, Config{
+		Keys: map[string]Limits{
+			"ops": {MaxNotional: decimal.NewFromInt(1000), Deny: []string{"DOGE/USDT"}},
+		},
+		Exchanges: map[string]Limits{
+			"binance":       {Allow: []string{"BTC/USDT", "DOGE/USDT"}, MaxDeviation: decimal.RequireFromString("0.05")},
+			"binance:hedge": {Allow: []string{"ETH/USDT"}},
+		},
+	})
+
+	doge := buy("10")
+	doge.Base = "DOGE"
+	limit := buy("1")
+	limit.Price = decimal.NewFromInt(110)
+	hedge := buy("1")
+	hedge.Account = "binance:hedge"
+
+	for name, test := range map[string]struct {
+		order Order
+		want  error
+	}{
+		"within limits":       {buy("9"), nil},
+		"notional":            {buy("11"), ErrMaxNotional},
+		"denied for the key":  {doge, ErrSymbolNotAllowed},
+		"fat finger":          {limit, ErrPriceDeviation},
+		"not allowed":         {hedge, ErrSymbolNotAllowed},
+		"no key limits apply": {Order{Account: "binance", Side: "sell", Base: "DOGE", Quote: "USDT", Amount: decimal.NewFromInt(1)}, nil},
+	} {
+		err := e.Reserve(test.order, sim)
+		if !errors.Is(err, test.want) || (err == nil) != (test.want == nil) {
+			t.Errorf("%s: got error %v", name, err)
+		}
+	}
+
+	var rejection *Rejection
+	err := e.Reserve(buy("11"), sim)
+	if !errors.As(err, &rejection) || rejection.Scope != "key ops" || rejection.Value.String() != "1100" || rejection.Limit.String() != "1000" {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestEngine_PositionAndDailyVolume(t *testing.T) {
+	now := time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC)
+	e, sim := newEngine(t, Config{
+		Exchanges: map[string]Limits{
+			"binance": {
+				MaxPosition: map[string]decimal.Decimal{"BTC": decimal.NewFromInt(3)},
+				DailyVolume: decimal.NewFromInt(500),
+			},
+		},
+	})
+	e.now = func() time.Time { return now }
+
+	first := buy("2")
+	first.ClientOrderID = "first"
+	err := e.Reserve(first, sim)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The open order counts towards the position until it is settled.
+	err = e.Reserve(buy("1.5"), sim)
+	if !errors.Is(err, ErrMaxPosition) {
+		t.Fatalf("got error %v", err)
+	}
+
+	e.Settle(filled(first, "1", "100"))
+
+	second := buy("2")
+	second.ClientOrderID = "second"
+	err = e.Reserve(second, sim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Settle(filled(second, "2", "200"))
+
+	// Selling reduces the position of 3, but the day's volume is spent.
+	err = e.Reserve(Order{Account: "binance", Side: "sell", Base: "BTC", Quote: "USDT", Amount: decimal.NewFromInt(3)}, sim)
+	if !errors.Is(err, ErrDailyVolume) {
+		t.Fatalf("got error %v", err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	err = e.Reserve(Order{Account: "binance", Side: "sell", Base: "BTC", Quote: "USDT", Amount: decimal.NewFromInt(3)}, sim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = e.Reserve(buy("0.5"), sim)
+	if !errors.Is(err, ErrMaxPosition) {
+		t.Fatalf("got error %v", err)
+	}
+
+	// Reloaded limits apply to the positions built so far.
+	err = e.SetConfig(Config{
+		Exchanges: map[string]Limits{
+			"binance": {MaxPosition: map[string]decimal.Decimal{"BTC": decimal.NewFromInt(4)}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = e.Reserve(buy("0.5"), sim)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = e.SetConfig(Config{Keys: map[string]Limits{"ops": {MaxNotional: decimal.NewFromInt(-1)}}})
+	if err == nil {
+		t.Fatal("accepted a negative limit")
+	}
+}
+
+func TestClient(t *testing.T) {
+	e, sim := newEngine(t, Config{
+		Keys: map[string]Limits{"ops": {MaxNotional: decimal.NewFromInt(150)}},
+	})
+	client := e.Client("ops", "binance", sim)
+
+	_, err := client.Buy(trading.BuyRequest{TradeRequest: trading.TradeRequest{
+		Base: "BTC", Quote: "USDT", Amount: decimal.NewFromInt(1), ClientOrderID: "a",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Sell(trading.SellRequest{TradeRequest: trading.TradeRequest{
+		Base: "BTC", Quote: "USDT", Amount: decimal.NewFromInt(2), ClientOrderID: "b",
+	}})
+	if !errors.Is(err, ErrMaxNotional) {
+		t.Fatalf("got error %v", err)
+	}
+
+	// Rejected orders never reach the exchange.
+	if fills := sim.Fills(); len(fills) != 1 || fills[0].Side != "buy" {
+		t.Fatalf("got fills %+v", fills)
+	}
+}
+
+type inverseExchange struct {
+	*simulator.Exchange
+}
+
+func (e inverseExchange) QuoteSized() bool { return true }
+
+func TestEngine_QuoteSized(t *testing.T) {
+	e, sim := newEngine(t, Config{
+		Keys:      map[string]Limits{"ops": {MaxNotional: decimal.NewFromInt(1000)}},
+		Exchanges: map[string]Limits{"bybit:inverse": {MaxPosition: map[string]decimal.Decimal{"BTC": decimal.NewFromInt(5)}}},
+	})
+	sim.SetPrice("BTC", "USD", decimal.NewFromInt(1000))
+	inverse := inverseExchange{sim}
+
+	// 900 USD contracts are worth 900 USD, not 900 × the price.
+	contracts := Order{Key: "ops", Account: "bybit:inverse", Side: "buy", Base: "BTC", Quote: "USD", Amount: decimal.NewFromInt(900), ClientOrderID: "a"}
+	err := e.Reserve(contracts, inverse)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contracts.Amount = decimal.NewFromInt(1100)
+	contracts.ClientOrderID = "b"
+	var rejection *Rejection
+	err = e.Reserve(contracts, inverse)
+	if !errors.As(err, &rejection) || !errors.Is(err, ErrMaxNotional) || rejection.Value.String() != "1100" {
+		t.Fatalf("got error %v", err)
+	}
+
+	// Positions count in BTC: 0.9 and 4 are reserved, and 0.5 more goes
+	// over 5.
+	contracts.Key = ""
+	contracts.Amount = decimal.NewFromInt(4000)
+	err = e.Reserve(contracts, inverse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contracts.Amount = decimal.NewFromInt(500)
+	contracts.ClientOrderID = "c"
+	err = e.Reserve(contracts, inverse)
+	if !errors.As(err, &rejection) || !errors.Is(err, ErrMaxPosition) || rejection.Value.String() != "5.4" {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func TestEngine_StopOrders(t *testing.T) {
+	e, sim := newEngine(t, Config{
+		Keys:      map[string]Limits{"ops": {MaxNotional: decimal.NewFromInt(1000)}},
+		Exchanges: map[string]Limits{"binance": {MaxDeviation: decimal.RequireFromString("0.05")}},
+	})
+
+	// A stop 10% below the market is where it is meant to be.
+	stopLoss := buy("1")
+	stopLoss.Side = "sell"
+	stopLoss.StopPrice = decimal.NewFromInt(90)
+	stopLimit := stopLoss
+	stopLimit.Price = decimal.NewFromInt(89)
+	farLimit := stopLoss
+	farLimit.Price = decimal.NewFromInt(80)
+	breakout := buy("9")
+	breakout.StopPrice = decimal.NewFromInt(120)
+
+	for name, test := range map[string]struct {
+		order Order
+		want  error
+	}{
+		"stop-market":            {stopLoss, nil},
+		"stop-limit":             {stopLimit, nil},
+		"limit far from stop":    {farLimit, ErrPriceDeviation},
+		"notional at stop price": {breakout, ErrMaxNotional},
+	} {
+		err := e.Reserve(test.order, sim)
+		if !errors.Is(err, test.want) || (err == nil) != (test.want == nil) {
+			t.Errorf("%s: got error %v", name, err)
+		}
+	}
+}
+
+func TestEngine_OCO(t *testing.T) {
+	e, sim := newEngine(t, Config{
+		Exchanges: map[string]Limits{"binance": {DailyVolume: decimal.NewFromInt(300)}},
+	})
+
+	above := buy("2")
+	above.Side = "sell"
+	above.Price = decimal.NewFromInt(120)
+	above.ClientOrderID = "tp"
+	below := above
+	below.Price = decimal.Zero
+	below.StopPrice = decimal.NewFromInt(90)
+	below.ClientOrderID = "sl"
+
+	// Reserved leg by leg the OCO would take 440 of the day's 300.
+	err := e.ReserveOCO([]Order{above, below}, sim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Reserve(buy("1"), sim); !errors.Is(err, ErrDailyVolume) {
+		t.Fatalf("got error %v", err)
+	}
+
+	// The reservation of the take profit stays with the stop loss when it
+	// is cancelled, and ends once the stop loss fills.
+	e.Settle(filled(above, "0", "0"))
+	if err := e.Reserve(buy("1"), sim); !errors.Is(err, ErrDailyVolume) {
+		t.Fatalf("got error %v", err)
+	}
+	e.Settle(filled(below, "2", "180"))
+	if err := e.Reserve(buy("1"), sim); err != nil {
+		t.Fatal(err)
+	}
+}
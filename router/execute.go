@@ -0,0 +1,69 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/book"
+	"trading-aggregator/trading"
+)
+
+// Placer places a market order on a venue and returns the ID of the order.
+type Placer func(venue, side string, req trading.TradeRequest) (string, error)
+
+// Child is the part of a routed order placed on one venue.
+type Child struct {
+	Venue   string          `json:"venue"`
+	Amount  decimal.Decimal `json:"amount"`
+	OrderID string          `json:"order_id,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// Execute splits a market order across the venues like Quote, taking at most
+// caps[venue] of base on each venue, and places every part with place. The
+// parts are placed even if the books cannot fill the whole amount within the
+// caps, in which case the error is book.ErrInsufficientLiquidity.
+func (r *Router) Execute(side, base, quote string, amount decimal.Decimal, caps map[string]decimal.Decimal, place Placer) ([]Child, error) {
+	side = strings.ToLower(side)
+	if side != "buy" && side != "sell" {
+		return nil, fmt.Errorf("unknown side %q", side)
+	}
+	if !amount.IsPositive() {
+		return nil, fmt.Errorf("amount must be positive, got %s", amount)
+	}
+
+	b, err := r.books.Book(trading.NewInstrument(base, quote))
+	if err != nil {
+		return nil, err
+	}
+
+	var fill book.Fill
+	var fillErr error
+	if side == "buy" {
+		fill, fillErr = b.BuyWithin(amount, caps)
+	} else {
+		fill, fillErr = b.SellWithin(amount, caps)
+	}
+	if fillErr != nil && !errors.Is(fillErr, book.ErrInsufficientLiquidity) {
+		return nil, fillErr
+	}
+
+	children := make([]Child, 0, len(fill.Venues))
+	for _, venue := range fill.Venues {
+		child := Child{Venue: venue.Venue, Amount: venue.Base}
+		child.OrderID, err = place(venue.Venue, side, trading.TradeRequest{
+			Base:   b.Instrument.Base,
+			Quote:  b.Instrument.Quote,
+			Amount: venue.Base,
+		})
+		if err != nil {
+			child.Error = err.Error()
+		}
+		children = append(children, child)
+	}
+
+	return children, fillErr
+}
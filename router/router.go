@@ -0,0 +1,129 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/book"
+	"trading-aggregator/trading"
+)
+
+var ErrNoMidPrice = errors.New("book has no bid or no ask")
+
+// VenueQuote is the outcome of filling the whole amount on one venue.
+type VenueQuote struct {
+	Venue        string          `json:"venue"`
+	Filled       decimal.Decimal `json:"filled"`
+	AveragePrice decimal.Decimal `json:"average_price"`
+	Fee          decimal.Decimal `json:"fee"`
+	Total        decimal.Decimal `json:"total"`
+}
+
+// Quote estimates a market order from the consolidated book. Notional is the
+// quote amount before fees and Total what a buyer pays or a seller receives
+// after fees. Slippage is the average price's distance from the mid price as
+// a fraction of it, positive when the fill is worse than mid.
+type Quote struct {
+	Side         string             `json:"side"`
+	Instrument   trading.Instrument `json:"instrument"`
+	Amount       decimal.Decimal    `json:"amount"`
+	Filled       decimal.Decimal    `json:"filled"`
+	MidPrice     decimal.Decimal    `json:"mid_price"`
+	AveragePrice decimal.Decimal    `json:"average_price"`
+	Slippage     decimal.Decimal    `json:"slippage"`
+	Notional     decimal.Decimal    `json:"notional"`
+	Fee          decimal.Decimal    `json:"fee"`
+	Total        decimal.Decimal    `json:"total"`
+	Split        []book.VenueFill   `json:"split"`
+	Venues       []VenueQuote       `json:"venues"`
+	Time         time.Time          `json:"time"`
+}
+
+// Router decides how an order is spread across venues.
+type Router struct {
+	books *book.Aggregator
+}
+
+func NewRouter(books *book.Aggregator) *Router {
+	return &Router{books: books}
+}
+
+// Quote walks the consolidated book without placing orders. Split is the
+// recommended venue split, filling from the best effective price on, and
+// Venues compares it with filling everything on a single venue. If the books
+// cannot fill amount, the quote covers what they can along with
+// book.ErrInsufficientLiquidity.
+func (r *Router) Quote(side, base, quote string, amount decimal.Decimal) (Quote, error) {
+	side = strings.ToLower(side)
+	if side != "buy" && side != "sell" {
+		return Quote{}, fmt.Errorf("unknown side %q", side)
+	}
+	if !amount.IsPositive() {
+		return Quote{}, fmt.Errorf("amount must be positive, got %s", amount)
+	}
+
+	b, err := r.books.Book(trading.NewInstrument(base, quote))
+	if err != nil {
+		return Quote{}, err
+	}
+
+	mid, ok := b.Mid()
+	if !ok {
+		return Quote{}, ErrNoMidPrice
+	}
+
+	fill, fillErr := walk(b, side, amount)
+	q := Quote{
+		Side:         side,
+		Instrument:   b.Instrument,
+		Amount:       amount,
+		Filled:       fill.Base,
+		MidPrice:     mid,
+		AveragePrice: fill.AveragePrice,
+		Notional:     fill.Quote,
+		Fee:          fill.Fee,
+		Total:        total(side, fill),
+		Split:        fill.Venues,
+		Venues:       make([]VenueQuote, 0, len(b.Venues)),
+		Time:         b.Time,
+	}
+	if fill.Base.IsPositive() {
+		q.Slippage = fill.AveragePrice.Sub(mid).Div(mid)
+		if side == "sell" {
+			q.Slippage = q.Slippage.Neg()
+		}
+	}
+
+	for _, venue := range b.Venues {
+		fill, _ := walk(b.Venue(venue), side, amount)
+		q.Venues = append(q.Venues, VenueQuote{
+			Venue:        venue,
+			Filled:       fill.Base,
+			AveragePrice: fill.AveragePrice,
+			Fee:          fill.Fee,
+			Total:        total(side, fill),
+		})
+	}
+
+	return q, fillErr
+}
+
+func walk(b *book.Book, side string, amount decimal.Decimal) (book.Fill, error) {
+	if side == "buy" {
+		return b.Buy(amount)
+	}
+
+	return b.Sell(amount)
+}
+
+func total(side string, fill book.Fill) decimal.Decimal {
+	if side == "buy" {
+		return fill.Quote.Add(fill.Fee)
+	}
+
+	return fill.Quote.Sub(fill.Fee)
+}
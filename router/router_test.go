@@ -0,0 +1,140 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/book"
+	"trading-aggregator/trading"
+)
+
+var btcUSDT = trading.NewInstrument("BTC", "USDT")
+
+type venueClient struct {
+	book *trading.OrderBook
+}
+
+func (c *venueClient) Sell(trading.SellRequest) (trading.SellResponse, error) {
+	return trading.SellResponse{}, nil
+}
+
+func (c *venueClient) Buy(trading.BuyRequest) (trading.BuyResponse, error) {
+	return trading.BuyResponse{}, nil
+}
+
+func (c *venueClient) GetOrderDetail(trading.GetOrderDetailRequest) (trading.GetOrderDetailResponse, error) {
+	return trading.GetOrderDetailResponse{}, nil
+}
+
+func (c *venueClient) ListInstruments() ([]trading.Listing, error) {
+	return []trading.Listing{{Instrument: btcUSDT, Symbol: "BTCUSDT", Tradable: true}}, nil
+}
+
+func (c *venueClient) SubscribeOrderBook(ctx context.Context, instrument trading.Instrument) (*trading.OrderBook, error) {
+	return c.book, nil
+}
+
+func newVenue(bids, asks []trading.Level) *venueClient {
+	book := trading.NewOrderBook(btcUSDT)
+	book.Snapshot(bids, asks, time.Now())
+
+	return &venueClient{book: book}
+}
+
+func level(price, size int64) trading.Level {
+	return trading.Level{Price: decimal.NewFromInt(price), Size: decimal.NewFromInt(size)}
+}
+
+func TestRouter_Quote(t *testing.T) {
+	registry := trading.NewRegistry()
+	registry.Set("binance", newVenue([]trading.Level{level(99, 1)}, []trading.Level{level(100, 1), level(102, 5)}))
+	registry.Set("bybit", newVenue([]trading.Level{level(98, 3)}, []trading.Level{level(101, 1)}))
+
+	books := book.NewAggregator(registry, book.Config{
+		TakerFees: map[string]decimal.Decimal{"bybit": decimal.RequireFromString("0.001")},
+	})
+	defer books.Close()
+
+	r := NewRouter(books)
+
+	q, err := r.Quote("BUY", "btc", "usdt", decimal.NewFromInt(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q.MidPrice.String() != "99.5" || q.AveragePrice.String() != "100.5" || q.Notional.String() != "201" {
+		t.Fatalf("got quote %+v", q)
+	}
+	if q.Fee.String() != "0.101" || q.Total.String() != "201.101" {
+		t.Fatalf("got fee %s and total %s", q.Fee, q.Total)
+	}
+	if !q.Slippage.Round(4).Equal(decimal.RequireFromString("0.0101")) {
+		t.Fatalf("got slippage %s", q.Slippage)
+	}
+	if len(q.Split) != 2 || q.Split[0].Venue != "binance" || q.Split[1].Venue != "bybit" || !q.Split[1].Base.Equal(decimal.NewFromInt(1)) {
+		t.Fatalf("got split %+v", q.Split)
+	}
+
+	if len(q.Venues) != 2 || q.Venues[0].Total.String() != "202" || q.Venues[1].Filled.String() != "1" {
+		t.Fatalf("got venue quotes %+v", q.Venues)
+	}
+
+	q, err = r.Quote("sell", "BTC", "USDT", decimal.NewFromInt(5))
+	if !errors.Is(err, book.ErrInsufficientLiquidity) || q.Filled.String() != "4" {
+		t.Fatalf("got quote %+v and error %v", q, err)
+	}
+	if !q.Slippage.IsPositive() {
+		t.Fatalf("got slippage %s for selling below mid", q.Slippage)
+	}
+
+	_, err = r.Quote("hold", "BTC", "USDT", decimal.NewFromInt(1))
+	if err == nil {
+		t.Fatal("expected error for unknown side")
+	}
+}
+
+func TestRouter_Execute(t *testing.T) {
+	registry := trading.NewRegistry()
+	registry.Set("binance", newVenue([]trading.Level{level(99, 1)}, []trading.Level{level(100, 1), level(102, 5)}))
+	registry.Set("bybit", newVenue([]trading.Level{level(98, 3)}, []trading.Level{level(101, 1)}))
+
+	books := book.NewAggregator(registry, book.Config{})
+	defer books.Close()
+
+	r := NewRouter(books)
+
+	var placed []string
+	place := func(venue, side string, req trading.TradeRequest) (string, error) {
+		placed = append(placed, venue+" "+side+" "+req.Amount.String()+" "+req.Base+"/"+req.Quote)
+		if venue == "bybit" {
+			return "", errors.New("rejected")
+		}
+		return venue + "-1", nil
+	}
+
+	// Binance is capped at 1.5, so the books only fill 2.5.
+	children, err := r.Execute("buy", "BTC", "USDT", decimal.NewFromInt(3), map[string]decimal.Decimal{
+		"binance": decimal.RequireFromString("1.5"),
+		"bybit":   decimal.NewFromInt(5),
+	}, place)
+	if !errors.Is(err, book.ErrInsufficientLiquidity) {
+		t.Fatalf("got error %v", err)
+	}
+	if len(placed) != 2 || placed[0] != "binance buy 1.5 BTC/USDT" || placed[1] != "bybit buy 1 BTC/USDT" {
+		t.Fatalf("got placed %v", placed)
+	}
+	if len(children) != 2 || children[0].OrderID != "binance-1" || children[1].Error != "rejected" {
+		t.Fatalf("got children %+v", children)
+	}
+
+	// Venues without a cap are left out.
+	placed = nil
+	_, err = r.Execute("sell", "BTC", "USDT", decimal.NewFromInt(2), map[string]decimal.Decimal{"bybit": decimal.NewFromInt(2)}, place)
+	if err != nil || len(placed) != 1 || placed[0] != "bybit sell 2 BTC/USDT" {
+		t.Fatalf("got placed %v and error %v", placed, err)
+	}
+}
@@ -0,0 +1,152 @@
+package secret
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// keystoreFile is the on-disk format of the keystore: a JSON object of secret
+// names to values sealed with NaCl secretbox under a scrypt derived key.
+type keystoreFile struct {
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Box   []byte `json:"box"`
+}
+
+type keystoreProvider struct {
+	path       string
+	passphrase []byte
+
+	mu      sync.Mutex
+	modTime time.Time
+	secrets map[string]string
+}
+
+// NewKeystoreProvider reads secrets from an encrypted keystore file created
+// with SealKeystore. The file is decrypted again whenever it changes on disk.
+func NewKeystoreProvider(path, passphrase string) Provider {
+	return &keystoreProvider{
+		path:       path,
+		passphrase: []byte(passphrase),
+	}
+}
+
+func (p *keystoreProvider) GetSecret(_ context.Context, ref string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return "", err
+	}
+
+	if p.secrets == nil || !info.ModTime().Equal(p.modTime) {
+		data, err := os.ReadFile(p.path)
+		if err != nil {
+			return "", err
+		}
+
+		secrets, err := OpenKeystore(data, string(p.passphrase))
+		if err != nil {
+			return "", err
+		}
+
+		p.secrets = secrets
+		p.modTime = info.ModTime()
+	}
+
+	value, ok := p.secrets[ref]
+	if !ok {
+		return "", fmt.Errorf("%w: keystore entry %s", ErrNotFound, ref)
+	}
+
+	return value, nil
+}
+
+func SealKeystore(secrets map[string]string, passphrase string) ([]byte, error) {
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	_, err = rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce [24]byte
+	_, err = rand.Read(nonce[:])
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(keystoreFile{
+		Salt:  salt,
+		Nonce: nonce[:],
+		Box:   secretbox.Seal(nil, plaintext, &nonce, key),
+	})
+}
+
+func OpenKeystore(data []byte, passphrase string) (map[string]string, error) {
+	var file keystoreFile
+	err := json.Unmarshal(data, &file)
+	if err != nil {
+		return nil, err
+	}
+	if len(file.Nonce) != 24 {
+		return nil, errors.New("invalid keystore nonce")
+	}
+
+	key, err := deriveKey(passphrase, file.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], file.Nonce)
+
+	plaintext, ok := secretbox.Open(nil, file.Box, &nonce, key)
+	if !ok {
+		return nil, errors.New("cannot decrypt keystore: wrong passphrase or corrupted file")
+	}
+
+	var secrets map[string]string
+	err = json.Unmarshal(plaintext, &secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	return secrets, nil
+}
+
+func deriveKey(passphrase string, salt []byte) (*[32]byte, error) {
+	derived, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	var key [32]byte
+	copy(key[:], derived)
+	return &key, nil
+}
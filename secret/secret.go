@@ -0,0 +1,170 @@
+package secret
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNotFound = errors.New("secret not found")
+
+// Provider returns the current value of the secret identified by ref. The
+// format of ref is specific to each provider.
+type Provider interface {
+	GetSecret(ctx context.Context, ref string) (string, error)
+}
+
+type envProvider struct{}
+
+func NewEnvProvider() Provider {
+	return envProvider{}
+}
+
+func (envProvider) GetSecret(_ context.Context, ref string) (string, error) {
+	value, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("%w: environment variable %s", ErrNotFound, ref)
+	}
+
+	return value, nil
+}
+
+type fileProvider struct {
+	dir string
+}
+
+// NewFileProvider reads secrets from files such as Docker or Kubernetes
+// secrets. Relative refs are resolved against dir.
+func NewFileProvider(dir string) Provider {
+	return fileProvider{dir: dir}
+}
+
+func (p fileProvider) GetSecret(_ context.Context, ref string) (string, error) {
+	path := ref
+	if !filepath.IsAbs(path) && p.dir != "" {
+		path = filepath.Join(p.dir, path)
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%w: file %s", ErrNotFound, path)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Resolver dispatches references of the form "scheme:ref" to the provider
+// registered for scheme, e.g. "env:BINANCE_API_SECRET" or
+// "vault:exchanges/binance#api_secret". Values without a registered scheme are
+// returned as they are so that literal values keep working.
+type Resolver struct {
+	mu        sync.RWMutex
+	providers map[string]Provider
+}
+
+func NewResolver() *Resolver {
+	return &Resolver{
+		providers: make(map[string]Provider),
+	}
+}
+
+func (r *Resolver) Register(scheme string, provider Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.providers[scheme] = provider
+}
+
+func (r *Resolver) GetSecret(ctx context.Context, ref string) (string, error) {
+	scheme, rest, ok := strings.Cut(ref, ":")
+	if !ok {
+		return ref, nil
+	}
+
+	r.mu.RLock()
+	provider, ok := r.providers[scheme]
+	r.mu.RUnlock()
+	if !ok {
+		return ref, nil
+	}
+
+	value, err := provider.GetSecret(ctx, rest)
+	if err != nil {
+		return "", fmt.Errorf("resolve %s secret: %w", scheme, err)
+	}
+
+	return value, nil
+}
+
+// Watch resolves refs every interval and calls onChange with the resolved
+// values whenever any of them differs from the previous resolution, which is
+// how rotated credentials are picked up without a restart. The first
+// resolution is not reported since callers already built their clients from
+// it. Resolution errors are passed to onError and the previous values are
+// kept.
+func Watch(ctx context.Context, provider Provider, interval time.Duration, refs []string, onChange func([]string), onError func(error)) {
+	previous, err := resolveAll(ctx, provider, refs)
+	if err != nil && onError != nil {
+		onError(err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		values, err := resolveAll(ctx, provider, refs)
+		if err != nil {
+			if onError != nil {
+				onError(err)
+			}
+			continue
+		}
+
+		if previous != nil && equal(previous, values) {
+			continue
+		}
+
+		previous = values
+		onChange(values)
+	}
+}
+
+func resolveAll(ctx context.Context, provider Provider, refs []string) ([]string, error) {
+	values := make([]string, len(refs))
+	for i, ref := range refs {
+		value, err := provider.GetSecret(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+
+	return values, nil
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
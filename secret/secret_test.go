@@ -0,0 +1,186 @@
+package secret
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResolver(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "api_secret"), []byte("from-file\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_API_SECRET", "from-env")
+
+	resolver := NewResolver()
+	resolver.Register("env", NewEnvProvider())
+	resolver.Register("file", NewFileProvider(dir))
+
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"env:TEST_API_SECRET", "from-env"},
+		{"file:api_secret", "from-file"},
+		{"literal", "literal"},
+		{"unknown:scheme", "unknown:scheme"},
+	}
+
+	for _, tt := range tests {
+		got, err := resolver.GetSecret(context.Background(), tt.ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Fatalf("got %s for %s", got, tt.want)
+		}
+	}
+
+	_, err = resolver.GetSecret(context.Background(), "env:TEST_MISSING")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func TestKeystoreProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	write := func(secrets map[string]string) {
+		data, err := SealKeystore(secrets, "passphrase")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, data, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(map[string]string{"binance/api_secret": "v1"})
+	provider := NewKeystoreProvider(path, "passphrase")
+
+	got, err := provider.GetSecret(context.Background(), "binance/api_secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "v1" {
+		t.Fatalf("got %s", got)
+	}
+
+	write(map[string]string{"binance/api_secret": "v2"})
+	future := time.Now().Add(time.Minute)
+	err = os.Chtimes(path, future, future)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = provider.GetSecret(context.Background(), "binance/api_secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "v2" {
+		t.Fatalf("rotated secret not picked up, got %s", got)
+	}
+
+	_, err = NewKeystoreProvider(path, "wrong").GetSecret(context.Background(), "binance/api_secret")
+	if err == nil {
+		t.Fatal("expected error for wrong passphrase")
+	}
+}
+
+func TestVaultProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			rw.WriteHeader(http.StatusForbidden)
+			_, _ = rw.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		if r.URL.Path != "/v1/kv/data/exchanges/binance" {
+			rw.WriteHeader(http.StatusNotFound)
+			_, _ = rw.Write([]byte(`{"errors":[]}`))
+			return
+		}
+		_, _ = rw.Write([]byte(`{"data":{"data":{"api_secret":"from-vault"},"metadata":{"version":3}}}`))
+	}))
+	defer server.Close()
+
+	provider := NewVaultProvider(VaultConfig{Address: server.URL, Token: "token", Mount: "kv"}, http.DefaultClient)
+
+	got, err := provider.GetSecret(context.Background(), "exchanges/binance#api_secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "from-vault" {
+		t.Fatalf("got %s", got)
+	}
+
+	_, err = provider.GetSecret(context.Background(), "exchanges/binance#api_key")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got error %v", err)
+	}
+
+	_, err = provider.GetSecret(context.Background(), "exchanges/bybit#api_secret")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got error %v", err)
+	}
+
+	_, err = NewVaultProvider(VaultConfig{Address: server.URL, Token: "wrong", Mount: "kv"}, http.DefaultClient).
+		GetSecret(context.Background(), "exchanges/binance#api_secret")
+	if err == nil {
+		t.Fatal("expected error for wrong token")
+	}
+}
+
+type mapProvider struct {
+	mu      sync.Mutex
+	secrets map[string]string
+}
+
+func (p *mapProvider) GetSecret(_ context.Context, ref string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.secrets[ref], nil
+}
+
+func (p *mapProvider) set(ref, value string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.secrets[ref] = value
+}
+
+func TestWatch(t *testing.T) {
+	provider := &mapProvider{secrets: map[string]string{"key": "k", "secret": "v1"}}
+	changes := make(chan []string, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Watch(ctx, provider, 5*time.Millisecond, []string{"key", "secret"}, func(values []string) {
+		changes <- values
+	}, nil)
+
+	select {
+	case values := <-changes:
+		t.Fatalf("unexpected change %v", values)
+	case <-time.After(30 * time.Millisecond):
+	}
+
+	provider.set("secret", "v2")
+
+	select {
+	case values := <-changes:
+		if values[1] != "v2" {
+			t.Fatalf("got %v", values)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("rotation not detected")
+	}
+}
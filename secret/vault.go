@@ -0,0 +1,99 @@
+package secret
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type VaultConfig struct {
+	Address string
+	Token   string
+	// Mount is the path of the KV version 2 secrets engine, "secret" by default.
+	Mount string
+}
+
+type vaultProvider struct {
+	config     VaultConfig
+	httpClient *http.Client
+}
+
+type vaultReadResponse struct {
+	Data struct {
+		Data map[string]interface{} `json:"data"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+// NewVaultProvider reads secrets from a HashiCorp Vault compatible KV version 2
+// engine. Refs are written as "path#field", for example
+// "exchanges/binance#api_secret".
+func NewVaultProvider(config VaultConfig, httpClient *http.Client) Provider {
+	if config.Mount == "" {
+		config.Mount = "secret"
+	}
+
+	return &vaultProvider{
+		config:     config,
+		httpClient: httpClient,
+	}
+}
+
+func (p *vaultProvider) GetSecret(ctx context.Context, ref string) (string, error) {
+	path, field, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || field == "" {
+		return "", fmt.Errorf("vault ref %q must be written as path#field", ref)
+	}
+
+	u, err := url.Parse(strings.TrimRight(p.config.Address, "/") + "/v1/" + strings.Trim(p.config.Mount, "/") + "/data/" + strings.Trim(path, "/"))
+	if err != nil {
+		return "", err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	httpReq.Header.Set("X-Vault-Token", p.config.Token)
+
+	res, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("%w: vault path %s", ErrNotFound, path)
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("get http response code %d and body %s", res.StatusCode, resBody)
+	}
+
+	var response vaultReadResponse
+	err = json.Unmarshal(resBody, &response)
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := response.Data.Data[field]
+	if !ok {
+		return "", fmt.Errorf("%w: vault field %s#%s", ErrNotFound, path, field)
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("vault field %s#%s is not a string", path, field)
+	}
+
+	return s, nil
+}
@@ -0,0 +1,452 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/trading"
+)
+
+// Order statuses follow Binance's spelling.
+const (
+	StatusNew      = "NEW"
+	StatusPartial  = "PARTIALLY_FILLED"
+	StatusFilled   = "FILLED"
+	StatusCanceled = "CANCELED"
+)
+
+var (
+	ErrNoPrice       = errors.New("no price set")
+	ErrUnknownOrder  = errors.New("unknown order")
+	ErrDuplicateID   = errors.New("duplicate client order id")
+	ErrInvalidAmount = errors.New("amount must be positive")
+	ErrOrderClosed   = errors.New("order is not open")
+)
+
+// Fill is one execution on the simulated exchange.
+type Fill struct {
+	OrderID    string
+	Side       string
+	Instrument trading.Instrument
+	Base       decimal.Decimal
+	Price      decimal.Decimal
+	Time       time.Time
+}
+
+type simOrder struct {
+	id         string
+	side       string
+	instrument trading.Instrument
+	request    trading.TradeRequest
+	status     string
+	executed   decimal.Decimal
+	quote      decimal.Decimal
+}
+
+// Exchange is an in-memory venue implementing trading.Client for tests and
+// dry runs. Market orders fill in full at the current price and limit orders
+// fill once the price reaches them; SetLiquidity caps what a single price
+// update can fill. Balances follow the fills without any funds check.
+type Exchange struct {
+	mu        sync.Mutex
+	now       func() time.Time
+	prices    map[trading.Instrument]decimal.Decimal
+	liquidity decimal.Decimal
+	orders    map[string]*simOrder
+	clientIDs map[string]string
+	fills     []Fill
+	fail      func(side string, req trading.TradeRequest) error
+	nextID    int
+	klines    map[trading.Instrument][]trading.Kline
+	streams   map[chan trading.Trade]trading.Instrument
+	balances  map[string]decimal.Decimal
+}
+
+func New() *Exchange {
+	return &Exchange{
+		now:       time.Now,
+		prices:    map[trading.Instrument]decimal.Decimal{},
+		orders:    map[string]*simOrder{},
+		clientIDs: map[string]string{},
+		klines:    map[trading.Instrument][]trading.Kline{},
+		streams:   map[chan trading.Trade]trading.Instrument{},
+		balances:  map[string]decimal.Decimal{},
+	}
+}
+
+// SetClock replaces time.Now for fill timestamps.
+func (e *Exchange) SetClock(now func() time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.now = now
+}
+
+// SetLiquidity caps the base amount that fills per order and price update;
+// zero, the default, is unlimited.
+func (e *Exchange) SetLiquidity(base decimal.Decimal) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.liquidity = base
+}
+
+// SetBalance sets what the account holds of asset.
+func (e *Exchange) SetBalance(asset string, amount decimal.Decimal) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.balances[asset] = amount
+}
+
+// FailWith makes Buy and Sell return the error fail returns, so that tests
+// can inject rejections. A nil fail accepts every order again.
+func (e *Exchange) FailWith(fail func(side string, req trading.TradeRequest) error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.fail = fail
+}
+
+// SetPrice moves the market and fills the resting limit orders it reaches.
+func (e *Exchange) SetPrice(base, quote string, price decimal.Decimal) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	instrument := trading.NewInstrument(base, quote)
+	e.prices[instrument] = price
+
+	for _, o := range e.orders {
+		if o.instrument == instrument && (o.status == StatusNew || o.status == StatusPartial) {
+			e.match(o)
+		}
+	}
+}
+
+// Trade prints a trade of others at price, which moves the market as
+// SetPrice does, to the trade streams.
+func (e *Exchange) Trade(base, quote string, price, size decimal.Decimal) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	instrument := trading.NewInstrument(base, quote)
+	e.publish(trading.Trade{
+		Instrument: instrument,
+		Price:      price,
+		Size:       size,
+		Time:       e.now(),
+	})
+
+	e.prices[instrument] = price
+	for _, o := range e.orders {
+		if o.instrument == instrument && (o.status == StatusNew || o.status == StatusPartial) {
+			e.match(o)
+		}
+	}
+}
+
+// publish sends a trade to the trade streams of its instrument. Streams
+// that fall more than their buffer behind miss trades.
+func (e *Exchange) publish(trade trading.Trade) {
+	for trades, instrument := range e.streams {
+		if instrument != trade.Instrument {
+			continue
+		}
+
+		select {
+		case trades <- trade:
+		default:
+		}
+	}
+}
+
+// SetKlines sets the klines GetKlines serves for an instrument, oldest
+// first.
+func (e *Exchange) SetKlines(base, quote string, klines []trading.Kline) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.klines[trading.NewInstrument(base, quote)] = append([]trading.Kline(nil), klines...)
+}
+
+// Fills returns every execution so far, oldest first.
+func (e *Exchange) Fills() []Fill {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]Fill(nil), e.fills...)
+}
+
+func (e *Exchange) Buy(req trading.BuyRequest) (trading.BuyResponse, error) {
+	id, err := e.place("buy", req.TradeRequest)
+	if err != nil {
+		return trading.BuyResponse{}, err
+	}
+
+	return trading.BuyResponse{TradeResponse: trading.TradeResponse{OrderID: id}}, nil
+}
+
+func (e *Exchange) Sell(req trading.SellRequest) (trading.SellResponse, error) {
+	id, err := e.place("sell", req.TradeRequest)
+	if err != nil {
+		return trading.SellResponse{}, err
+	}
+
+	return trading.SellResponse{TradeResponse: trading.TradeResponse{OrderID: id}}, nil
+}
+
+func (e *Exchange) place(side string, req trading.TradeRequest) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.fail != nil {
+		err := e.fail(side, req)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err := req.Validate()
+	if err != nil {
+		return "", err
+	}
+	if !req.Amount.IsPositive() {
+		return "", ErrInvalidAmount
+	}
+
+	instrument := trading.NewInstrument(req.Base, req.Quote)
+	if _, ok := e.prices[instrument]; !ok {
+		return "", fmt.Errorf("%w for %s", ErrNoPrice, instrument)
+	}
+
+	if req.ClientOrderID != "" {
+		if _, ok := e.clientIDs[req.ClientOrderID]; ok {
+			return "", ErrDuplicateID
+		}
+	}
+
+	e.nextID++
+	o := &simOrder{
+		id:         strconv.Itoa(e.nextID),
+		side:       side,
+		instrument: instrument,
+		request:    req,
+		status:     StatusNew,
+	}
+	e.orders[o.id] = o
+	if req.ClientOrderID != "" {
+		e.clientIDs[req.ClientOrderID] = o.id
+	}
+
+	e.match(o)
+
+	// Market and immediate-or-cancel orders never rest.
+	if (!req.IsLimit() || req.TimeInForce == trading.ImmediateOrCancel) && o.status != StatusFilled {
+		o.status = StatusCanceled
+	}
+
+	return o.id, nil
+}
+
+// match fills o as far as the current price and liquidity allow.
+func (e *Exchange) match(o *simOrder) {
+	price := e.prices[o.instrument]
+	if o.request.IsLimit() {
+		if o.side == "buy" && price.GreaterThan(o.request.Price) {
+			return
+		}
+		if o.side == "sell" && price.LessThan(o.request.Price) {
+			return
+		}
+	}
+
+	size := o.request.Amount.Sub(o.executed)
+	if e.liquidity.IsPositive() {
+		size = decimal.Min(size, e.liquidity)
+	}
+	if !size.IsPositive() {
+		return
+	}
+
+	o.executed = o.executed.Add(size)
+	o.quote = o.quote.Add(size.Mul(price))
+	base, quote := o.instrument.Base, o.instrument.Quote
+	if o.side == "buy" {
+		e.balances[base] = e.balances[base].Add(size)
+		e.balances[quote] = e.balances[quote].Sub(size.Mul(price))
+	} else {
+		e.balances[base] = e.balances[base].Sub(size)
+		e.balances[quote] = e.balances[quote].Add(size.Mul(price))
+	}
+	o.status = StatusPartial
+	if o.executed.Equal(o.request.Amount) {
+		o.status = StatusFilled
+	}
+
+	fill := Fill{
+		OrderID:    o.id,
+		Side:       o.side,
+		Instrument: o.instrument,
+		Base:       size,
+		Price:      price,
+		Time:       e.now(),
+	}
+	e.fills = append(e.fills, fill)
+	e.publish(trading.Trade{
+		Instrument: fill.Instrument,
+		Price:      fill.Price,
+		Size:       fill.Base,
+		Time:       fill.Time,
+	})
+}
+
+func (e *Exchange) GetOrderDetail(req trading.GetOrderDetailRequest) (trading.GetOrderDetailResponse, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	o, err := e.lookup(req.OrderID, req.ClientOrderID)
+	if err != nil {
+		return trading.GetOrderDetailResponse{}, err
+	}
+
+	return trading.GetOrderDetailResponse{
+		Status:        o.status,
+		ExecutedBase:  o.executed,
+		ExecutedQuote: o.quote,
+	}, nil
+}
+
+func (e *Exchange) CancelOrder(req trading.CancelOrderRequest) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	o, err := e.lookup(req.OrderID, req.ClientOrderID)
+	if err != nil {
+		return err
+	}
+	if o.status != StatusNew && o.status != StatusPartial {
+		return ErrOrderClosed
+	}
+
+	o.status = StatusCanceled
+	return nil
+}
+
+func (e *Exchange) CancelAllOrders() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, o := range e.orders {
+		if o.status == StatusNew || o.status == StatusPartial {
+			o.status = StatusCanceled
+		}
+	}
+
+	return nil
+}
+
+// GetBalances returns the non-zero balances by asset. Open orders lock
+// nothing.
+func (e *Exchange) GetBalances() ([]trading.Balance, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var balances []trading.Balance
+	for asset, amount := range e.balances {
+		if !amount.IsZero() {
+			balances = append(balances, trading.Balance{Asset: asset, Free: amount})
+		}
+	}
+	sort.Slice(balances, func(i, j int) bool { return balances[i].Asset < balances[j].Asset })
+
+	return balances, nil
+}
+
+func (e *Exchange) lookup(orderID, clientOrderID string) (*simOrder, error) {
+	if orderID == "" {
+		orderID = e.clientIDs[clientOrderID]
+	}
+
+	o, ok := e.orders[orderID]
+	if !ok {
+		return nil, ErrUnknownOrder
+	}
+
+	return o, nil
+}
+
+func (e *Exchange) GetPrice(req trading.GetPriceRequest) (trading.GetPriceResponse, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	instrument := trading.NewInstrument(req.Base, req.Quote)
+	price, ok := e.prices[instrument]
+	if !ok {
+		return trading.GetPriceResponse{}, fmt.Errorf("%w for %s", ErrNoPrice, instrument)
+	}
+
+	return trading.GetPriceResponse{Price: price}, nil
+}
+
+// ListInstruments lists every instrument that has a price, with its
+// canonical name as the symbol.
+func (e *Exchange) ListInstruments() ([]trading.Listing, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	listings := make([]trading.Listing, 0, len(e.prices))
+	for instrument := range e.prices {
+		listings = append(listings, trading.Listing{
+			Instrument: instrument,
+			Symbol:     instrument.String(),
+			Tradable:   true,
+		})
+	}
+
+	return listings, nil
+}
+
+// GetKlines serves the klines set with SetKlines that open in the requested
+// range, whatever the interval.
+func (e *Exchange) GetKlines(req trading.KlinesRequest) ([]trading.Kline, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var klines []trading.Kline
+	for _, kline := range e.klines[trading.NewInstrument(req.Base, req.Quote)] {
+		if !kline.Time.Before(req.Start) && kline.Time.Before(req.End) {
+			klines = append(klines, kline)
+		}
+	}
+
+	return klines, nil
+}
+
+// StreamTrades streams the trades printed with Trade and the fills of the
+// simulated orders.
+func (e *Exchange) StreamTrades(ctx context.Context, instrument trading.Instrument) (<-chan trading.Trade, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	trades := make(chan trading.Trade, 1024)
+	e.streams[trades] = trading.NewInstrument(instrument.Base, instrument.Quote)
+
+	go func() {
+		<-ctx.Done()
+
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		delete(e.streams, trades)
+		close(trades)
+	}()
+
+	return trades, nil
+}
@@ -0,0 +1,174 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type Config struct {
+	// URL returns the address to connect to. It is called before every
+	// connection so that it can create short lived credentials such as a
+	// Binance listen key.
+	URL    func(ctx context.Context) (string, error)
+	Header http.Header
+
+	// OnConnect authenticates and subscribes on a new connection. ctx is
+	// cancelled when the connection is lost, so work tied to the connection,
+	// such as keep-alive requests, can run until then.
+	OnConnect func(ctx context.Context, conn *Conn) error
+	// OnMessage handles one message. Returning an error drops the connection
+	// and reconnects.
+	OnMessage func(data []byte) error
+	// OnError is told about every connection failure; it is optional.
+	OnError func(err error)
+
+	PingInterval time.Duration
+	// PingMessage is sent every PingInterval instead of a websocket ping frame
+	// for venues that expect an application level ping.
+	PingMessage []byte
+
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	Dialer     *websocket.Dialer
+}
+
+type Conn struct {
+	mu sync.Mutex
+	ws *websocket.Conn
+}
+
+func (c *Conn) WriteMessage(data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ws.WriteMessage(websocket.TextMessage, data)
+}
+
+func (c *Conn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return c.WriteMessage(data)
+}
+
+func (c *Conn) ping(message []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if message != nil {
+		return c.ws.WriteMessage(websocket.TextMessage, message)
+	}
+
+	return c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second))
+}
+
+// Run keeps a websocket connection open until ctx is done, reconnecting with
+// exponential backoff and running OnConnect again after every reconnect.
+func Run(ctx context.Context, config Config) {
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = time.Second
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = time.Minute
+	}
+	if config.PingInterval <= 0 {
+		config.PingInterval = 20 * time.Second
+	}
+	if config.Dialer == nil {
+		config.Dialer = websocket.DefaultDialer
+	}
+
+	backoff := config.MinBackoff
+	for {
+		connected, err := runOnce(ctx, config)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil && config.OnError != nil {
+			config.OnError(err)
+		}
+
+		if connected {
+			backoff = config.MinBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > config.MaxBackoff {
+			backoff = config.MaxBackoff
+		}
+	}
+}
+
+// runOnce serves a single connection and reports whether it got as far as
+// subscribing, which resets the backoff.
+func runOnce(ctx context.Context, config Config) (bool, error) {
+	connCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	u, err := config.URL(connCtx)
+	if err != nil {
+		return false, err
+	}
+
+	ws, _, err := config.Dialer.DialContext(connCtx, u, config.Header)
+	if err != nil {
+		return false, err
+	}
+	defer ws.Close()
+
+	conn := &Conn{ws: ws}
+
+	go func() {
+		<-connCtx.Done()
+		_ = ws.Close()
+	}()
+
+	if config.OnConnect != nil {
+		err = config.OnConnect(connCtx, conn)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(config.PingInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-connCtx.Done():
+				return
+			case <-ticker.C:
+				if conn.ping(config.PingMessage) != nil {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			return true, err
+		}
+
+		err = config.OnMessage(data)
+		if err != nil {
+			return true, err
+		}
+	}
+}
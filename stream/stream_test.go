@@ -0,0 +1,89 @@
+package stream
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRun_ReconnectAndResubscribe(t *testing.T) {
+	var connections int32
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(rw, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		n := atomic.AddInt32(&connections, 1)
+
+		_, data, err := ws.ReadMessage()
+		if err != nil || string(data) != "subscribe" {
+			return
+		}
+
+		_ = ws.WriteMessage(websocket.TextMessage, []byte("update"))
+		if n == 1 {
+			// Drop the first connection to force a reconnect.
+			return
+		}
+
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messages := make(chan string, 10)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Run(ctx, Config{
+			URL: func(context.Context) (string, error) {
+				return "ws" + strings.TrimPrefix(server.URL, "http"), nil
+			},
+			OnConnect: func(ctx context.Context, conn *Conn) error {
+				return conn.WriteMessage([]byte("subscribe"))
+			},
+			OnMessage: func(data []byte) error {
+				messages <- string(data)
+				return nil
+			},
+			MinBackoff: time.Millisecond,
+		})
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case m := <-messages:
+			if m != "update" {
+				t.Fatalf("got message %s", m)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("got %d messages", i)
+		}
+	}
+
+	if atomic.LoadInt32(&connections) != 2 {
+		t.Fatalf("got %d connections", connections)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
@@ -0,0 +1,191 @@
+package trading
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrBookNotSynced is returned while a book waits for its first snapshot or
+// for a resync after a sequence gap.
+var ErrBookNotSynced = errors.New("order book not synced")
+
+type Level struct {
+	Price decimal.Decimal `json:"price"`
+	Size  decimal.Decimal `json:"size"`
+}
+
+// Ticker is the top of an order book.
+type Ticker struct {
+	Instrument Instrument      `json:"instrument"`
+	Bid        decimal.Decimal `json:"bid"`
+	BidSize    decimal.Decimal `json:"bid_size"`
+	Ask        decimal.Decimal `json:"ask"`
+	AskSize    decimal.Decimal `json:"ask_size"`
+	Time       time.Time       `json:"time"`
+}
+
+// OrderBook is a local copy of a venue's order book that the venue's stream
+// keeps up to date. Bids are kept best (highest) first and asks best (lowest)
+// first. It is safe for concurrent use.
+type OrderBook struct {
+	instrument Instrument
+
+	mu      sync.RWMutex
+	version uint64
+	synced  bool
+	bids    []Level
+	asks    []Level
+	time    time.Time
+}
+
+func NewOrderBook(instrument Instrument) *OrderBook {
+	return &OrderBook{instrument: instrument}
+}
+
+func (b *OrderBook) Instrument() Instrument {
+	return b.instrument
+}
+
+// Reset drops every level and marks the book as not synced until the next
+// snapshot, so that readers never see a book with missing updates.
+func (b *OrderBook) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.version++
+	b.synced = false
+	b.bids = nil
+	b.asks = nil
+}
+
+// Snapshot replaces the book. Levels with a zero size are ignored.
+func (b *OrderBook) Snapshot(bids, asks []Level, t time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.version++
+	b.bids = b.bids[:0]
+	b.asks = b.asks[:0]
+	for _, level := range bids {
+		b.bids = setLevel(b.bids, level, true)
+	}
+	for _, level := range asks {
+		b.asks = setLevel(b.asks, level, false)
+	}
+	b.synced = true
+	b.time = t
+}
+
+// Update applies changed levels, where a zero size removes the level.
+func (b *OrderBook) Update(bids, asks []Level, t time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.version++
+	for _, level := range bids {
+		b.bids = setLevel(b.bids, level, true)
+	}
+	for _, level := range asks {
+		b.asks = setLevel(b.asks, level, false)
+	}
+	b.time = t
+}
+
+func setLevel(levels []Level, level Level, descending bool) []Level {
+	i := sort.Search(len(levels), func(i int) bool {
+		if descending {
+			return levels[i].Price.LessThanOrEqual(level.Price)
+		}
+		return levels[i].Price.GreaterThanOrEqual(level.Price)
+	})
+
+	found := i < len(levels) && levels[i].Price.Equal(level.Price)
+	switch {
+	case level.Size.Sign() <= 0 && found:
+		return append(levels[:i], levels[i+1:]...)
+	case level.Size.Sign() <= 0:
+		return levels
+	case found:
+		levels[i].Size = level.Size
+		return levels
+	}
+
+	levels = append(levels, Level{})
+	copy(levels[i+1:], levels[i:])
+	levels[i] = level
+	return levels
+}
+
+// Version changes with every change of the book, so that views derived from
+// it can tell whether they are stale.
+func (b *OrderBook) Version() uint64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.version
+}
+
+func (b *OrderBook) Synced() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.synced
+}
+
+// Ticker returns the best bid and ask.
+func (b *OrderBook) Ticker() (Ticker, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if !b.synced {
+		return Ticker{}, ErrBookNotSynced
+	}
+
+	ticker := Ticker{
+		Instrument: b.instrument,
+		Time:       b.time,
+	}
+	if len(b.bids) > 0 {
+		ticker.Bid = b.bids[0].Price
+		ticker.BidSize = b.bids[0].Size
+	}
+	if len(b.asks) > 0 {
+		ticker.Ask = b.asks[0].Price
+		ticker.AskSize = b.asks[0].Size
+	}
+
+	return ticker, nil
+}
+
+// Depth returns copies of up to limit levels per side; a limit of zero
+// returns the whole book.
+func (b *OrderBook) Depth(limit int) (bids, asks []Level, err error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if !b.synced {
+		return nil, nil, ErrBookNotSynced
+	}
+
+	return copyLevels(b.bids, limit), copyLevels(b.asks, limit), nil
+}
+
+func copyLevels(levels []Level, limit int) []Level {
+	if limit > 0 && len(levels) > limit {
+		levels = levels[:limit]
+	}
+
+	return append([]Level(nil), levels...)
+}
+
+// MarketDataClient maintains local order books from a venue's public market
+// data stream. The book is kept in sync, resyncing after sequence gaps and
+// reconnects, until ctx is done.
+type MarketDataClient interface {
+	SubscribeOrderBook(ctx context.Context, instrument Instrument) (*OrderBook, error)
+}
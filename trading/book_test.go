@@ -0,0 +1,74 @@
+package trading
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func level(price, size string) Level {
+	return Level{Price: decimal.RequireFromString(price), Size: decimal.RequireFromString(size)}
+}
+
+func TestOrderBook(t *testing.T) {
+	book := NewOrderBook(NewInstrument("BTC", "USDT"))
+
+	_, err := book.Ticker()
+	if !errors.Is(err, ErrBookNotSynced) {
+		t.Fatalf("got error %v before the snapshot", err)
+	}
+
+	book.Snapshot(
+		[]Level{level("99", "1"), level("100", "2"), level("98", "0")},
+		[]Level{level("102", "1"), level("101", "3")},
+		time.Now(),
+	)
+	book.Update(
+		[]Level{level("100", "0"), level("99.5", "4")},
+		[]Level{level("100.5", "1"), level("102", "5")},
+		time.Now(),
+	)
+
+	ticker, err := book.Ticker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticker.Bid.String() != "99.5" || ticker.BidSize.String() != "4" || ticker.Ask.String() != "100.5" {
+		t.Fatalf("got ticker %+v", ticker)
+	}
+
+	bids, asks, err := book.Depth(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantBids := []string{"99.5", "99"}
+	wantAsks := []string{"100.5", "101", "102"}
+	if len(bids) != len(wantBids) || len(asks) != len(wantAsks) {
+		t.Fatalf("got bids %v asks %v", bids, asks)
+	}
+	for i, price := range wantBids {
+		if bids[i].Price.String() != price {
+			t.Fatalf("got bids %v", bids)
+		}
+	}
+	for i, price := range wantAsks {
+		if asks[i].Price.String() != price {
+			t.Fatalf("got asks %v", asks)
+		}
+	}
+	if asks[2].Size.String() != "5" {
+		t.Fatalf("got ask size %s", asks[2].Size)
+	}
+
+	bids, _, _ = book.Depth(1)
+	if len(bids) != 1 {
+		t.Fatalf("got %d bids with limit 1", len(bids))
+	}
+
+	book.Reset()
+	if book.Synced() {
+		t.Fatal("book synced after reset")
+	}
+}
@@ -0,0 +1,110 @@
+package trading
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// PositionIdx selects a position of a derivatives account. Accounts in
+// one-way mode have a single position per contract; in hedge mode longs and
+// shorts are separate positions.
+type PositionIdx int
+
+const (
+	OneWayPosition PositionIdx = 0
+	LongPosition   PositionIdx = 1
+	ShortPosition  PositionIdx = 2
+)
+
+// Position is an open position in a perpetual contract. Size is positive for
+// longs and negative for shorts, in the contract's quantity unit: the base
+// asset for linear contracts and the quote currency for inverse ones.
+type Position struct {
+	Symbol           string          `json:"symbol"`
+	Instrument       Instrument      `json:"instrument"`
+	PositionIdx      PositionIdx     `json:"position_idx"`
+	Size             decimal.Decimal `json:"size"`
+	EntryPrice       decimal.Decimal `json:"entry_price"`
+	MarkPrice        decimal.Decimal `json:"mark_price"`
+	LiquidationPrice decimal.Decimal `json:"liquidation_price"`
+	Leverage         decimal.Decimal `json:"leverage"`
+	UnrealizedPnL    decimal.Decimal `json:"unrealized_pnl"`
+	MarginType       MarginType      `json:"margin_type,omitempty"`
+}
+
+type MarginType string
+
+const (
+	CrossMargin    MarginType = "cross"
+	IsolatedMargin MarginType = "isolated"
+)
+
+// GetPositionsRequest asks for the positions of one instrument, or of all
+// instruments when Base and Quote are empty.
+type GetPositionsRequest struct {
+	Base  string
+	Quote string
+}
+
+type SetLeverageRequest struct {
+	Base     string
+	Quote    string
+	Leverage decimal.Decimal
+}
+
+// FundingPayment is a funding fee settled on a position. Amount is in Asset
+// and positive when the account received it.
+type FundingPayment struct {
+	Symbol     string          `json:"symbol"`
+	Instrument Instrument      `json:"instrument"`
+	Asset      string          `json:"asset"`
+	Amount     decimal.Decimal `json:"amount"`
+	Rate       decimal.Decimal `json:"rate"`
+	Time       time.Time       `json:"time"`
+}
+
+// GetFundingHistoryRequest filters funding payments by instrument, when Base
+// and Quote are set, and by time, when Start or End are set.
+type GetFundingHistoryRequest struct {
+	Base  string
+	Quote string
+	Start time.Time
+	End   time.Time
+}
+
+// DerivativesClient is a client of a perpetual futures account. Its orders
+// are TradeRequests on the contract's instrument, e.g. BTC/USDT for the
+// linear BTCUSDT perpetual, and may be ReduceOnly.
+type DerivativesClient interface {
+	Client
+	SetLeverage(SetLeverageRequest) error
+	GetPositions(GetPositionsRequest) ([]Position, error)
+	GetFundingHistory(GetFundingHistoryRequest) ([]FundingPayment, error)
+}
+
+type SetMarginTypeRequest struct {
+	Base       string
+	Quote      string
+	MarginType MarginType
+}
+
+// MarginTypeSetter switches the position of an instrument between cross and
+// isolated margin, on venues that set it per instrument.
+type MarginTypeSetter interface {
+	SetMarginType(SetMarginTypeRequest) error
+}
+
+// QuoteSizer is implemented by clients whose order amounts are in the quote
+// asset rather than the base asset, such as Bybit inverse perpetuals whose
+// contracts are worth one USD each.
+type QuoteSizer interface {
+	QuoteSized() bool
+}
+
+// IsQuoteSized reports whether the order amounts of client are in the quote
+// asset, so that an amount is its own notional.
+func IsQuoteSized(client Client) bool {
+	sizer, ok := client.(QuoteSizer)
+	return ok && sizer.QuoteSized()
+}
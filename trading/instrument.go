@@ -0,0 +1,276 @@
+package trading
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+var ErrUnknownInstrument = errors.New("unknown instrument")
+
+// assetAliases maps venue specific asset codes to their canonical code.
+var assetAliases = map[string]string{
+	"XBT": "BTC",
+	"XDG": "DOGE",
+}
+
+func CanonicalAsset(asset string) string {
+	asset = strings.ToUpper(strings.TrimSpace(asset))
+	if canonical, ok := assetAliases[asset]; ok {
+		return canonical
+	}
+
+	return asset
+}
+
+// Instrument is a spot pair in canonical asset codes, independent of how any
+// venue spells its symbol.
+type Instrument struct {
+	Base  string `json:"base"`
+	Quote string `json:"quote"`
+}
+
+func NewInstrument(base, quote string) Instrument {
+	return Instrument{
+		Base:  CanonicalAsset(base),
+		Quote: CanonicalAsset(quote),
+	}
+}
+
+// ParseInstrument parses a canonical pair written as BASE/QUOTE or BASE-QUOTE.
+func ParseInstrument(s string) (Instrument, error) {
+	for _, sep := range []string{"/", "-", "_"} {
+		if base, quote, ok := strings.Cut(s, sep); ok && base != "" && quote != "" {
+			return NewInstrument(base, quote), nil
+		}
+	}
+
+	return Instrument{}, fmt.Errorf("invalid instrument %q, expected BASE/QUOTE", s)
+}
+
+func (i Instrument) String() string {
+	return i.Base + "/" + i.Quote
+}
+
+// Listing is one instrument as listed by a venue. Zero increments mean the
+// venue did not report any and amounts are passed through unrounded.
+type Listing struct {
+	Instrument     Instrument      `json:"instrument"`
+	Symbol         string          `json:"symbol"`
+	Tradable       bool            `json:"tradable"`
+	BaseIncrement  decimal.Decimal `json:"base_increment"`
+	QuoteIncrement decimal.Decimal `json:"quote_increment"`
+	PriceIncrement decimal.Decimal `json:"price_increment"`
+	MinBase        decimal.Decimal `json:"min_base"`
+}
+
+// FormatBase rounds a base amount down to the venue's base increment and
+// formats it for the venue, failing for non-positive amounts and amounts below
+// the venue's minimum.
+func (l Listing) FormatBase(amount decimal.Decimal) (string, error) {
+	return formatAmount(l.Instrument.Base, amount, l.BaseIncrement, l.MinBase)
+}
+
+// FormatQuote is FormatBase for amounts in the quote asset.
+func (l Listing) FormatQuote(amount decimal.Decimal) (string, error) {
+	return formatAmount(l.Instrument.Quote, amount, l.QuoteIncrement, decimal.Zero)
+}
+
+// FormatPrice rounds a stop price down to the venue's tick size. Limit prices
+// go through FormatLimitPrice.
+func (l Listing) FormatPrice(price decimal.Decimal) (string, error) {
+	return formatAmount(l.Instrument.Quote, price, l.PriceIncrement, decimal.Zero)
+}
+
+// FormatLimitPrice rounds a limit price to the venue's tick size in the
+// order's favour, down for buys and up for sells, so that an off-tick limit
+// never fills at a worse price than asked.
+func (l Listing) FormatLimitPrice(price decimal.Decimal, sell bool) (string, error) {
+	if sell {
+		price = RoundUp(price, l.PriceIncrement)
+	}
+
+	return formatAmount(l.Instrument.Quote, price, l.PriceIncrement, decimal.Zero)
+}
+
+func formatAmount(asset string, amount, increment, min decimal.Decimal) (string, error) {
+	if !amount.IsPositive() {
+		return "", fmt.Errorf("%s amount must be positive, got %s", asset, amount)
+	}
+
+	rounded := RoundDown(amount, increment)
+	if !rounded.IsPositive() {
+		return "", fmt.Errorf("%s amount %s is below the increment %s", asset, amount, increment)
+	}
+	if rounded.LessThan(min) {
+		return "", fmt.Errorf("%s amount %s is below the minimum %s", asset, rounded, min)
+	}
+
+	if increment.IsPositive() {
+		return rounded.StringFixed(decimalPlaces(increment)), nil
+	}
+
+	return rounded.String(), nil
+}
+
+// decimalPlaces counts the significant decimal places of d, so that a venue
+// increment written as 0.00010000 yields 4.
+func decimalPlaces(d decimal.Decimal) int32 {
+	s := d.String()
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		return int32(len(s) - i - 1)
+	}
+
+	return 0
+}
+
+// RoundDown rounds amount down to a multiple of increment. A zero increment
+// leaves amount unchanged.
+func RoundDown(amount, increment decimal.Decimal) decimal.Decimal {
+	if !increment.IsPositive() {
+		return amount
+	}
+
+	return amount.Div(increment).Floor().Mul(increment)
+}
+
+// RoundUp is RoundDown rounding up.
+func RoundUp(amount, increment decimal.Decimal) decimal.Decimal {
+	if !increment.IsPositive() {
+		return amount
+	}
+
+	return amount.Div(increment).Ceil().Mul(increment)
+}
+
+type InstrumentLister interface {
+	ListInstruments() ([]Listing, error)
+}
+
+// Instruments is the mapping table between canonical instruments and the
+// symbols of one venue. It is loaded lazily from the venue's instrument listing
+// and reloaded once it is older than ttl.
+type Instruments struct {
+	load func() ([]Listing, error)
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu           sync.Mutex
+	loadedAt     time.Time
+	listings     []Listing
+	byInstrument map[Instrument]Listing
+	bySymbol     map[string]Listing
+}
+
+func NewInstruments(load func() ([]Listing, error), ttl time.Duration) *Instruments {
+	return &Instruments{
+		load: load,
+		ttl:  ttl,
+		now:  time.Now,
+	}
+}
+
+func (t *Instruments) refresh() error {
+	if t.listings != nil && t.now().Sub(t.loadedAt) < t.ttl {
+		return nil
+	}
+
+	listings, err := t.load()
+	if err != nil {
+		if t.listings != nil {
+			// Keep serving the previous table rather than failing every order
+			// because the listing endpoint is briefly unavailable.
+			return nil
+		}
+		return fmt.Errorf("load instruments: %w", err)
+	}
+
+	byInstrument := make(map[Instrument]Listing, len(listings))
+	bySymbol := make(map[string]Listing, len(listings))
+	for _, listing := range listings {
+		byInstrument[listing.Instrument] = listing
+		bySymbol[strings.ToUpper(listing.Symbol)] = listing
+	}
+
+	t.listings = listings
+	t.byInstrument = byInstrument
+	t.bySymbol = bySymbol
+	t.loadedAt = t.now()
+	return nil
+}
+
+func (t *Instruments) List() ([]Listing, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	err := t.refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]Listing(nil), t.listings...), nil
+}
+
+func (t *Instruments) Lookup(instrument Instrument) (Listing, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	err := t.refresh()
+	if err != nil {
+		return Listing{}, err
+	}
+
+	instrument = NewInstrument(instrument.Base, instrument.Quote)
+	listing, ok := t.byInstrument[instrument]
+	if !ok {
+		return Listing{}, fmt.Errorf("%w %s", ErrUnknownInstrument, instrument)
+	}
+
+	return listing, nil
+}
+
+func (t *Instruments) LookupSymbol(symbol string) (Listing, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	err := t.refresh()
+	if err != nil {
+		return Listing{}, err
+	}
+
+	listing, ok := t.bySymbol[strings.ToUpper(symbol)]
+	if !ok {
+		return Listing{}, fmt.Errorf("%w symbol %s", ErrUnknownInstrument, symbol)
+	}
+
+	return listing, nil
+}
+
+// Symbol returns the venue symbol of instrument, failing for instruments the
+// venue does not list.
+func (t *Instruments) Symbol(instrument Instrument) (string, error) {
+	listing, err := t.Lookup(instrument)
+	if err != nil {
+		return "", err
+	}
+
+	return listing.Symbol, nil
+}
+
+// Tradable is Lookup for placing orders, which additionally fails for listed
+// instruments whose trading is halted.
+func (t *Instruments) Tradable(instrument Instrument) (Listing, error) {
+	listing, err := t.Lookup(instrument)
+	if err != nil {
+		return Listing{}, err
+	}
+	if !listing.Tradable {
+		return Listing{}, fmt.Errorf("instrument %s is not tradable", listing.Instrument)
+	}
+
+	return listing, nil
+}
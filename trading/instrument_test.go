@@ -0,0 +1,176 @@
+package trading
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestParseInstrument(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Instrument
+	}{
+		{"btc/usdt", Instrument{Base: "BTC", Quote: "USDT"}},
+		{"XBT-USD", Instrument{Base: "BTC", Quote: "USD"}},
+		{"ETH_BTC", Instrument{Base: "ETH", Quote: "BTC"}},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseInstrument(tt.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Fatalf("got %v for %s", got, tt.s)
+		}
+	}
+
+	_, err := ParseInstrument("BTCUSDT")
+	if err == nil {
+		t.Fatal("expected error for pair without separator")
+	}
+}
+
+func TestInstruments(t *testing.T) {
+	loads := 0
+	var loadErr error
+	instruments := NewInstruments(func() ([]Listing, error) {
+		loads++
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		return []Listing{
+			{Instrument: NewInstrument("XBT", "USD"), Symbol: "XBTUSD", Tradable: true},
+			{Instrument: NewInstrument("LUNA", "USDT"), Symbol: "LUNAUSDT", Tradable: false},
+		}, nil
+	}, time.Minute)
+
+	now := time.Now()
+	instruments.now = func() time.Time { return now }
+
+	tradable, err := instruments.Tradable(NewInstrument("BTC", "USD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tradable.Symbol != "XBTUSD" {
+		t.Fatalf("got symbol %s", tradable.Symbol)
+	}
+
+	_, err = instruments.Symbol(NewInstrument("BTC", "USDT"))
+	if !errors.Is(err, ErrUnknownInstrument) {
+		t.Fatalf("got error %v", err)
+	}
+
+	_, err = instruments.Tradable(NewInstrument("LUNA", "USDT"))
+	if err == nil {
+		t.Fatal("expected error for halted instrument")
+	}
+
+	listing, err := instruments.LookupSymbol("xbtusd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listing.Instrument != NewInstrument("BTC", "USD") {
+		t.Fatalf("got listing %+v", listing)
+	}
+
+	if loads != 1 {
+		t.Fatalf("got %d loads before ttl", loads)
+	}
+
+	now = now.Add(2 * time.Minute)
+	loadErr = errors.New("unavailable")
+	_, err = instruments.Symbol(NewInstrument("BTC", "USD"))
+	if err != nil {
+		t.Fatalf("stale table not kept on load failure: %v", err)
+	}
+	if loads != 2 {
+		t.Fatalf("got %d loads after ttl", loads)
+	}
+}
+
+func TestInstruments_LoadFailure(t *testing.T) {
+	instruments := NewInstruments(func() ([]Listing, error) {
+		return nil, errors.New("unavailable")
+	}, time.Minute)
+
+	_, err := instruments.Symbol(NewInstrument("BTC", "USD"))
+	if err == nil {
+		t.Fatal("expected error when the listing never loaded")
+	}
+}
+
+func TestListing_FormatBase(t *testing.T) {
+	listing := Listing{
+		Instrument:    NewInstrument("BTC", "USDT"),
+		BaseIncrement: decimal.RequireFromString("0.00010"),
+		MinBase:       decimal.RequireFromString("0.001"),
+	}
+
+	tests := []struct {
+		amount string
+		want   string
+		err    bool
+	}{
+		{amount: "0.12345", want: "0.1234"},
+		{amount: "1", want: "1.0000"},
+		{amount: "0.00099", err: true},
+		{amount: "0", err: true},
+		{amount: "-1", err: true},
+	}
+
+	for _, tt := range tests {
+		got, err := listing.FormatBase(decimal.RequireFromString(tt.amount))
+		if tt.err {
+			if err == nil {
+				t.Fatalf("expected error for %s, got %s", tt.amount, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Fatalf("got %s for %s", got, tt.amount)
+		}
+	}
+
+	got, err := Listing{}.FormatBase(decimal.RequireFromString("0.123456789"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "0.123456789" {
+		t.Fatalf("got %s without increment", got)
+	}
+}
+
+func TestListing_FormatLimitPrice(t *testing.T) {
+	listing := Listing{
+		Instrument:     NewInstrument("BTC", "USDT"),
+		PriceIncrement: decimal.RequireFromString("0.10"),
+	}
+
+	tests := []struct {
+		price string
+		sell  bool
+		want  string
+	}{
+		{price: "60000.05", want: "60000.0"},
+		{price: "60000.05", sell: true, want: "60000.1"},
+		{price: "60000.1", sell: true, want: "60000.1"},
+		{price: "0.01", sell: true, want: "0.1"},
+	}
+
+	for _, tt := range tests {
+		got, err := listing.FormatLimitPrice(decimal.RequireFromString(tt.price), tt.sell)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Fatalf("got %s for %s with sell %v", got, tt.price, tt.sell)
+		}
+	}
+}
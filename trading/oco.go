@@ -0,0 +1,71 @@
+package trading
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// OCOLeg is one order of an OCO: a limit order at Price, a stop order
+// triggering at StopPrice, or a stop-limit order with both.
+type OCOLeg struct {
+	Price         decimal.Decimal
+	StopPrice     decimal.Decimal
+	ClientOrderID string
+}
+
+// OCORequest places two orders of Amount on the same side, one above and one
+// below the market, and the venue cancels the other once either executes.
+// The stop order is on the side the price moves against the order: below
+// for sells, above for buys; the other leg is a take-profit.
+type OCORequest struct {
+	Side          string
+	Base          string
+	Quote         string
+	Amount        decimal.Decimal
+	Above         OCOLeg
+	Below         OCOLeg
+	ClientOrderID string
+}
+
+func (r OCORequest) Validate() error {
+	var stop OCOLeg
+	var stopSide string
+	switch strings.ToLower(r.Side) {
+	case "sell":
+		stop, stopSide = r.Below, "below"
+	case "buy":
+		stop, stopSide = r.Above, "above"
+	default:
+		return fmt.Errorf("unknown side %q", r.Side)
+	}
+
+	if !r.Amount.IsPositive() {
+		return fmt.Errorf("amount must be positive, got %s", r.Amount)
+	}
+	for _, leg := range []OCOLeg{r.Above, r.Below} {
+		if leg.Price.IsNegative() || leg.StopPrice.IsNegative() || (leg.Price.IsZero() && leg.StopPrice.IsZero()) {
+			return errors.New("each leg needs a positive price or stop price")
+		}
+	}
+	if !stop.StopPrice.IsPositive() {
+		return fmt.Errorf("the %s leg of a %s oco needs a stop price", stopSide, strings.ToLower(r.Side))
+	}
+
+	return nil
+}
+
+// OCOResponse identifies the order list on the venue and its two orders.
+type OCOResponse struct {
+	ListID string
+	Above  TradeResponse
+	Below  TradeResponse
+}
+
+// OCOPlacer places OCOs natively; adapters that implement it report
+// OCOOrders in their Capabilities.
+type OCOPlacer interface {
+	PlaceOCO(OCORequest) (OCOResponse, error)
+}
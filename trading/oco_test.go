@@ -0,0 +1,37 @@
+package trading
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestOCORequest_Validate(t *testing.T) {
+	one := decimal.NewFromInt(1)
+	tests := []struct {
+		req  OCORequest
+		want string
+	}{
+		{OCORequest{Side: "sell", Amount: one, Above: OCOLeg{Price: decimal.NewFromInt(120)}, Below: OCOLeg{StopPrice: decimal.NewFromInt(90)}}, ""},
+		{OCORequest{Side: "buy", Amount: one, Above: OCOLeg{StopPrice: decimal.NewFromInt(110)}, Below: OCOLeg{Price: decimal.NewFromInt(90)}}, ""},
+		{OCORequest{Side: "buy", Amount: one, Above: OCOLeg{Price: decimal.NewFromInt(110)}, Below: OCOLeg{StopPrice: decimal.NewFromInt(90)}}, "above leg of a buy oco"},
+		{OCORequest{Side: "sell", Amount: one, Above: OCOLeg{}, Below: OCOLeg{StopPrice: decimal.NewFromInt(90)}}, "each leg"},
+		{OCORequest{Side: "short", Amount: one}, "unknown side"},
+		{OCORequest{Side: "sell"}, "amount"},
+	}
+	for _, tt := range tests {
+		err := tt.req.Validate()
+		if (tt.want == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("%+v: got %v, want %q", tt.req, err, tt.want)
+		}
+	}
+
+	stop := TradeRequest{Amount: one, StopPrice: decimal.NewFromInt(90), StopDirection: "sideways"}
+	if err := stop.Validate(); err == nil {
+		t.Error("accepted an unknown stop direction")
+	}
+	if err := (TradeRequest{Amount: one, StopDirection: StopRising}).Validate(); err == nil {
+		t.Error("accepted a stop direction without a stop price")
+	}
+}
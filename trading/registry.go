@@ -0,0 +1,274 @@
+package trading
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const DefaultAccount = "default"
+
+var ErrUnknownAccount = errors.New("unknown account")
+
+// Capabilities are what an adapter supports natively. StopOrders are stop
+// orders with a limit price, StopMarketOrders those without; the venues
+// without them are left to client-side triggers. QuoteSizeOrders take market
+// orders sized by TradeRequest.QuoteAmount. Derivatives adapters can
+// open perpetual futures accounts, whose clients are DerivativesClients.
+type Capabilities struct {
+	Spot             bool `json:"spot"`
+	Derivatives      bool `json:"derivatives"`
+	LimitOrders      bool `json:"limit_orders"`
+	QuoteSizeOrders  bool `json:"quote_size_orders"`
+	StopOrders       bool `json:"stop_orders"`
+	StopMarketOrders bool `json:"stop_market_orders"`
+	OCOOrders        bool `json:"oco_orders"`
+	WebSocket        bool `json:"websocket"`
+	OrderBook        bool `json:"order_book"`
+	Klines           bool `json:"klines"`
+	Trades           bool `json:"trades"`
+}
+
+// AdapterConfig is the exchange agnostic configuration handed to an adapter
+// factory, which turns it into its own Config.
+type AdapterConfig struct {
+	URL           string
+	StreamURL     string
+	MarketDataURL string
+	APIKey        string
+	APISecret     string
+	// Category picks the product of adapters that trade several, such as
+	// "spot", "linear" or "inverse" on Bybit. Empty means spot.
+	Category   string
+	HTTPClient *http.Client
+}
+
+type Factory func(AdapterConfig) (Client, error)
+
+type Adapter struct {
+	Name         string
+	Capabilities Capabilities
+	Factory      Factory
+}
+
+var (
+	adaptersMu sync.RWMutex
+	adapters   = make(map[string]Adapter)
+)
+
+// RegisterAdapter makes an exchange adapter available by name. Adapter
+// packages call it from init, so importing an adapter is enough to use it.
+func RegisterAdapter(adapter Adapter) {
+	adaptersMu.Lock()
+	defer adaptersMu.Unlock()
+
+	name := strings.ToLower(adapter.Name)
+	if _, ok := adapters[name]; ok {
+		panic(fmt.Sprintf("trading: adapter %s registered twice", name))
+	}
+	adapters[name] = adapter
+}
+
+func LookupAdapter(name string) (Adapter, bool) {
+	adaptersMu.RLock()
+	defer adaptersMu.RUnlock()
+
+	adapter, ok := adapters[strings.ToLower(name)]
+	return adapter, ok
+}
+
+func Adapters() []Adapter {
+	adaptersMu.RLock()
+	defer adaptersMu.RUnlock()
+
+	list := make([]Adapter, 0, len(adapters))
+	for _, adapter := range adapters {
+		list = append(list, adapter)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	return list
+}
+
+// ParseAccount splits an account name such as "binance:hedge" into its
+// exchange and account. A bare exchange name refers to its default account.
+func ParseAccount(name string) (string, string) {
+	exchange, account, ok := strings.Cut(strings.ToLower(strings.TrimSpace(name)), ":")
+	if !ok || account == "" {
+		return exchange, DefaultAccount
+	}
+
+	return exchange, account
+}
+
+// AccountName returns the canonical "exchange:account" form of name.
+func AccountName(name string) string {
+	exchange, account := ParseAccount(name)
+	return exchange + ":" + account
+}
+
+type Account struct {
+	Name         string
+	Exchange     string
+	Capabilities Capabilities
+	Client       Client
+}
+
+// Registry maps account names to clients. Several accounts may use the same
+// exchange adapter, e.g. "binance:main" and "binance:hedge".
+type Registry struct {
+	mu        sync.RWMutex
+	accounts  map[string]Account
+	listeners []AccountListener
+}
+
+// AccountListener is called with an account whose client was set.
+type AccountListener func(Account)
+
+func NewRegistry() *Registry {
+	return &Registry{
+		accounts: make(map[string]Account),
+	}
+}
+
+// Open builds a client for the account with the adapter of its exchange and
+// registers it, replacing any previous client of that account.
+func (r *Registry) Open(name string, config AdapterConfig) error {
+	exchange, _ := ParseAccount(name)
+
+	adapter, ok := LookupAdapter(exchange)
+	if !ok {
+		return fmt.Errorf("no adapter registered for exchange %s", exchange)
+	}
+
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+
+	client, err := adapter.Factory(config)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", AccountName(name), err)
+	}
+
+	r.set(name, client, adapter.Capabilities)
+	return nil
+}
+
+// Set registers an already built client under name with the capabilities of
+// its exchange adapter, if any.
+func (r *Registry) Set(name string, client Client) {
+	exchange, _ := ParseAccount(name)
+	adapter, _ := LookupAdapter(exchange)
+
+	r.set(name, client, adapter.Capabilities)
+}
+
+func (r *Registry) set(name string, client Client, capabilities Capabilities) {
+	exchange, _ := ParseAccount(name)
+
+	account := Account{
+		Name:         AccountName(name),
+		Exchange:     exchange,
+		Capabilities: capabilities,
+		Client:       client,
+	}
+
+	r.mu.Lock()
+	r.accounts[account.Name] = account
+	listeners := append([]AccountListener(nil), r.listeners...)
+	r.mu.Unlock()
+
+	for _, l := range listeners {
+		l(account)
+	}
+}
+
+// OnChange calls l with every account whose client is set or replaced from
+// now on, such as when rotated credentials reopen it.
+func (r *Registry) OnChange(l AccountListener) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.listeners = append(r.listeners, l)
+}
+
+func (r *Registry) Remove(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.accounts, AccountName(name))
+}
+
+func (r *Registry) Account(name string) (Account, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	account, ok := r.accounts[AccountName(name)]
+	if !ok {
+		return Account{}, fmt.Errorf("%w %s", ErrUnknownAccount, AccountName(name))
+	}
+
+	return account, nil
+}
+
+func (r *Registry) Client(name string) (Client, bool) {
+	account, err := r.Account(name)
+	if err != nil {
+		return nil, false
+	}
+
+	return account.Client, true
+}
+
+func (r *Registry) Accounts() []Account {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]Account, 0, len(r.accounts))
+	for _, account := range r.accounts {
+		list = append(list, account)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	return list
+}
+
+type AccountListing struct {
+	Account string `json:"account"`
+	Symbol  string `json:"symbol"`
+}
+
+// Listings returns the accounts whose venue lists instrument, with the venue
+// symbol. Accounts whose client cannot list instruments or whose listing fails
+// to load are skipped.
+func (r *Registry) Listings(instrument Instrument) []AccountListing {
+	instrument = NewInstrument(instrument.Base, instrument.Quote)
+
+	var listings []AccountListing
+	for _, account := range r.Accounts() {
+		lister, ok := account.Client.(InstrumentLister)
+		if !ok {
+			continue
+		}
+
+		all, err := lister.ListInstruments()
+		if err != nil {
+			continue
+		}
+
+		for _, listing := range all {
+			if listing.Instrument == instrument {
+				listings = append(listings, AccountListing{
+					Account: account.Name,
+					Symbol:  listing.Symbol,
+				})
+				break
+			}
+		}
+	}
+
+	return listings
+}
@@ -0,0 +1,91 @@
+package trading
+
+import (
+	"errors"
+	"testing"
+)
+
+type nopClient struct {
+	config AdapterConfig
+}
+
+func (c *nopClient) Sell(SellRequest) (SellResponse, error) {
+	return SellResponse{}, nil
+}
+
+func (c *nopClient) Buy(BuyRequest) (BuyResponse, error) {
+	return BuyResponse{}, nil
+}
+
+func (c *nopClient) GetOrderDetail(GetOrderDetailRequest) (GetOrderDetailResponse, error) {
+	return GetOrderDetailResponse{}, nil
+}
+
+func init() {
+	RegisterAdapter(Adapter{
+		Name:         "test",
+		Capabilities: Capabilities{Spot: true, LimitOrders: true},
+		Factory: func(config AdapterConfig) (Client, error) {
+			return &nopClient{config: config}, nil
+		},
+	})
+}
+
+func TestParseAccount(t *testing.T) {
+	tests := []struct {
+		name     string
+		exchange string
+		account  string
+	}{
+		{"binance", "binance", DefaultAccount},
+		{"Binance:Hedge", "binance", "hedge"},
+		{"bybit:", "bybit", DefaultAccount},
+	}
+
+	for _, tt := range tests {
+		exchange, account := ParseAccount(tt.name)
+		if exchange != tt.exchange || account != tt.account {
+			t.Fatalf("got %s:%s for %s", exchange, account, tt.name)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+
+	err := registry.Open("test:main", AdapterConfig{APIKey: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = registry.Open("test:hedge", AdapterConfig{APIKey: "hedge"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = registry.Open("unknown", AdapterConfig{})
+	if err == nil {
+		t.Fatal("expected error for unknown adapter")
+	}
+
+	client, ok := registry.Client("TEST:hedge")
+	if !ok || client.(*nopClient).config.APIKey != "hedge" {
+		t.Fatalf("got client %v", client)
+	}
+
+	account, err := registry.Account("test:main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Exchange != "test" || !account.Capabilities.LimitOrders {
+		t.Fatalf("got account %+v", account)
+	}
+
+	_, err = registry.Account("test")
+	if !errors.Is(err, ErrUnknownAccount) {
+		t.Fatalf("got error %v", err)
+	}
+
+	if len(registry.Accounts()) != 2 {
+		t.Fatalf("got accounts %+v", registry.Accounts())
+	}
+}
@@ -0,0 +1,34 @@
+package trading
+
+import (
+	"context"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// OrderUpdate is a change of one of the account's orders pushed by a venue.
+// ExecutedBase and ExecutedQuote are cumulative; LastBase and LastPrice
+// describe the fill that caused the update, if any. Venues that report fills
+// separately from order changes send fill-only updates with an empty Status
+// and zero cumulative amounts.
+type OrderUpdate struct {
+	Symbol        string          `json:"symbol"`
+	Instrument    Instrument      `json:"instrument"`
+	OrderID       string          `json:"order_id"`
+	ClientOrderID string          `json:"client_order_id"`
+	Side          string          `json:"side"`
+	Status        string          `json:"status"`
+	ExecutedBase  decimal.Decimal `json:"executed_base"`
+	ExecutedQuote decimal.Decimal `json:"executed_quote"`
+	LastBase      decimal.Decimal `json:"last_base"`
+	LastPrice     decimal.Decimal `json:"last_price"`
+	Time          time.Time       `json:"time"`
+}
+
+// OrderStreamer streams order updates of the account. The returned channel is
+// closed once ctx is done; connection losses are handled by reconnecting and
+// resubscribing, so updates may be delivered more than once.
+type OrderStreamer interface {
+	StreamOrderUpdates(ctx context.Context) (<-chan OrderUpdate, error)
+}
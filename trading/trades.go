@@ -0,0 +1,81 @@
+package trading
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+var ErrUnsupportedInterval = errors.New("unsupported kline interval")
+
+// Kline is a candle opening at Time; Volume is in the base asset.
+type Kline struct {
+	Time   time.Time       `json:"time"`
+	Open   decimal.Decimal `json:"open"`
+	High   decimal.Decimal `json:"high"`
+	Low    decimal.Decimal `json:"low"`
+	Close  decimal.Decimal `json:"close"`
+	Volume decimal.Decimal `json:"volume"`
+}
+
+// KlinesRequest asks for the klines opening in [Start, End).
+type KlinesRequest struct {
+	Base     string
+	Quote    string
+	Interval time.Duration
+	Start    time.Time
+	End      time.Time
+}
+
+// KlineClient serves a venue's historical candles, oldest first. Venues
+// only support some intervals and fail with ErrUnsupportedInterval for the
+// others.
+type KlineClient interface {
+	GetKlines(KlinesRequest) ([]Kline, error)
+}
+
+// Trade is a public trade of an instrument on a venue.
+type Trade struct {
+	Instrument Instrument      `json:"instrument"`
+	Price      decimal.Decimal `json:"price"`
+	Size       decimal.Decimal `json:"size"`
+	Time       time.Time       `json:"time"`
+}
+
+// TradeStreamer streams the public trades of an instrument. The returned
+// channel is closed once ctx is done; trades made while the stream
+// reconnects are missed.
+type TradeStreamer interface {
+	StreamTrades(ctx context.Context, instrument Instrument) (<-chan Trade, error)
+}
+
+// PageKlines serves a KlinesRequest from a venue endpoint that returns at
+// most limit klines per call, oldest first, for the klines opening in
+// [start, end).
+func PageKlines(req KlinesRequest, limit int, page func(start, end time.Time) ([]Kline, error)) ([]Kline, error) {
+	var klines []Kline
+
+	start := req.Start
+	for start.Before(req.End) {
+		end := start.Add(time.Duration(limit) * req.Interval)
+		if end.After(req.End) {
+			end = req.End
+		}
+
+		list, err := page(start, end)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, kline := range list {
+			if !kline.Time.Before(start) && kline.Time.Before(end) {
+				klines = append(klines, kline)
+			}
+		}
+		start = end
+	}
+
+	return klines, nil
+}
@@ -1,5 +1,12 @@
 package trading
 
+import (
+	"errors"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
 type Client interface {
 	Sell(SellRequest) (SellResponse, error)
 	Buy(BuyRequest) (BuyResponse, error)
@@ -22,13 +29,125 @@ type BuyResponse struct {
 	TradeResponse
 }
 
+type OrderType string
+
+const (
+	OrderTypeMarket OrderType = "market"
+	OrderTypeLimit  OrderType = "limit"
+)
+
+type TimeInForce string
+
+const (
+	GoodTillCanceled  TimeInForce = "GTC"
+	ImmediateOrCancel TimeInForce = "IOC"
+)
+
+// StopDirection is the way the last price has to cross the stop price of a
+// stop order for it to trigger.
+type StopDirection string
+
+const (
+	StopRising  StopDirection = "rising"
+	StopFalling StopDirection = "falling"
+)
+
+// TradeRequest is a market order unless Type is OrderTypeLimit, in which case
+// Price is required and the order rests until canceled, or is canceled right
+// away for whatever does not fill if TimeInForce is ImmediateOrCancel.
+//
+// A StopPrice makes it a stop order the venue holds until the last price
+// rises to or falls to StopPrice, as StopDirection says, and then places. A
+// sell stop falling below the market is a stop-loss, one rising above it a
+// take-profit. Venues that support stop orders report StopOrders in their
+// Capabilities.
+//
+// A market order may give QuoteAmount, the quote asset to spend or to
+// receive, instead of Amount. Venues that take it report QuoteSizeOrders in
+// their Capabilities.
+//
+// ReduceOnly and PositionIdx only apply to derivatives accounts: a
+// reduce-only order can only shrink a position, and PositionIdx picks the
+// position in hedge mode, see PositionIdx.
 type TradeRequest struct {
 	Base          string
 	Quote         string
-	Amount        string
+	Amount        decimal.Decimal
+	QuoteAmount   decimal.Decimal
+	Type          OrderType
+	Price         decimal.Decimal
+	TimeInForce   TimeInForce
+	StopPrice     decimal.Decimal
+	StopDirection StopDirection
+	ReduceOnly    bool
+	PositionIdx   PositionIdx
 	ClientOrderID string
 }
 
+func (r TradeRequest) IsStop() bool {
+	return !r.StopPrice.IsZero()
+}
+
+func (r TradeRequest) IsLimit() bool {
+	return r.Type == OrderTypeLimit
+}
+
+func (r TradeRequest) IsQuoteSized() bool {
+	return !r.QuoteAmount.IsZero()
+}
+
+// Validate checks the order type fields; amounts are checked against the
+// venue's listing by the adapter.
+func (r TradeRequest) Validate() error {
+	if r.IsStop() {
+		if !r.StopPrice.IsPositive() {
+			return fmt.Errorf("stop price must be positive, got %s", r.StopPrice)
+		}
+		if r.StopDirection != StopRising && r.StopDirection != StopFalling {
+			return fmt.Errorf("unknown stop direction %q", r.StopDirection)
+		}
+	} else if r.StopDirection != "" {
+		return errors.New("stop direction without a stop price")
+	}
+
+	if r.IsQuoteSized() {
+		if !r.QuoteAmount.IsPositive() {
+			return fmt.Errorf("quote amount must be positive, got %s", r.QuoteAmount)
+		}
+		if !r.Amount.IsZero() {
+			return errors.New("an order has either an amount or a quote amount")
+		}
+		if r.IsLimit() || r.IsStop() {
+			return errors.New("only market orders can have a quote amount")
+		}
+	}
+
+	switch r.PositionIdx {
+	case OneWayPosition, LongPosition, ShortPosition:
+	default:
+		return fmt.Errorf("unknown position index %d", r.PositionIdx)
+	}
+
+	switch r.Type {
+	case "", OrderTypeMarket:
+		return nil
+	case OrderTypeLimit:
+	default:
+		return fmt.Errorf("unknown order type %q", r.Type)
+	}
+
+	if !r.Price.IsPositive() {
+		return fmt.Errorf("limit price must be positive, got %s", r.Price)
+	}
+
+	switch r.TimeInForce {
+	case "", GoodTillCanceled, ImmediateOrCancel:
+		return nil
+	}
+
+	return fmt.Errorf("unknown time in force %q", r.TimeInForce)
+}
+
 type TradeResponse struct {
 	OrderID string
 }
@@ -41,7 +160,51 @@ type GetOrderDetailRequest struct {
 }
 
 type GetOrderDetailResponse struct {
-	Status        string
-	ExecutedBase  string
-	ExecutedQuote string
+	Status        string          `json:"status"`
+	ExecutedBase  decimal.Decimal `json:"executed_base"`
+	ExecutedQuote decimal.Decimal `json:"executed_quote"`
+}
+
+type PriceClient interface {
+	GetPrice(GetPriceRequest) (GetPriceResponse, error)
+}
+
+type GetPriceRequest struct {
+	Base  string
+	Quote string
+}
+
+type GetPriceResponse struct {
+	Price decimal.Decimal
+}
+
+type CancelOrderRequest struct {
+	Base          string
+	Quote         string
+	OrderID       string
+	ClientOrderID string
+}
+
+// Canceler cancels open orders. The order's final status comes through the
+// usual order updates; canceling an order that already ended fails.
+type Canceler interface {
+	CancelOrder(CancelOrderRequest) error
+}
+
+// CancelAller cancels every open order of the account, on all instruments.
+type CancelAller interface {
+	CancelAllOrders() error
+}
+
+// Balance is what the account holds of an asset. Locked is held by open
+// orders.
+type Balance struct {
+	Asset  string          `json:"asset"`
+	Free   decimal.Decimal `json:"free"`
+	Locked decimal.Decimal `json:"locked"`
+}
+
+// BalanceClient reports the balances of the account, omitting empty ones.
+type BalanceClient interface {
+	GetBalances() ([]Balance, error)
 }
@@ -0,0 +1,105 @@
+package webhook
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"trading-aggregator/accounting"
+	"trading-aggregator/auth"
+	"trading-aggregator/portfolio"
+)
+
+// export answers the fills of the accounts the key may trade on as tax lots
+// or trades in one of the accounting.Format. The from and to query
+// parameters, dates or RFC 3339 times, bound the rows to [from, to); method
+// and fiat override the configured lot matching method and currency.
+func (w *Webhook) export(rw http.ResponseWriter, r *http.Request) {
+	key, _ := auth.KeyFromContext(r.Context())
+	if !key.CanRead() {
+		writeError(rw, http.StatusForbidden, auth.ErrForbidden)
+		return
+	}
+
+	format := accounting.Format(mux.Vars(r)["format"])
+	err := format.Validate()
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	query := r.URL.Query()
+	from, err := parseTime(query.Get("from"), time.Time{})
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+	to, err := parseTime(query.Get("to"), time.Now().UTC())
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	method := accounting.Method(query.Get("method"))
+	if method == "" {
+		method = w.config.Accounting.Method
+	}
+	fiat := query.Get("fiat")
+	if fiat == "" {
+		fiat = w.config.Accounting.Fiat
+	}
+
+	orders, err := w.tracker.Store().List()
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+
+	var fills []portfolio.Fill
+	for _, fill := range portfolio.SpotFills(orders, w.registry) {
+		if key.AuthorizeExchange(fill.Account) == nil {
+			fills = append(fills, fill)
+		}
+	}
+
+	// Lots acquired before from are the cost basis of later disposals, so
+	// the lots are built from every fill before the rows are bounded.
+	report, err := accounting.Build(fills, fiat, method, w.valuer)
+	if err != nil {
+		status := http.StatusBadGateway
+		if method.Validate() != nil {
+			status = http.StatusBadRequest
+		}
+		writeError(rw, status, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	err = accounting.Export(&buf, format, report.Between(from, to))
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "text/csv")
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(buf.Bytes())
+}
+
+func parseTime(s string, fallback time.Time) (time.Time, error) {
+	if s == "" {
+		return fallback, nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q, want a date or an RFC 3339 time", s)
+}
@@ -0,0 +1,232 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/algo"
+	"trading-aggregator/auth"
+	"trading-aggregator/order"
+	"trading-aggregator/risk"
+	"trading-aggregator/trading"
+)
+
+// algoRequest turns an order into a parent order worked by an execution
+// algorithm. Durations use Go's syntax, e.g. "30m". TWAP and VWAP spread the
+// parent over duration in slices, VWAP following the volume profile of the
+// last days; POV trades rate of the market's volume, checking every interval.
+// Iceberg works a limit order, whose price is the limit, showing display of
+// it at a time and, with a peg, resting near the market.
+type algoRequest struct {
+	Type        string            `json:"type"`
+	Duration    string            `json:"duration"`
+	Slices      int               `json:"slices"`
+	Jitter      float64           `json:"jitter"`
+	Days        int               `json:"days"`
+	Rate        decimal.Decimal   `json:"rate"`
+	Interval    string            `json:"interval"`
+	ChildType   trading.OrderType `json:"child_type"`
+	LimitOffset decimal.Decimal   `json:"limit_offset"`
+	Display     decimal.Decimal   `json:"display"`
+	Peg         *pegRequest       `json:"peg"`
+}
+
+type pegRequest struct {
+	Offset    decimal.Decimal `json:"offset"`
+	Threshold decimal.Decimal `json:"threshold"`
+}
+
+func (r algoRequest) interval() (time.Duration, error) {
+	if r.Interval == "" {
+		return 10 * time.Second, nil
+	}
+
+	interval, err := time.ParseDuration(r.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("invalid interval: %w", err)
+	}
+
+	return interval, nil
+}
+
+func (r algoRequest) algorithm(limit decimal.Decimal) (algo.Algorithm, error) {
+	switch strings.ToLower(r.Type) {
+	case "twap":
+		duration, err := time.ParseDuration(r.Duration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration: %w", err)
+		}
+
+		return algo.NewTWAP(duration, r.Slices, r.Jitter)
+	case "vwap":
+		duration, err := time.ParseDuration(r.Duration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration: %w", err)
+		}
+
+		days := r.Days
+		if days == 0 {
+			days = 7
+		}
+
+		return algo.NewVWAP(duration, r.Slices, days)
+	case "pov":
+		interval, err := r.interval()
+		if err != nil {
+			return nil, err
+		}
+
+		return algo.NewPOV(r.Rate, interval)
+	case "iceberg":
+		interval, err := r.interval()
+		if err != nil {
+			return nil, err
+		}
+
+		var peg *algo.Peg
+		if r.Peg != nil {
+			peg = &algo.Peg{Offset: r.Peg.Offset, Threshold: r.Peg.Threshold}
+		}
+
+		return algo.NewIceberg(limit, r.Display, peg, interval)
+	}
+
+	return nil, fmt.Errorf("unknown algorithm %q", r.Type)
+}
+
+// startAlgo reserves the whole parent with the risk engine, which lets its
+// children through as they are placed.
+func (w *Webhook) startAlgo(req placeOrderRequest, keyID string, client trading.Client) (order.Order, int, error) {
+	iceberg := strings.EqualFold(req.Algo.Type, "iceberg")
+	switch {
+	case iceberg && (req.Type != trading.OrderTypeLimit || req.TimeInForce != ""):
+		return order.Order{}, http.StatusBadRequest, errors.New("iceberg orders are limit orders without a time in force")
+	case !iceberg && (req.Type != "" || req.Price.IsPositive()):
+		return order.Order{}, http.StatusBadRequest, errors.New("algorithmic orders set the order type of their children in algo")
+	}
+
+	algorithm, err := req.Algo.algorithm(req.Price)
+	if err != nil {
+		return order.Order{}, http.StatusBadRequest, err
+	}
+
+	if (iceberg || req.Algo.ChildType == trading.OrderTypeLimit) && !w.supportsLimitOrders(req.Exchange) {
+		return order.Order{}, http.StatusBadRequest, fmt.Errorf("%s does not support limit orders", req.Exchange)
+	}
+
+	err = w.risk.Reserve(risk.Order{
+		Key:           keyID,
+		Account:       req.Exchange,
+		Side:          strings.ToLower(req.Side),
+		Base:          req.Base,
+		Quote:         req.Quote,
+		Amount:        req.Amount,
+		Price:         req.Price,
+		ClientOrderID: req.ClientOrderID,
+	}, client)
+	if err != nil {
+		return order.Order{}, clientErrorStatus(err), err
+	}
+
+	o, err := w.algos.Start(order.Order{
+		ID:            uuid.NewString(),
+		Exchange:      req.Exchange,
+		Side:          strings.ToLower(req.Side),
+		Base:          req.Base,
+		Quote:         req.Quote,
+		Amount:        req.Amount,
+		Type:          req.Type,
+		Price:         req.Price,
+		ClientOrderID: req.ClientOrderID,
+		CallbackURL:   req.CallbackURL,
+	}, algorithm, algo.Child{
+		Type:        req.Algo.ChildType,
+		LimitOffset: req.Algo.LimitOffset,
+	})
+	if err != nil {
+		w.risk.Release(req.Exchange, req.ClientOrderID)
+		return order.Order{}, http.StatusBadRequest, err
+	}
+
+	return o, http.StatusCreated, nil
+}
+
+// readableOrder looks up the order in the route for a key that may read it,
+// answering 404 for orders of exchanges the key has no access to.
+func (w *Webhook) readableOrder(rw http.ResponseWriter, r *http.Request) (order.Order, auth.Key, bool) {
+	key, _ := auth.KeyFromContext(r.Context())
+
+	o, err := w.tracker.Store().Get(mux.Vars(r)["id"])
+	if errors.Is(err, order.ErrNotFound) || (err == nil && (!key.CanRead() || key.AuthorizeExchange(o.Exchange) != nil)) {
+		writeError(rw, http.StatusNotFound, order.ErrNotFound)
+		return order.Order{}, key, false
+	}
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err)
+		return order.Order{}, key, false
+	}
+
+	return o, key, true
+}
+
+func (w *Webhook) listChildren(rw http.ResponseWriter, r *http.Request) {
+	parent, _, ok := w.readableOrder(rw, r)
+	if !ok {
+		return
+	}
+
+	orders, err := w.tracker.Store().List()
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+
+	children := []order.Order{}
+	for _, o := range orders {
+		if o.ParentID == parent.ID {
+			children = append(children, o)
+		}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].CreatedAt.Before(children[j].CreatedAt)
+	})
+
+	writeJSON(rw, http.StatusOK, children)
+}
+
+// controlAlgo pauses, resumes or cancels a running parent order. The change
+// is applied asynchronously, so the response is the parent as it was.
+func (w *Webhook) controlAlgo(control func(id string) error) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		o, key, ok := w.readableOrder(rw, r)
+		if !ok {
+			return
+		}
+
+		err := key.AuthorizeTrade(o.Exchange, o.Side, o.Base, o.Quote)
+		if err != nil {
+			writeError(rw, http.StatusForbidden, err)
+			return
+		}
+
+		err = control(o.ID)
+		if errors.Is(err, algo.ErrNotRunning) {
+			writeError(rw, http.StatusConflict, err)
+			return
+		}
+		if err != nil {
+			writeError(rw, http.StatusInternalServerError, err)
+			return
+		}
+
+		writeJSON(rw, http.StatusAccepted, o)
+	}
+}
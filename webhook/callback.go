@@ -0,0 +1,174 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"trading-aggregator/order"
+)
+
+const (
+	SignatureHeader = "X-Aggregator-Signature"
+	TimestampHeader = "X-Aggregator-Timestamp"
+	OrderIDHeader   = "X-Aggregator-Order-Id"
+)
+
+type CallbackConfig struct {
+	Secret     string
+	MaxRetries int
+	Backoff    time.Duration
+	DeadLetter io.Writer
+}
+
+// Notifier POSTs the order detail of terminal orders to their callback URL.
+// Deliveries that still fail after MaxRetries are appended to the dead-letter
+// log as one JSON object per line.
+type Notifier struct {
+	config     CallbackConfig
+	httpClient *http.Client
+	wg         sync.WaitGroup
+	mu         sync.Mutex
+}
+
+type deadLetter struct {
+	Order    order.Order `json:"order"`
+	Attempts int         `json:"attempts"`
+	Error    string      `json:"error"`
+	FailedAt time.Time   `json:"failed_at"`
+}
+
+func NewNotifier(config CallbackConfig, httpClient *http.Client) *Notifier {
+	if config.MaxRetries <= 0 {
+		config.MaxRetries = 5
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = time.Second
+	}
+
+	return &Notifier{
+		config:     config,
+		httpClient: httpClient,
+	}
+}
+
+func (n *Notifier) Notify(o order.Order) {
+	if o.CallbackURL == "" {
+		return
+	}
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		n.deliver(o)
+	}()
+}
+
+func (n *Notifier) Wait() {
+	n.wg.Wait()
+}
+
+func (n *Notifier) deliver(o order.Order) {
+	body, err := json.Marshal(o.Detail)
+	if err != nil {
+		n.deadLetter(o, 0, err)
+		return
+	}
+
+	backoff := n.config.Backoff
+	for attempt := 1; ; attempt++ {
+		err = n.post(o, body)
+		if err == nil {
+			return
+		}
+
+		if attempt > n.config.MaxRetries {
+			n.deadLetter(o, attempt, err)
+			return
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (n *Notifier) post(o order.Order, body []byte) error {
+	timestamp := strconv.FormatInt(time.Now().UTC().Unix(), 10)
+
+	httpReq, err := http.NewRequest(http.MethodPost, o.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(OrderIDHeader, o.ID)
+	httpReq.Header.Set(TimestampHeader, timestamp)
+	httpReq.Header.Set(SignatureHeader, Sign(n.config.Secret, timestamp, body))
+
+	res, err := n.httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	resBody, _ := io.ReadAll(res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("get http response code %d and body %s", res.StatusCode, resBody)
+	}
+
+	return nil
+}
+
+func (n *Notifier) deadLetter(o order.Order, attempts int, cause error) {
+	if n.config.DeadLetter == nil {
+		return
+	}
+
+	line, err := json.Marshal(deadLetter{
+		Order:    o,
+		Attempts: attempts,
+		Error:    cause.Error(),
+		FailedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, _ = n.config.DeadLetter.Write(append(line, '\n'))
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of timestamp followed by body, which
+// receivers recompute to verify a callback.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func validateCallbackURL(callbackURL string) error {
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("callback url must be http or https, got %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("callback url %q has no host", callbackURL)
+	}
+
+	return nil
+}
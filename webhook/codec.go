@@ -0,0 +1,29 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// decodeJSON decodes a request body into v. Amounts are decimal.Decimal, which
+// decodes JSON strings and numbers alike from their literal text, and any
+// number decoded into an untyped field is kept as a json.Number, so amounts
+// never pass through float64. Responses encode decimals as JSON strings.
+func decodeJSON(body []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	err := decoder.Decode(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = decoder.Token()
+	if !errors.Is(err, io.EOF) {
+		return errors.New("unexpected data after JSON body")
+	}
+
+	return nil
+}
@@ -0,0 +1,229 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/auth"
+	"trading-aggregator/conditional"
+	"trading-aggregator/trading"
+)
+
+type triggerRequest struct {
+	Exchange     string           `json:"exchange"`
+	Side         string           `json:"side"`
+	Base         string           `json:"base"`
+	Quote        string           `json:"quote"`
+	Amount       decimal.Decimal  `json:"amount"`
+	Kind         conditional.Kind `json:"kind"`
+	TriggerPrice decimal.Decimal  `json:"trigger_price"`
+	TrailAmount  decimal.Decimal  `json:"trail_amount"`
+	TrailPercent decimal.Decimal  `json:"trail_percent"`
+	LimitPrice   decimal.Decimal  `json:"limit_price"`
+}
+
+type ocoRequest struct {
+	Legs []triggerRequest `json:"legs"`
+}
+
+// placeTrigger places the order of a trigger that was hit with the
+// permissions its key has at that time.
+func (w *Webhook) placeTrigger(t conditional.Trigger) (string, error) {
+	key, ok := w.auth.Key(t.KeyID)
+	if !ok {
+		return "", fmt.Errorf("api key %s no longer exists", t.KeyID)
+	}
+
+	req := placeOrderRequest{
+		Exchange: t.Exchange,
+		Side:     t.Side,
+		Base:     t.Base,
+		Quote:    t.Quote,
+		Amount:   t.Amount,
+	}
+	if t.LimitPrice.IsPositive() {
+		req.Type = trading.OrderTypeLimit
+		req.Price = t.LimitPrice
+	}
+
+	o, _, err := w.submit(req, &key)
+	return o.ID, err
+}
+
+// trigger authorizes a trigger request for key, which will place its order.
+func (w *Webhook) trigger(key auth.Key, req triggerRequest) (conditional.Trigger, int, error) {
+	req.Exchange = trading.AccountName(req.Exchange)
+	if _, ok := w.registry.Client(req.Exchange); !ok {
+		return conditional.Trigger{}, http.StatusBadRequest, fmt.Errorf("unknown exchange %q", req.Exchange)
+	}
+
+	err := key.AuthorizeTrade(req.Exchange, req.Side, req.Base, req.Quote)
+	if err != nil {
+		return conditional.Trigger{}, http.StatusForbidden, err
+	}
+
+	return conditional.Trigger{
+		KeyID:        key.ID,
+		Exchange:     req.Exchange,
+		Side:         req.Side,
+		Base:         req.Base,
+		Quote:        req.Quote,
+		Amount:       req.Amount,
+		Kind:         req.Kind,
+		TriggerPrice: req.TriggerPrice,
+		TrailAmount:  req.TrailAmount,
+		TrailPercent: req.TrailPercent,
+		LimitPrice:   req.LimitPrice,
+	}, http.StatusOK, nil
+}
+
+func (w *Webhook) createTrigger(rw http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	var req triggerRequest
+	err = decodeJSON(body, &req)
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	key, _ := auth.KeyFromContext(r.Context())
+	t, status, err := w.trigger(key, req)
+	if err != nil {
+		writeError(rw, status, err)
+		return
+	}
+
+	t, err = w.triggers.Create(t)
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	writeJSON(rw, http.StatusCreated, t)
+}
+
+// createOCO creates two triggers that cancel each other, e.g. a stop-loss
+// and a take-profit on the same position.
+func (w *Webhook) createOCO(rw http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	var req ocoRequest
+	err = decodeJSON(body, &req)
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+	if len(req.Legs) != 2 {
+		writeError(rw, http.StatusBadRequest, fmt.Errorf("an oco has 2 legs, got %d", len(req.Legs)))
+		return
+	}
+
+	key, _ := auth.KeyFromContext(r.Context())
+	legs := make([]conditional.Trigger, len(req.Legs))
+	for i, leg := range req.Legs {
+		var status int
+		legs[i], status, err = w.trigger(key, leg)
+		if err != nil {
+			writeError(rw, status, err)
+			return
+		}
+	}
+
+	legs, err = w.triggers.CreateOCO(legs[0], legs[1])
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	writeJSON(rw, http.StatusCreated, legs)
+}
+
+// listTriggers lists the triggers of the accounts the key has access to.
+func (w *Webhook) listTriggers(rw http.ResponseWriter, r *http.Request) {
+	key, _ := auth.KeyFromContext(r.Context())
+	if !key.CanRead() {
+		writeError(rw, http.StatusForbidden, auth.ErrForbidden)
+		return
+	}
+
+	triggers, err := w.triggers.List()
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+
+	readable := []conditional.Trigger{}
+	for _, t := range triggers {
+		if key.AuthorizeExchange(t.Exchange) == nil {
+			readable = append(readable, t)
+		}
+	}
+
+	writeJSON(rw, http.StatusOK, readable)
+}
+
+func (w *Webhook) getTrigger(rw http.ResponseWriter, r *http.Request) {
+	t, _, ok := w.readableTrigger(rw, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, t)
+}
+
+// cancelTrigger cancels a pending trigger and the rest of its OCO group,
+// which only the key that created it or an admin key may do.
+func (w *Webhook) cancelTrigger(rw http.ResponseWriter, r *http.Request) {
+	t, key, ok := w.readableTrigger(rw, r)
+	if !ok {
+		return
+	}
+	if t.KeyID != key.ID && !key.IsAdmin() {
+		writeError(rw, http.StatusForbidden, auth.ErrForbidden)
+		return
+	}
+
+	t, err := w.triggers.Cancel(t.ID)
+	if errors.Is(err, conditional.ErrNotPending) {
+		writeError(rw, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, t)
+}
+
+// readableTrigger looks up the trigger in the route for a key that may read
+// it, answering 404 for triggers of accounts the key has no access to.
+func (w *Webhook) readableTrigger(rw http.ResponseWriter, r *http.Request) (conditional.Trigger, auth.Key, bool) {
+	key, _ := auth.KeyFromContext(r.Context())
+
+	t, err := w.triggers.Get(mux.Vars(r)["id"])
+	if errors.Is(err, conditional.ErrNotFound) || (err == nil && (!key.CanRead() || key.AuthorizeExchange(t.Exchange) != nil)) {
+		writeError(rw, http.StatusNotFound, conditional.ErrNotFound)
+		return conditional.Trigger{}, key, false
+	}
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err)
+		return conditional.Trigger{}, key, false
+	}
+
+	return t, key, true
+}
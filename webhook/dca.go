@@ -0,0 +1,211 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/auth"
+	"trading-aggregator/dca"
+	"trading-aggregator/trading"
+)
+
+type createPlanRequest struct {
+	Exchange    string          `json:"exchange"`
+	Base        string          `json:"base"`
+	Quote       string          `json:"quote"`
+	QuoteAmount decimal.Decimal `json:"quote_amount"`
+	Schedule    string          `json:"schedule"`
+	CatchUp     dca.CatchUp     `json:"catch_up"`
+}
+
+// executePlan buys the quote amount of a plan, with the permissions its key
+// has at the time of the run. The amount it returns is the base amount at the
+// last price.
+func (w *Webhook) executePlan(plan dca.Plan) (string, decimal.Decimal, error) {
+	key, ok := w.auth.Key(plan.KeyID)
+	if !ok {
+		return "", decimal.Zero, fmt.Errorf("api key %s no longer exists", plan.KeyID)
+	}
+
+	client, ok := w.registry.Client(plan.Exchange)
+	if !ok {
+		return "", decimal.Zero, fmt.Errorf("unknown exchange %q", plan.Exchange)
+	}
+	priceClient, ok := client.(trading.PriceClient)
+	if !ok {
+		return "", decimal.Zero, fmt.Errorf("%s does not quote prices", plan.Exchange)
+	}
+
+	res, err := priceClient.GetPrice(trading.GetPriceRequest{Base: plan.Base, Quote: plan.Quote})
+	if err != nil {
+		return "", decimal.Zero, err
+	}
+	if !res.Price.IsPositive() {
+		return "", decimal.Zero, fmt.Errorf("%s has no %s/%s price", plan.Exchange, plan.Base, plan.Quote)
+	}
+
+	// Venues that take quote sized buys spend exactly the quote amount;
+	// elsewhere it is converted at the last price.
+	amount := plan.QuoteAmount.Div(res.Price)
+	req := placeOrderRequest{
+		Exchange: plan.Exchange,
+		Side:     "buy",
+		Base:     plan.Base,
+		Quote:    plan.Quote,
+		Amount:   amount,
+	}
+	if w.supportsQuoteSizeOrders(plan.Exchange) {
+		req.Amount = decimal.Zero
+		req.QuoteAmount = plan.QuoteAmount
+	}
+	o, _, err := w.submit(req, &key)
+
+	return o.ID, amount, err
+}
+
+func (w *Webhook) createPlan(rw http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	var req createPlanRequest
+	err = decodeJSON(body, &req)
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	req.Exchange = trading.AccountName(req.Exchange)
+	if _, ok := w.registry.Client(req.Exchange); !ok {
+		writeError(rw, http.StatusBadRequest, fmt.Errorf("unknown exchange %q", req.Exchange))
+		return
+	}
+
+	key, _ := auth.KeyFromContext(r.Context())
+	err = key.AuthorizeTrade(req.Exchange, "buy", req.Base, req.Quote)
+	if err != nil {
+		writeError(rw, http.StatusForbidden, err)
+		return
+	}
+
+	plan, err := w.dca.Create(dca.Plan{
+		KeyID:       key.ID,
+		Exchange:    req.Exchange,
+		Base:        req.Base,
+		Quote:       req.Quote,
+		QuoteAmount: req.QuoteAmount,
+		Schedule:    req.Schedule,
+		CatchUp:     req.CatchUp,
+	})
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	writeJSON(rw, http.StatusCreated, plan)
+}
+
+// listPlans lists the plans of the accounts the key has access to.
+func (w *Webhook) listPlans(rw http.ResponseWriter, r *http.Request) {
+	key, _ := auth.KeyFromContext(r.Context())
+	if !key.CanRead() {
+		writeError(rw, http.StatusForbidden, auth.ErrForbidden)
+		return
+	}
+
+	plans, err := w.dca.List()
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+
+	readable := []dca.Plan{}
+	for _, plan := range plans {
+		if key.AuthorizeExchange(plan.Exchange) == nil {
+			readable = append(readable, plan)
+		}
+	}
+
+	writeJSON(rw, http.StatusOK, readable)
+}
+
+func (w *Webhook) getPlan(rw http.ResponseWriter, r *http.Request) {
+	plan, _, ok := w.readablePlan(rw, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, plan)
+}
+
+// controlPlan pauses or resumes a plan, which only the key that created it
+// or an admin key may do.
+func (w *Webhook) controlPlan(control func(id string) (dca.Plan, error)) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		plan, ok := w.ownPlan(rw, r)
+		if !ok {
+			return
+		}
+
+		plan, err := control(plan.ID)
+		if err != nil {
+			writeError(rw, http.StatusInternalServerError, err)
+			return
+		}
+
+		writeJSON(rw, http.StatusOK, plan)
+	}
+}
+
+func (w *Webhook) deletePlan(rw http.ResponseWriter, r *http.Request) {
+	plan, ok := w.ownPlan(rw, r)
+	if !ok {
+		return
+	}
+
+	err := w.dca.Delete(plan.ID)
+	if err != nil && !errors.Is(err, dca.ErrNotFound) {
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, plan)
+}
+
+// readablePlan looks up the plan in the route for a key that may read it,
+// answering 404 for plans of accounts the key has no access to.
+func (w *Webhook) readablePlan(rw http.ResponseWriter, r *http.Request) (dca.Plan, auth.Key, bool) {
+	key, _ := auth.KeyFromContext(r.Context())
+
+	plan, err := w.dca.Get(mux.Vars(r)["id"])
+	if errors.Is(err, dca.ErrNotFound) || (err == nil && (!key.CanRead() || key.AuthorizeExchange(plan.Exchange) != nil)) {
+		writeError(rw, http.StatusNotFound, dca.ErrNotFound)
+		return dca.Plan{}, key, false
+	}
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err)
+		return dca.Plan{}, key, false
+	}
+
+	return plan, key, true
+}
+
+func (w *Webhook) ownPlan(rw http.ResponseWriter, r *http.Request) (dca.Plan, bool) {
+	plan, key, ok := w.readablePlan(rw, r)
+	if !ok {
+		return dca.Plan{}, false
+	}
+	if plan.KeyID != key.ID && !key.IsAdmin() {
+		writeError(rw, http.StatusForbidden, auth.ErrForbidden)
+		return dca.Plan{}, false
+	}
+
+	return plan, true
+}
@@ -0,0 +1,202 @@
+package webhook
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/auth"
+	"trading-aggregator/trading"
+)
+
+type setLeverageRequest struct {
+	Base     string          `json:"base"`
+	Quote    string          `json:"quote"`
+	Leverage decimal.Decimal `json:"leverage"`
+}
+
+type setMarginTypeRequest struct {
+	Base       string             `json:"base"`
+	Quote      string             `json:"quote"`
+	MarginType trading.MarginType `json:"margin_type"`
+}
+
+// listDerivativesPositions lists the positions the venue reports for a
+// derivatives account, optionally of the instrument in ?base= and ?quote=.
+func (w *Webhook) listDerivativesPositions(rw http.ResponseWriter, r *http.Request) {
+	client, _, ok := w.derivativesAccount(rw, r)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	positions, err := client.GetPositions(trading.GetPositionsRequest{Base: q.Get("base"), Quote: q.Get("quote")})
+	if err != nil {
+		writeError(rw, clientErrorStatus(err), err)
+		return
+	}
+	if positions == nil {
+		positions = []trading.Position{}
+	}
+
+	writeJSON(rw, http.StatusOK, positions)
+}
+
+// listFunding lists the funding payments of a derivatives account, filtered
+// by ?base=, ?quote= and the RFC 3339 times ?start= and ?end=.
+func (w *Webhook) listFunding(rw http.ResponseWriter, r *http.Request) {
+	client, _, ok := w.derivativesAccount(rw, r)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	req := trading.GetFundingHistoryRequest{Base: q.Get("base"), Quote: q.Get("quote")}
+	for name, t := range map[string]*time.Time{"start": &req.Start, "end": &req.End} {
+		s := q.Get(name)
+		if s == "" {
+			continue
+		}
+
+		var err error
+		*t, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			writeError(rw, http.StatusBadRequest, fmt.Errorf("invalid %s %q", name, s))
+			return
+		}
+	}
+
+	payments, err := client.GetFundingHistory(req)
+	if err != nil {
+		writeError(rw, clientErrorStatus(err), err)
+		return
+	}
+	if payments == nil {
+		payments = []trading.FundingPayment{}
+	}
+
+	writeJSON(rw, http.StatusOK, payments)
+}
+
+// setLeverage sets the leverage of an instrument, which a key that may trade
+// it either way may do.
+func (w *Webhook) setLeverage(rw http.ResponseWriter, r *http.Request) {
+	client, account, ok := w.derivativesAccount(rw, r)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	var req setLeverageRequest
+	err = decodeJSON(body, &req)
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	if !w.authorizeInstrumentSetting(rw, r, account, req.Base, req.Quote) {
+		return
+	}
+
+	err = client.SetLeverage(trading.SetLeverageRequest{Base: req.Base, Quote: req.Quote, Leverage: req.Leverage})
+	if err != nil {
+		writeError(rw, clientErrorStatus(err), err)
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, req)
+}
+
+// setMarginType switches an instrument between cross and isolated margin on
+// venues that support it, authorized like setLeverage.
+func (w *Webhook) setMarginType(rw http.ResponseWriter, r *http.Request) {
+	client, account, ok := w.derivativesAccount(rw, r)
+	if !ok {
+		return
+	}
+
+	setter, ok := client.(trading.MarginTypeSetter)
+	if !ok {
+		writeError(rw, http.StatusBadRequest, fmt.Errorf("%s does not support changing the margin type", account))
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	var req setMarginTypeRequest
+	err = decodeJSON(body, &req)
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+	if req.MarginType != trading.CrossMargin && req.MarginType != trading.IsolatedMargin {
+		writeError(rw, http.StatusBadRequest, fmt.Errorf("invalid margin_type %q", req.MarginType))
+		return
+	}
+
+	if !w.authorizeInstrumentSetting(rw, r, account, req.Base, req.Quote) {
+		return
+	}
+
+	err = setter.SetMarginType(trading.SetMarginTypeRequest{Base: req.Base, Quote: req.Quote, MarginType: req.MarginType})
+	if err != nil {
+		writeError(rw, clientErrorStatus(err), err)
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, req)
+}
+
+// authorizeInstrumentSetting allows changing how an instrument trades while
+// the kill switch is off and for a key that may trade it either way.
+func (w *Webhook) authorizeInstrumentSetting(rw http.ResponseWriter, r *http.Request, account, base, quote string) bool {
+	err := w.kill.Check()
+	if err != nil {
+		writeError(rw, http.StatusServiceUnavailable, err)
+		return false
+	}
+
+	key, _ := auth.KeyFromContext(r.Context())
+	err = key.AuthorizeTrade(account, "buy", base, quote)
+	if err != nil && key.AuthorizeTrade(account, "sell", base, quote) != nil {
+		writeError(rw, http.StatusForbidden, err)
+		return false
+	}
+
+	return true
+}
+
+// derivativesAccount looks up the account in the route for a key that may
+// read it, answering 404 for accounts the key has no access to and 400 for
+// accounts that are not derivatives accounts.
+func (w *Webhook) derivativesAccount(rw http.ResponseWriter, r *http.Request) (trading.DerivativesClient, string, bool) {
+	key, _ := auth.KeyFromContext(r.Context())
+
+	account := trading.AccountName(mux.Vars(r)["account"])
+	client, ok := w.registry.Client(account)
+	if !ok || !key.CanRead() || key.AuthorizeExchange(account) != nil {
+		writeError(rw, http.StatusNotFound, fmt.Errorf("%w %s", trading.ErrUnknownAccount, account))
+		return nil, "", false
+	}
+
+	derivatives, ok := client.(trading.DerivativesClient)
+	if !ok {
+		writeError(rw, http.StatusBadRequest, fmt.Errorf("%s is not a derivatives account", account))
+		return nil, "", false
+	}
+
+	return derivatives, account, true
+}
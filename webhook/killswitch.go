@@ -0,0 +1,111 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"trading-aggregator/auth"
+	"trading-aggregator/killswitch"
+	"trading-aggregator/risk"
+)
+
+type KillSwitchConfig struct {
+	// FlattenTo is the asset positions are sold into when flattening.
+	FlattenTo string
+	// Flatten makes the triggers without a say of their own, signals and
+	// risk breaches, flatten positions too.
+	Flatten bool
+	// OnBreach names the risk checks, see risk.Checks, whose rejections
+	// engage the kill switch.
+	OnBreach []string
+}
+
+type killRequest struct {
+	Reason  string `json:"reason"`
+	Flatten *bool  `json:"flatten"`
+}
+
+// KillSwitch is the switch that stops the service from trading, for triggers
+// outside of the API such as signals.
+func (w *Webhook) KillSwitch() *killswitch.Switch {
+	return w.kill
+}
+
+// Kill engages the kill switch with the configured flattening.
+func (w *Webhook) Kill(reason string) (killswitch.Report, error) {
+	return w.kill.Engage(reason, w.config.KillSwitch.Flatten)
+}
+
+// breach engages the kill switch when a rejection is one of the configured
+// breaches.
+func (w *Webhook) breach(o risk.Order, rejection *risk.Rejection) {
+	for _, name := range w.config.KillSwitch.OnBreach {
+		if errors.Is(rejection, risk.Checks[name]) {
+			_, _ = w.Kill(fmt.Sprintf("risk breach: %v", rejection))
+			return
+		}
+	}
+}
+
+func (w *Webhook) getKillSwitch(rw http.ResponseWriter, r *http.Request) {
+	key, _ := auth.KeyFromContext(r.Context())
+	if !key.CanRead() {
+		writeError(rw, http.StatusForbidden, auth.ErrForbidden)
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, w.kill.State())
+}
+
+// engageKillSwitch blocks new orders and cancels every open one. The body is
+// optional; flatten defaults to the configured flattening.
+func (w *Webhook) engageKillSwitch(rw http.ResponseWriter, r *http.Request) {
+	key, _ := auth.KeyFromContext(r.Context())
+	if !key.IsAdmin() {
+		writeError(rw, http.StatusForbidden, auth.ErrForbidden)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	var req killRequest
+	if len(body) > 0 {
+		err = decodeJSON(body, &req)
+		if err != nil {
+			writeError(rw, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if req.Reason == "" {
+		req.Reason = "engaged by key " + key.ID
+	}
+	flatten := w.config.KillSwitch.Flatten
+	if req.Flatten != nil {
+		flatten = *req.Flatten
+	}
+
+	report, err := w.kill.Engage(req.Reason, flatten)
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, report)
+}
+
+func (w *Webhook) releaseKillSwitch(rw http.ResponseWriter, r *http.Request) {
+	key, _ := auth.KeyFromContext(r.Context())
+	if !key.IsAdmin() {
+		writeError(rw, http.StatusForbidden, auth.ErrForbidden)
+		return
+	}
+
+	w.kill.Release()
+	writeJSON(rw, http.StatusOK, w.kill.State())
+}
@@ -0,0 +1,188 @@
+package webhook
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/auth"
+	"trading-aggregator/order"
+	"trading-aggregator/risk"
+	"trading-aggregator/trading"
+)
+
+type ocoLegRequest struct {
+	Price     decimal.Decimal `json:"price"`
+	StopPrice decimal.Decimal `json:"stop_price"`
+}
+
+type placeOCORequest struct {
+	Exchange      string          `json:"exchange"`
+	Side          string          `json:"side"`
+	Base          string          `json:"base"`
+	Quote         string          `json:"quote"`
+	Amount        decimal.Decimal `json:"amount"`
+	Above         ocoLegRequest   `json:"above"`
+	Below         ocoLegRequest   `json:"below"`
+	ClientOrderID string          `json:"client_order_id"`
+	CallbackURL   string          `json:"callback_url"`
+}
+
+// placeOCO places an OCO on an exchange that supports them natively and
+// tracks its legs as two orders sharing a list ID. Exchanges without native
+// OCOs are left to /triggers/oco.
+func (w *Webhook) placeOCO(rw http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	var req placeOCORequest
+	err = decodeJSON(body, &req)
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	key, _ := auth.KeyFromContext(r.Context())
+	orders, status, err := w.submitOCO(req, key)
+	if err != nil {
+		writeError(rw, status, err)
+		return
+	}
+
+	writeJSON(rw, http.StatusCreated, orders)
+}
+
+func (w *Webhook) submitOCO(req placeOCORequest, key auth.Key) ([]order.Order, int, error) {
+	err := w.kill.Check()
+	if err != nil {
+		return nil, http.StatusServiceUnavailable, err
+	}
+
+	req.Exchange = trading.AccountName(req.Exchange)
+	client, ok := w.registry.Client(req.Exchange)
+	if !ok {
+		return nil, http.StatusBadRequest, fmt.Errorf("unknown exchange %q", req.Exchange)
+	}
+
+	account, err := w.registry.Account(req.Exchange)
+	placer, ok := client.(trading.OCOPlacer)
+	if err != nil || !account.Capabilities.OCOOrders || !ok {
+		return nil, http.StatusBadRequest, fmt.Errorf("%s does not support native oco orders, use /triggers/oco instead", req.Exchange)
+	}
+
+	ocoRequest := trading.OCORequest{
+		Side:          req.Side,
+		Base:          req.Base,
+		Quote:         req.Quote,
+		Amount:        req.Amount,
+		Above:         trading.OCOLeg{Price: req.Above.Price, StopPrice: req.Above.StopPrice, ClientOrderID: uuid.NewString()},
+		Below:         trading.OCOLeg{Price: req.Below.Price, StopPrice: req.Below.StopPrice, ClientOrderID: uuid.NewString()},
+		ClientOrderID: req.ClientOrderID,
+	}
+	err = ocoRequest.Validate()
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	// Either leg may execute, so each is authorized on its own.
+	legs := []trading.OCOLeg{ocoRequest.Above, ocoRequest.Below}
+	for _, leg := range legs {
+		status, err := authorizeTrade(key, client, placeOrderRequest{
+			Exchange:  req.Exchange,
+			Side:      req.Side,
+			Base:      req.Base,
+			Quote:     req.Quote,
+			Amount:    req.Amount,
+			Price:     leg.Price,
+			StopPrice: leg.StopPrice,
+		})
+		if err != nil {
+			return nil, status, err
+		}
+	}
+
+	if req.CallbackURL != "" {
+		err := validateCallbackURL(req.CallbackURL)
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+	}
+
+	release := func() {
+		for _, leg := range legs {
+			w.risk.Release(req.Exchange, leg.ClientOrderID)
+		}
+	}
+	// Only one leg can execute, so the legs share one reservation.
+	riskOrders := make([]risk.Order, 0, len(legs))
+	for _, leg := range legs {
+		riskOrders = append(riskOrders, risk.Order{
+			Key:           key.ID,
+			Account:       req.Exchange,
+			Side:          strings.ToLower(req.Side),
+			Base:          req.Base,
+			Quote:         req.Quote,
+			Amount:        req.Amount,
+			Price:         leg.Price,
+			StopPrice:     leg.StopPrice,
+			ClientOrderID: leg.ClientOrderID,
+		})
+	}
+	err = w.risk.ReserveOCO(riskOrders, client)
+	if err != nil {
+		return nil, clientErrorStatus(err), err
+	}
+
+	res, err := placer.PlaceOCO(ocoRequest)
+	if err != nil {
+		release()
+		return nil, clientErrorStatus(err), err
+	}
+
+	now := time.Now().UTC()
+	orders := make([]order.Order, 0, len(legs))
+	for i, placed := range []trading.TradeResponse{res.Above, res.Below} {
+		leg := legs[i]
+		o := order.Order{
+			ID:            uuid.NewString(),
+			Exchange:      req.Exchange,
+			Side:          strings.ToLower(req.Side),
+			Base:          req.Base,
+			Quote:         req.Quote,
+			Amount:        req.Amount,
+			Price:         leg.Price,
+			StopPrice:     leg.StopPrice,
+			ClientOrderID: leg.ClientOrderID,
+			OrderID:       placed.OrderID,
+			ListID:        res.ListID,
+			CallbackURL:   req.CallbackURL,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		if leg.Price.IsPositive() {
+			o.Type = trading.OrderTypeLimit
+		}
+		if leg.StopPrice.IsPositive() {
+			o.StopDirection = trading.StopFalling
+			if i == 0 {
+				o.StopDirection = trading.StopRising
+			}
+		}
+
+		err = w.tracker.Store().Save(o)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		orders = append(orders, o)
+	}
+
+	return orders, http.StatusCreated, nil
+}
@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"net/http"
+
+	"trading-aggregator/auth"
+	"trading-aggregator/portfolio"
+	"trading-aggregator/trading"
+)
+
+type positionsResponse struct {
+	Positions []portfolio.Position `json:"positions"`
+	Totals    []portfolio.Position `json:"totals"`
+}
+
+// Portfolio is the position tracker, for reporting drift outside of the API.
+func (w *Webhook) Portfolio() *portfolio.Portfolio {
+	return w.portfolio
+}
+
+// listPositions answers the positions of the accounts the key may trade on,
+// optionally of one account, with their totals per asset. The method query
+// parameter picks the lot matching method.
+func (w *Webhook) listPositions(rw http.ResponseWriter, r *http.Request) {
+	key, _ := auth.KeyFromContext(r.Context())
+	if !key.CanRead() {
+		writeError(rw, http.StatusForbidden, auth.ErrForbidden)
+		return
+	}
+
+	query := r.URL.Query()
+	positions, err := w.portfolio.Positions(portfolio.Method(query.Get("method")))
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	account := query.Get("account")
+	if account != "" {
+		account = trading.AccountName(account)
+	}
+
+	res := positionsResponse{Positions: []portfolio.Position{}}
+	for _, position := range positions {
+		if key.AuthorizeExchange(position.Account) != nil || (account != "" && position.Account != account) {
+			continue
+		}
+		res.Positions = append(res.Positions, position)
+	}
+	res.Totals = portfolio.Totals(res.Positions)
+
+	writeJSON(rw, http.StatusOK, res)
+}
+
+func (w *Webhook) getReconciliation(rw http.ResponseWriter, r *http.Request) {
+	key, _ := auth.KeyFromContext(r.Context())
+	if !key.CanRead() {
+		writeError(rw, http.StatusForbidden, auth.ErrForbidden)
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, w.portfolio.LastReconciliation())
+}
+
+// reconcile reconciles the positions now. With rebase=true the balances are
+// taken as the new baseline first, once the drift has been accounted for.
+func (w *Webhook) reconcile(rw http.ResponseWriter, r *http.Request) {
+	key, _ := auth.KeyFromContext(r.Context())
+	if !key.CanRead() {
+		writeError(rw, http.StatusForbidden, auth.ErrForbidden)
+		return
+	}
+
+	if r.URL.Query().Get("rebase") == "true" {
+		if !key.IsAdmin() {
+			writeError(rw, http.StatusForbidden, auth.ErrForbidden)
+			return
+		}
+		w.portfolio.Rebase()
+	}
+
+	writeJSON(rw, http.StatusOK, w.portfolio.Reconcile())
+}
@@ -0,0 +1,60 @@
+package webhook
+
+import (
+	"net/http"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/auth"
+	"trading-aggregator/rebalance"
+	"trading-aggregator/router"
+	"trading-aggregator/trading"
+)
+
+// executeRouted executes a rebalancing trade through the router, placing
+// each part as an order of the venue's default account.
+func (w *Webhook) executeRouted(side, asset, quote string, amount decimal.Decimal, caps map[string]decimal.Decimal) ([]router.Child, error) {
+	return w.routing.Execute(side, asset, quote, amount, caps, w.placeRouted)
+}
+
+// placeRouted submits a routed part like any other order, so that the kill
+// switch, the risk limits and order tracking apply to it.
+func (w *Webhook) placeRouted(venue, side string, req trading.TradeRequest) (string, error) {
+	o, _, err := w.submit(placeOrderRequest{
+		Exchange: trading.AccountName(venue),
+		Side:     side,
+		Base:     req.Base,
+		Quote:    req.Quote,
+		Amount:   req.Amount,
+	}, nil)
+
+	return o.ID, err
+}
+
+func (w *Webhook) listRebalances(rw http.ResponseWriter, r *http.Request) {
+	key, _ := auth.KeyFromContext(r.Context())
+	if !key.CanRead() {
+		writeError(rw, http.StatusForbidden, auth.ErrForbidden)
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, w.rebalancer.Reports())
+}
+
+// rebalance rebalances now. A dry run, with dry_run=true, only needs to
+// read; trading across every account needs the admin permission.
+func (w *Webhook) rebalance(rw http.ResponseWriter, r *http.Request) {
+	key, _ := auth.KeyFromContext(r.Context())
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+	if (dryRun && !key.CanRead()) || (!dryRun && !key.IsAdmin()) {
+		writeError(rw, http.StatusForbidden, auth.ErrForbidden)
+		return
+	}
+
+	if !w.config.Rebalance.Enabled() {
+		writeError(rw, http.StatusBadRequest, rebalance.ErrNoTargets)
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, w.rebalancer.Rebalance(dryRun))
+}
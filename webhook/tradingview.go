@@ -0,0 +1,279 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/trading"
+)
+
+type TradingViewConfig struct {
+	Passphrase      string
+	DefaultExchange string
+	DedupWindow     time.Duration
+}
+
+// tradingViewAlert is the alert message template users paste into TradingView,
+// for example {"action":"buy","ticker":"{{ticker}}","amount":"1","passphrase":"..."}.
+// The ticker may carry an exchange prefix such as BINANCE:SOLUSDT.
+type tradingViewAlert struct {
+	Passphrase    string          `json:"passphrase"`
+	Action        string          `json:"action"`
+	Ticker        string          `json:"ticker"`
+	Amount        decimal.Decimal `json:"amount"`
+	Exchange      string          `json:"exchange"`
+	ClientOrderID string          `json:"client_order_id"`
+	CallbackURL   string          `json:"callback_url"`
+}
+
+// knownQuotes is ordered so that longer quotes are tried first, e.g. FDUSD
+// before USD.
+var knownQuotes = []string{
+	"FDUSD", "USDT", "USDC", "BUSD", "TUSD", "DAI",
+	"USD", "EUR", "GBP", "TRY", "BRL", "JPY",
+	"BTC", "ETH", "BNB",
+}
+
+var errDuplicateAlert = errors.New("duplicate alert")
+
+type deduplicator struct {
+	window time.Duration
+	mu     sync.Mutex
+	seen   map[string]time.Time
+}
+
+func newDeduplicator(window time.Duration) *deduplicator {
+	return &deduplicator{
+		window: window,
+		seen:   make(map[string]time.Time),
+	}
+}
+
+// check records key and reports whether it was already seen within the window.
+func (d *deduplicator) check(key string, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for k, t := range d.seen {
+		if now.Sub(t) >= d.window {
+			delete(d.seen, k)
+		}
+	}
+
+	if _, ok := d.seen[key]; ok {
+		return true
+	}
+
+	d.seen[key] = now
+	return false
+}
+
+func (d *deduplicator) forget(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.seen, key)
+}
+
+func (w *Webhook) tradingView(rw http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	alert, err := parseTradingViewAlert(body)
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	if w.config.TradingView.Passphrase == "" ||
+		!hmac.Equal([]byte(alert.Passphrase), []byte(w.config.TradingView.Passphrase)) {
+		writeError(rw, http.StatusUnauthorized, errors.New("invalid passphrase"))
+		return
+	}
+
+	req, err := alert.toPlaceOrderRequest(w.config.TradingView.DefaultExchange, w.registry)
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	key := alert.dedupKey()
+	if w.dedup.check(key, time.Now()) {
+		writeError(rw, http.StatusConflict, errDuplicateAlert)
+		return
+	}
+
+	o, status, err := w.submit(req, nil)
+	if err != nil {
+		w.dedup.forget(key)
+		writeError(rw, status, err)
+		return
+	}
+
+	writeJSON(rw, http.StatusCreated, o)
+}
+
+// parseTradingViewAlert accepts either the JSON template or the plain text form
+// "action=buy ticker=SOLUSDT amount=1 passphrase=...", since TradingView sends
+// alert messages verbatim and users often use the text form.
+func parseTradingViewAlert(body []byte) (tradingViewAlert, error) {
+	var alert tradingViewAlert
+
+	trimmed := strings.TrimSpace(string(body))
+	if strings.HasPrefix(trimmed, "{") {
+		err := decodeJSON([]byte(trimmed), &alert)
+		return alert, err
+	}
+
+	fields := strings.FieldsFunc(trimmed, func(r rune) bool {
+		return r == ' ' || r == ',' || r == '\n' || r == '\r' || r == '\t'
+	})
+	for _, field := range fields {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return tradingViewAlert{}, fmt.Errorf("invalid alert field %q", field)
+		}
+
+		switch strings.ToLower(key) {
+		case "passphrase":
+			alert.Passphrase = value
+		case "action":
+			alert.Action = value
+		case "ticker":
+			alert.Ticker = value
+		case "amount":
+			amount, err := decimal.NewFromString(value)
+			if err != nil {
+				return tradingViewAlert{}, fmt.Errorf("invalid amount %q: %w", value, err)
+			}
+			alert.Amount = amount
+		case "exchange":
+			alert.Exchange = value
+		case "client_order_id":
+			alert.ClientOrderID = value
+		case "callback_url":
+			alert.CallbackURL = value
+		default:
+			return tradingViewAlert{}, fmt.Errorf("unknown alert field %q", key)
+		}
+	}
+
+	return alert, nil
+}
+
+func (a tradingViewAlert) toPlaceOrderRequest(defaultExchange string, registry *trading.Registry) (placeOrderRequest, error) {
+	exchange := a.Exchange
+	ticker := a.Ticker
+	if prefix, symbol, ok := strings.Cut(ticker, ":"); ok {
+		ticker = symbol
+		if exchange == "" {
+			exchange = prefix
+		}
+	}
+	if exchange == "" {
+		exchange = defaultExchange
+	}
+
+	base, quote, err := resolveTicker(registry, exchange, ticker)
+	if err != nil {
+		return placeOrderRequest{}, err
+	}
+
+	if !a.Amount.IsPositive() {
+		return placeOrderRequest{}, errors.New("alert has no positive amount")
+	}
+
+	return placeOrderRequest{
+		Exchange:      strings.ToLower(exchange),
+		Side:          strings.ToLower(a.Action),
+		Base:          base,
+		Quote:         quote,
+		Amount:        a.Amount,
+		ClientOrderID: a.ClientOrderID,
+		CallbackURL:   a.CallbackURL,
+	}, nil
+}
+
+func (a tradingViewAlert) dedupKey() string {
+	if a.ClientOrderID != "" {
+		return a.ClientOrderID
+	}
+
+	h := sha256.Sum256([]byte(strings.Join([]string{
+		strings.ToLower(a.Exchange),
+		strings.ToLower(a.Action),
+		strings.ToUpper(a.Ticker),
+		a.Amount.String(),
+	}, "|")))
+
+	return hex.EncodeToString(h[:])
+}
+
+// resolveTicker looks the ticker up in the instrument listing of the exchange,
+// ignoring separators since TradingView writes Coinbase's BTC-USD as BTCUSD.
+// Exchanges that cannot list their instruments fall back to splitTicker.
+func resolveTicker(registry *trading.Registry, exchange, ticker string) (string, string, error) {
+	client, ok := registry.Client(exchange)
+	if !ok {
+		return splitTicker(ticker)
+	}
+
+	lister, ok := client.(trading.InstrumentLister)
+	if !ok {
+		return splitTicker(ticker)
+	}
+
+	listings, err := lister.ListInstruments()
+	if err != nil {
+		return "", "", err
+	}
+
+	want := normalizeTicker(ticker)
+	for _, listing := range listings {
+		if normalizeTicker(listing.Symbol) == want {
+			return listing.Instrument.Base, listing.Instrument.Quote, nil
+		}
+	}
+
+	return "", "", fmt.Errorf("%w: ticker %s on %s", trading.ErrUnknownInstrument, ticker, exchange)
+}
+
+func normalizeTicker(ticker string) string {
+	return strings.NewReplacer("/", "", "-", "", "_", "").Replace(strings.ToUpper(strings.TrimSpace(ticker)))
+}
+
+// splitTicker splits a TradingView ticker such as SOLUSDT, SOL/USDT or SOL-USD
+// into its base and quote assets.
+func splitTicker(ticker string) (string, string, error) {
+	ticker = strings.ToUpper(strings.TrimSpace(ticker))
+	if ticker == "" {
+		return "", "", errors.New("alert has no ticker")
+	}
+
+	for _, sep := range []string{"/", "-", "_"} {
+		if base, quote, ok := strings.Cut(ticker, sep); ok && base != "" && quote != "" {
+			return base, quote, nil
+		}
+	}
+
+	for _, quote := range knownQuotes {
+		if strings.HasSuffix(ticker, quote) && len(ticker) > len(quote) {
+			return strings.TrimSuffix(ticker, quote), quote, nil
+		}
+	}
+
+	return "", "", fmt.Errorf("cannot split ticker %q into base and quote", ticker)
+}
@@ -0,0 +1,735 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/accounting"
+	"trading-aggregator/algo"
+	"trading-aggregator/auth"
+	"trading-aggregator/book"
+	"trading-aggregator/conditional"
+	"trading-aggregator/dca"
+	"trading-aggregator/killswitch"
+	"trading-aggregator/order"
+	"trading-aggregator/portfolio"
+	"trading-aggregator/rebalance"
+	"trading-aggregator/risk"
+	"trading-aggregator/router"
+	"trading-aggregator/trading"
+)
+
+type Config struct {
+	PollInterval time.Duration
+	Callback     CallbackConfig
+	TradingView  TradingViewConfig
+	Auth         auth.Config
+	Books        book.Config
+	Risk         risk.Config
+	KillSwitch   KillSwitchConfig
+	Portfolio    portfolio.Config
+	Accounting   accounting.Config
+	Rebalance    rebalance.Config
+	DCA          dca.Config
+	Conditional  conditional.Config
+}
+
+type Webhook struct {
+	config     Config
+	listener   net.Listener
+	router     *mux.Router
+	tracker    *order.Tracker
+	notifier   *Notifier
+	dedup      *deduplicator
+	auth       *auth.Authenticator
+	registry   *trading.Registry
+	books      *book.Aggregator
+	routing    *router.Router
+	algos      *algo.Engine
+	risk       *risk.Engine
+	kill       *killswitch.Switch
+	portfolio  *portfolio.Portfolio
+	valuer     accounting.Valuer
+	rebalancer *rebalance.Rebalancer
+	dca        *dca.Scheduler
+	triggers   *conditional.Engine
+}
+
+type placeOrderRequest struct {
+	Exchange      string                `json:"exchange"`
+	Side          string                `json:"side"`
+	Base          string                `json:"base"`
+	Quote         string                `json:"quote"`
+	Amount        decimal.Decimal       `json:"amount"`
+	QuoteAmount   decimal.Decimal       `json:"quote_amount"`
+	Type          trading.OrderType     `json:"type"`
+	Price         decimal.Decimal       `json:"price"`
+	TimeInForce   trading.TimeInForce   `json:"time_in_force"`
+	StopPrice     decimal.Decimal       `json:"stop_price"`
+	StopDirection trading.StopDirection `json:"stop_direction"`
+	ReduceOnly    bool                  `json:"reduce_only"`
+	PositionIdx   trading.PositionIdx   `json:"position_idx"`
+	ClientOrderID string                `json:"client_order_id"`
+	CallbackURL   string                `json:"callback_url"`
+	Algo          *algoRequest          `json:"algo"`
+}
+
+type quoteRequest struct {
+	Side   string          `json:"side"`
+	Base   string          `json:"base"`
+	Quote  string          `json:"quote"`
+	Amount decimal.Decimal `json:"amount"`
+}
+
+type accountResponse struct {
+	Name         string               `json:"name"`
+	Exchange     string               `json:"exchange"`
+	Capabilities trading.Capabilities `json:"capabilities"`
+}
+
+type instrumentResponse struct {
+	Instrument trading.Instrument       `json:"instrument"`
+	Listings   []trading.AccountListing `json:"listings"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func NewWebhook(listener net.Listener, registry *trading.Registry, config Config) (*Webhook, error) {
+	if config.PollInterval <= 0 {
+		config.PollInterval = 5 * time.Second
+	}
+	if config.TradingView.DedupWindow <= 0 {
+		config.TradingView.DedupWindow = time.Minute
+	}
+
+	authenticator, err := auth.NewAuthenticator(config.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	riskEngine, err := risk.NewEngine(config.Risk)
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.Portfolio.Validate()
+	if err != nil {
+		return nil, err
+	}
+	err = config.Rebalance.Validate()
+	if err != nil {
+		return nil, err
+	}
+	err = config.DCA.Validate()
+	if err != nil {
+		return nil, err
+	}
+	plans := dca.NewMemoryStore()
+	if config.DCA.Path != "" {
+		plans, err = dca.NewFileStore(config.DCA.Path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = config.Conditional.Validate()
+	if err != nil {
+		return nil, err
+	}
+	triggers := conditional.NewMemoryStore()
+	if config.Conditional.Path != "" {
+		triggers, err = conditional.NewFileStore(config.Conditional.Path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.Accounting.Method == "" {
+		config.Accounting.Method = accounting.FIFO
+	}
+	if config.Accounting.Fiat == "" {
+		config.Accounting.Fiat = "USD"
+	}
+
+	w := &Webhook{
+		config:   config,
+		listener: listener,
+		router:   mux.NewRouter(),
+		notifier: NewNotifier(config.Callback, http.DefaultClient),
+		dedup:    newDeduplicator(config.TradingView.DedupWindow),
+		auth:     authenticator,
+		registry: registry,
+		books:    book.NewAggregator(registry, config.Books),
+		risk:     riskEngine,
+		kill:     killswitch.New(registry, killswitch.Config{FlattenTo: config.KillSwitch.FlattenTo}),
+	}
+	w.routing = router.NewRouter(w.books)
+	w.tracker = order.NewTracker(order.NewMemoryStore(), registry.Client, config.PollInterval)
+	w.tracker.OnTerminal(w.notifier.Notify)
+	w.tracker.OnTerminal(w.risk.Settle)
+	w.portfolio = portfolio.New(w.tracker.Store(), registry, config.Portfolio)
+	w.valuer = accounting.KlineValuer(registry)
+	w.rebalancer = rebalance.New(registry, w.executeRouted, config.Rebalance)
+	w.dca = dca.New(plans, w.executePlan, config.DCA)
+	w.triggers = conditional.New(triggers, registry.Client, w.placeTrigger, config.Conditional)
+	w.algos = algo.NewEngine(w.tracker, registry.Client, algo.Config{Gate: w.kill.Check})
+	w.kill.OnEngage(func(string) {
+		w.algos.CancelAll()
+		w.triggers.CancelAll()
+	})
+	w.risk.OnRejection(w.breach)
+
+	w.router.HandleFunc("/tradingview", w.tradingView).Methods(http.MethodPost)
+
+	api := w.router.NewRoute().Subrouter()
+	api.Use(w.authenticate)
+	api.HandleFunc("/orders", w.placeOrder).Methods(http.MethodPost)
+	api.HandleFunc("/orders/oco", w.placeOCO).Methods(http.MethodPost)
+	api.HandleFunc("/orders/{id}", w.getOrder).Methods(http.MethodGet)
+	api.HandleFunc("/orders/{id}/children", w.listChildren).Methods(http.MethodGet)
+	api.HandleFunc("/orders/{id}/pause", w.controlAlgo(w.algos.Pause)).Methods(http.MethodPost)
+	api.HandleFunc("/orders/{id}/resume", w.controlAlgo(w.algos.Resume)).Methods(http.MethodPost)
+	api.HandleFunc("/orders/{id}/cancel", w.controlAlgo(w.algos.Cancel)).Methods(http.MethodPost)
+	api.HandleFunc("/accounts", w.listAccounts).Methods(http.MethodGet)
+	api.HandleFunc("/accounts/{account}/positions", w.listDerivativesPositions).Methods(http.MethodGet)
+	api.HandleFunc("/accounts/{account}/funding", w.listFunding).Methods(http.MethodGet)
+	api.HandleFunc("/accounts/{account}/leverage", w.setLeverage).Methods(http.MethodPost)
+	api.HandleFunc("/accounts/{account}/margin-type", w.setMarginType).Methods(http.MethodPost)
+	api.HandleFunc("/instruments/{pair}", w.getInstrument).Methods(http.MethodGet)
+	api.HandleFunc("/books/{pair}", w.getBook).Methods(http.MethodGet)
+	api.HandleFunc("/quotes", w.quote).Methods(http.MethodPost)
+	api.HandleFunc("/kill-switch", w.getKillSwitch).Methods(http.MethodGet)
+	api.HandleFunc("/kill-switch", w.engageKillSwitch).Methods(http.MethodPost)
+	api.HandleFunc("/kill-switch", w.releaseKillSwitch).Methods(http.MethodDelete)
+	api.HandleFunc("/positions", w.listPositions).Methods(http.MethodGet)
+	api.HandleFunc("/reconciliation", w.getReconciliation).Methods(http.MethodGet)
+	api.HandleFunc("/reconciliation", w.reconcile).Methods(http.MethodPost)
+	api.HandleFunc("/exports/{format}", w.export).Methods(http.MethodGet)
+	api.HandleFunc("/rebalances", w.listRebalances).Methods(http.MethodGet)
+	api.HandleFunc("/rebalances", w.rebalance).Methods(http.MethodPost)
+	api.HandleFunc("/dca-plans", w.createPlan).Methods(http.MethodPost)
+	api.HandleFunc("/dca-plans", w.listPlans).Methods(http.MethodGet)
+	api.HandleFunc("/dca-plans/{id}", w.getPlan).Methods(http.MethodGet)
+	api.HandleFunc("/dca-plans/{id}", w.deletePlan).Methods(http.MethodDelete)
+	api.HandleFunc("/dca-plans/{id}/pause", w.controlPlan(w.dca.Pause)).Methods(http.MethodPost)
+	api.HandleFunc("/dca-plans/{id}/resume", w.controlPlan(w.dca.Resume)).Methods(http.MethodPost)
+	api.HandleFunc("/triggers", w.createTrigger).Methods(http.MethodPost)
+	api.HandleFunc("/triggers", w.listTriggers).Methods(http.MethodGet)
+	api.HandleFunc("/triggers/oco", w.createOCO).Methods(http.MethodPost)
+	api.HandleFunc("/triggers/{id}", w.getTrigger).Methods(http.MethodGet)
+	api.HandleFunc("/triggers/{id}", w.cancelTrigger).Methods(http.MethodDelete)
+
+	return w, nil
+}
+
+// Reload applies the parts of config that can change while serving: the API
+// keys and the risk limits. Nothing is applied if either is invalid.
+func (w *Webhook) Reload(config Config) error {
+	err := config.Risk.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = w.auth.SetKeys(config.Auth.Keys)
+	if err != nil {
+		return err
+	}
+
+	return w.risk.SetConfig(config.Risk)
+}
+
+func (w *Webhook) Handler() http.Handler {
+	return w.router
+}
+
+func (w *Webhook) Serve(ctx context.Context) error {
+	server := &http.Server{Handler: w.router}
+
+	err := w.triggers.Resume()
+	if err != nil {
+		return err
+	}
+
+	go w.tracker.Run(ctx)
+	go w.portfolio.Run(ctx)
+	go w.rebalancer.Run(ctx)
+	go w.dca.Run(ctx)
+	w.followOrderStreams(ctx)
+	go func() {
+		<-ctx.Done()
+		w.books.Close()
+		w.algos.Close()
+		w.triggers.Close()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	err = server.Serve(w.listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		w.notifier.Wait()
+		return nil
+	}
+
+	return err
+}
+
+// followOrderStreams follows the order stream of every account that has one.
+// A client replaced in the registry, e.g. with rotated credentials, stops
+// the stream of the old client and follows its own.
+func (w *Webhook) followOrderStreams(ctx context.Context) {
+	var mu sync.Mutex
+	streams := map[string]context.CancelFunc{}
+
+	follow := func(account trading.Account) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if cancel, ok := streams[account.Name]; ok {
+			cancel()
+			delete(streams, account.Name)
+		}
+
+		streamer, ok := account.Client.(trading.OrderStreamer)
+		if !ok || ctx.Err() != nil {
+			return
+		}
+
+		streamCtx, cancel := context.WithCancel(ctx)
+		streams[account.Name] = cancel
+		go func() {
+			_ = w.tracker.Follow(streamCtx, account.Name, streamer)
+		}()
+	}
+
+	w.registry.OnChange(follow)
+	for _, account := range w.registry.Accounts() {
+		follow(account)
+	}
+}
+
+func (w *Webhook) placeOrder(rw http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	var req placeOrderRequest
+	err = decodeJSON(body, &req)
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	key, _ := auth.KeyFromContext(r.Context())
+	o, status, err := w.submit(req, &key)
+	if err != nil {
+		writeError(rw, status, err)
+		return
+	}
+
+	writeJSON(rw, http.StatusCreated, o)
+}
+
+// submit places the order on its exchange and starts tracking it. key is nil
+// for routes that authenticate by other means, such as the TradingView
+// passphrase.
+func (w *Webhook) submit(req placeOrderRequest, key *auth.Key) (order.Order, int, error) {
+	err := w.kill.Check()
+	if err != nil {
+		return order.Order{}, http.StatusServiceUnavailable, err
+	}
+
+	if req.QuoteAmount.IsZero() && !req.Amount.IsPositive() {
+		return order.Order{}, http.StatusBadRequest, fmt.Errorf("amount must be positive, got %s", req.Amount)
+	}
+
+	req.Exchange = trading.AccountName(req.Exchange)
+	client, ok := w.registry.Client(req.Exchange)
+	if !ok {
+		return order.Order{}, http.StatusBadRequest, fmt.Errorf("unknown exchange %q", req.Exchange)
+	}
+
+	if key != nil {
+		status, err := authorizeTrade(*key, client, req)
+		if err != nil {
+			return order.Order{}, status, err
+		}
+	}
+
+	if req.CallbackURL != "" {
+		err := validateCallbackURL(req.CallbackURL)
+		if err != nil {
+			return order.Order{}, http.StatusBadRequest, err
+		}
+	}
+
+	if req.ClientOrderID == "" {
+		req.ClientOrderID = uuid.NewString()
+	}
+
+	var keyID string
+	if key != nil {
+		keyID = key.ID
+	}
+
+	if req.Algo != nil {
+		if !req.StopPrice.IsZero() || !req.QuoteAmount.IsZero() || req.ReduceOnly || req.PositionIdx != trading.OneWayPosition {
+			return order.Order{}, http.StatusBadRequest, errors.New("algo orders cannot have a stop price or a quote amount, be reduce-only or pick a position")
+		}
+		return w.startAlgo(req, keyID, client)
+	}
+
+	tradeRequest := trading.TradeRequest{
+		Base:          req.Base,
+		Quote:         req.Quote,
+		Amount:        req.Amount,
+		QuoteAmount:   req.QuoteAmount,
+		Type:          req.Type,
+		Price:         req.Price,
+		TimeInForce:   req.TimeInForce,
+		StopPrice:     req.StopPrice,
+		StopDirection: req.StopDirection,
+		ReduceOnly:    req.ReduceOnly,
+		PositionIdx:   req.PositionIdx,
+		ClientOrderID: req.ClientOrderID,
+	}
+	err = tradeRequest.Validate()
+	if err != nil {
+		return order.Order{}, http.StatusBadRequest, err
+	}
+	if tradeRequest.IsStop() && !w.supportsStopOrders(req.Exchange, tradeRequest.IsLimit()) {
+		return order.Order{}, http.StatusBadRequest, fmt.Errorf("%s does not support native stop orders, use /triggers instead", req.Exchange)
+	}
+	if tradeRequest.IsLimit() && !w.supportsLimitOrders(req.Exchange) {
+		return order.Order{}, http.StatusBadRequest, fmt.Errorf("%s does not support limit orders", req.Exchange)
+	}
+	if tradeRequest.IsQuoteSized() && !w.supportsQuoteSizeOrders(req.Exchange) {
+		return order.Order{}, http.StatusBadRequest, fmt.Errorf("%s does not support quote sized orders", req.Exchange)
+	}
+
+	client = w.risk.Client(keyID, req.Exchange, client)
+
+	var tradeResponse trading.TradeResponse
+	switch strings.ToLower(req.Side) {
+	case "buy":
+		res, err := client.Buy(trading.BuyRequest{TradeRequest: tradeRequest})
+		if err != nil {
+			return order.Order{}, clientErrorStatus(err), err
+		}
+		tradeResponse = res.TradeResponse
+	case "sell":
+		res, err := client.Sell(trading.SellRequest{TradeRequest: tradeRequest})
+		if err != nil {
+			return order.Order{}, clientErrorStatus(err), err
+		}
+		tradeResponse = res.TradeResponse
+	default:
+		return order.Order{}, http.StatusBadRequest, fmt.Errorf("unknown side %q", req.Side)
+	}
+
+	now := time.Now().UTC()
+	o := order.Order{
+		ID:            uuid.NewString(),
+		Exchange:      req.Exchange,
+		Side:          strings.ToLower(req.Side),
+		Base:          req.Base,
+		Quote:         req.Quote,
+		Amount:        req.Amount,
+		QuoteAmount:   req.QuoteAmount,
+		Type:          req.Type,
+		Price:         req.Price,
+		TimeInForce:   req.TimeInForce,
+		StopPrice:     req.StopPrice,
+		StopDirection: req.StopDirection,
+		ReduceOnly:    req.ReduceOnly,
+		PositionIdx:   req.PositionIdx,
+		ClientOrderID: req.ClientOrderID,
+		OrderID:       tradeResponse.OrderID,
+		CallbackURL:   req.CallbackURL,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	err = w.tracker.Store().Save(o)
+	if err != nil {
+		return order.Order{}, http.StatusInternalServerError, err
+	}
+
+	return o, http.StatusCreated, nil
+}
+
+func (w *Webhook) getOrder(rw http.ResponseWriter, r *http.Request) {
+	o, _, ok := w.readableOrder(rw, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, o)
+}
+
+func (w *Webhook) listAccounts(rw http.ResponseWriter, r *http.Request) {
+	key, _ := auth.KeyFromContext(r.Context())
+	if !key.CanRead() {
+		writeError(rw, http.StatusForbidden, auth.ErrForbidden)
+		return
+	}
+
+	accounts := []accountResponse{}
+	for _, account := range w.registry.Accounts() {
+		if key.AuthorizeExchange(account.Name) != nil {
+			continue
+		}
+
+		accounts = append(accounts, accountResponse{
+			Name:         account.Name,
+			Exchange:     account.Exchange,
+			Capabilities: account.Capabilities,
+		})
+	}
+
+	writeJSON(rw, http.StatusOK, accounts)
+}
+
+// getInstrument answers which accounts list a pair, written as BASE-QUOTE.
+func (w *Webhook) getInstrument(rw http.ResponseWriter, r *http.Request) {
+	key, _ := auth.KeyFromContext(r.Context())
+	if !key.CanRead() {
+		writeError(rw, http.StatusForbidden, auth.ErrForbidden)
+		return
+	}
+
+	instrument, err := trading.ParseInstrument(mux.Vars(r)["pair"])
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	listings := []trading.AccountListing{}
+	for _, listing := range w.registry.Listings(instrument) {
+		if key.AuthorizeExchange(listing.Account) == nil {
+			listings = append(listings, listing)
+		}
+	}
+
+	writeJSON(rw, http.StatusOK, instrumentResponse{
+		Instrument: instrument,
+		Listings:   listings,
+	})
+}
+
+// getBook returns the consolidated book of a pair, written as BASE-QUOTE,
+// limited to depth levels per side (20 by default).
+func (w *Webhook) getBook(rw http.ResponseWriter, r *http.Request) {
+	key, _ := auth.KeyFromContext(r.Context())
+	if !key.CanRead() {
+		writeError(rw, http.StatusForbidden, auth.ErrForbidden)
+		return
+	}
+
+	instrument, err := trading.ParseInstrument(mux.Vars(r)["pair"])
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	depth := 20
+	if s := r.URL.Query().Get("depth"); s != "" {
+		depth, err = strconv.Atoi(s)
+		if err != nil || depth <= 0 {
+			writeError(rw, http.StatusBadRequest, fmt.Errorf("invalid depth %q", s))
+			return
+		}
+	}
+
+	b, err := w.books.Book(instrument)
+	switch {
+	case errors.Is(err, trading.ErrUnknownInstrument):
+		writeError(rw, http.StatusNotFound, err)
+		return
+	case errors.Is(err, trading.ErrBookNotSynced):
+		writeError(rw, http.StatusServiceUnavailable, err)
+		return
+	case err != nil:
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, b.Depth(depth))
+}
+
+// quote estimates the fill of a market order across venues without placing
+// it.
+func (w *Webhook) quote(rw http.ResponseWriter, r *http.Request) {
+	key, _ := auth.KeyFromContext(r.Context())
+	if !key.CanRead() {
+		writeError(rw, http.StatusForbidden, auth.ErrForbidden)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	var req quoteRequest
+	err = decodeJSON(body, &req)
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	if side := strings.ToLower(req.Side); side != "buy" && side != "sell" {
+		writeError(rw, http.StatusBadRequest, fmt.Errorf("unknown side %q", req.Side))
+		return
+	}
+	if !req.Amount.IsPositive() {
+		writeError(rw, http.StatusBadRequest, fmt.Errorf("amount must be positive, got %s", req.Amount))
+		return
+	}
+
+	q, err := w.routing.Quote(req.Side, req.Base, req.Quote, req.Amount)
+	switch {
+	case errors.Is(err, trading.ErrUnknownInstrument):
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	case errors.Is(err, trading.ErrBookNotSynced), errors.Is(err, router.ErrNoMidPrice):
+		writeError(rw, http.StatusServiceUnavailable, err)
+		return
+	case errors.Is(err, book.ErrInsufficientLiquidity):
+		writeError(rw, http.StatusUnprocessableEntity, fmt.Errorf("%w: the books fill %s of %s", err, q.Filled, req.Amount))
+		return
+	case err != nil:
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, q)
+}
+
+func (w *Webhook) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(rw, http.StatusBadRequest, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		key, err := w.auth.Authenticate(r, body)
+		if err != nil {
+			writeError(rw, http.StatusUnauthorized, err)
+			return
+		}
+
+		next.ServeHTTP(rw, r.WithContext(auth.WithKey(r.Context(), key)))
+	})
+}
+
+func authorizeTrade(key auth.Key, client trading.Client, req placeOrderRequest) (int, error) {
+	err := key.AuthorizeTrade(req.Exchange, req.Side, req.Base, req.Quote)
+	if err != nil {
+		return http.StatusForbidden, err
+	}
+
+	if !key.HasMaxNotional() {
+		return http.StatusOK, nil
+	}
+
+	if !req.QuoteAmount.IsZero() {
+		err = key.AuthorizeNotional(req.QuoteAmount)
+		if err != nil {
+			return http.StatusForbidden, err
+		}
+		return http.StatusOK, nil
+	}
+
+	priceClient, ok := client.(trading.PriceClient)
+	if !ok {
+		return http.StatusForbidden, fmt.Errorf("%w: cannot check notional on %s", auth.ErrForbidden, req.Exchange)
+	}
+
+	priceResponse, err := priceClient.GetPrice(trading.GetPriceRequest{
+		Base:  req.Base,
+		Quote: req.Quote,
+	})
+	if err != nil {
+		return http.StatusBadGateway, err
+	}
+
+	// A limit order may fill at its price and a stop order at its stop price
+	// rather than the market's.
+	price := decimal.Max(priceResponse.Price, req.Price, req.StopPrice)
+	notional := req.Amount.Mul(price)
+	if trading.IsQuoteSized(client) {
+		notional = req.Amount
+	}
+	err = key.AuthorizeNotional(notional)
+	if err != nil {
+		return http.StatusForbidden, err
+	}
+
+	return http.StatusOK, nil
+}
+
+func (w *Webhook) supportsLimitOrders(exchange string) bool {
+	account, err := w.registry.Account(exchange)
+	return err == nil && account.Capabilities.LimitOrders
+}
+
+func (w *Webhook) supportsQuoteSizeOrders(exchange string) bool {
+	account, err := w.registry.Account(exchange)
+	return err == nil && account.Capabilities.QuoteSizeOrders
+}
+
+// supportsStopOrders reports whether the exchange places stop orders itself,
+// so that they survive our outages. Some venues only take stop-limit orders.
+func (w *Webhook) supportsStopOrders(exchange string, limit bool) bool {
+	account, err := w.registry.Account(exchange)
+	if err != nil {
+		return false
+	}
+	if limit {
+		return account.Capabilities.StopOrders
+	}
+
+	return account.Capabilities.StopMarketOrders
+}
+
+func clientErrorStatus(err error) int {
+	if errors.Is(err, trading.ErrUnknownInstrument) {
+		return http.StatusBadRequest
+	}
+	var rejection *risk.Rejection
+	if errors.As(err, &rejection) {
+		return http.StatusForbidden
+	}
+
+	return http.StatusBadGateway
+}
+
+func writeJSON(rw http.ResponseWriter, status int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	_ = json.NewEncoder(rw).Encode(v)
+}
+
+func writeError(rw http.ResponseWriter, status int, err error) {
+	writeJSON(rw, status, errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,1332 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	"trading-aggregator/auth"
+	"trading-aggregator/book"
+	"trading-aggregator/conditional"
+	"trading-aggregator/dca"
+	"trading-aggregator/order"
+	"trading-aggregator/rebalance"
+	"trading-aggregator/risk"
+	"trading-aggregator/router"
+	"trading-aggregator/simulator"
+	"trading-aggregator/trading"
+)
+
+type fakeClient struct {
+	mu     sync.Mutex
+	status string
+}
+
+func (c *fakeClient) Sell(req trading.SellRequest) (trading.SellResponse, error) {
+	return trading.SellResponse{TradeResponse: trading.TradeResponse{OrderID: "sell-1"}}, nil
+}
+
+func (c *fakeClient) Buy(req trading.BuyRequest) (trading.BuyResponse, error) {
+	return trading.BuyResponse{TradeResponse: trading.TradeResponse{OrderID: "buy-1"}}, nil
+}
+
+func (c *fakeClient) GetOrderDetail(req trading.GetOrderDetailRequest) (trading.GetOrderDetailResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return trading.GetOrderDetailResponse{
+		Status:        c.status,
+		ExecutedBase:  decimal.NewFromInt(1),
+		ExecutedQuote: decimal.NewFromInt(150),
+	}, nil
+}
+
+func (c *fakeClient) GetPrice(req trading.GetPriceRequest) (trading.GetPriceResponse, error) {
+	return trading.GetPriceResponse{Price: decimal.NewFromInt(150)}, nil
+}
+
+func (c *fakeClient) setStatus(status string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.status = status
+}
+
+var testKey = auth.Key{
+	ID:          "test",
+	Secret:      "test-secret",
+	Exchanges:   []string{auth.Wildcard},
+	Symbols:     []string{auth.Wildcard},
+	Permissions: []string{auth.PermissionRead, auth.PermissionBuy, auth.PermissionSell},
+}
+
+func newWebhook(t *testing.T, config Config) *Webhook {
+	t.Helper()
+
+	if len(config.Auth.Keys) == 0 {
+		config.Auth.Keys = []auth.Key{testKey}
+	}
+
+	w, err := NewWebhook(nil, trading.NewRegistry(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return w
+}
+
+func signedRequest(key auth.Key, method, target, body string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	nonce := uuid.NewString()
+
+	r.Header.Set(auth.APIKeyHeader, key.ID)
+	r.Header.Set(auth.TimestampHeader, timestamp)
+	r.Header.Set(auth.NonceHeader, nonce)
+	r.Header.Set(auth.SignatureHeader, auth.Sign(key.Secret, timestamp, nonce, method, r.URL.RequestURI(), []byte(body)))
+	return r
+}
+
+func placeOrder(t *testing.T, w *Webhook, body string) order.Order {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodPost, "/orders", body))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	var o order.Order
+	err := json.Unmarshal(rec.Body.Bytes(), &o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return o
+}
+
+func TestWebhook_Callback(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	receivedBody := make(chan []byte, 1)
+	callbackServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		receivedBody <- body
+	}))
+	defer callbackServer.Close()
+
+	client := &fakeClient{status: "NEW"}
+	w := newWebhook(t, Config{Callback: CallbackConfig{Secret: "secret"}})
+	w.registry.Set("binance", client)
+
+	o := placeOrder(t, w, `{"exchange":"binance","side":"buy","base":"SOL","quote":"USDT","amount":"1","callback_url":"`+callbackServer.URL+`"}`)
+	if o.OrderID != "buy-1" {
+		t.Fatalf("got order id %s", o.OrderID)
+	}
+
+	w.tracker.Poll()
+	select {
+	case <-received:
+		t.Fatal("callback sent for non-terminal order")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	client.setStatus("FILLED")
+	w.tracker.Poll()
+
+	var r *http.Request
+	select {
+	case r = <-received:
+	case <-time.After(time.Second):
+		t.Fatal("callback not sent")
+	}
+	body := <-receivedBody
+
+	if r.Header.Get(OrderIDHeader) != o.ID {
+		t.Fatalf("got order id header %s", r.Header.Get(OrderIDHeader))
+	}
+	if Sign("secret", r.Header.Get(TimestampHeader), body) != r.Header.Get(SignatureHeader) {
+		t.Fatal("invalid signature")
+	}
+
+	var detail trading.GetOrderDetailResponse
+	err := json.Unmarshal(body, &detail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detail.Status != "FILLED" || !detail.ExecutedQuote.Equal(decimal.NewFromInt(150)) {
+		t.Fatalf("got detail %+v", detail)
+	}
+
+	w.tracker.Poll()
+	select {
+	case <-received:
+		t.Fatal("callback sent twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWebhook_CallbackDeadLetter(t *testing.T) {
+	var attempts int
+	var mu sync.Mutex
+	callbackServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		mu.Unlock()
+		rw.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer callbackServer.Close()
+
+	var deadLetter bytes.Buffer
+	w := newWebhook(t, Config{Callback: CallbackConfig{
+		MaxRetries: 2,
+		Backoff:    time.Millisecond,
+		DeadLetter: &deadLetter,
+	}})
+	w.registry.Set("binance", &fakeClient{status: "FILLED"})
+
+	o := placeOrder(t, w, `{"exchange":"binance","side":"sell","base":"SOL","quote":"USDT","amount":"1","callback_url":"`+callbackServer.URL+`"}`)
+	w.tracker.Poll()
+	w.notifier.Wait()
+
+	if attempts != 3 {
+		t.Fatalf("got %d attempts", attempts)
+	}
+	if !strings.Contains(deadLetter.String(), o.ID) {
+		t.Fatalf("dead letter log does not contain order: %s", deadLetter.String())
+	}
+}
+
+func TestWebhook_InvalidCallbackURL(t *testing.T) {
+	w := newWebhook(t, Config{})
+	w.registry.Set("binance", &fakeClient{})
+
+	rec := httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodPost, "/orders", `{"exchange":"binance","side":"buy","callback_url":"ftp://example.com"}`))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d", rec.Code)
+	}
+}
+
+func TestWebhook_TradingView(t *testing.T) {
+	w := newWebhook(t, Config{TradingView: TradingViewConfig{
+		Passphrase:      "secret",
+		DefaultExchange: "bybit",
+	}})
+	w.registry.Set("binance", &fakeClient{})
+	w.registry.Set("bybit", &fakeClient{})
+
+	tests := []struct {
+		name     string
+		body     string
+		status   int
+		exchange string
+	}{
+		{
+			name:     "json with exchange prefix",
+			body:     `{"passphrase":"secret","action":"buy","ticker":"BINANCE:SOLUSDT","amount":"1"}`,
+			status:   http.StatusCreated,
+			exchange: "binance",
+		},
+		{
+			name:   "duplicate",
+			body:   `{"passphrase":"secret","action":"buy","ticker":"BINANCE:SOLUSDT","amount":"1"}`,
+			status: http.StatusConflict,
+		},
+		{
+			name:     "text with default exchange",
+			body:     "action=sell ticker=ETHUSDC amount=0.5 passphrase=secret",
+			status:   http.StatusCreated,
+			exchange: "bybit",
+		},
+		{
+			name:   "wrong passphrase",
+			body:   `{"passphrase":"wrong","action":"buy","ticker":"SOLUSDT","amount":"1"}`,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "unknown quote",
+			body:   `{"passphrase":"secret","action":"buy","ticker":"SOLXYZ","amount":"1"}`,
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			w.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/tradingview", strings.NewReader(tt.body)))
+			if rec.Code != tt.status {
+				t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+			}
+			if tt.status != http.StatusCreated {
+				return
+			}
+
+			var o order.Order
+			err := json.Unmarshal(rec.Body.Bytes(), &o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if o.Exchange != trading.AccountName(tt.exchange) {
+				t.Fatalf("got exchange %s", o.Exchange)
+			}
+		})
+	}
+}
+
+func TestSplitTicker(t *testing.T) {
+	tests := []struct {
+		ticker string
+		base   string
+		quote  string
+	}{
+		{"SOLUSDT", "SOL", "USDT"},
+		{"btcfdusd", "BTC", "FDUSD"},
+		{"ETH/BTC", "ETH", "BTC"},
+		{"SOL-USD", "SOL", "USD"},
+	}
+
+	for _, tt := range tests {
+		base, quote, err := splitTicker(tt.ticker)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if base != tt.base || quote != tt.quote {
+			t.Fatalf("got %s/%s for %s", base, quote, tt.ticker)
+		}
+	}
+}
+
+func TestWebhook_Authorization(t *testing.T) {
+	readOnly := auth.Key{
+		ID:          "read-only",
+		Secret:      "read-only-secret",
+		Exchanges:   []string{"binance"},
+		Symbols:     []string{auth.Wildcard},
+		Permissions: []string{auth.PermissionRead},
+	}
+	limited := auth.Key{
+		ID:          "limited",
+		Secret:      "limited-secret",
+		Exchanges:   []string{"binance"},
+		Symbols:     []string{"SOL/USDT"},
+		Permissions: []string{auth.PermissionBuy},
+		MaxNotional: "1000",
+	}
+
+	w := newWebhook(t, Config{Auth: auth.Config{Keys: []auth.Key{testKey, readOnly, limited}}})
+	w.registry.Set("binance", &fakeClient{})
+	w.registry.Set("bybit", &fakeClient{})
+
+	tests := []struct {
+		name   string
+		key    auth.Key
+		body   string
+		status int
+	}{
+		{
+			name:   "read only key cannot trade",
+			key:    readOnly,
+			body:   `{"exchange":"binance","side":"buy","base":"SOL","quote":"USDT","amount":"1"}`,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "exchange not allowed",
+			key:    limited,
+			body:   `{"exchange":"bybit","side":"buy","base":"SOL","quote":"USDT","amount":"1"}`,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "symbol not allowed",
+			key:    limited,
+			body:   `{"exchange":"binance","side":"buy","base":"ETH","quote":"USDT","amount":"1"}`,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "side not allowed",
+			key:    limited,
+			body:   `{"exchange":"binance","side":"sell","base":"SOL","quote":"USDT","amount":"1"}`,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "notional exceeded",
+			key:    limited,
+			body:   `{"exchange":"binance","side":"buy","base":"SOL","quote":"USDT","amount":"7"}`,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "within scope",
+			key:    limited,
+			body:   `{"exchange":"binance","side":"buy","base":"SOL","quote":"USDT","amount":"6"}`,
+			status: http.StatusCreated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			w.Handler().ServeHTTP(rec, signedRequest(tt.key, http.MethodPost, "/orders", tt.body))
+			if rec.Code != tt.status {
+				t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+			}
+		})
+	}
+
+	o := placeOrder(t, w, `{"exchange":"bybit","side":"buy","base":"SOL","quote":"USDT","amount":"1"}`)
+
+	rec := httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(readOnly, http.MethodGet, "/orders/"+o.ID, ""))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("read only key could read order on other exchange: %d", rec.Code)
+	}
+}
+
+func TestWebhook_Unauthenticated(t *testing.T) {
+	w := newWebhook(t, Config{})
+	w.registry.Set("binance", &fakeClient{})
+
+	body := `{"exchange":"binance","side":"buy","base":"SOL","quote":"USDT","amount":"1"}`
+
+	rec := httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body)))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("got status %d for unsigned request", rec.Code)
+	}
+
+	r := signedRequest(testKey, http.MethodPost, "/orders", body)
+	replay := r.Clone(r.Context())
+	replay.Body = io.NopCloser(strings.NewReader(body))
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, r)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, replay)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("got status %d for replayed request", rec.Code)
+	}
+}
+
+type listingClient struct {
+	fakeClient
+}
+
+func (c *listingClient) ListInstruments() ([]trading.Listing, error) {
+	return []trading.Listing{
+		{Instrument: trading.NewInstrument("BTC", "USD"), Symbol: "BTC-USD", Tradable: true},
+		{Instrument: trading.NewInstrument("BTC", "USDC"), Symbol: "BTC-USDC", Tradable: true},
+	}, nil
+}
+
+func TestWebhook_Instruments(t *testing.T) {
+	w := newWebhook(t, Config{TradingView: TradingViewConfig{Passphrase: "secret"}})
+	w.registry.Set("binance", &fakeClient{})
+	w.registry.Set("coinbase", &listingClient{})
+	w.registry.Set("coinbase:other", &listingClient{})
+
+	rec := httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodGet, "/instruments/xbt-usdc", ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	var res instrumentResponse
+	err := json.Unmarshal(rec.Body.Bytes(), &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Instrument.String() != "BTC/USDC" || len(res.Listings) != 2 || res.Listings[0].Symbol != "BTC-USDC" {
+		t.Fatalf("got %+v", res)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/tradingview", strings.NewReader(
+		`{"passphrase":"secret","action":"buy","ticker":"COINBASE:BTCUSDC","amount":"1"}`)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	var o order.Order
+	err = json.Unmarshal(rec.Body.Bytes(), &o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Base != "BTC" || o.Quote != "USDC" {
+		t.Fatalf("got order %+v", o)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/tradingview", strings.NewReader(
+		`{"passphrase":"secret","action":"buy","ticker":"COINBASE:ETHUSD","amount":"1"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d for unlisted ticker", rec.Code)
+	}
+}
+
+type bookClient struct {
+	listingClient
+	book *trading.OrderBook
+}
+
+func (c *bookClient) SubscribeOrderBook(ctx context.Context, instrument trading.Instrument) (*trading.OrderBook, error) {
+	return c.book, nil
+}
+
+func TestWebhook_Books(t *testing.T) {
+	synced := trading.NewOrderBook(trading.NewInstrument("BTC", "USD"))
+	synced.Snapshot(
+		[]trading.Level{{Price: decimal.NewFromInt(99), Size: decimal.NewFromInt(1)}},
+		[]trading.Level{{Price: decimal.NewFromInt(101), Size: decimal.NewFromInt(1)}, {Price: decimal.NewFromInt(102), Size: decimal.NewFromInt(1)}},
+		time.Now(),
+	)
+
+	w := newWebhook(t, Config{Books: book.Config{
+		TakerFees: map[string]decimal.Decimal{"coinbase": decimal.RequireFromString("0.01")},
+	}})
+	w.registry.Set("coinbase", &bookClient{book: synced})
+
+	rec := httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodGet, "/books/BTC-USD?depth=1", ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	var res book.Book
+	err := json.Unmarshal(rec.Body.Bytes(), &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Asks) != 1 || res.Asks[0].Venue != "coinbase" || res.Asks[0].EffectivePrice.String() != "102.01" {
+		t.Fatalf("got %+v", res)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodGet, "/books/ETH-USD", ""))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("got status %d for unlisted pair", rec.Code)
+	}
+
+	w = newWebhook(t, Config{})
+	w.registry.Set("coinbase", &bookClient{book: trading.NewOrderBook(trading.NewInstrument("BTC", "USD"))})
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodGet, "/books/BTC-USD", ""))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got status %d before the book is synced", rec.Code)
+	}
+}
+
+func TestWebhook_Quotes(t *testing.T) {
+	synced := trading.NewOrderBook(trading.NewInstrument("BTC", "USD"))
+	synced.Snapshot(
+		[]trading.Level{{Price: decimal.NewFromInt(99), Size: decimal.NewFromInt(1)}},
+		[]trading.Level{{Price: decimal.NewFromInt(101), Size: decimal.NewFromInt(1)}, {Price: decimal.NewFromInt(103), Size: decimal.NewFromInt(1)}},
+		time.Now(),
+	)
+
+	w := newWebhook(t, Config{})
+	w.registry.Set("coinbase", &bookClient{book: synced})
+
+	rec := httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodPost, "/quotes", `{"side":"buy","base":"BTC","quote":"USD","amount":"2"}`))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	var q router.Quote
+	err := json.Unmarshal(rec.Body.Bytes(), &q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.AveragePrice.String() != "102" || q.MidPrice.String() != "100" || len(q.Split) != 1 || q.Split[0].Venue != "coinbase" {
+		t.Fatalf("got %+v", q)
+	}
+
+	for body, want := range map[string]int{
+		`{"side":"buy","base":"BTC","quote":"USD","amount":"3"}`:  http.StatusUnprocessableEntity,
+		`{"side":"buy","base":"ETH","quote":"USD","amount":"1"}`:  http.StatusBadRequest,
+		`{"side":"hold","base":"BTC","quote":"USD","amount":"1"}`: http.StatusBadRequest,
+	} {
+		rec = httptest.NewRecorder()
+		w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodPost, "/quotes", body))
+		if rec.Code != want {
+			t.Fatalf("got status %d for %s", rec.Code, body)
+		}
+	}
+}
+
+func TestWebhook_Algo(t *testing.T) {
+	sim := simulator.New()
+	sim.SetPrice("BTC", "USDT", decimal.NewFromInt(100))
+
+	w := newWebhook(t, Config{})
+	w.registry.Set("binance", sim)
+	defer w.algos.Close()
+
+	rec := httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodPost, "/orders", `{"exchange":"binance","side":"buy","base":"BTC","quote":"USDT","amount":"1","type":"limit","price":"100"}`))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("limit order without capability: got status %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodPost, "/orders", `{"exchange":"binance","side":"buy","base":"BTC","quote":"USDT","amount":"1","algo":{"type":"pov","rate":"1.5"}}`))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("pov above 100%%: got status %d", rec.Code)
+	}
+
+	for body, want := range map[string]string{
+		`{"exchange":"binance","side":"sell","base":"BTC","quote":"USDT","amount":"1","algo":{"type":"iceberg","display":"0.1"}}`:                              "iceberg without a limit",
+		`{"exchange":"binance","side":"sell","base":"BTC","quote":"USDT","amount":"1","type":"limit","price":"110","algo":{"type":"iceberg","display":"0.1"}}`: "limit order without capability",
+	} {
+		rec = httptest.NewRecorder()
+		w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodPost, "/orders", body))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: got status %d", want, rec.Code)
+		}
+	}
+
+	pov := placeOrder(t, w, `{"exchange":"binance","side":"sell","base":"BTC","quote":"USDT","amount":"1","algo":{"type":"pov","rate":"0.1","interval":"1s"}}`)
+	if pov.Algo == nil || pov.Algo.Name != "pov" {
+		t.Fatalf("got parent %+v", pov)
+	}
+
+	parent := placeOrder(t, w, `{"exchange":"binance","side":"buy","base":"BTC","quote":"USDT","amount":"2","algo":{"type":"twap","duration":"1h","slices":2}}`)
+	if parent.Algo == nil || parent.Algo.Name != "twap" || parent.Detail.Status != order.StatusRunning {
+		t.Fatalf("got parent %+v", parent)
+	}
+
+	var children []order.Order
+	deadline := time.Now().Add(5 * time.Second)
+	for len(children) == 0 && time.Now().Before(deadline) {
+		rec = httptest.NewRecorder()
+		w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodGet, "/orders/"+parent.ID+"/children", ""))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+		}
+		_ = json.Unmarshal(rec.Body.Bytes(), &children)
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(children) != 1 || children[0].ParentID != parent.ID || children[0].Amount.String() != "1" {
+		t.Fatalf("got children %+v", children)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodPost, "/orders/"+parent.ID+"/cancel", ""))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	deadline = time.Now().Add(5 * time.Second)
+	for parent.Detail.Status != order.StatusCanceled && time.Now().Before(deadline) {
+		w.tracker.Poll()
+		parent, _ = w.tracker.Store().Get(parent.ID)
+		time.Sleep(5 * time.Millisecond)
+	}
+	if parent.Detail.Status != order.StatusCanceled || parent.Detail.ExecutedBase.String() != "1" {
+		t.Fatalf("got parent %+v", parent)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodPost, "/orders/"+parent.ID+"/pause", ""))
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("paused an ended parent: got status %d", rec.Code)
+	}
+}
+
+func TestWebhook_Risk(t *testing.T) {
+	w := newWebhook(t, Config{Risk: risk.Config{
+		Keys: map[string]risk.Limits{"test": {MaxNotional: decimal.NewFromInt(200)}},
+	}})
+	w.registry.Set("binance", &fakeClient{})
+
+	placeOrder(t, w, `{"exchange":"binance","side":"buy","base":"SOL","quote":"USDT","amount":"1"}`)
+
+	rec := httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodPost, "/orders", `{"exchange":"binance","side":"buy","base":"SOL","quote":"USDT","amount":"2"}`))
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "max order notional") {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	err := w.Reload(Config{
+		Auth: auth.Config{Keys: []auth.Key{testKey}},
+		Risk: risk.Config{Exchanges: map[string]risk.Limits{"binance": {Deny: []string{"SOL/USDT"}}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodPost, "/orders", `{"exchange":"binance","side":"buy","base":"SOL","quote":"USDT","amount":"2"}`))
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "symbol not allowed") {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestWebhook_KillSwitch(t *testing.T) {
+	admin := auth.Key{
+		ID:          "admin",
+		Secret:      "admin-secret",
+		Exchanges:   []string{auth.Wildcard},
+		Symbols:     []string{auth.Wildcard},
+		Permissions: []string{auth.PermissionRead, auth.PermissionAdmin},
+	}
+
+	sim := simulator.New()
+	sim.SetPrice("BTC", "USDT", decimal.NewFromInt(100))
+
+	w := newWebhook(t, Config{
+		Auth:       auth.Config{Keys: []auth.Key{testKey, admin}},
+		Risk:       risk.Config{Keys: map[string]risk.Limits{"test": {MaxNotional: decimal.NewFromInt(1000)}}},
+		KillSwitch: KillSwitchConfig{OnBreach: []string{"max_notional"}},
+	})
+	w.registry.Set("binance", sim)
+	defer w.algos.Close()
+
+	parent := placeOrder(t, w, `{"exchange":"binance","side":"buy","base":"BTC","quote":"USDT","amount":"2","algo":{"type":"twap","duration":"1h","slices":2}}`)
+
+	rec := httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodPost, "/kill-switch", ""))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("engaged without the admin permission: got status %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(admin, http.MethodPost, "/kill-switch", `{"reason":"drill"}`))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"canceled":[{"account":"binance:default"}]`) {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodPost, "/orders", `{"exchange":"binance","side":"buy","base":"BTC","quote":"USDT","amount":"1"}`))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "drill") {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for parent.Detail.Status != order.StatusCanceled && time.Now().Before(deadline) {
+		w.tracker.Poll()
+		parent, _ = w.tracker.Store().Get(parent.ID)
+		time.Sleep(5 * time.Millisecond)
+	}
+	if parent.Detail.Status != order.StatusCanceled {
+		t.Fatalf("got parent %+v", parent)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(admin, http.MethodDelete, "/kill-switch", ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+	placeOrder(t, w, `{"exchange":"binance","side":"buy","base":"BTC","quote":"USDT","amount":"1"}`)
+
+	// A breach of the notional limit engages the switch on its own.
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodPost, "/orders", `{"exchange":"binance","side":"buy","base":"BTC","quote":"USDT","amount":"20"}`))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodGet, "/kill-switch", ""))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "risk breach") {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestWebhook_Positions(t *testing.T) {
+	other := auth.Key{
+		ID:          "other",
+		Secret:      "other-secret",
+		Exchanges:   []string{"bybit"},
+		Symbols:     []string{auth.Wildcard},
+		Permissions: []string{auth.PermissionRead},
+	}
+
+	w := newWebhook(t, Config{Auth: auth.Config{Keys: []auth.Key{testKey, other}}})
+	client := &fakeClient{}
+	w.registry.Set("binance", client)
+
+	placeOrder(t, w, `{"exchange":"binance","side":"buy","base":"SOL","quote":"USDT","amount":"1"}`)
+	client.setStatus("FILLED")
+	w.tracker.Poll()
+
+	rec := httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodGet, "/positions?method=lifo", ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	var res positionsResponse
+	err := json.Unmarshal(rec.Body.Bytes(), &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Positions) != 1 || res.Positions[0].Account != "binance:default" || res.Positions[0].Asset != "SOL" ||
+		res.Positions[0].Cost.String() != "150" || !res.Positions[0].Unrealized.IsZero() || len(res.Totals) != 1 {
+		t.Fatalf("got %+v", res)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(other, http.MethodGet, "/positions", ""))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"positions":[]`) {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodGet, "/positions?method=hifo", ""))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodPost, "/reconciliation", ""))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"drifts":[]`) {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodPost, "/reconciliation?rebase=true", ""))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("rebased without the admin permission: got status %d", rec.Code)
+	}
+}
+
+func TestWebhook_Export(t *testing.T) {
+	w := newWebhook(t, Config{})
+	client := &fakeClient{}
+	w.registry.Set("binance", client)
+
+	placeOrder(t, w, `{"exchange":"binance","side":"buy","base":"SOL","quote":"USDT","amount":"1"}`)
+	client.setStatus("FILLED")
+	w.tracker.Poll()
+
+	rec := httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodGet, "/exports/koinly?fiat=USDT&from=2020-01-01", ""))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/csv" ||
+		!strings.Contains(rec.Body.String(), ",150,USDT,1,SOL,,,150.00,USDT,,binance:default,") {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodGet, "/exports/koinly?fiat=USDT&to=2020-01-01", ""))
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "SOL") {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	// Nothing serves USDT/USD klines to value the trade with.
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodGet, "/exports/csv", ""))
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	for _, target := range []string{"/exports/xlsx", "/exports/csv?method=average", "/exports/csv?from=yesterday"} {
+		rec = httptest.NewRecorder()
+		w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodGet, target, ""))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: got status %d and body %s", target, rec.Code, rec.Body)
+		}
+	}
+}
+
+type balanceClient struct {
+	bookClient
+}
+
+func (c *balanceClient) GetBalances() ([]trading.Balance, error) {
+	return []trading.Balance{{Asset: "BTC", Free: decimal.NewFromInt(2)}}, nil
+}
+
+func TestWebhook_Rebalance(t *testing.T) {
+	admin := auth.Key{
+		ID:          "admin",
+		Secret:      "admin-secret",
+		Exchanges:   []string{auth.Wildcard},
+		Symbols:     []string{auth.Wildcard},
+		Permissions: []string{auth.PermissionRead, auth.PermissionAdmin},
+	}
+
+	synced := trading.NewOrderBook(trading.NewInstrument("BTC", "USD"))
+	synced.Snapshot(
+		[]trading.Level{{Price: decimal.NewFromInt(149), Size: decimal.NewFromInt(5)}},
+		[]trading.Level{{Price: decimal.NewFromInt(151), Size: decimal.NewFromInt(5)}},
+		time.Now(),
+	)
+
+	w := newWebhook(t, Config{
+		Auth: auth.Config{Keys: []auth.Key{testKey, admin}},
+		Rebalance: rebalance.Config{
+			Targets: map[string]decimal.Decimal{"BTC": decimal.RequireFromString("0.5"), "USD": decimal.RequireFromString("0.5")},
+			Quote:   "USD",
+		},
+	})
+	w.registry.Set("coinbase", &balanceClient{bookClient: bookClient{book: synced}})
+	defer w.books.Close()
+
+	rec := httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodPost, "/rebalances", ""))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("rebalanced without the admin permission: got status %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodPost, "/rebalances?dry_run=true", ""))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"trades":[{"side":"sell","asset":"BTC","amount":"1","value":"150"}]`) {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(admin, http.MethodPost, "/rebalances", ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	var report rebalance.Report
+	err := json.Unmarshal(rec.Body.Bytes(), &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Trades) != 1 || len(report.Trades[0].Children) != 1 || report.Trades[0].Error != "" {
+		t.Fatalf("got report %+v", report)
+	}
+
+	o, err := w.tracker.Store().Get(report.Trades[0].Children[0].OrderID)
+	if err != nil || o.Exchange != "coinbase:default" || o.Side != "sell" || o.Amount.String() != "1" {
+		t.Fatalf("got order %+v, %v", o, err)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodGet, "/rebalances", ""))
+	if rec.Code != http.StatusOK || strings.Count(rec.Body.String(), `"id"`) != 2 {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+}
+
+type quoteSizedClient struct {
+	fakeClient
+	last trading.TradeRequest
+}
+
+func (c *quoteSizedClient) Buy(req trading.BuyRequest) (trading.BuyResponse, error) {
+	c.last = req.TradeRequest
+	return c.fakeClient.Buy(req)
+}
+
+func TestWebhook_DCA(t *testing.T) {
+	other := auth.Key{
+		ID:          "other",
+		Secret:      "other-secret",
+		Exchanges:   []string{auth.Wildcard},
+		Symbols:     []string{auth.Wildcard},
+		Permissions: []string{auth.PermissionRead},
+	}
+
+	w := newWebhook(t, Config{Auth: auth.Config{Keys: []auth.Key{testKey, other}}})
+	w.registry.Set("binance", &fakeClient{})
+
+	body := `{"exchange":"binance","base":"btc","quote":"usd","quote_amount":"300","schedule":"@daily"}`
+	rec := httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(other, http.MethodPost, "/dca-plans", body))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("created a plan without the buy permission: got status %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodPost, "/dca-plans", body))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	var plan dca.Plan
+	err := json.Unmarshal(rec.Body.Bytes(), &plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Exchange != "binance:default" || plan.Base != "BTC" || plan.CatchUp != dca.CatchUpOnce || plan.KeyID != "test" || plan.NextRun.IsZero() {
+		t.Fatalf("got plan %+v", plan)
+	}
+
+	orderID, amount, err := w.executePlan(plan)
+	if err != nil || amount.String() != "2" {
+		t.Fatalf("got amount %s, %v", amount, err)
+	}
+	o, err := w.tracker.Store().Get(orderID)
+	if err != nil || o.Side != "buy" || o.Amount.String() != "2" || o.Exchange != "binance:default" {
+		t.Fatalf("got order %+v, %v", o, err)
+	}
+
+	// Venues with quote sized orders spend exactly the quote amount.
+	native := &quoteSizedClient{}
+	w.registry.Set("native", native)
+	quotePlan := plan
+	quotePlan.Exchange = "native:default"
+	orderID, amount, err = w.executePlan(quotePlan)
+	if err != nil || amount.String() != "2" || native.last.QuoteAmount.String() != "300" || !native.last.Amount.IsZero() {
+		t.Fatalf("got amount %s, request %+v, %v", amount, native.last, err)
+	}
+	o, _ = w.tracker.Store().Get(orderID)
+	if o.QuoteAmount.String() != "300" || !o.Amount.IsZero() {
+		t.Fatalf("got order %+v", o)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodPost, "/orders", `{"exchange":"binance","side":"buy","base":"BTC","quote":"USD","quote_amount":"300"}`))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "quote sized") {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(other, http.MethodPost, "/dca-plans/"+plan.ID+"/pause", ""))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("paused the plan of another key: got status %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodPost, "/dca-plans/"+plan.ID+"/pause", ""))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"paused":true`) {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(other, http.MethodGet, "/dca-plans", ""))
+	if rec.Code != http.StatusOK || strings.Count(rec.Body.String(), `"id"`) != 1 {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodDelete, "/dca-plans/"+plan.ID, ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodGet, "/dca-plans/"+plan.ID, ""))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("got status %d for a deleted plan", rec.Code)
+	}
+}
+
+func TestWebhook_Triggers(t *testing.T) {
+	reader := auth.Key{
+		ID:          "reader",
+		Secret:      "reader-secret",
+		Exchanges:   []string{auth.Wildcard},
+		Symbols:     []string{auth.Wildcard},
+		Permissions: []string{auth.PermissionRead},
+	}
+
+	w := newWebhook(t, Config{Auth: auth.Config{Keys: []auth.Key{testKey, reader}}, Conditional: conditional.Config{PollInterval: 10 * time.Millisecond}})
+	defer w.triggers.Close()
+	sim := simulator.New()
+	sim.SetPrice("BTC", "USDT", decimal.NewFromInt(100))
+	w.registry.Set("binance", sim)
+
+	stop := `{"exchange":"binance","side":"sell","base":"BTC","quote":"USDT","amount":"1","kind":"stop","trigger_price":"90"}`
+	rec := httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(reader, http.MethodPost, "/triggers", stop))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("created a trigger without the sell permission: got status %d", rec.Code)
+	}
+
+	oco := `{"legs":[` + stop + `,{"exchange":"binance","side":"sell","base":"BTC","quote":"USDT","amount":"1","kind":"take_profit","trigger_price":"120"}]}`
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodPost, "/triggers/oco", oco))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	var legs []conditional.Trigger
+	err := json.Unmarshal(rec.Body.Bytes(), &legs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	tp, _ := w.triggers.Get(legs[1].ID)
+	for tp.Status == conditional.StatusPending && time.Now().Before(deadline) {
+		sim.Trade("BTC", "USDT", decimal.NewFromInt(125), decimal.NewFromInt(1))
+		time.Sleep(10 * time.Millisecond)
+		tp, _ = w.triggers.Get(legs[1].ID)
+	}
+	o, err := w.tracker.Store().Get(tp.OrderID)
+	if tp.Status != conditional.StatusTriggered || err != nil || o.Side != "sell" || o.Amount.String() != "1" {
+		t.Fatalf("got trigger %+v and order %+v, %v", tp, o, err)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodDelete, "/triggers/"+legs[0].ID, ""))
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "not pending") {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodPost, "/triggers", stop))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	_, err = w.Kill("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(reader, http.MethodGet, "/triggers", ""))
+	if rec.Code != http.StatusOK || strings.Count(rec.Body.String(), `"status":"CANCELED"`) != 2 {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+}
+
+// ocoClient is a venue with native stop and OCO orders, registered as the
+// "native" adapter below.
+type ocoClient struct {
+	fakeClient
+	placed []trading.OCORequest
+}
+
+func (c *ocoClient) PlaceOCO(req trading.OCORequest) (trading.OCOResponse, error) {
+	c.placed = append(c.placed, req)
+	return trading.OCOResponse{
+		ListID: "list-1",
+		Above:  trading.TradeResponse{OrderID: "above-1"},
+		Below:  trading.TradeResponse{OrderID: "below-1"},
+	}, nil
+}
+
+func init() {
+	trading.RegisterAdapter(trading.Adapter{
+		Name:         "native",
+		Capabilities: trading.Capabilities{Spot: true, LimitOrders: true, QuoteSizeOrders: true, StopOrders: true, OCOOrders: true},
+	})
+}
+
+func TestWebhook_NativeStopOrders(t *testing.T) {
+	w := newWebhook(t, Config{})
+	client := &ocoClient{}
+	w.registry.Set("native", client)
+	w.registry.Set("binance", &fakeClient{})
+
+	stopLimit := `{"side":"sell","base":"BTC","quote":"USDT","amount":"1","type":"limit","price":"89","stop_price":"90","stop_direction":"falling"}`
+	o := placeOrder(t, w, `{"exchange":"native",`+stopLimit[1:])
+	if !o.StopPrice.Equal(decimal.NewFromInt(90)) || o.StopDirection != trading.StopFalling {
+		t.Fatalf("got order %+v", o)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"no stop orders", `{"exchange":"binance",` + stopLimit[1:], "/triggers"},
+		{"no stop-market orders", `{"exchange":"native","side":"sell","base":"BTC","quote":"USDT","amount":"1","stop_price":"90","stop_direction":"falling"}`, "/triggers"},
+		{"no direction", `{"exchange":"native","side":"sell","base":"BTC","quote":"USDT","amount":"1","type":"limit","price":"89","stop_price":"90"}`, "stop direction"},
+		{"no native oco", `{"exchange":"binance","side":"sell","base":"BTC","quote":"USDT","amount":"1","above":{"price":"120"},"below":{"stop_price":"90"}}`, "/triggers/oco"},
+		{"oco without stop", `{"exchange":"native","side":"sell","base":"BTC","quote":"USDT","amount":"1","above":{"price":"120"},"below":{"price":"90"}}`, "stop price"},
+	}
+	for _, tt := range tests {
+		path := "/orders"
+		if strings.Contains(tt.body, "above") {
+			path = "/orders/oco"
+		}
+		rec := httptest.NewRecorder()
+		w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodPost, path, tt.body))
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), tt.want) {
+			t.Errorf("%s: got status %d and body %s", tt.name, rec.Code, rec.Body)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, signedRequest(testKey, http.MethodPost, "/orders/oco", `{"exchange":"native","side":"sell","base":"BTC","quote":"USDT","amount":"1","above":{"price":"120"},"below":{"price":"89","stop_price":"90"}}`))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("got status %d and body %s", rec.Code, rec.Body)
+	}
+
+	var legs []order.Order
+	err := json.Unmarshal(rec.Body.Bytes(), &legs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(legs) != 2 || legs[0].OrderID != "above-1" || legs[1].OrderID != "below-1" || legs[1].ListID != "list-1" ||
+		legs[0].StopDirection != "" || legs[1].StopDirection != trading.StopFalling {
+		t.Fatalf("got legs %+v", legs)
+	}
+	if len(client.placed) != 1 || client.placed[0].Below.ClientOrderID != legs[1].ClientOrderID {
+		t.Fatalf("placed %+v", client.placed)
+	}
+}
+
+type perpetualClient struct {
+	fakeClient
+	leverage decimal.Decimal
+}
+
+func (c *perpetualClient) SetLeverage(req trading.SetLeverageRequest) error {
+	c.leverage = req.Leverage
+	return nil
+}
+
+func (c *perpetualClient) GetPositions(req trading.GetPositionsRequest) ([]trading.Position, error) {
+	return []trading.Position{{Symbol: "BTCUSDT", Instrument: trading.NewInstrument("BTC", "USDT"), Size: decimal.NewFromInt(-2), Leverage: c.leverage}}, nil
+}
+
+func (c *perpetualClient) GetFundingHistory(req trading.GetFundingHistoryRequest) ([]trading.FundingPayment, error) {
+	if req.Start.IsZero() {
+		return nil, nil
+	}
+	return []trading.FundingPayment{{Symbol: "BTCUSDT", Asset: "USDT", Amount: decimal.NewFromInt(3), Time: req.Start}}, nil
+}
+
+type inverseClient struct {
+	perpetualClient
+}
+
+func (c *inverseClient) QuoteSized() bool { return true }
+
+type marginClient struct {
+	perpetualClient
+	marginType trading.MarginType
+}
+
+func (c *marginClient) SetMarginType(req trading.SetMarginTypeRequest) error {
+	c.marginType = req.MarginType
+	return nil
+}
+
+func TestWebhook_Derivatives(t *testing.T) {
+	reader := auth.Key{
+		ID:          "reader",
+		Secret:      "reader-secret",
+		Exchanges:   []string{auth.Wildcard},
+		Symbols:     []string{auth.Wildcard},
+		Permissions: []string{auth.PermissionRead},
+	}
+	spotOnly := auth.Key{
+		ID:          "spot",
+		Secret:      "spot-secret",
+		Exchanges:   []string{"binance"},
+		Symbols:     []string{auth.Wildcard},
+		Permissions: []string{auth.PermissionRead},
+	}
+
+	inverse := auth.Key{
+		ID:          "inverse",
+		Secret:      "inverse-secret",
+		Exchanges:   []string{"bybit:inverse"},
+		Symbols:     []string{auth.Wildcard},
+		Permissions: []string{auth.PermissionBuy},
+		MaxNotional: "1000",
+	}
+
+	w := newWebhook(t, Config{Auth: auth.Config{Keys: []auth.Key{testKey, reader, spotOnly, inverse}}})
+	w.registry.Set("bybit:inverse", &inverseClient{})
+	client := &perpetualClient{}
+	w.registry.Set("bybit:perp", client)
+	w.registry.Set("binance", &fakeClient{})
+	margin := &marginClient{}
+	w.registry.Set("binance_futures", margin)
+
+	o := placeOrder(t, w, `{"exchange":"bybit:perp","side":"buy","base":"BTC","quote":"USDT","amount":"2","reduce_only":true,"position_idx":2}`)
+	if !o.ReduceOnly || o.PositionIdx != trading.ShortPosition {
+		t.Fatalf("got order %+v", o)
+	}
+
+	tests := []struct {
+		name   string
+		key    auth.Key
+		method string
+		path   string
+		body   string
+		status int
+		want   string
+	}{
+		{"leverage without trading", reader, http.MethodPost, "/accounts/bybit:perp/leverage", `{"base":"BTC","quote":"USDT","leverage":"5"}`, http.StatusForbidden, "forbidden"},
+		{"leverage", testKey, http.MethodPost, "/accounts/bybit:perp/leverage", `{"base":"BTC","quote":"USDT","leverage":"5"}`, http.StatusOK, `"leverage":"5"`},
+		{"positions", reader, http.MethodGet, "/accounts/bybit:perp/positions", "", http.StatusOK, `"size":"-2","entry_price":"0","mark_price":"0","liquidation_price":"0","leverage":"5"`},
+		{"other account", spotOnly, http.MethodGet, "/accounts/bybit:perp/positions", "", http.StatusNotFound, "unknown account"},
+		{"spot account", reader, http.MethodGet, "/accounts/binance/positions", "", http.StatusBadRequest, "not a derivatives account"},
+		{"funding", reader, http.MethodGet, "/accounts/bybit:perp/funding?start=2024-01-01T00:00:00Z", "", http.StatusOK, `"amount":"3","rate":"0","time":"2024-01-01T00:00:00Z"`},
+		{"no funding", reader, http.MethodGet, "/accounts/bybit:perp/funding", "", http.StatusOK, "[]"},
+		{"bad time", reader, http.MethodGet, "/accounts/bybit:perp/funding?end=yesterday", "", http.StatusBadRequest, "invalid end"},
+		{"inverse contracts", inverse, http.MethodPost, "/orders", `{"exchange":"bybit:inverse","side":"buy","base":"BTC","quote":"USD","amount":"900"}`, http.StatusCreated, `"amount":"900"`},
+		{"inverse notional", inverse, http.MethodPost, "/orders", `{"exchange":"bybit:inverse","side":"buy","base":"BTC","quote":"USD","amount":"1100"}`, http.StatusForbidden, "notional"},
+		{"margin type", testKey, http.MethodPost, "/accounts/binance_futures/margin-type", `{"base":"BTC","quote":"USDT","margin_type":"isolated"}`, http.StatusOK, `"margin_type":"isolated"`},
+		{"bad margin type", testKey, http.MethodPost, "/accounts/binance_futures/margin-type", `{"base":"BTC","quote":"USDT","margin_type":"portfolio"}`, http.StatusBadRequest, "invalid margin_type"},
+		{"margin type without trading", reader, http.MethodPost, "/accounts/binance_futures/margin-type", `{"base":"BTC","quote":"USDT","margin_type":"cross"}`, http.StatusForbidden, "forbidden"},
+		{"no margin type", testKey, http.MethodPost, "/accounts/bybit:perp/margin-type", `{"base":"BTC","quote":"USDT","margin_type":"cross"}`, http.StatusBadRequest, "does not support changing the margin type"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		w.Handler().ServeHTTP(rec, signedRequest(tt.key, tt.method, tt.path, tt.body))
+		if rec.Code != tt.status || !strings.Contains(rec.Body.String(), tt.want) {
+			t.Errorf("%s: got status %d and body %s", tt.name, rec.Code, rec.Body)
+		}
+	}
+	if margin.marginType != trading.IsolatedMargin {
+		t.Fatalf("got margin type %q", margin.marginType)
+	}
+}
+
+type streamingClient struct {
+	fakeClient
+	key     string
+	started chan string
+	stopped chan string
+}
+
+func (c *streamingClient) StreamOrderUpdates(ctx context.Context) (<-chan trading.OrderUpdate, error) {
+	updates := make(chan trading.OrderUpdate)
+	c.started <- c.key
+	go func() {
+		<-ctx.Done()
+		c.stopped <- c.key
+		close(updates)
+	}()
+
+	return updates, nil
+}
+
+func TestWebhook_FollowOrderStreams(t *testing.T) {
+	w := newWebhook(t, Config{})
+	started, stopped := make(chan string, 4), make(chan string, 4)
+	w.registry.Set("binance", &streamingClient{key: "old", started: started, stopped: stopped})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w.followOrderStreams(ctx)
+
+	receive := func(ch chan string, want string) {
+		t.Helper()
+		select {
+		case got := <-ch:
+			if got != want {
+				t.Fatalf("got stream %s, want %s", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("stream %s did not change", want)
+		}
+	}
+	receive(started, "old")
+
+	// Rotated credentials replace the client and its stream.
+	w.registry.Set("binance", &streamingClient{key: "new", started: started, stopped: stopped})
+	receive(stopped, "old")
+	receive(started, "new")
+
+	cancel()
+	receive(stopped, "new")
+}